@@ -8,11 +8,14 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"slices"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
 
 	"github.com/orgoj/weblogproxy/internal/config"
+	"github.com/orgoj/weblogproxy/internal/geoip"
 	"github.com/orgoj/weblogproxy/internal/logger"
 	"github.com/orgoj/weblogproxy/internal/rules"
 	"github.com/orgoj/weblogproxy/internal/server"
@@ -21,10 +24,9 @@ import (
 
 var (
 	// Mutex protection for config reload to prevent race conditions
-	configMu         sync.RWMutex
-	currentCfg       *config.Config
-	currentRuleProc  *rules.RuleProcessor
-	currentLoggerMgr *logger.Manager
+	configMu        sync.RWMutex
+	currentCfg      *config.Config
+	currentRuleProc *rules.RuleProcessor
 )
 
 func main() {
@@ -52,9 +54,33 @@ func main() {
 		fmt.Printf("[CRITICAL] Configuration validation failed for '%s':\n%v\n", *configPath, err)
 		os.Exit(1)
 	}
+	printConfigWarnings(cfg)
+
+	// Load GeoIP databases used by the geoip add_log_data source and country/asn conditions
+	if len(cfg.GeoIP.Databases) > 0 {
+		db, err := geoip.OpenDB(cfg.GeoIP.Databases)
+		if err != nil {
+			fmt.Printf("[CRITICAL] Failed to load GeoIP databases: %v\n", err)
+			os.Exit(1)
+		}
+		geoip.SetDefault(db)
+	}
+
+	// Subcommands (e.g. "rules explain") run against the loaded configuration and exit
+	if args := flag.Args(); len(args) > 0 {
+		os.Exit(runCommand(cfg, args))
+	}
 
 	if *testConfigShort || *testConfigLong {
-		// Validation was already done above
+		// Validation was already done above, lint warnings do not make the configuration invalid
+		warnings, err := rules.Lint(cfg)
+		if err != nil {
+			fmt.Printf("[CRITICAL] Configuration validation failed for '%s':\n%v\n", *configPath, err)
+			os.Exit(1)
+		}
+		for _, w := range warnings {
+			fmt.Printf("[WARNING] %s\n", w)
+		}
 		fmt.Printf("Configuration '%s' is valid.\n", *configPath)
 		os.Exit(0)
 	}
@@ -88,7 +114,6 @@ func main() {
 	configMu.Lock()
 	currentCfg = cfg
 	currentRuleProc = ruleProcessor
-	currentLoggerMgr = loggerManager
 	configMu.Unlock()
 
 	// Prepare server dependencies
@@ -104,27 +129,42 @@ func main() {
 	// Create Server instance
 	srv := server.NewServer(serverDeps)
 
+	// --- GeoIP Reload Goroutine --- //
+	// Runs even without databases, they may be added by a config reload
+	geoipInterval := time.Duration(cfg.GeoIP.ReloadInterval) * time.Second
+	if geoipInterval == 0 {
+		geoipInterval = 300 * time.Second
+	}
+	go func() {
+		for {
+			time.Sleep(geoipInterval)
+			reloaded, err := geoip.Default().ReloadIfChanged()
+			for _, path := range reloaded {
+				appLogger.Info("GeoIP database '%s' reloaded", path)
+			}
+			if err != nil {
+				appLogger.Error("GeoIP reload failed, keeping the loaded databases: %v", err)
+			}
+		}
+	}()
+
 	// --- Config Reload Goroutine --- //
 	if cfg.ConfigReload.Enabled && cfg.ConfigReload.Interval > 0 {
 		configPathCopy := *configPath
 		interval := time.Duration(cfg.ConfigReload.Interval) * time.Second
-		lastModTime := func() time.Time {
-			info, err := os.Stat(configPathCopy)
-			if err != nil {
-				return time.Time{}
-			}
-			return info.ModTime()
-		}()
+		lastModTime := config.SourceModTime(cfg, configPathCopy)
 
 		go func() {
 			for {
 				time.Sleep(interval)
-				info, err := os.Stat(configPathCopy)
-				if err != nil {
-					fmt.Fprintf(os.Stdout, "[ERROR] Config reload: cannot stat config file: %v\n", err)
+				configMu.RLock()
+				modTime := config.SourceModTime(currentCfg, configPathCopy)
+				configMu.RUnlock()
+				if modTime.IsZero() {
+					fmt.Fprintf(os.Stdout, "[ERROR] Config reload: cannot stat config file '%s'\n", configPathCopy)
 					continue
 				}
-				if info.ModTime().After(lastModTime) {
+				if modTime.After(lastModTime) {
 					fmt.Fprintf(os.Stdout, "[INFO] Config reload: detected change, reloading...\n")
 					newCfg, err := config.LoadConfig(configPathCopy)
 					if err != nil {
@@ -135,34 +175,54 @@ func main() {
 						fmt.Fprintf(os.Stdout, "[ERROR] Config reload: validation failed: %v\n", err)
 						continue
 					}
+					printConfigWarnings(newCfg)
 
-					// Re-init loggerManager
+					// Handlers and log destinations keep the configuration they were created
+					// with, so only reloads limited to the rules and GeoIP databases are applied
 					configMu.RLock()
-					mgr := currentLoggerMgr
+					changed, err := config.RestartRequired(currentCfg, newCfg)
 					configMu.RUnlock()
-
-					if err := mgr.InitLoggers(newCfg.LogDestinations); err != nil {
-						fmt.Fprintf(os.Stdout, "[ERROR] Config reload: failed to re-init loggers: %v\n", err)
+					if err != nil {
+						fmt.Fprintf(os.Stdout, "[ERROR] Config reload: %v\n", err)
+						continue
+					}
+					if len(changed) > 0 {
+						fmt.Fprintf(os.Stdout, "[ERROR] Config reload: changes of %s require a restart, configuration not reloaded\n", strings.Join(changed, ", "))
+						lastModTime = modTime
 						continue
 					}
 
-					newRuleProcessor, err := rules.NewRuleProcessor(newCfg)
-					if err != nil {
-						fmt.Fprintf(os.Stdout, "[ERROR] Config reload: failed to re-init rule processor: %v\n", err)
+					// Open the GeoIP databases again only when the list of files changed
+					if !slices.Equal(geoip.Default().Paths(), newCfg.GeoIP.Databases) {
+						var db *geoip.DB
+						if len(newCfg.GeoIP.Databases) > 0 {
+							if db, err = geoip.OpenDB(newCfg.GeoIP.Databases); err != nil {
+								fmt.Fprintf(os.Stdout, "[ERROR] Config reload: failed to load GeoIP databases: %v\n", err)
+								continue
+							}
+						}
+						geoip.SetDefault(db)
+					}
+
+					// Reload rules in place, the server keeps using the same processor and
+					// hit counters of unchanged rules are preserved
+					configMu.RLock()
+					proc := currentRuleProc
+					configMu.RUnlock()
+
+					if err := proc.Reload(newCfg); err != nil {
+						fmt.Fprintf(os.Stdout, "[ERROR] Config reload: failed to reload rules: %v\n", err)
 						continue
 					}
 
 					// Thread-safe update of runtime config
 					configMu.Lock()
 					currentCfg = newCfg
-					currentRuleProc = newRuleProcessor
 					cfg = newCfg
-					ruleProcessor = newRuleProcessor
 					configMu.Unlock()
 
 					fmt.Fprintf(os.Stdout, "[INFO] Config reload: applied new configuration.\n")
-					fmt.Fprintf(os.Stdout, "[WARN] Config reload: Note that server instances retain original config. Restart required for full effect.\n")
-					lastModTime = info.ModTime()
+					lastModTime = modTime
 				}
 			}
 		}()
@@ -194,3 +254,10 @@ func main() {
 	appLogger.Info("WebLogProxy shut down gracefully.")
 	os.Exit(0)
 }
+
+// printConfigWarnings prints the non-fatal problems found by the configuration validation.
+func printConfigWarnings(cfg *config.Config) {
+	for _, w := range cfg.Warnings {
+		fmt.Fprintf(os.Stderr, "[WARNING] %s\n", w)
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/orgoj/weblogproxy/internal/config"
+	"github.com/orgoj/weblogproxy/internal/rules"
+)
+
+// headerFlags collects repeated -header "Name: value" flags.
+type headerFlags map[string]string
+
+func (h headerFlags) String() string {
+	parts := make([]string, 0, len(h))
+	for name, value := range h {
+		parts = append(parts, name+": "+value)
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (h headerFlags) Set(s string) error {
+	name, value, ok := strings.Cut(s, ":")
+	if !ok || strings.TrimSpace(name) == "" {
+		return fmt.Errorf("header must be in 'Name: value' format, got '%s'", s)
+	}
+	h[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	return nil
+}
+
+// runCommand dispatches a subcommand given after the global flags and returns the exit code.
+func runCommand(cfg *config.Config, args []string) int {
+	switch args[0] {
+	case "rules":
+		return runRulesCommand(cfg, args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command '%s'. Available commands: rules\n", args[0])
+		return 2
+	}
+}
+
+// runRulesCommand handles the "rules" subcommands.
+func runRulesCommand(cfg *config.Config, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: weblogproxy [-config path] rules explain [options]")
+		fmt.Fprintln(os.Stderr, "       weblogproxy [-config path] rules test [-v] <cases.yaml>")
+		return 2
+	}
+
+	switch args[0] {
+	case "explain":
+		return runRulesExplain(cfg, args[1:])
+	case "test":
+		return runRulesTest(cfg, args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown rules command '%s'. Available commands: explain, test\n", args[0])
+		return 2
+	}
+}
+
+// runRulesExplain evaluates the rules for a synthetic request and prints the trace.
+func runRulesExplain(cfg *config.Config, args []string) int {
+	fs := flag.NewFlagSet("rules explain", flag.ContinueOnError)
+	var synthetic rules.SyntheticRequest
+	headers := headerFlags{}
+	fs.StringVar(&synthetic.SiteID, "site-id", "", "Site ID of the synthetic request (required)")
+	fs.StringVar(&synthetic.GtmID, "gtm-id", "", "GTM ID of the synthetic request")
+	fs.StringVar(&synthetic.IP, "ip", "", "Client IP of the synthetic request")
+	fs.StringVar(&synthetic.UserAgent, "ua", "", "User-Agent of the synthetic request")
+	fs.Var(headers, "header", "Request header in 'Name: value' format (repeatable)")
+	asJSON := fs.Bool("json", false, "Print the trace as JSON")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	synthetic.Headers = headers
+
+	req, err := synthetic.HTTPRequest()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid synthetic request: %v\n", err)
+		return 2
+	}
+
+	processor, err := rules.NewRuleProcessor(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to initialize rule processor: %v\n", err)
+		return 1
+	}
+
+	trace := processor.Explain(synthetic.SiteID, synthetic.GtmID, req)
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(trace); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to encode trace: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	printTrace(os.Stdout, trace)
+	return 0
+}
+
+// runRulesTest runs the rule test cases from a YAML file and returns 1 if any case fails.
+func runRulesTest(cfg *config.Config, args []string) int {
+	fs := flag.NewFlagSet("rules test", flag.ContinueOnError)
+	verbose := fs.Bool("v", false, "Print the rule trace for failed cases")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: weblogproxy [-config path] rules test [-v] <cases.yaml>")
+		return 2
+	}
+
+	suite, err := rules.LoadTestSuite(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 2
+	}
+
+	processor, err := rules.NewRuleProcessor(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to initialize rule processor: %v\n", err)
+		return 1
+	}
+
+	failed := 0
+	for _, result := range suite.Run(processor) {
+		if result.Passed() {
+			fmt.Printf("PASS  %s\n", result.Name)
+			continue
+		}
+		failed++
+		fmt.Printf("FAIL  %s\n", result.Name)
+		for _, failure := range result.Failures {
+			fmt.Printf("      %s\n", failure)
+		}
+		if *verbose && result.Trace != nil {
+			var b strings.Builder
+			printTrace(&b, result.Trace)
+			for _, line := range strings.Split(strings.TrimRight(b.String(), "\n"), "\n") {
+				fmt.Printf("      | %s\n", line)
+			}
+		}
+	}
+
+	fmt.Printf("\n%d passed, %d failed, %d total\n", len(suite.Cases)-failed, failed, len(suite.Cases))
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// printTrace writes a human-readable rule trace.
+func printTrace(w io.Writer, trace *rules.Trace) {
+	fmt.Fprintf(w, "Request: site_id=%q gtm_id=%q client_ip=%q user_agent=%q\n", trace.SiteID, trace.GtmID, trace.ClientIP, trace.UserAgent)
+	fmt.Fprintf(w, "Time:    %s\n\n", trace.Time.Format("2006-01-02T15:04:05Z07:00"))
+
+	for _, rt := range trace.Rules {
+		flags := ""
+		if rt.Continue {
+			flags = " [continue]"
+		}
+		status := "NO MATCH"
+		switch {
+		case !rt.Evaluated:
+			status = "SKIPPED"
+		case rt.Final:
+			status = "MATCH (final)"
+		case rt.Matched:
+			status = "MATCH"
+		}
+		fmt.Fprintf(w, "Rule %s%s: %s\n", rt.Path, flags, status)
+		if rt.Description != "" {
+			fmt.Fprintf(w, "    # %s\n", rt.Description)
+		}
+		if rt.Note != "" {
+			fmt.Fprintf(w, "    %s\n", rt.Note)
+		}
+		for _, check := range rt.Checks {
+			mark := "FAIL"
+			if check.Matched {
+				mark = "ok  "
+			}
+			fmt.Fprintf(w, "    %s %s: %s\n", mark, check.Field, check.Detail)
+		}
+		if len(rt.AddLogData) > 0 {
+			fmt.Fprintf(w, "    + add_log_data: %s\n", strings.Join(rt.AddLogData, ", "))
+		}
+		if len(rt.Scripts) > 0 {
+			fmt.Fprintf(w, "    + scripts: %s\n", strings.Join(rt.Scripts, ", "))
+		}
+		if len(rt.JavaScriptOptions) > 0 {
+			fmt.Fprintf(w, "    + javascript_options: %s\n", strings.Join(rt.JavaScriptOptions, ", "))
+		}
+	}
+
+	out := trace.Outcome
+	destinations := "all enabled"
+	if len(out.Destinations) > 0 {
+		destinations = strings.Join(out.Destinations, ", ")
+	}
+	fmt.Fprintf(w, "\nOutcome:\n")
+	fmt.Fprintf(w, "    log enabled:          %t\n", out.LogEnabled)
+	if out.LogEnabled {
+		fmt.Fprintf(w, "    destinations:         %s\n", destinations)
+	}
+	fmt.Fprintf(w, "    log script downloads: %t\n", out.LogScriptDownloads)
+	fmt.Fprintf(w, "    scripts:              %s\n", strings.Join(out.Scripts, ", "))
+	fmt.Fprintf(w, "    add_log_data:         %s\n", strings.Join(out.AddLogData, ", "))
+	fmt.Fprintf(w, "    track_url:            %t\n", out.TrackURL)
+	fmt.Fprintf(w, "    track_traceback:      %t\n", out.TrackTraceback)
+}
@@ -1,25 +1,363 @@
 package config
 
 import (
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"math/big"
+	"net"
+	"net/http"
 	"os"
+	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/go-playground/validator/v10"
+	"github.com/orgoj/weblogproxy/internal/consent"
+	"github.com/orgoj/weblogproxy/internal/geoip"
+	"github.com/orgoj/weblogproxy/internal/ipanon"
+	"github.com/orgoj/weblogproxy/internal/iputil"
+	"github.com/orgoj/weblogproxy/internal/jsonschema"
+	"github.com/orgoj/weblogproxy/internal/logtemplate"
+	"github.com/orgoj/weblogproxy/internal/redact"
+	"github.com/orgoj/weblogproxy/internal/schedule"
+	"github.com/orgoj/weblogproxy/internal/schema"
+	"github.com/orgoj/weblogproxy/internal/security"
+	"github.com/orgoj/weblogproxy/internal/tlsutil"
+	"github.com/orgoj/weblogproxy/internal/transform"
+	"github.com/orgoj/weblogproxy/internal/useragent"
+	"github.com/orgoj/weblogproxy/internal/validation"
 	"gopkg.in/yaml.v3"
 )
 
+// TokenConfig configures the signing and lifetime of logger.js tokens.
+type TokenConfig struct {
+	Secret             string        `yaml:"secret"`
+	Expiration         string        `yaml:"expiration"`                     // Changed to string, e.g. "10m", "1h"
+	Keys               []TokenKey    `yaml:"keys,omitempty"`                 // Signing keys with IDs for key rotation
+	ActiveKey          string        `yaml:"active_key,omitempty"`           // ID of the key new tokens are signed with (default: first key)
+	AcceptLegacyTokens *bool         `yaml:"accept_legacy_tokens,omitempty"` // Accept tokens without key ID (default: true)
+	Binding            *TokenBinding `yaml:"binding,omitempty"`              // Bind tokens to the client of logger.js
+
+	Keyring *security.Keyring `yaml:"-"` // Built from secret and keys during validation
+}
+
+// TokenBinding selects the claims of the logger.js request a token is bound to. A /log request
+// whose claims differ from those of the logger.js request is rejected.
+type TokenBinding struct {
+	Origin    bool `yaml:"origin"`     // Host of the Origin header (logger.js: the Referer header)
+	IP        bool `yaml:"ip"`         // Client IP network, /24 for IPv4 and /64 for IPv6
+	UserAgent bool `yaml:"user_agent"` // User-Agent header
+}
+
+// binding converts the token binding to the security package type, nil stays nil.
+func (b *TokenBinding) binding() *security.Binding {
+	if b == nil {
+		return nil
+	}
+	return &security.Binding{Origin: b.Origin, IP: b.IP, UserAgent: b.UserAgent}
+}
+
+// SiteTokenPolicy overrides the token settings for one site_id. Without secret and keys the
+// site uses the keys of security.token, without expiration its expiration.
+type SiteTokenPolicy struct {
+	TokenConfig   `yaml:",inline"`
+	AllowedGtmIDs []string `yaml:"allowed_gtm_ids,omitempty"` // Accepted gtm_id values, requests without gtm_id are rejected too
+}
+
+// TokenKey is a token signing secret with an ID. Tokens signed with a retired key are rejected.
+type TokenKey struct {
+	ID      string `yaml:"id"`
+	Secret  string `yaml:"secret"`
+	Retired bool   `yaml:"retired,omitempty"`
+}
+
+// TokenKeyring returns the keyring built during validation. Configs that were not validated
+// get a keyring with the single security.token.secret.
+func (c *Config) TokenKeyring() *security.Keyring {
+	if c.Security.Token.Keyring != nil {
+		return c.Security.Token.Keyring
+	}
+	keyring, err := security.NewKeyring([]security.Key{{ID: security.DefaultKeyID, Secret: c.Security.Token.Secret}}, security.DefaultKeyID, true)
+	if err != nil {
+		return nil
+	}
+	return keyring
+}
+
+// TokenPolicies returns the per-site token policies built during validation. Configs that were
+// not validated get policies with the keyring of TokenKeyring for all sites.
+func (c *Config) TokenPolicies() *security.Policies {
+	if c.Security.Policies != nil {
+		return c.Security.Policies
+	}
+	return security.NewPolicies(security.Policy{Keyring: c.TokenKeyring()}, nil)
+}
+
+// tokenSecrets returns all configured token secrets, for redaction from error messages.
+func (c *Config) tokenSecrets() []string {
+	configs := []TokenConfig{c.Security.Token}
+	for _, site := range c.Security.Sites {
+		if site != nil {
+			configs = append(configs, site.TokenConfig)
+		}
+	}
+	var secrets []string
+	for _, token := range configs {
+		secrets = append(secrets, token.Secret)
+		for _, key := range token.Keys {
+			secrets = append(secrets, key.Secret)
+		}
+	}
+	return secrets
+}
+
 // AddLogDataSpec defines how to add or modify a field in the log record.
 type AddLogDataSpec struct {
+	Name     string                `yaml:"name"`
+	Source   string                `yaml:"source"` // static, header, query, post, cookie, client_ip, request, env, server, geoip, user_agent, template
+	Value    string                `yaml:"value"`  // Static value, key/name for header/query/post/cookie/env, field for request/server/geoip/user_agent or template expression
+	EnvValue string                `yaml:"-"`      // Value of the environment variable for source 'env', read at load time
+	Template *logtemplate.Template `yaml:"-"`      // Compiled expression for source 'template', set by validation
+}
+
+// RequestFields lists the fields supported by the request add_log_data source.
+var RequestFields = []string{"method", "path", "host", "protocol"}
+
+// ServerFields lists the fields supported by the server add_log_data source.
+var ServerFields = []string{"hostname", "version"}
+
+// Redaction configures masking of personal data (PII) in the client data of log records.
+// It can be set globally, per log destination and per rule; all applicable redactions are applied.
+type Redaction struct {
+	Detectors []string           `yaml:"detectors,omitempty"` // Built-in detectors: email, jwt, credit_card, iban, ipv6, ipv4, phone
+	Action    string             `yaml:"action,omitempty"`    // Default action for detectors and patterns: mask, hash, drop (default: mask)
+	HashSalt  string             `yaml:"hash_salt,omitempty"` // Salt for the hash action (min 16 characters)
+	Patterns  []RedactionPattern `yaml:"patterns,omitempty"`  // Custom regular expressions
+	Fields    []RedactionField   `yaml:"fields,omitempty"`    // Actions for whole fields of the client data
+
+	Redactor *redact.Redactor `yaml:"-"` // Compiled by validation
+}
+
+// RedactionPattern is a custom regular expression redacted in string values.
+type RedactionPattern struct {
 	Name   string `yaml:"name"`
-	Source string `yaml:"source"` // static, header, query, post
-	Value  string `yaml:"value"`  // Static value or key/name for header/query/post
+	Regex  string `yaml:"regex"`
+	Action string `yaml:"action,omitempty"` // Optional, default: redaction action
+}
+
+// RedactionField is an action applied to a field of the client data, e.g. path "user.email".
+type RedactionField struct {
+	Path   string `yaml:"path"`
+	Action string `yaml:"action"` // mask, hash or drop
+}
+
+// Apply returns a redacted copy of the client data. A nil or not validated Redaction returns data unchanged.
+func (r *Redaction) Apply(data map[string]interface{}) map[string]interface{} {
+	if r == nil {
+		return data
+	}
+	return r.Redactor.Apply(data)
+}
+
+// IPAnonymization configures anonymization of IP addresses in log records. It applies to client_ip,
+// add_log_data fields with source client_ip or a header carrying client IPs (X-Forwarded-For,
+// X-Real-IP, Forwarded, ...), template fields reading them and the listed fields. Rules and rate
+// limiting use the real address.
+type IPAnonymization struct {
+	Mode         string   `yaml:"mode"`                    // truncate (IPv4 /24, IPv6 /48), hash or drop
+	HashKey      string   `yaml:"hash_key,omitempty"`      // Key for mode hash (min 16 characters)
+	SaltRotation string   `yaml:"salt_rotation,omitempty"` // How often the hash salt changes, e.g. 24h or 7d (default: 24h)
+	Fields       []string `yaml:"fields,omitempty"`        // Additional record fields containing IP addresses
+
+	Anonymizer *ipanon.Anonymizer `yaml:"-"` // Compiled by validation
+}
+
+// ipHeaders are request headers carrying client IP addresses, in canonical form.
+var ipHeaders = []string{"X-Forwarded-For", "X-Real-Ip", "Forwarded", "Cf-Connecting-Ip", "True-Client-Ip", "X-Client-Ip"}
+
+// Apply anonymizes the IP fields of the record in place. specs are the add_log_data specs used for
+// the record and clientIPHeader is server.client_ip_header. A nil IPAnonymization does nothing.
+func (a *IPAnonymization) Apply(record map[string]interface{}, specs []AddLogDataSpec, clientIPHeader string) {
+	if a == nil {
+		return
+	}
+	a.Anonymizer.Apply(record, ipFields(a.Fields, specs, clientIPHeader))
+}
+
+// ipFields returns the record fields containing IP addresses.
+func ipFields(extra []string, specs []AddLogDataSpec, clientIPHeader string) []string {
+	isIPHeader := func(header string) bool {
+		header = http.CanonicalHeaderKey(header)
+		return containsString(ipHeaders, header) || clientIPHeader != "" && header == http.CanonicalHeaderKey(clientIPHeader)
+	}
+	fields := append([]string{"client_ip"}, extra...)
+	for _, spec := range specs {
+		switch spec.Source {
+		case "client_ip":
+			fields = append(fields, spec.Name)
+		case "header":
+			if isIPHeader(spec.Value) {
+				fields = append(fields, spec.Name)
+			}
+		case "template":
+			// Templates reading .ClientIP or IP headers may render the address
+			if spec.Template != nil && spec.Template.UsesClientIP(isIPHeader) {
+				fields = append(fields, spec.Name)
+			}
+		}
+	}
+	return fields
+}
+
+// TransformOp is a record transformation applied after add_log_data and before truncation.
+type TransformOp struct {
+	Op        string   `yaml:"op"`                  // rename, drop, move, cast, flatten, keep_only
+	From      string   `yaml:"from,omitempty"`      // Source path for rename and move
+	To        string   `yaml:"to,omitempty"`        // New field name for rename, target path for move
+	Path      string   `yaml:"path,omitempty"`      // Path for cast, object path for flatten (empty = whole record)
+	Paths     []string `yaml:"paths,omitempty"`     // Glob paths for drop and keep_only ('*' within a segment, '**' across)
+	Type      string   `yaml:"type,omitempty"`      // Cast type: string, int, float, bool, timestamp
+	Separator string   `yaml:"separator,omitempty"` // Key separator for flatten (default: ".")
+
+	Compiled *transform.Op `yaml:"-"` // Compiled by validation
+}
+
+// ApplyTransforms returns a transformed copy of the record, the record itself is not modified.
+func ApplyTransforms(record map[string]interface{}, ops []TransformOp) map[string]interface{} {
+	if len(ops) == 0 {
+		return record
+	}
+	compiled := make([]*transform.Op, 0, len(ops))
+	for _, op := range ops {
+		if op.Compiled != nil {
+			compiled = append(compiled, op.Compiled)
+		}
+	}
+	return transform.Apply(record, compiled)
 }
 
+// Payload schema actions, from the weakest to the strongest.
+const (
+	PayloadSchemaAnnotate   = "annotate"   // Log the record with the errors in _schema_errors
+	PayloadSchemaQuarantine = "quarantine" // Log the record with _schema_errors to the quarantine destination only
+	PayloadSchemaDrop       = "drop"       // Do not log the record
+)
+
+// PayloadSchemaActions lists the supported on_error actions, from the weakest to the strongest.
+var PayloadSchemaActions = []string{PayloadSchemaAnnotate, PayloadSchemaQuarantine, PayloadSchemaDrop}
+
+// PayloadSchema validates the client data sent to /log against a JSON Schema (draft 2020-12 subset).
+type PayloadSchema struct {
+	File                  string                 `yaml:"file,omitempty"`                   // JSON Schema file, relative to the config file
+	Schema                map[string]interface{} `yaml:"schema,omitempty"`                 // Inline schema, alternative to file
+	OnError               string                 `yaml:"on_error,omitempty"`               // annotate, quarantine or drop (default: annotate)
+	QuarantineDestination string                 `yaml:"quarantine_destination,omitempty"` // Destination for on_error quarantine
+
+	Compiled *jsonschema.Schema `yaml:"-"` // Compiled by validation
+}
+
+// Validate returns the validation errors of the client data, nil if it is valid.
+// A nil PayloadSchema accepts everything.
+func (p *PayloadSchema) Validate(data map[string]interface{}) []string {
+	if p == nil || p.Compiled == nil {
+		return nil
+	}
+	return p.Compiled.Validate(data)
+}
+
+// Schema selects the field layout of records written to a destination.
+type Schema struct {
+	Format    string `yaml:"format"`              // bunyan (default), ecs or otel
+	Namespace string `yaml:"namespace,omitempty"` // Key for fields without a standard mapping (default: weblogproxy)
+}
+
+// Map returns the record in the configured layout. A nil Schema returns the record unchanged.
+func (s *Schema) Map(record map[string]interface{}) map[string]interface{} {
+	if s == nil {
+		return record
+	}
+	return schema.Map(record, s.Format, s.Namespace)
+}
+
+// Consent is the global consent policy. When a request carries a denying signal, the action
+// is applied to its records; rules can request stronger actions with consent_action.
+type Consent struct {
+	HonorGPC        bool     `yaml:"honor_gpc"`                  // Sec-GPC: 1 denies consent
+	HonorDNT        bool     `yaml:"honor_dnt"`                  // DNT: 1 denies consent
+	Cookie          string   `yaml:"cookie,omitempty"`           // Cookie with consent categories, e.g. "analytics=false,marketing=true"
+	Header          string   `yaml:"header,omitempty"`           // Header with consent categories, takes precedence over the cookie
+	Categories      []string `yaml:"categories,omitempty"`       // Categories required for logging, e.g. ["analytics"]
+	RequireExplicit bool     `yaml:"require_explicit,omitempty"` // Missing categories deny consent (default: only explicit denial)
+	Action          string   `yaml:"action,omitempty"`           // drop, strip or anonymize (default: drop)
+	StripFields     []string `yaml:"strip_fields,omitempty"`     // Additional record fields removed by the strip action
+}
+
+// Signals reads the privacy signals of the request using the configured cookie and header.
+// A nil Consent reads only Sec-GPC and DNT.
+func (c *Consent) Signals(r *http.Request) consent.Signals {
+	if c == nil {
+		return consent.Read(r, "", "")
+	}
+	return consent.Read(r, c.Cookie, c.Header)
+}
+
+// Denied reports whether the signals deny consent under the policy.
+func (c *Consent) Denied(s consent.Signals) bool {
+	if c == nil {
+		return false
+	}
+	if c.HonorGPC && s.GPC || c.HonorDNT && s.DNT {
+		return true
+	}
+	for _, category := range c.Categories {
+		granted, ok := s.Granted(category)
+		if ok && !granted || !ok && c.RequireExplicit {
+			return true
+		}
+	}
+	return false
+}
+
+// identifyingSources are add_log_data sources removed by the strip consent action.
+var identifyingSources = []string{"client_ip", "cookie", "user_agent", "geoip"}
+
+// ApplyAction applies a consent action (strip or anonymize) to the record in place. specs are
+// the add_log_data specs used for the record and clientIPHeader is server.client_ip_header.
+// Strip removes IP fields, fields from the client_ip, cookie, user_agent and geoip sources, the
+// User-Agent header and strip_fields; anonymize truncates IP addresses and removes cookie values.
+func (c *Consent) ApplyAction(action string, record map[string]interface{}, specs []AddLogDataSpec, clientIPHeader string) {
+	switch action {
+	case consent.ActionStrip:
+		for _, field := range ipFields(nil, specs, clientIPHeader) {
+			delete(record, field)
+		}
+		for _, spec := range specs {
+			if containsString(identifyingSources, spec.Source) ||
+				spec.Source == "header" && http.CanonicalHeaderKey(spec.Value) == "User-Agent" {
+				delete(record, spec.Name)
+			}
+		}
+		if c != nil {
+			for _, field := range c.StripFields {
+				delete(record, field)
+			}
+		}
+	case consent.ActionAnonymize:
+		truncateAnonymizer.Apply(record, ipFields(nil, specs, clientIPHeader))
+		for _, spec := range specs {
+			if spec.Source == "cookie" {
+				delete(record, spec.Name)
+			}
+		}
+	}
+}
+
+// truncateAnonymizer truncates IP addresses for the anonymize consent action.
+var truncateAnonymizer, _ = ipanon.New(ipanon.ModeTruncate, "", 0)
+
 // ScriptInjectionSpec defines a script to be injected.
 type ScriptInjectionSpec struct {
 	URL   string `yaml:"url"`
@@ -74,18 +412,74 @@ type Config struct {
 			CacheControl string `yaml:"cache_control"`
 		} `yaml:"unknown_route"`
 		ClientIPHeader string `yaml:"client_ip_header"` // Header to use for real client IP (e.g. CF-Connecting-IP, X-Real-IP)
+		Admin          struct {
+			Enabled    bool     `yaml:"enabled"`     // Enable admin endpoints (rule explain, ...)
+			AllowedIPs []string `yaml:"allowed_ips"` // IPs/CIDRs allowed to access admin endpoints (default: loopback only)
+		} `yaml:"admin"`
+		TLS struct {
+			Enabled        bool     `yaml:"enabled"`         // Serve HTTPS instead of HTTP
+			CertFile       string   `yaml:"cert_file"`       // PEM certificate (chain), relative to the config file
+			KeyFile        string   `yaml:"key_file"`        // PEM private key, relative to the config file
+			MinVersion     string   `yaml:"min_version"`     // 1.2 or 1.3 (default: 1.2)
+			CipherSuites   []string `yaml:"cipher_suites"`   // TLS 1.2 cipher suites (default: Go defaults)
+			ClientCAFile   string   `yaml:"client_ca_file"`  // PEM CAs of client certificates required on admin and health endpoints
+			ReloadInterval string   `yaml:"reload_interval"` // How often the files are checked for changes (default: 1m, 0s = never)
+		} `yaml:"tls"`
+		Listeners     []ListenerConfig `yaml:"listeners"`      // Addresses served by the same router, replace host and port when set
+		ProxyProtocol bool             `yaml:"proxy_protocol"` // Read PROXY protocol v1/v2 headers sent by trusted_proxies on host:port
 	} `yaml:"server"`
 
 	Security struct {
-		Token struct {
-			Secret     string `yaml:"secret"`
-			Expiration string `yaml:"expiration"` // Changed to string, e.g. "10m", "1h"
-		} `yaml:"token"`
+		Token TokenConfig                 `yaml:"token"`
+		Sites map[string]*SiteTokenPolicy `yaml:"sites,omitempty"` // Per-site_id token overrides
+
+		// Blocking of clients sending invalid tokens to /log, keyed by client IP and by client IP and site_id
+		TokenRateLimit struct {
+			MaxAttempts      int    `yaml:"max_attempts"`       // Failed validations within 10 minutes before blocking (0 = disabled)
+			BlockDuration    string `yaml:"block_duration"`     // Duration of the first block
+			MaxBlockDuration string `yaml:"max_block_duration"` // Cap of the block duration, doubled for every further block
+		} `yaml:"token_rate_limit"`
+
+		// Token refresh endpoint (/token) used by logger.js to renew tokens before they expire
+		TokenRefresh struct {
+			Enabled     bool   `yaml:"enabled"`
+			GracePeriod string `yaml:"grace_period"` // How long after expiration tokens can still be refreshed (default: 1h, 0s = only unexpired tokens)
+		} `yaml:"token_refresh"`
+
+		// Rejection of events sent to /log more than once with the same token and event_id. The
+		// event_id is chosen by the client, so only unchanged copies of an event are rejected.
+		ReplayProtection struct {
+			Enabled        bool   `yaml:"enabled"`
+			Window         string `yaml:"window"`           // How long events are remembered (default: the longest token expiration)
+			MaxEntries     int    `yaml:"max_entries"`      // Maximum number of remembered events, the oldest are forgotten first
+			RequireEventID bool   `yaml:"require_event_id"` // Reject events without event_id (sent by logger.js since this version)
+		} `yaml:"replay_protection"`
+
+		Policies *security.Policies `yaml:"-"` // Built from token and sites during validation
 		// RequestLimits moved to Server section
 	} `yaml:"security"`
 
+	Redaction *Redaction `yaml:"redaction,omitempty"` // Redaction of client data applied to all log records
+	Consent   *Consent   `yaml:"consent,omitempty"`   // Consent policy honouring GPC, DNT and a consent cookie/header
+
+	PayloadSchemas map[string]*PayloadSchema `yaml:"payload_schemas,omitempty"` // JSON Schemas of the client data by site_id
+
+	GeoIP struct {
+		Databases      []string `yaml:"databases"`       // MaxMind DB (.mmdb) files, e.g. City/Country and ASN databases
+		ReloadInterval int      `yaml:"reload_interval"` // seconds between checks for changed database files (0 = default 300)
+	} `yaml:"geoip"`
+
 	LogDestinations []LogDestination `yaml:"log_destinations"`
 	LogConfig       []LogRule        `yaml:"log_config"`
+
+	IncludeDir string `yaml:"include_dir"` // Directory with additional rule files (*.yaml), relative to the config file
+
+	Warnings []string `yaml:"-"` // Non-fatal problems found by the last validation, printed once by the caller
+}
+
+// warnf records a non-fatal configuration problem in Warnings.
+func (cfg *Config) warnf(format string, args ...interface{}) {
+	cfg.Warnings = append(cfg.Warnings, fmt.Sprintf(format, args...))
 }
 
 // LogDestination represents a logging destination configuration
@@ -108,6 +502,11 @@ type LogDestination struct {
 	CompressionType string `yaml:"compression_type,omitempty"` // Optional for type: gelf (gzip, zlib, none, default none)
 
 	AddLogData []AddLogDataSpec `yaml:"add_log_data,omitempty"`
+	Redaction  *Redaction       `yaml:"redaction,omitempty"` // Redaction of client data written to this destination
+
+	IPAnonymization *IPAnonymization `yaml:"ip_anonymization,omitempty"` // Anonymization of IP addresses written to this destination
+	Transform       []TransformOp    `yaml:"transform,omitempty"`        // Record transformations for this destination, after rule transformations
+	Schema          *Schema          `yaml:"schema,omitempty"`           // Output field layout (ECS, OTel), only for type file with format json
 }
 
 // LogRuleCondition specifies criteria for matching requests.
@@ -117,21 +516,86 @@ type LogRuleCondition struct {
 	UserAgents []string               `yaml:"user_agents,omitempty"`
 	IPs        []string               `yaml:"ips,omitempty"`
 	Headers    map[string]interface{} `yaml:"headers,omitempty"` // Header name and value (string or false for removal)
+
+	ActiveFrom  string   `yaml:"active_from,omitempty"`  // RFC 3339 timestamp, rule matches only from this moment on
+	ActiveUntil string   `yaml:"active_until,omitempty"` // RFC 3339 timestamp, rule stops matching at this moment
+	Schedules   []string `yaml:"schedules,omitempty"`    // Cron-like expressions (minute hour day-of-month month day-of-week), any must match
+	Timezone    string   `yaml:"timezone,omitempty"`     // IANA time zone for schedules (default: UTC)
+	Countries   []string `yaml:"countries,omitempty"`    // ISO 3166-1 alpha-2 country codes of the client IP (requires geoip)
+	ASNs        []uint   `yaml:"asns,omitempty"`         // Autonomous system numbers of the client IP (requires geoip)
+	DeviceTypes []string `yaml:"device_types,omitempty"` // Device types parsed from the User-Agent (desktop, mobile, tablet, bot)
+	IsBot       *bool    `yaml:"is_bot,omitempty"`       // true = only bots, false = only non-bots (parsed from the User-Agent)
+
+	GPC     *bool           `yaml:"gpc,omitempty"`     // true = only requests with Sec-GPC: 1, false = only without
+	DNT     *bool           `yaml:"dnt,omitempty"`     // true = only requests with DNT: 1, false = only without
+	Consent map[string]bool `yaml:"consent,omitempty"` // Consent categories that must be explicitly granted (true) or denied (false)
 }
 
 // LogRule represents a logging rule configuration
 type LogRule struct {
-	Condition          LogRuleCondition      `yaml:"condition"` // Use named type
+	ID                 string                `yaml:"id,omitempty"`          // Optional unique identifier, used in messages and to keep rule statistics across reloads
+	Description        string                `yaml:"description,omitempty"` // Optional human-readable description
+	Condition          LogRuleCondition      `yaml:"condition"`             // Use named type
 	Enabled            bool                  `yaml:"enabled"`
 	Continue           bool                  `yaml:"continue,omitempty"`             // Default: false
 	LogScriptDownloads bool                  `yaml:"log_script_downloads,omitempty"` // If true and continue:true, accumulates script download logging; if true and continue:false, enables script download logging
 	ScriptInjection    []ScriptInjectionSpec `yaml:"script_injection,omitempty"`
 	AddLogData         []AddLogDataSpec      `yaml:"add_log_data,omitempty"`
 	LogDestinations    []string              `yaml:"log_destinations,omitempty"` // Optional list of destination names
+	Redaction          *Redaction            `yaml:"redaction,omitempty"`        // Redaction of client data when the rule matches
+	IPAnonymization    *IPAnonymization      `yaml:"ip_anonymization,omitempty"` // Anonymization of IP addresses when the rule matches
+	ConsentAction      string                `yaml:"consent_action,omitempty"`   // drop, strip or anonymize applied when the rule matches
+	Transform          []TransformOp         `yaml:"transform,omitempty"`        // Record transformations when the rule matches
+	PayloadSchema      *PayloadSchema        `yaml:"payload_schema,omitempty"`   // JSON Schema of the client data when the rule matches
 	JavaScriptOptions  struct {
 		TrackURL       bool `yaml:"track_url,omitempty"`
 		TrackTraceback bool `yaml:"track_traceback,omitempty"`
 	} `yaml:"javascript_options,omitempty"`
+
+	SourceFile  string `yaml:"-"` // Include file the rule was loaded from, empty for the main config file
+	SourceIndex int    `yaml:"-"` // Position of the rule within SourceFile
+}
+
+// Path returns the path of the rule used in messages: log_config[<id>] for rules with an id,
+// log_config[<file>#<n>] for rules from an include file and log_config[<index>] otherwise.
+func (r LogRule) Path(index int) string {
+	switch {
+	case r.ID != "":
+		return fmt.Sprintf("log_config[%s]", r.ID)
+	case r.SourceFile != "":
+		return fmt.Sprintf("log_config[%s#%d]", r.SourceFile, r.SourceIndex)
+	default:
+		return fmt.Sprintf("log_config[%d]", index)
+	}
+}
+
+// source describes where the rule was defined.
+func (r LogRule) source() string {
+	if r.SourceFile != "" {
+		return fmt.Sprintf("include file '%s'", r.SourceFile)
+	}
+	return "main config file"
+}
+
+// ListenerConfig is an address the server listens on, see server.listeners.
+type ListenerConfig struct {
+	Network       string `yaml:"network"`        // tcp (default) or unix
+	Address       string `yaml:"address"`        // host:port for tcp, socket path for unix
+	SocketMode    string `yaml:"socket_mode"`    // Octal permissions of the unix socket, e.g. "0660" (default: umask)
+	ProxyProtocol bool   `yaml:"proxy_protocol"` // Read PROXY protocol v1/v2 headers sent by trusted_proxies
+	Admin         bool   `yaml:"admin"`          // Serve the admin endpoints on the unix socket (default: false)
+}
+
+// FileMode returns the parsed socket_mode, 0 when not set.
+func (l ListenerConfig) FileMode() (os.FileMode, error) {
+	if l.SocketMode == "" {
+		return 0, nil
+	}
+	mode, err := strconv.ParseUint(l.SocketMode, 8, 32)
+	if err != nil || mode > 0o777 {
+		return 0, fmt.Errorf("invalid socket_mode '%s': must be octal permissions, e.g. \"0660\"", l.SocketMode)
+	}
+	return os.FileMode(mode), nil
 }
 
 // LoadConfig reads the configuration file from the given path.
@@ -152,32 +616,98 @@ func LoadConfig(path string) (*Config, error) {
 	cfg.AppLog.ShowHealthLogs = false              // Default health logs setting
 	cfg.Server.UnknownRoute.Code = 200
 	cfg.Server.UnknownRoute.CacheControl = "public, max-age=3600"
+	cfg.Server.TLS.MinVersion = "1.2"
+	cfg.Server.TLS.ReloadInterval = "1m"
+	cfg.Security.TokenRateLimit.BlockDuration = "1m"
+	cfg.Security.TokenRateLimit.MaxBlockDuration = "1h"
+	cfg.Security.TokenRefresh.GracePeriod = "1h"
+	cfg.Security.ReplayProtection.MaxEntries = 100000
 
 	if err := yaml.Unmarshal(data, &cfg); err != nil {
 		// Don't sanitize parse errors - they shouldn't contain secrets
 		return nil, fmt.Errorf("error parsing config file '%s': %w", path, err)
 	}
 
+	if err := loadIncludeDir(&cfg, path); err != nil {
+		return nil, err
+	}
+
+	resolvePayloadSchemaFiles(&cfg, path)
+	resolveTLSFiles(&cfg, path)
+
 	if err := validateConfig(&cfg); err != nil {
 		// Sanitize validation errors to prevent secret leakage
 		return nil, sanitizeSecretInError(
 			fmt.Errorf("configuration validation failed: %w", err),
-			cfg.Security.Token.Secret,
+			cfg.tokenSecrets()...,
 		)
 	}
 
+	resolveEnvSources(&cfg)
+
 	return &cfg, nil
 }
 
-// sanitizeSecretInError redacts any occurrence of the secret from error messages
+// resolvePayloadSchemaFiles makes relative payload schema files relative to the directory of the config file.
+func resolvePayloadSchemaFiles(cfg *Config, configPath string) {
+	resolve := func(p *PayloadSchema) {
+		if p != nil && p.File != "" && !filepath.IsAbs(p.File) {
+			p.File = filepath.Join(filepath.Dir(configPath), p.File)
+		}
+	}
+	for _, p := range cfg.PayloadSchemas {
+		resolve(p)
+	}
+	for i := range cfg.LogConfig {
+		resolve(cfg.LogConfig[i].PayloadSchema)
+	}
+}
+
+// resolveTLSFiles makes relative TLS files relative to the directory of the config file.
+func resolveTLSFiles(cfg *Config, configPath string) {
+	for _, file := range []*string{&cfg.Server.TLS.CertFile, &cfg.Server.TLS.KeyFile, &cfg.Server.TLS.ClientCAFile} {
+		if *file != "" && !filepath.IsAbs(*file) {
+			*file = filepath.Join(filepath.Dir(configPath), *file)
+		}
+	}
+}
+
+// resolveEnvSources reads the environment variables of all add_log_data specs with source 'env'.
+// The values are read once at load time, unset variables are reported as warnings.
+func resolveEnvSources(cfg *Config) {
+	resolve := func(specs []AddLogDataSpec, path string) {
+		for j := range specs {
+			if specs[j].Source != "env" {
+				continue
+			}
+			value, ok := os.LookupEnv(specs[j].Value)
+			if !ok {
+				fmt.Fprintf(os.Stderr, "[WARNING] %s[%d]: environment variable '%s' is not set, field '%s' will be omitted.\n", path, j, specs[j].Value, specs[j].Name)
+			}
+			specs[j].EnvValue = value
+		}
+	}
+	for i := range cfg.LogDestinations {
+		resolve(cfg.LogDestinations[i].AddLogData, fmt.Sprintf("log_destinations[%s]", cfg.LogDestinations[i].Name))
+	}
+	for i := range cfg.LogConfig {
+		resolve(cfg.LogConfig[i].AddLogData, cfg.LogConfig[i].Path(i)+".add_log_data")
+	}
+}
+
+// sanitizeSecretInError redacts any occurrence of the secrets from error messages
 // This prevents accidental secret exposure in logs or error outputs
-func sanitizeSecretInError(err error, secret string) error {
-	if err == nil || secret == "" {
+func sanitizeSecretInError(err error, secrets ...string) error {
+	if err == nil {
 		return err
 	}
 	errMsg := err.Error()
-	if strings.Contains(errMsg, secret) {
-		errMsg = strings.ReplaceAll(errMsg, secret, "[REDACTED]")
+	for _, secret := range secrets {
+		if secret != "" && strings.Contains(errMsg, secret) {
+			errMsg = strings.ReplaceAll(errMsg, secret, "[REDACTED]")
+		}
+	}
+	if errMsg != err.Error() {
 		return fmt.Errorf("%s", errMsg)
 	}
 	return err
@@ -185,35 +715,12 @@ func sanitizeSecretInError(err error, secret string) error {
 
 // validateConfig performs semantic validation of the configuration
 func validateConfig(cfg *Config) error {
-	// Basic security checks
-	const minSecretLength = 32 // Minimum 32 characters for HMAC-SHA256 security
-
-	if cfg.Security.Token.Secret == "" {
-		return errors.New("security.token.secret cannot be empty")
-	}
-
-	// Enforce minimum secret length for security
-	if len(cfg.Security.Token.Secret) < minSecretLength {
-		return fmt.Errorf("security.token.secret must be at least %d characters long, got %d. Use a strong random string", minSecretLength, len(cfg.Security.Token.Secret))
-	}
+	// Warnings are collected anew, validating the same config twice does not repeat them
+	cfg.Warnings = nil
 
-	// Check for commonly used weak secrets
-	weakSecrets := []string{
-		"change_this_to_a_secure_random_string",
-		"secret",
-		"password",
-		"123456",
-		"12345678",
-		"qwerty",
-		"admin",
-		"letmein",
-		"welcome",
-		"monkey",
-	}
-	for _, weak := range weakSecrets {
-		if cfg.Security.Token.Secret == weak {
-			return fmt.Errorf("security.token.secret must not be a default or commonly used weak value. Use a strong random string of at least %d characters", minSecretLength)
-		}
+	// Basic security checks
+	if err := validateTokenKeys(&cfg.Security.Token, "security.token"); err != nil {
+		return err
 	}
 
 	// Token expiration validation
@@ -221,6 +728,20 @@ func validateConfig(cfg *Config) error {
 	if err != nil {
 		return fmt.Errorf("invalid security.token.expiration: %w", err)
 	}
+	if err := validateSiteTokenPolicies(cfg); err != nil {
+		return err
+	}
+	if err := validateTokenRateLimit(cfg); err != nil {
+		return err
+	}
+	if cfg.Security.TokenRefresh.Enabled {
+		if _, err := ParseNonNegativeDuration(cfg.Security.TokenRefresh.GracePeriod); err != nil {
+			return fmt.Errorf("invalid security.token_refresh.grace_period '%s': must be a duration of at least 0s", cfg.Security.TokenRefresh.GracePeriod)
+		}
+	}
+	if err := validateReplayProtection(cfg); err != nil {
+		return err
+	}
 
 	// AppLog validation
 	if cfg.AppLog.Level != "" {
@@ -271,6 +792,13 @@ func validateConfig(cfg *Config) error {
 		return errors.New("server.request_limits.max_body_size cannot be negative")
 	}
 
+	if err := validateTLS(cfg); err != nil {
+		return err
+	}
+	if err := validateListeners(cfg); err != nil {
+		return err
+	}
+
 	// CORS validation
 	if cfg.Server.CORS.Enabled {
 		if len(cfg.Server.CORS.AllowedOrigins) == 0 {
@@ -294,8 +822,7 @@ func validateConfig(cfg *Config) error {
 
 		// Print security warning for wildcard in CORS
 		if hasWildcard {
-			fmt.Fprintf(os.Stderr, "[SECURITY WARNING] CORS wildcard '*' detected in allowed_origins. This allows ANY origin to make requests.\n")
-			fmt.Fprintf(os.Stderr, "[SECURITY WARNING] Wildcard '*' is NOT recommended for production environments. Specify exact origins instead.\n")
+			cfg.warnf("CORS wildcard '*' detected in allowed_origins. This allows ANY origin to make requests, specify exact origins in production environments.")
 		}
 
 		// Validate MaxAge
@@ -304,6 +831,13 @@ func validateConfig(cfg *Config) error {
 		}
 	}
 
+	// Admin validation
+	if cfg.Server.Admin.Enabled {
+		if _, err := iputil.ParseCIDRs(cfg.Server.Admin.AllowedIPs); err != nil {
+			return fmt.Errorf("invalid server.admin.allowed_ips: %w", err)
+		}
+	}
+
 	// Log Destinations validation
 	destinationNames := make(map[string]bool)
 	for i, dest := range cfg.LogDestinations {
@@ -368,15 +902,50 @@ func validateConfig(cfg *Config) error {
 		if err := validateAddLogDataSpecs(dest.AddLogData, fmt.Sprintf("log_destinations[%s]", dest.Name)); err != nil {
 			return err
 		}
+		if err := validateRedaction(dest.Redaction, fmt.Sprintf("log_destinations[%s].redaction", dest.Name)); err != nil {
+			return err
+		}
+		if err := validateIPAnonymization(dest.IPAnonymization, fmt.Sprintf("log_destinations[%s].ip_anonymization", dest.Name)); err != nil {
+			return err
+		}
+		if err := validateTransform(dest.Transform, fmt.Sprintf("log_destinations[%s].transform", dest.Name)); err != nil {
+			return err
+		}
+		if err := validateSchema(dest); err != nil {
+			return err
+		}
 	}
 
 	// Log Rules validation
+	ruleIDs := make(map[string]int)
 	for i, rule := range cfg.LogConfig {
-		rulePath := fmt.Sprintf("log_config[%d]", i)
+		if rule.ID != "" {
+			if !isValidRuleID(rule.ID) {
+				return fmt.Errorf("log_config[%d]: invalid id '%s', only letters, digits, '.', '_' and '-' are allowed", i, rule.ID)
+			}
+			if other, exists := ruleIDs[rule.ID]; exists {
+				return fmt.Errorf("log_config[%d]: duplicate id '%s' in %s, already used by log_config[%d] in %s",
+					i, rule.ID, rule.source(), other, cfg.LogConfig[other].source())
+			}
+			ruleIDs[rule.ID] = i
+		}
+		rulePath := rule.Path(i)
 		// Validate AddLogData within rule
 		if err := validateAddLogDataSpecs(rule.AddLogData, rulePath+".add_log_data"); err != nil {
 			return err
 		}
+		if err := validateRedaction(rule.Redaction, rulePath+".redaction"); err != nil {
+			return err
+		}
+		if err := validateIPAnonymization(rule.IPAnonymization, rulePath+".ip_anonymization"); err != nil {
+			return err
+		}
+		if err := validateTransform(rule.Transform, rulePath+".transform"); err != nil {
+			return err
+		}
+		if err := validatePayloadSchema(cfg, rule.PayloadSchema, rulePath+".payload_schema"); err != nil {
+			return err
+		}
 		// Validate ScriptInjection URLs
 		for j, script := range rule.ScriptInjection {
 			if script.URL == "" {
@@ -406,6 +975,52 @@ func validateConfig(cfg *Config) error {
 				return fmt.Errorf("%s.condition.headers: header '%s' value must be string or bool, got %T", rulePath, k, v)
 			}
 		}
+		if err := validateTimeConditions(cfg, rule.Condition, rulePath+".condition"); err != nil {
+			return err
+		}
+		for j, country := range rule.Condition.Countries {
+			if !isValidCountryCode(country) {
+				return fmt.Errorf("%s.condition.countries[%d]: invalid country code '%s', must be ISO 3166-1 alpha-2 (e.g. CZ)", rulePath, j, country)
+			}
+		}
+		for j, deviceType := range rule.Condition.DeviceTypes {
+			if !containsString(useragent.DeviceTypes, deviceType) {
+				return fmt.Errorf("%s.condition.device_types[%d]: invalid device type '%s', must be one of %v", rulePath, j, deviceType, useragent.DeviceTypes)
+			}
+		}
+		if len(rule.Condition.Consent) > 0 && (cfg.Consent == nil || cfg.Consent.Cookie == "" && cfg.Consent.Header == "") {
+			return fmt.Errorf("%s.condition.consent: requires consent.cookie or consent.header", rulePath)
+		}
+		for category := range rule.Condition.Consent {
+			if category == "" {
+				return fmt.Errorf("%s.condition.consent: category name cannot be empty", rulePath)
+			}
+		}
+		if rule.ConsentAction != "" && !containsString(consent.Actions, rule.ConsentAction) {
+			return fmt.Errorf("%s: invalid consent_action '%s', must be one of %v", rulePath, rule.ConsentAction, consent.Actions)
+		}
+	}
+
+	if err := validateGeoIP(cfg); err != nil {
+		return err
+	}
+
+	if err := validateRedaction(cfg.Redaction, "redaction"); err != nil {
+		return err
+	}
+
+	if err := validateConsent(cfg); err != nil {
+		return err
+	}
+
+	for siteID, p := range cfg.PayloadSchemas {
+		path := fmt.Sprintf("payload_schemas[%s]", siteID)
+		if p == nil {
+			return fmt.Errorf("%s: file or schema is required", path)
+		}
+		if err := validatePayloadSchema(cfg, p, path); err != nil {
+			return err
+		}
 	}
 
 	if cfg.Server.UnknownRoute.Code < 100 || cfg.Server.UnknownRoute.Code > 599 {
@@ -418,9 +1033,545 @@ func validateConfig(cfg *Config) error {
 	return nil
 }
 
+// validateTimeConditions validates the time window and schedules of a rule condition.
+// Windows that have already ended are reported as warnings, not errors.
+func validateTimeConditions(cfg *Config, cond LogRuleCondition, path string) error {
+	var activeFrom, activeUntil time.Time
+	var err error
+	if cond.ActiveFrom != "" {
+		activeFrom, err = time.Parse(time.RFC3339, cond.ActiveFrom)
+		if err != nil {
+			return fmt.Errorf("%s.active_from: invalid timestamp '%s', must be RFC 3339 (e.g. 2025-01-31T08:00:00Z)", path, cond.ActiveFrom)
+		}
+	}
+	if cond.ActiveUntil != "" {
+		activeUntil, err = time.Parse(time.RFC3339, cond.ActiveUntil)
+		if err != nil {
+			return fmt.Errorf("%s.active_until: invalid timestamp '%s', must be RFC 3339 (e.g. 2025-01-31T18:00:00Z)", path, cond.ActiveUntil)
+		}
+	}
+	if !activeFrom.IsZero() && !activeUntil.IsZero() && !activeUntil.After(activeFrom) {
+		return fmt.Errorf("%s: active_until '%s' must be after active_from '%s'", path, cond.ActiveUntil, cond.ActiveFrom)
+	}
+	if !activeUntil.IsZero() && !activeUntil.After(time.Now()) {
+		cfg.warnf("%s.active_until '%s' is in the past, the rule will never match.", path, cond.ActiveUntil)
+	}
+
+	if cond.Timezone != "" {
+		if _, err := time.LoadLocation(cond.Timezone); err != nil {
+			return fmt.Errorf("%s.timezone: unknown time zone '%s'", path, cond.Timezone)
+		}
+	}
+	for i, expr := range cond.Schedules {
+		if _, err := schedule.Parse(expr); err != nil {
+			return fmt.Errorf("%s.schedules[%d]: %w", path, i, err)
+		}
+	}
+	return nil
+}
+
+// validateRedaction compiles the redaction settings, the compiled redactor is stored in r.
+func validateRedaction(r *Redaction, path string) error {
+	if r == nil {
+		return nil
+	}
+	patterns := make([]redact.Pattern, len(r.Patterns))
+	for i, p := range r.Patterns {
+		patterns[i] = redact.Pattern{Name: p.Name, Regex: p.Regex, Action: p.Action}
+	}
+	fields := make([]redact.Field, len(r.Fields))
+	for i, f := range r.Fields {
+		fields[i] = redact.Field{Path: f.Path, Action: f.Action}
+	}
+	redactor, err := redact.New(redact.Options{
+		Detectors: r.Detectors,
+		Action:    r.Action,
+		HashSalt:  r.HashSalt,
+		Patterns:  patterns,
+		Fields:    fields,
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	r.Redactor = redactor
+	return nil
+}
+
+// validateIPAnonymization compiles the IP anonymization settings, the anonymizer is stored in a.
+func validateIPAnonymization(a *IPAnonymization, path string) error {
+	if a == nil {
+		return nil
+	}
+	rotation := 24 * time.Hour
+	if a.SaltRotation != "" {
+		d, err := ParseDuration(a.SaltRotation)
+		if err != nil {
+			return fmt.Errorf("%s: invalid salt_rotation '%s': %w", path, a.SaltRotation, err)
+		}
+		rotation = d
+	}
+	for i, field := range a.Fields {
+		if field == "" {
+			return fmt.Errorf("%s.fields[%d]: field name cannot be empty", path, i)
+		}
+	}
+	anonymizer, err := ipanon.New(a.Mode, a.HashKey, rotation)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	a.Anonymizer = anonymizer
+	return nil
+}
+
+// validateTransform compiles the transformations, the compiled operations are stored in ops.
+func validateTransform(ops []TransformOp, path string) error {
+	for i := range ops {
+		op := &ops[i]
+		compiled, err := transform.Compile(transform.Spec{
+			Op:        op.Op,
+			From:      op.From,
+			To:        op.To,
+			Path:      op.Path,
+			Paths:     op.Paths,
+			Type:      op.Type,
+			Separator: op.Separator,
+		})
+		if err != nil {
+			return fmt.Errorf("%s[%d]: %w", path, i, err)
+		}
+		op.Compiled = compiled
+	}
+	return nil
+}
+
+// validateTokenSecret checks the length and strength of a token signing secret.
+func validateTokenSecret(secret, path string) error {
+	const minSecretLength = 32 // Minimum 32 characters for HMAC-SHA256 security
+
+	if secret == "" {
+		return fmt.Errorf("%s cannot be empty", path)
+	}
+
+	// Enforce minimum secret length for security
+	if len(secret) < minSecretLength {
+		return fmt.Errorf("%s must be at least %d characters long, got %d. Use a strong random string", path, minSecretLength, len(secret))
+	}
+
+	// Check for commonly used weak secrets
+	weakSecrets := []string{
+		"change_this_to_a_secure_random_string",
+		"secret",
+		"password",
+		"123456",
+		"12345678",
+		"qwerty",
+		"admin",
+		"letmein",
+		"welcome",
+		"monkey",
+	}
+	for _, weak := range weakSecrets {
+		if secret == weak {
+			return fmt.Errorf("%s must not be a default or commonly used weak value. Use a strong random string of at least %d characters", path, minSecretLength)
+		}
+	}
+	return nil
+}
+
+// validateTokenKeys validates the secret and keys of a token config at path and builds its keyring.
+// The secret is the key with ID "default"; without keys it is required and signs all tokens.
+func validateTokenKeys(token *TokenConfig, path string) error {
+	var keys []security.Key
+	if token.Secret != "" || len(token.Keys) == 0 {
+		if err := validateTokenSecret(token.Secret, path+".secret"); err != nil {
+			return err
+		}
+		keys = append(keys, security.Key{ID: security.DefaultKeyID, Secret: token.Secret})
+	}
+	for i, key := range token.Keys {
+		if !security.ValidKeyID(key.ID) {
+			return fmt.Errorf("%s.keys[%d]: invalid id '%s', use 1-64 letters, digits, '.', '_' or '-'", path, i, key.ID)
+		}
+		keyPath := fmt.Sprintf("%s.keys[%s]", path, key.ID)
+		for _, existing := range keys {
+			if existing.ID == key.ID {
+				if key.ID == security.DefaultKeyID {
+					return fmt.Errorf("%s: id '%s' is reserved for %s.secret", keyPath, key.ID, path)
+				}
+				return fmt.Errorf("%s: duplicate id", keyPath)
+			}
+		}
+		if err := validateTokenSecret(key.Secret, keyPath+".secret"); err != nil {
+			return err
+		}
+		keys = append(keys, security.Key{ID: key.ID, Secret: key.Secret, Retired: key.Retired})
+	}
+
+	if token.ActiveKey == "" {
+		token.ActiveKey = keys[0].ID
+		if len(token.Keys) > 0 {
+			token.ActiveKey = token.Keys[0].ID
+		}
+	}
+	active := slices.IndexFunc(keys, func(k security.Key) bool { return k.ID == token.ActiveKey })
+	if active == -1 {
+		return fmt.Errorf("%s.active_key '%s' does not exist", path, token.ActiveKey)
+	}
+	if keys[active].Retired {
+		return fmt.Errorf("%s.active_key '%s' is retired", path, token.ActiveKey)
+	}
+	acceptLegacy := token.AcceptLegacyTokens == nil || *token.AcceptLegacyTokens
+	keyring, err := security.NewKeyring(keys, token.ActiveKey, acceptLegacy)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	token.Keyring = keyring
+	return nil
+}
+
+// validateSiteTokenPolicies validates security.sites and builds the token policies of all sites.
+func validateSiteTokenPolicies(cfg *Config) error {
+	sites := make(map[string]security.Policy, len(cfg.Security.Sites))
+	for siteID, site := range cfg.Security.Sites {
+		path := fmt.Sprintf("security.sites[%s]", siteID)
+		if err := validation.IsValidID(siteID, validation.DefaultMaxInputLength); err != nil {
+			return fmt.Errorf("%s: invalid site_id: %w", path, err)
+		}
+		if site == nil {
+			return fmt.Errorf("%s: policy cannot be empty", path)
+		}
+		policy := security.Policy{AllowedGtmIDs: site.AllowedGtmIDs, Binding: site.Binding.binding()}
+		if site.Secret != "" || len(site.Keys) > 0 {
+			if err := validateTokenKeys(&site.TokenConfig, path); err != nil {
+				return err
+			}
+			policy.Keyring = site.Keyring
+		} else if site.ActiveKey != "" || site.AcceptLegacyTokens != nil {
+			return fmt.Errorf("%s: active_key and accept_legacy_tokens require secret or keys", path)
+		}
+		if site.Expiration != "" {
+			expiration, err := ParseDuration(site.Expiration)
+			if err != nil {
+				return fmt.Errorf("invalid %s.expiration: %w", path, err)
+			}
+			policy.Expiration = expiration
+		}
+		for i, gtmID := range site.AllowedGtmIDs {
+			if err := validation.IsValidID(gtmID, validation.DefaultMaxInputLength); err != nil {
+				return fmt.Errorf("%s.allowed_gtm_ids[%d]: invalid gtm_id '%s': %w", path, i, gtmID, err)
+			}
+		}
+		sites[siteID] = policy
+	}
+	defaults := security.Policy{Keyring: cfg.Security.Token.Keyring, Binding: cfg.Security.Token.Binding.binding()}
+	cfg.Security.Policies = security.NewPolicies(defaults, sites)
+	return nil
+}
+
+// validateTLS checks server.tls and loads the certificate, key and client CA files once.
+func validateTLS(cfg *Config) error {
+	t := cfg.Server.TLS
+	if !t.Enabled {
+		return nil
+	}
+	if t.CertFile == "" || t.KeyFile == "" {
+		return errors.New("server.tls.cert_file and server.tls.key_file are required when TLS is enabled")
+	}
+	minVersion, err := tlsutil.ParseVersion(t.MinVersion)
+	if err != nil {
+		return fmt.Errorf("server.tls.min_version: %w", err)
+	}
+	cipherSuites, err := tlsutil.ParseCipherSuites(t.CipherSuites)
+	if err != nil {
+		return fmt.Errorf("server.tls.cipher_suites: %w", err)
+	}
+	if err := tlsutil.CheckHTTP2CipherSuites(cipherSuites, minVersion); err != nil {
+		return fmt.Errorf("server.tls.cipher_suites: %w", err)
+	}
+	if len(t.CipherSuites) > 0 && minVersion == tls.VersionTLS13 {
+		cfg.warnf("server.tls.cipher_suites are ignored with min_version 1.3, TLS 1.3 cipher suites are not configurable")
+	}
+	if _, err := ParseNonNegativeDuration(t.ReloadInterval); err != nil {
+		return fmt.Errorf("invalid server.tls.reload_interval '%s': must be a duration of at least 0s", t.ReloadInterval)
+	}
+	if _, err := tlsutil.NewReloader(t.CertFile, t.KeyFile, t.ClientCAFile); err != nil {
+		return fmt.Errorf("server.tls: %w", err)
+	}
+	if cfg.Server.Protocol == "http" {
+		cfg.warnf("server.tls is enabled but server.protocol is 'http', URLs generated for standalone mode use http")
+	}
+	return nil
+}
+
+// validateListeners checks server.listeners and sets the default network.
+func validateListeners(cfg *Config) error {
+	if cfg.Server.ProxyProtocol {
+		if len(cfg.Server.TrustedProxies) == 0 {
+			return errors.New("server.proxy_protocol requires server.trusted_proxies")
+		}
+		if len(cfg.Server.Listeners) > 0 {
+			cfg.warnf("server.proxy_protocol only applies to host and port, set proxy_protocol on server.listeners instead")
+		}
+	}
+	seen := make(map[string]bool)
+	for i := range cfg.Server.Listeners {
+		l := &cfg.Server.Listeners[i]
+		if l.Network == "" {
+			l.Network = "tcp"
+		}
+		switch l.Network {
+		case "tcp":
+			_, port, err := net.SplitHostPort(l.Address)
+			if err != nil {
+				return fmt.Errorf("server.listeners[%d]: invalid address '%s': %w", i, l.Address, err)
+			}
+			if p, err := strconv.Atoi(port); err != nil || p <= 0 || p > 65535 {
+				return fmt.Errorf("server.listeners[%d]: invalid port in address '%s'", i, l.Address)
+			}
+			if l.SocketMode != "" {
+				return fmt.Errorf("server.listeners[%d]: socket_mode is only supported for network 'unix'", i)
+			}
+			if l.Admin {
+				return fmt.Errorf("server.listeners[%d]: admin is only supported for network 'unix', admin.allowed_ips applies to tcp listeners", i)
+			}
+		case "unix":
+			if l.Address == "" {
+				return fmt.Errorf("server.listeners[%d]: address (socket path) is required for network 'unix'", i)
+			}
+			if _, err := l.FileMode(); err != nil {
+				return fmt.Errorf("server.listeners[%d]: %w", i, err)
+			}
+		default:
+			return fmt.Errorf("server.listeners[%d]: invalid network '%s', must be 'tcp' or 'unix'", i, l.Network)
+		}
+		if l.ProxyProtocol && len(cfg.Server.TrustedProxies) == 0 {
+			return fmt.Errorf("server.listeners[%d]: proxy_protocol requires server.trusted_proxies", i)
+		}
+		key := l.Network + ":" + l.Address
+		if seen[key] {
+			return fmt.Errorf("server.listeners[%d]: duplicate %s address '%s'", i, l.Network, l.Address)
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+// ServerListeners returns server.listeners, or a tcp listener on server.host and server.port
+// with server.proxy_protocol when none are configured.
+func (cfg *Config) ServerListeners() []ListenerConfig {
+	if len(cfg.Server.Listeners) > 0 {
+		return cfg.Server.Listeners
+	}
+	return []ListenerConfig{{
+		Network:       "tcp",
+		Address:       net.JoinHostPort(cfg.Server.Host, strconv.Itoa(cfg.Server.Port)),
+		ProxyProtocol: cfg.Server.ProxyProtocol,
+	}}
+}
+
+// validateTokenRateLimit checks security.token_rate_limit.
+func validateTokenRateLimit(cfg *Config) error {
+	limit := cfg.Security.TokenRateLimit
+	if limit.MaxAttempts < 0 {
+		return errors.New("security.token_rate_limit.max_attempts cannot be negative")
+	}
+	if limit.MaxAttempts == 0 {
+		return nil
+	}
+	block, err := ParseDuration(limit.BlockDuration)
+	if err != nil || block <= 0 {
+		return fmt.Errorf("invalid security.token_rate_limit.block_duration '%s': must be a positive duration", limit.BlockDuration)
+	}
+	maxBlock, err := ParseDuration(limit.MaxBlockDuration)
+	if err != nil || maxBlock < block {
+		return fmt.Errorf("invalid security.token_rate_limit.max_block_duration '%s': must be a duration of at least block_duration", limit.MaxBlockDuration)
+	}
+	return nil
+}
+
+// validateReplayProtection checks security.replay_protection and defaults the window to the
+// longest token expiration, after which replayed events are rejected as expired anyway.
+func validateReplayProtection(cfg *Config) error {
+	replay := &cfg.Security.ReplayProtection
+	if !replay.Enabled {
+		return nil
+	}
+	if replay.MaxEntries <= 0 {
+		return errors.New("security.replay_protection.max_entries must be positive")
+	}
+	longest, longestStr := time.Duration(0), ""
+	for _, expiration := range cfg.tokenExpirations() {
+		if d, err := ParseDuration(expiration); err == nil && d > longest {
+			longest, longestStr = d, expiration
+		}
+	}
+	if replay.Window == "" {
+		replay.Window = longestStr
+		return nil
+	}
+	window, err := ParseDuration(replay.Window)
+	if err != nil || window <= 0 {
+		return fmt.Errorf("invalid security.replay_protection.window '%s': must be a positive duration", replay.Window)
+	}
+	if window < longest {
+		cfg.warnf("security.replay_protection.window '%s' is shorter than the token expiration '%s', events can be replayed after the window", replay.Window, longestStr)
+	}
+	return nil
+}
+
+// tokenExpirations returns the token expiration of security.token and of all sites overriding it.
+func (c *Config) tokenExpirations() []string {
+	expirations := []string{c.Security.Token.Expiration}
+	for _, site := range c.Security.Sites {
+		if site != nil && site.Expiration != "" {
+			expirations = append(expirations, site.Expiration)
+		}
+	}
+	return expirations
+}
+
+// validatePayloadSchema compiles the JSON Schema and checks the on_error action, the compiled schema is stored in p.
+func validatePayloadSchema(cfg *Config, p *PayloadSchema, path string) error {
+	if p == nil {
+		return nil
+	}
+	var compiled *jsonschema.Schema
+	var err error
+	switch {
+	case p.File != "" && p.Schema != nil:
+		return fmt.Errorf("%s: file and schema are mutually exclusive", path)
+	case p.File != "":
+		data, readErr := os.ReadFile(p.File) // #nosec G304 -- Schema path comes from the trusted config file
+		if readErr != nil {
+			return fmt.Errorf("%s: %w", path, readErr)
+		}
+		compiled, err = jsonschema.Compile(data)
+	case p.Schema != nil:
+		compiled, err = jsonschema.CompileValue(p.Schema)
+	default:
+		return fmt.Errorf("%s: file or schema is required", path)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: invalid schema: %w", path, err)
+	}
+
+	if p.OnError == "" {
+		p.OnError = PayloadSchemaAnnotate
+	}
+	if !containsString(PayloadSchemaActions, p.OnError) {
+		return fmt.Errorf("%s: invalid on_error '%s', must be one of %v", path, p.OnError, PayloadSchemaActions)
+	}
+	if p.OnError == PayloadSchemaQuarantine {
+		if p.QuarantineDestination == "" {
+			return fmt.Errorf("%s: quarantine_destination is required for on_error 'quarantine'", path)
+		}
+		found := false
+		for _, dest := range cfg.LogDestinations {
+			found = found || dest.Name == p.QuarantineDestination
+		}
+		if !found {
+			return fmt.Errorf("%s: quarantine_destination '%s' does not exist", path, p.QuarantineDestination)
+		}
+	} else if p.QuarantineDestination != "" {
+		return fmt.Errorf("%s: quarantine_destination is only used with on_error 'quarantine'", path)
+	}
+	p.Compiled = compiled
+	return nil
+}
+
+// validateSchema checks the schema of a destination. GELF and text output have their own
+// layouts, so a schema is only supported for JSON files.
+func validateSchema(dest LogDestination) error {
+	s := dest.Schema
+	if s == nil {
+		return nil
+	}
+	if s.Format == "" {
+		s.Format = schema.FormatBunyan
+	}
+	if !containsString(schema.Formats, s.Format) {
+		return fmt.Errorf("log_destinations[%s].schema: invalid format '%s', must be one of %v", dest.Name, s.Format, schema.Formats)
+	}
+	if s.Namespace != "" && (!isValidRuleID(s.Namespace) || strings.Contains(s.Namespace, ".")) {
+		return fmt.Errorf("log_destinations[%s].schema: invalid namespace '%s', only letters, digits, '_' and '-' are allowed", dest.Name, s.Namespace)
+	}
+	if dest.Type != "file" || dest.Format != "json" {
+		return fmt.Errorf("log_destinations[%s].schema: only supported for type 'file' with format 'json'", dest.Name)
+	}
+	return nil
+}
+
+// validateConsent checks the consent policy and sets the default action.
+func validateConsent(cfg *Config) error {
+	c := cfg.Consent
+	if c == nil {
+		return nil
+	}
+	if c.Action == "" {
+		c.Action = consent.ActionDrop
+	}
+	if !containsString(consent.Actions, c.Action) {
+		return fmt.Errorf("consent.action: invalid action '%s', must be one of %v", c.Action, consent.Actions)
+	}
+	if len(c.Categories) > 0 && c.Cookie == "" && c.Header == "" {
+		return errors.New("consent.categories: requires consent.cookie or consent.header")
+	}
+	for i, category := range c.Categories {
+		if strings.TrimSpace(category) == "" {
+			return fmt.Errorf("consent.categories[%d]: category name cannot be empty", i)
+		}
+	}
+	if !c.HonorGPC && !c.HonorDNT && len(c.Categories) == 0 {
+		cfg.warnf("consent: no signal is honoured (honor_gpc, honor_dnt, categories), the policy never applies.")
+	}
+	return nil
+}
+
+// validateGeoIP checks that GeoIP databases are configured when the geoip source or the
+// countries/asns conditions are used.
+func validateGeoIP(cfg *Config) error {
+	if cfg.GeoIP.ReloadInterval < 0 {
+		return fmt.Errorf("geoip.reload_interval must be >= 0, got %d", cfg.GeoIP.ReloadInterval)
+	}
+	for i, path := range cfg.GeoIP.Databases {
+		if path == "" {
+			return fmt.Errorf("geoip.databases[%d] cannot be empty", i)
+		}
+	}
+	if len(cfg.GeoIP.Databases) > 0 {
+		return nil
+	}
+
+	usesGeoIP := func(specs []AddLogDataSpec) bool {
+		for _, spec := range specs {
+			if spec.Source == "geoip" {
+				return true
+			}
+		}
+		return false
+	}
+	for _, dest := range cfg.LogDestinations {
+		if usesGeoIP(dest.AddLogData) {
+			return fmt.Errorf("log_destinations[%s]: source 'geoip' requires geoip.databases", dest.Name)
+		}
+	}
+	for i, rule := range cfg.LogConfig {
+		if usesGeoIP(rule.AddLogData) {
+			return fmt.Errorf("%s.add_log_data: source 'geoip' requires geoip.databases", rule.Path(i))
+		}
+		if len(rule.Condition.Countries) > 0 || len(rule.Condition.ASNs) > 0 {
+			return fmt.Errorf("%s.condition: countries and asns require geoip.databases", rule.Path(i))
+		}
+	}
+	return nil
+}
+
 // validateAddLogDataSpecs validates a slice of AddLogDataSpec
 func validateAddLogDataSpecs(specs []AddLogDataSpec, path string) error {
-	validSources := map[string]bool{"static": true, "header": true, "query": true, "post": true}
+	validSources := map[string]bool{
+		"static": true, "header": true, "query": true, "post": true, "cookie": true, "client_ip": true,
+		"request": true, "env": true, "server": true, "geoip": true, "user_agent": true, "template": true,
+	}
 	for j, spec := range specs {
 		specPath := fmt.Sprintf("%s[%d]", path, j)
 		if spec.Name == "" {
@@ -431,8 +1582,28 @@ func validateAddLogDataSpecs(specs []AddLogDataSpec, path string) error {
 		}
 		// Value can be empty for header/query/post (means get the value of that key)
 		// Value is mandatory for static source? Yes.
-		if spec.Source == "static" && spec.Value == "" {
-			return fmt.Errorf("%s: value is required for source 'static'", specPath)
+		if (spec.Source == "static" || spec.Source == "cookie" || spec.Source == "env" || spec.Source == "template") && spec.Value == "" {
+			return fmt.Errorf("%s: value is required for source '%s'", specPath, spec.Source)
+		}
+		if spec.Source == "request" && !containsString(RequestFields, spec.Value) {
+			return fmt.Errorf("%s: invalid request field '%s', must be one of %v", specPath, spec.Value, RequestFields)
+		}
+		if spec.Source == "server" && !containsString(ServerFields, spec.Value) {
+			return fmt.Errorf("%s: invalid server field '%s', must be one of %v", specPath, spec.Value, ServerFields)
+		}
+		if spec.Source == "template" {
+			tmpl, err := logtemplate.Compile(spec.Value)
+			if err != nil {
+				return fmt.Errorf("%s: %w", specPath, err)
+			}
+			specs[j].Template = tmpl
+		}
+		if spec.Source == "geoip" && !containsString(geoip.Fields, spec.Value) {
+			return fmt.Errorf("%s: invalid geoip field '%s', must be one of %v", specPath, spec.Value, geoip.Fields)
+		}
+		// Empty value adds all user_agent fields prefixed with the name
+		if spec.Source == "user_agent" && spec.Value != "" && !containsString(useragent.Fields, spec.Value) {
+			return fmt.Errorf("%s: invalid user_agent field '%s', must be one of %v", specPath, spec.Value, useragent.Fields)
 		}
 	}
 	return nil
@@ -521,6 +1692,20 @@ func ParseDuration(durationStr string) (time.Duration, error) {
 	return d, nil
 }
 
+// ParseNonNegativeDuration parses a duration like ParseDuration, but also accepts zero
+// (e.g. "0s" or "0d") for options where zero disables something.
+func ParseNonNegativeDuration(durationStr string) (time.Duration, error) {
+	trimmed := strings.TrimSpace(strings.ToLower(durationStr))
+	if strings.HasSuffix(trimmed, "d") {
+		if days, err := strconv.ParseInt(strings.TrimSuffix(trimmed, "d"), 10, 64); err == nil && days == 0 {
+			return 0, nil
+		}
+	} else if d, err := time.ParseDuration(trimmed); err == nil && d == 0 {
+		return 0, nil
+	}
+	return ParseDuration(durationStr)
+}
+
 // ParseSize parses a size string (e.g., "10MB", "5k", "1G") into bytes.
 // Supports K, M, G suffixes (case-insensitive).
 // TODO: Limit support to K, M, G (and KB, MB, GB) suffixes only. Larger units are unlikely for logs.
@@ -675,3 +1860,41 @@ func isValidHeaderName(name string) bool {
 	}
 	return true
 }
+
+// isValidRuleID checks that a rule id contains only letters, digits, '.', '_' and '-'
+func isValidRuleID(id string) bool {
+	if len(id) == 0 || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		if !(('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') || c == '.' || c == '_' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// isValidCountryCode checks for a two-letter country code
+func isValidCountryCode(code string) bool {
+	if len(code) != 2 {
+		return false
+	}
+	for i := 0; i < len(code); i++ {
+		c := code[i]
+		if !(('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')) {
+			return false
+		}
+	}
+	return true
+}
+
+// containsString reports whether the slice contains the string
+func containsString(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
@@ -1,11 +1,20 @@
 package config
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
 	"os"
 	"path/filepath"
 	"testing"
 	"time"
 
+	"github.com/orgoj/weblogproxy/internal/logtemplate"
+	"github.com/orgoj/weblogproxy/internal/security"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"gopkg.in/yaml.v3"
@@ -676,6 +685,1097 @@ log_config:
 `,
 			expectedError: "log_config[0].condition.headers: header 'X-Test' value must be string or bool, got int",
 		},
+		{
+			name: "Invalid active_from timestamp",
+			config: `
+server:
+  mode: "standalone"
+  domain: "example.com"
+  unknown_route:
+    code: 200
+    cache_control: "public, max-age=3600"
+security:
+  token:
+    secret: "test_token_secret_exactly_32chars"
+    expiration: "24h"
+log_config:
+  - enabled: true
+    condition:
+      active_from: "2025-01-01 08:00"
+`,
+			expectedError: "log_config[0].condition.active_from: invalid timestamp '2025-01-01 08:00'",
+		},
+		{
+			name: "Time window end before start",
+			config: `
+server:
+  mode: "standalone"
+  domain: "example.com"
+  unknown_route:
+    code: 200
+    cache_control: "public, max-age=3600"
+security:
+  token:
+    secret: "test_token_secret_exactly_32chars"
+    expiration: "24h"
+log_config:
+  - enabled: true
+    condition:
+      active_from: "2025-01-02T00:00:00Z"
+      active_until: "2025-01-01T00:00:00Z"
+`,
+			expectedError: "log_config[0].condition: active_until '2025-01-01T00:00:00Z' must be after active_from",
+		},
+		{
+			name: "Malformed schedule",
+			config: `
+server:
+  mode: "standalone"
+  domain: "example.com"
+  unknown_route:
+    code: 200
+    cache_control: "public, max-age=3600"
+security:
+  token:
+    secret: "test_token_secret_exactly_32chars"
+    expiration: "24h"
+log_config:
+  - enabled: true
+    condition:
+      schedules: ["* 9-17 * *"]
+`,
+			expectedError: "log_config[0].condition.schedules[0]: schedule '* 9-17 * *' must have 5 fields",
+		},
+		{
+			name: "Schedule value out of range",
+			config: `
+server:
+  mode: "standalone"
+  domain: "example.com"
+  unknown_route:
+    code: 200
+    cache_control: "public, max-age=3600"
+security:
+  token:
+    secret: "test_token_secret_exactly_32chars"
+    expiration: "24h"
+log_config:
+  - enabled: true
+    condition:
+      schedules: ["* 25 * * *"]
+`,
+			expectedError: "log_config[0].condition.schedules[0]: schedule '* 25 * * *': hour: value 25 out of range 0-23",
+		},
+		{
+			name: "Unknown schedule timezone",
+			config: `
+server:
+  mode: "standalone"
+  domain: "example.com"
+  unknown_route:
+    code: 200
+    cache_control: "public, max-age=3600"
+security:
+  token:
+    secret: "test_token_secret_exactly_32chars"
+    expiration: "24h"
+log_config:
+  - enabled: true
+    condition:
+      schedules: ["* 9-17 * * *"]
+      timezone: "Mars/Olympus_Mons"
+`,
+			expectedError: "log_config[0].condition.timezone: unknown time zone 'Mars/Olympus_Mons'",
+		},
+		{
+			name: "Invalid rule id",
+			config: `
+server:
+  mode: "standalone"
+  domain: "example.com"
+  unknown_route:
+    code: 200
+    cache_control: "public, max-age=3600"
+security:
+  token:
+    secret: "test_token_secret_exactly_32chars"
+    expiration: "24h"
+log_config:
+  - id: "shop rule"
+    enabled: true
+`,
+			expectedError: "log_config[0]: invalid id 'shop rule'",
+		},
+		{
+			name: "Duplicate rule id",
+			config: `
+server:
+  mode: "standalone"
+  domain: "example.com"
+  unknown_route:
+    code: 200
+    cache_control: "public, max-age=3600"
+security:
+  token:
+    secret: "test_token_secret_exactly_32chars"
+    expiration: "24h"
+log_config:
+  - id: "shop"
+    enabled: true
+    continue: true
+  - id: "shop"
+    enabled: true
+`,
+			expectedError: "log_config[1]: duplicate id 'shop' in main config file, already used by log_config[0] in main config file",
+		},
+		{
+			name: "Country condition without geoip databases",
+			config: `
+server:
+  mode: "standalone"
+  domain: "example.com"
+security:
+  token:
+    secret: "test_token_secret_exactly_32chars"
+    expiration: "24h"
+log_config:
+  - id: "eu"
+    enabled: true
+    condition:
+      countries: ["CZ"]
+`,
+			expectedError: "log_config[eu].condition: countries and asns require geoip.databases",
+		},
+		{
+			name: "Invalid country code",
+			config: `
+server:
+  mode: "standalone"
+  domain: "example.com"
+security:
+  token:
+    secret: "test_token_secret_exactly_32chars"
+    expiration: "24h"
+geoip:
+  databases: ["/var/lib/GeoIP/GeoLite2-Country.mmdb"]
+log_config:
+  - enabled: true
+    condition:
+      countries: ["CZE"]
+`,
+			expectedError: "log_config[0].condition.countries[0]: invalid country code 'CZE'",
+		},
+		{
+			name: "Invalid geoip field",
+			config: `
+server:
+  mode: "standalone"
+  domain: "example.com"
+security:
+  token:
+    secret: "test_token_secret_exactly_32chars"
+    expiration: "24h"
+geoip:
+  databases: ["/var/lib/GeoIP/GeoLite2-City.mmdb"]
+log_config:
+  - enabled: true
+    add_log_data:
+      - name: "geo_zip"
+        source: "geoip"
+        value: "postal_code"
+`,
+			expectedError: "log_config[0].add_log_data[0]: invalid geoip field 'postal_code'",
+		},
+		{
+			name: "Geoip source without databases",
+			config: `
+server:
+  mode: "standalone"
+  domain: "example.com"
+security:
+  token:
+    secret: "test_token_secret_exactly_32chars"
+    expiration: "24h"
+log_destinations:
+  - name: "file"
+    type: "file"
+    enabled: true
+    path: "/tmp/test.log"
+    format: "json"
+    add_log_data:
+      - name: "country"
+        source: "geoip"
+        value: "country"
+`,
+			expectedError: "log_destinations[file]: source 'geoip' requires geoip.databases",
+		},
+		{
+			name: "Invalid device type",
+			config: `
+server:
+  mode: "standalone"
+  domain: "example.com"
+security:
+  token:
+    secret: "test_token_secret_exactly_32chars"
+    expiration: "24h"
+log_config:
+  - enabled: true
+    condition:
+      device_types: ["phone"]
+`,
+			expectedError: "log_config[0].condition.device_types[0]: invalid device type 'phone'",
+		},
+		{
+			name: "Invalid user_agent field",
+			config: `
+server:
+  mode: "standalone"
+  domain: "example.com"
+security:
+  token:
+    secret: "test_token_secret_exactly_32chars"
+    expiration: "24h"
+log_config:
+  - enabled: true
+    add_log_data:
+      - name: "ua"
+        source: "user_agent"
+        value: "engine"
+`,
+			expectedError: "log_config[0].add_log_data[0]: invalid user_agent field 'engine'",
+		},
+		{
+			name: "Invalid request field",
+			config: `
+server:
+  mode: "standalone"
+  domain: "example.com"
+security:
+  token:
+    secret: "test_token_secret_exactly_32chars"
+    expiration: "24h"
+log_config:
+  - enabled: true
+    add_log_data:
+      - name: "url"
+        source: "request"
+        value: "url"
+`,
+			expectedError: "log_config[0].add_log_data[0]: invalid request field 'url'",
+		},
+		{
+			name: "Env source without variable name",
+			config: `
+server:
+  mode: "standalone"
+  domain: "example.com"
+security:
+  token:
+    secret: "test_token_secret_exactly_32chars"
+    expiration: "24h"
+log_config:
+  - enabled: true
+    add_log_data:
+      - name: "deployment"
+        source: "env"
+`,
+			expectedError: "log_config[0].add_log_data[0]: value is required for source 'env'",
+		},
+		{
+			name: "Invalid template",
+			config: `
+server:
+  mode: "standalone"
+  domain: "example.com"
+security:
+  token:
+    secret: "test_token_secret_exactly_32chars"
+    expiration: "24h"
+log_config:
+  - enabled: true
+    add_log_data:
+      - name: "label"
+        source: "template"
+        value: "{{.Header.X-Env"
+`,
+			expectedError: "log_config[0].add_log_data[0]: invalid template '{{.Header.X-Env'",
+		},
+		{
+			name: "Unknown redaction detector",
+			config: `
+server:
+  mode: "standalone"
+  domain: "example.com"
+security:
+  token:
+    secret: "test_token_secret_exactly_32chars"
+    expiration: "24h"
+redaction:
+  detectors: ["ssn"]
+`,
+			expectedError: "redaction: detectors[0]: unknown detector 'ssn'",
+		},
+		{
+			name: "Redaction hash without salt",
+			config: `
+server:
+  mode: "standalone"
+  domain: "example.com"
+security:
+  token:
+    secret: "test_token_secret_exactly_32chars"
+    expiration: "24h"
+log_config:
+  - id: "shop"
+    enabled: true
+    redaction:
+      fields:
+        - path: "user.email"
+          action: "hash"
+`,
+			expectedError: "log_config[shop].redaction: hash_salt must be at least 16 characters",
+		},
+		{
+			name: "Invalid IP anonymization mode",
+			config: `
+server:
+  mode: "standalone"
+  domain: "example.com"
+security:
+  token:
+    secret: "test_token_secret_exactly_32chars"
+    expiration: "24h"
+log_destinations:
+  - name: "vendor"
+    type: "file"
+    enabled: true
+    path: "/tmp/vendor.log"
+    format: "json"
+    ip_anonymization:
+      mode: "mask"
+`,
+			expectedError: "log_destinations[vendor].ip_anonymization: invalid mode 'mask'",
+		},
+		{
+			name: "IP anonymization hash without key",
+			config: `
+server:
+  mode: "standalone"
+  domain: "example.com"
+security:
+  token:
+    secret: "test_token_secret_exactly_32chars"
+    expiration: "24h"
+log_config:
+  - id: "shop"
+    enabled: true
+    ip_anonymization:
+      mode: "hash"
+      salt_rotation: "7d"
+`,
+			expectedError: "log_config[shop].ip_anonymization: hash_key must be at least 16 characters",
+		},
+		{
+			name: "Invalid IP anonymization salt rotation",
+			config: `
+server:
+  mode: "standalone"
+  domain: "example.com"
+security:
+  token:
+    secret: "test_token_secret_exactly_32chars"
+    expiration: "24h"
+log_config:
+  - id: "shop"
+    enabled: true
+    ip_anonymization:
+      mode: "hash"
+      hash_key: "ip-hash-key-0123456789"
+      salt_rotation: "daily"
+`,
+			expectedError: "log_config[shop].ip_anonymization: invalid salt_rotation 'daily'",
+		},
+		{
+			name: "Invalid consent action",
+			config: `
+server:
+  mode: "standalone"
+  domain: "example.com"
+security:
+  token:
+    secret: "test_token_secret_exactly_32chars"
+    expiration: "24h"
+consent:
+  honor_gpc: true
+  action: "ignore"
+`,
+			expectedError: "consent.action: invalid action 'ignore'",
+		},
+		{
+			name: "Consent categories without cookie or header",
+			config: `
+server:
+  mode: "standalone"
+  domain: "example.com"
+security:
+  token:
+    secret: "test_token_secret_exactly_32chars"
+    expiration: "24h"
+consent:
+  categories: ["analytics"]
+`,
+			expectedError: "consent.categories: requires consent.cookie or consent.header",
+		},
+		{
+			name: "Consent condition without cookie or header",
+			config: `
+server:
+  mode: "standalone"
+  domain: "example.com"
+security:
+  token:
+    secret: "test_token_secret_exactly_32chars"
+    expiration: "24h"
+log_config:
+  - id: "shop"
+    enabled: true
+    condition:
+      consent:
+        analytics: false
+`,
+			expectedError: "log_config[shop].condition.consent: requires consent.cookie or consent.header",
+		},
+		{
+			name: "Invalid rule consent action",
+			config: `
+server:
+  mode: "standalone"
+  domain: "example.com"
+security:
+  token:
+    secret: "test_token_secret_exactly_32chars"
+    expiration: "24h"
+log_config:
+  - id: "shop"
+    enabled: true
+    consent_action: "block"
+`,
+			expectedError: "log_config[shop]: invalid consent_action 'block'",
+		},
+		{
+			name: "Unknown transform op",
+			config: `
+server:
+  mode: "standalone"
+  domain: "example.com"
+security:
+  token:
+    secret: "test_token_secret_exactly_32chars"
+    expiration: "24h"
+log_config:
+  - id: "shop"
+    enabled: true
+    transform:
+      - op: "rename"
+        from: "msg"
+        to: "message"
+      - op: "copy"
+`,
+			expectedError: "log_config[shop].transform[1]: unknown op 'copy'",
+		},
+		{
+			name: "Invalid transform cast type",
+			config: `
+server:
+  mode: "standalone"
+  domain: "example.com"
+security:
+  token:
+    secret: "test_token_secret_exactly_32chars"
+    expiration: "24h"
+log_destinations:
+  - name: "vendor"
+    type: "file"
+    enabled: true
+    path: "/tmp/vendor.log"
+    format: "json"
+    transform:
+      - op: "cast"
+        path: "total"
+        type: "decimal"
+`,
+			expectedError: "log_destinations[vendor].transform[0]: invalid cast type 'decimal'",
+		},
+		{
+			name: "Invalid schema format",
+			config: `
+server:
+  mode: "standalone"
+  domain: "example.com"
+security:
+  token:
+    secret: "test_token_secret_exactly_32chars"
+    expiration: "24h"
+log_destinations:
+  - name: "elastic"
+    type: "file"
+    enabled: true
+    path: "/tmp/elastic.log"
+    format: "json"
+    schema:
+      format: "splunk"
+`,
+			expectedError: "log_destinations[elastic].schema: invalid format 'splunk'",
+		},
+		{
+			name: "Schema with text format",
+			config: `
+server:
+  mode: "standalone"
+  domain: "example.com"
+security:
+  token:
+    secret: "test_token_secret_exactly_32chars"
+    expiration: "24h"
+log_destinations:
+  - name: "elastic"
+    type: "file"
+    enabled: true
+    path: "/tmp/elastic.log"
+    format: "text"
+    schema:
+      format: "ecs"
+`,
+			expectedError: "log_destinations[elastic].schema: only supported for type 'file' with format 'json'",
+		},
+		{
+			name: "Short token key secret",
+			config: `
+server:
+  mode: "standalone"
+  domain: "example.com"
+security:
+  token:
+    expiration: "24h"
+    keys:
+      - id: "2024-06"
+        secret: "too-short"
+`,
+			expectedError: "security.token.keys[2024-06].secret must be at least 32 characters long",
+		},
+		{
+			name: "Invalid token key id",
+			config: `
+server:
+  mode: "standalone"
+  domain: "example.com"
+security:
+  token:
+    expiration: "24h"
+    keys:
+      - id: "2024:06"
+        secret: "new_token_secret_exactly_32chars"
+`,
+			expectedError: "security.token.keys[0]: invalid id '2024:06'",
+		},
+		{
+			name: "Token key id reserved for secret",
+			config: `
+server:
+  mode: "standalone"
+  domain: "example.com"
+security:
+  token:
+    expiration: "24h"
+    secret: "test_token_secret_exactly_32chars"
+    keys:
+      - id: "default"
+        secret: "new_token_secret_exactly_32chars"
+`,
+			expectedError: "security.token.keys[default]: id 'default' is reserved for security.token.secret",
+		},
+		{
+			name: "Duplicate token key id",
+			config: `
+server:
+  mode: "standalone"
+  domain: "example.com"
+security:
+  token:
+    expiration: "24h"
+    keys:
+      - id: "2024-06"
+        secret: "new_token_secret_exactly_32chars"
+      - id: "2024-06"
+        secret: "new_token_secret_exactly_32chars"
+`,
+			expectedError: "security.token.keys[2024-06]: duplicate id",
+		},
+		{
+			name: "Unknown active token key",
+			config: `
+server:
+  mode: "standalone"
+  domain: "example.com"
+security:
+  token:
+    expiration: "24h"
+    active_key: "2025-01"
+    keys:
+      - id: "2024-06"
+        secret: "new_token_secret_exactly_32chars"
+`,
+			expectedError: "security.token.active_key '2025-01' does not exist",
+		},
+		{
+			name: "Retired active token key",
+			config: `
+server:
+  mode: "standalone"
+  domain: "example.com"
+security:
+  token:
+    expiration: "24h"
+    keys:
+      - id: "2024-06"
+        secret: "new_token_secret_exactly_32chars"
+        retired: true
+`,
+			expectedError: "security.token.active_key '2024-06' is retired",
+		},
+		{
+			name: "Invalid site policy site_id",
+			config: `
+server:
+  mode: "standalone"
+  domain: "example.com"
+security:
+  token:
+    secret: "test_token_secret_exactly_32chars"
+    expiration: "24h"
+  sites:
+    "shop.example":
+      expiration: "1h"
+`,
+			expectedError: "security.sites[shop.example]: invalid site_id",
+		},
+		{
+			name: "Short site policy secret",
+			config: `
+server:
+  mode: "standalone"
+  domain: "example.com"
+security:
+  token:
+    secret: "test_token_secret_exactly_32chars"
+    expiration: "24h"
+  sites:
+    shop:
+      secret: "too-short"
+`,
+			expectedError: "security.sites[shop].secret must be at least 32 characters long",
+		},
+		{
+			name: "Invalid site policy expiration",
+			config: `
+server:
+  mode: "standalone"
+  domain: "example.com"
+security:
+  token:
+    secret: "test_token_secret_exactly_32chars"
+    expiration: "24h"
+  sites:
+    shop:
+      expiration: "soon"
+`,
+			expectedError: "invalid security.sites[shop].expiration",
+		},
+		{
+			name: "Invalid site policy gtm_id",
+			config: `
+server:
+  mode: "standalone"
+  domain: "example.com"
+security:
+  token:
+    secret: "test_token_secret_exactly_32chars"
+    expiration: "24h"
+  sites:
+    shop:
+      allowed_gtm_ids: ["GTM OK"]
+`,
+			expectedError: "security.sites[shop].allowed_gtm_ids[0]: invalid gtm_id 'GTM OK'",
+		},
+		{
+			name: "Site policy active_key without keys",
+			config: `
+server:
+  mode: "standalone"
+  domain: "example.com"
+security:
+  token:
+    secret: "test_token_secret_exactly_32chars"
+    expiration: "24h"
+  sites:
+    shop:
+      active_key: "2024-06"
+`,
+			expectedError: "security.sites[shop]: active_key and accept_legacy_tokens require secret or keys",
+		},
+		{
+			name: "Negative token rate limit attempts",
+			config: `
+server:
+  mode: "standalone"
+  domain: "example.com"
+security:
+  token:
+    secret: "test_token_secret_exactly_32chars"
+    expiration: "24h"
+  token_rate_limit:
+    max_attempts: -1
+`,
+			expectedError: "security.token_rate_limit.max_attempts cannot be negative",
+		},
+		{
+			name: "Invalid token rate limit block duration",
+			config: `
+server:
+  mode: "standalone"
+  domain: "example.com"
+security:
+  token:
+    secret: "test_token_secret_exactly_32chars"
+    expiration: "24h"
+  token_rate_limit:
+    max_attempts: 10
+    block_duration: "0s"
+`,
+			expectedError: "invalid security.token_rate_limit.block_duration '0s'",
+		},
+		{
+			name: "Token rate limit max block shorter than block",
+			config: `
+server:
+  mode: "standalone"
+  domain: "example.com"
+security:
+  token:
+    secret: "test_token_secret_exactly_32chars"
+    expiration: "24h"
+  token_rate_limit:
+    max_attempts: 10
+    block_duration: "10m"
+    max_block_duration: "5m"
+`,
+			expectedError: "invalid security.token_rate_limit.max_block_duration '5m'",
+		},
+		{
+			name: "TLS without certificate",
+			config: `
+server:
+  mode: "standalone"
+  domain: "example.com"
+  tls:
+    enabled: true
+    key_file: "server.key"
+security:
+  token:
+    secret: "test_token_secret_exactly_32chars"
+    expiration: "24h"
+`,
+			expectedError: "server.tls.cert_file and server.tls.key_file are required",
+		},
+		{
+			name: "Invalid TLS min version",
+			config: `
+server:
+  mode: "standalone"
+  domain: "example.com"
+  tls:
+    enabled: true
+    cert_file: "server.crt"
+    key_file: "server.key"
+    min_version: "1.1"
+security:
+  token:
+    secret: "test_token_secret_exactly_32chars"
+    expiration: "24h"
+`,
+			expectedError: "server.tls.min_version: unsupported TLS version '1.1'",
+		},
+		{
+			name: "Insecure TLS cipher suite",
+			config: `
+server:
+  mode: "standalone"
+  domain: "example.com"
+  tls:
+    enabled: true
+    cert_file: "server.crt"
+    key_file: "server.key"
+    cipher_suites: ["TLS_RSA_WITH_RC4_128_SHA"]
+security:
+  token:
+    secret: "test_token_secret_exactly_32chars"
+    expiration: "24h"
+`,
+			expectedError: "server.tls.cipher_suites: unknown or insecure cipher suite",
+		},
+		{
+			name: "TLS cipher suites without HTTP/2 suite",
+			config: `
+server:
+  mode: "standalone"
+  domain: "example.com"
+  tls:
+    enabled: true
+    cert_file: "server.crt"
+    key_file: "server.key"
+    cipher_suites: ["TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384"]
+security:
+  token:
+    secret: "test_token_secret_exactly_32chars"
+    expiration: "24h"
+`,
+			expectedError: "server.tls.cipher_suites: HTTP/2 requires TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256",
+		},
+		{
+			name: "Missing TLS certificate file",
+			config: `
+server:
+  mode: "standalone"
+  domain: "example.com"
+  tls:
+    enabled: true
+    cert_file: "missing.crt"
+    key_file: "missing.key"
+security:
+  token:
+    secret: "test_token_secret_exactly_32chars"
+    expiration: "24h"
+`,
+			expectedError: "server.tls: failed to read TLS file",
+		},
+		{
+			name: "Invalid listener network",
+			config: `
+server:
+  mode: "standalone"
+  domain: "example.com"
+  listeners:
+    - network: "udp"
+      address: "127.0.0.1:8080"
+security:
+  token:
+    secret: "test_token_secret_exactly_32chars"
+    expiration: "24h"
+`,
+			expectedError: "server.listeners[0]: invalid network 'udp'",
+		},
+		{
+			name: "Invalid listener address",
+			config: `
+server:
+  mode: "standalone"
+  domain: "example.com"
+  listeners:
+    - address: "127.0.0.1"
+security:
+  token:
+    secret: "test_token_secret_exactly_32chars"
+    expiration: "24h"
+`,
+			expectedError: "server.listeners[0]: invalid address '127.0.0.1'",
+		},
+		{
+			name: "Invalid listener socket mode",
+			config: `
+server:
+  mode: "standalone"
+  domain: "example.com"
+  listeners:
+    - network: "unix"
+      address: "/run/weblogproxy.sock"
+      socket_mode: "rw-rw----"
+security:
+  token:
+    secret: "test_token_secret_exactly_32chars"
+    expiration: "24h"
+`,
+			expectedError: "server.listeners[0]: invalid socket_mode 'rw-rw----'",
+		},
+		{
+			name: "Listener admin on tcp",
+			config: `
+server:
+  mode: "standalone"
+  domain: "example.com"
+  listeners:
+    - address: "127.0.0.1:8081"
+      admin: true
+security:
+  token:
+    secret: "test_token_secret_exactly_32chars"
+    expiration: "24h"
+`,
+			expectedError: "server.listeners[0]: admin is only supported for network 'unix'",
+		},
+		{
+			name: "Listener PROXY protocol without trusted proxies",
+			config: `
+server:
+  mode: "standalone"
+  domain: "example.com"
+  trusted_proxies: []
+  listeners:
+    - address: "127.0.0.1:8080"
+      proxy_protocol: true
+security:
+  token:
+    secret: "test_token_secret_exactly_32chars"
+    expiration: "24h"
+`,
+			expectedError: "server.listeners[0]: proxy_protocol requires server.trusted_proxies",
+		},
+		{
+			name: "PROXY protocol without trusted proxies",
+			config: `
+server:
+  mode: "standalone"
+  domain: "example.com"
+  trusted_proxies: []
+  proxy_protocol: true
+security:
+  token:
+    secret: "test_token_secret_exactly_32chars"
+    expiration: "24h"
+`,
+			expectedError: "server.proxy_protocol requires server.trusted_proxies",
+		},
+		{
+			name: "Duplicate listener",
+			config: `
+server:
+  mode: "standalone"
+  domain: "example.com"
+  listeners:
+    - address: "127.0.0.1:8080"
+    - network: "tcp"
+      address: "127.0.0.1:8080"
+security:
+  token:
+    secret: "test_token_secret_exactly_32chars"
+    expiration: "24h"
+`,
+			expectedError: "server.listeners[1]: duplicate tcp address '127.0.0.1:8080'",
+		},
+		{
+			name: "Invalid token refresh grace period",
+			config: `
+server:
+  mode: "standalone"
+  domain: "example.com"
+security:
+  token:
+    secret: "test_token_secret_exactly_32chars"
+    expiration: "24h"
+  token_refresh:
+    enabled: true
+    grace_period: "-1h"
+`,
+			expectedError: "invalid security.token_refresh.grace_period '-1h'",
+		},
+		{
+			name: "Invalid replay protection window",
+			config: `
+server:
+  mode: "standalone"
+  domain: "example.com"
+security:
+  token:
+    secret: "test_token_secret_exactly_32chars"
+    expiration: "24h"
+  replay_protection:
+    enabled: true
+    window: "soon"
+`,
+			expectedError: "invalid security.replay_protection.window 'soon'",
+		},
+		{
+			name: "Replay protection without entries",
+			config: `
+server:
+  mode: "standalone"
+  domain: "example.com"
+security:
+  token:
+    secret: "test_token_secret_exactly_32chars"
+    expiration: "24h"
+  replay_protection:
+    enabled: true
+    max_entries: 0
+`,
+			expectedError: "security.replay_protection.max_entries must be positive",
+		},
+		{
+			name: "Invalid payload schema keyword",
+			config: `
+server:
+  mode: "standalone"
+  domain: "example.com"
+security:
+  token:
+    secret: "test_token_secret_exactly_32chars"
+    expiration: "24h"
+payload_schemas:
+  shop:
+    schema:
+      properties:
+        event:
+          typ: "string"
+`,
+			expectedError: "payload_schemas[shop]: invalid schema: #/properties/event/typ: unsupported keyword",
+		},
+		{
+			name: "Missing payload schema file",
+			config: `
+server:
+  mode: "standalone"
+  domain: "example.com"
+security:
+  token:
+    secret: "test_token_secret_exactly_32chars"
+    expiration: "24h"
+log_config:
+  - id: "shop"
+    enabled: true
+    payload_schema:
+      file: "missing.json"
+`,
+			expectedError: "log_config[shop].payload_schema: open ",
+		},
+		{
+			name: "Unknown payload schema quarantine destination",
+			config: `
+server:
+  mode: "standalone"
+  domain: "example.com"
+security:
+  token:
+    secret: "test_token_secret_exactly_32chars"
+    expiration: "24h"
+payload_schemas:
+  shop:
+    on_error: "quarantine"
+    quarantine_destination: "nowhere"
+    schema:
+      type: "object"
+`,
+			expectedError: "payload_schemas[shop]: quarantine_destination 'nowhere' does not exist",
+		},
 	}
 
 	for _, tc := range testCases {
@@ -689,6 +1789,21 @@ log_config:
 }
 
 // Added: Tests for ParseDuration
+func TestParseNonNegativeDuration(t *testing.T) {
+	for _, zero := range []string{"0", "0s", " 0m ", "0d"} {
+		d, err := ParseNonNegativeDuration(zero)
+		assert.NoError(t, err, zero)
+		assert.Zero(t, d, zero)
+	}
+	d, err := ParseNonNegativeDuration("2d")
+	assert.NoError(t, err)
+	assert.Equal(t, 48*time.Hour, d)
+	for _, invalid := range []string{"", "-5m", "10minutes"} {
+		_, err := ParseNonNegativeDuration(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
 func TestParseDuration(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -1022,3 +2137,349 @@ security:
 		})
 	}
 }
+
+func TestValidateConfig_TimeConditions(t *testing.T) {
+	content := `
+server:
+  mode: "standalone"
+  domain: "example.com"
+security:
+  token:
+    secret: "test_token_secret_exactly_32chars"
+    expiration: "24h"
+log_config:
+  - enabled: true
+    condition:
+      site_id: "incident-site"
+      active_from: "2025-01-01T08:00:00Z"
+      active_until: "2025-01-01T18:00:00+01:00"
+  - enabled: true
+    condition:
+      schedules: ["*/5 9-17 * * mon-fri", "0 12 1 jan *"]
+      timezone: "Europe/Prague"
+`
+	// An expired window is only a warning and must not fail validation
+	cfg, err := LoadConfig(createTempConfigFile(t, content))
+	require.NoError(t, err)
+	assert.Equal(t, "2025-01-01T18:00:00+01:00", cfg.LogConfig[0].Condition.ActiveUntil)
+	assert.Equal(t, []string{"*/5 9-17 * * mon-fri", "0 12 1 jan *"}, cfg.LogConfig[1].Condition.Schedules)
+	assert.Equal(t, "Europe/Prague", cfg.LogConfig[1].Condition.Timezone)
+
+	// Warnings are collected instead of printed, validating again does not repeat them
+	expected := []string{"log_config[0].condition.active_until '2025-01-01T18:00:00+01:00' is in the past, the rule will never match."}
+	assert.Equal(t, expected, cfg.Warnings)
+	require.NoError(t, ValidateConfig(cfg))
+	assert.Equal(t, expected, cfg.Warnings)
+}
+
+func TestLoadConfig_EnvSource(t *testing.T) {
+	t.Setenv("WEBLOGPROXY_TEST_DEPLOYMENT", "blue")
+	content := `
+server:
+  mode: "standalone"
+  domain: "example.com"
+security:
+  token:
+    secret: "test_token_secret_exactly_32chars"
+    expiration: "24h"
+log_destinations:
+  - name: "file"
+    type: "file"
+    enabled: true
+    path: "/tmp/test.log"
+    format: "json"
+    add_log_data:
+      - name: "deployment"
+        source: "env"
+        value: "WEBLOGPROXY_TEST_DEPLOYMENT"
+log_config:
+  - enabled: true
+    add_log_data:
+      - name: "region"
+        source: "env"
+        value: "WEBLOGPROXY_TEST_UNSET"
+`
+	cfg, err := LoadConfig(createTempConfigFile(t, content))
+	require.NoError(t, err)
+	assert.Equal(t, "blue", cfg.LogDestinations[0].AddLogData[0].EnvValue)
+	assert.Equal(t, "", cfg.LogConfig[0].AddLogData[0].EnvValue)
+}
+
+func TestLoadConfig_TemplateSource(t *testing.T) {
+	content := `
+server:
+  mode: "standalone"
+  domain: "example.com"
+security:
+  token:
+    secret: "test_token_secret_exactly_32chars"
+    expiration: "24h"
+log_config:
+  - enabled: true
+    add_log_data:
+      - name: "label"
+        source: "template"
+        value: "{{.Header.X-Env}}-{{.Data.page.section}}"
+`
+	cfg, err := LoadConfig(createTempConfigFile(t, content))
+	require.NoError(t, err)
+	require.NotNil(t, cfg.LogConfig[0].AddLogData[0].Template, "template must be compiled at load time")
+	assert.Equal(t, "{{.Header.X-Env}}-{{.Data.page.section}}", cfg.LogConfig[0].AddLogData[0].Template.String())
+}
+
+func TestIPFields(t *testing.T) {
+	specs := []AddLogDataSpec{
+		{Name: "visitor_ip", Source: "client_ip"},
+		{Name: "forwarded_for", Source: "header", Value: "x-forwarded-for"},
+		{Name: "cdn_ip", Source: "header", Value: "X-Origin-IP"},
+		{Name: "referer", Source: "header", Value: "Referer"},
+		{Name: "env", Source: "static", Value: "prod"},
+		{Name: "visitor", Source: "template", Value: "{{.ClientIP}}/{{.Header.User-Agent}}"},
+		{Name: "cdn_chain", Source: "template", Value: "{{.Header.X-Origin-IP}}"},
+		{Name: "page", Source: "template", Value: "{{.Data.page}}"},
+	}
+	for i := range specs {
+		if specs[i].Source == "template" {
+			tmpl, err := logtemplate.Compile(specs[i].Value)
+			require.NoError(t, err)
+			specs[i].Template = tmpl
+		}
+	}
+	assert.Equal(t, []string{"client_ip", "raw_ip", "visitor_ip", "forwarded_for", "cdn_ip", "visitor", "cdn_chain"},
+		ipFields([]string{"raw_ip"}, specs, "x-origin-ip"))
+	assert.Equal(t, []string{"client_ip", "visitor_ip", "forwarded_for", "visitor"}, ipFields(nil, specs, ""))
+}
+
+func TestLoadConfig_PayloadSchemaFile(t *testing.T) {
+	content := `
+server:
+  mode: "standalone"
+  domain: "example.com"
+security:
+  token:
+    secret: "test_token_secret_exactly_32chars"
+    expiration: "24h"
+payload_schemas:
+  shop:
+    file: "schemas/shop.json"
+`
+	configFile := createTempConfigFile(t, content)
+	schemaDir := filepath.Join(filepath.Dir(configFile), "schemas")
+	require.NoError(t, os.Mkdir(schemaDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(schemaDir, "shop.json"), []byte(`{"required": ["event"]}`), 0644))
+
+	cfg, err := LoadConfig(configFile)
+	require.NoError(t, err)
+	schema := cfg.PayloadSchemas["shop"]
+	assert.Equal(t, filepath.Join(schemaDir, "shop.json"), schema.File)
+	assert.Equal(t, PayloadSchemaAnnotate, schema.OnError)
+	assert.Nil(t, schema.Validate(map[string]interface{}{"event": "view"}))
+	assert.Equal(t, []string{"/: missing required property 'event'"}, schema.Validate(map[string]interface{}{}))
+}
+
+func TestLoadConfig_TokenKeys(t *testing.T) {
+	content := `
+server:
+  mode: "standalone"
+  domain: "example.com"
+security:
+  token:
+    secret: "test_token_secret_exactly_32chars"
+    expiration: "24h"
+    keys:
+      - id: "2024-06"
+        secret: "new_token_secret_exactly_32chars"
+      - id: "2024-01"
+        secret: "old_token_secret_exactly_32chars"
+        retired: true
+`
+	cfg, err := LoadConfig(createTempConfigFile(t, content))
+	require.NoError(t, err)
+	assert.Equal(t, "2024-06", cfg.Security.Token.ActiveKey)
+	keyring := cfg.TokenKeyring()
+	assert.Equal(t, "2024-06", keyring.ActiveKeyID())
+
+	// The single secret stays valid for legacy tokens and as key "default"
+	legacy, err := security.GenerateToken("test_token_secret_exactly_32chars", "site", "", time.Hour)
+	require.NoError(t, err)
+	valid, _ := keyring.Validate("site", "", legacy)
+	assert.True(t, valid)
+
+	retired, err := security.NewKeyring([]security.Key{{ID: "2024-01", Secret: "old_token_secret_exactly_32chars"}}, "2024-01", true)
+	require.NoError(t, err)
+	token, err := retired.Generate("site", "", time.Hour)
+	require.NoError(t, err)
+	valid, _ = keyring.Validate("site", "", token)
+	assert.False(t, valid)
+}
+
+func TestLoadConfig_TokenKeySecretRedacted(t *testing.T) {
+	content := `
+server:
+  mode: "standalone"
+  domain: "example.com"
+security:
+  token:
+    expiration: "24h"
+    keys:
+      - id: "2024-06"
+        secret: "new_token_secret_exactly_32chars"
+    active_key: "new_token_secret_exactly_32chars"
+`
+	_, err := LoadConfig(createTempConfigFile(t, content))
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "new_token_secret_exactly_32chars")
+	assert.Contains(t, err.Error(), "security.token.active_key '[REDACTED]' does not exist")
+}
+
+func TestLoadConfig_SiteTokenPolicies(t *testing.T) {
+	content := `
+server:
+  mode: "standalone"
+  domain: "example.com"
+security:
+  token:
+    secret: "test_token_secret_exactly_32chars"
+    expiration: "24h"
+    binding:
+      ip: true
+  sites:
+    shop:
+      binding:
+        origin: true
+      keys:
+        - id: "shop-1"
+          secret: "shop_token_secret_exactly_32char"
+      expiration: "15m"
+      allowed_gtm_ids: ["GTM-SHOP"]
+    blog:
+      allowed_gtm_ids: ["GTM-BLOG"]
+`
+	cfg, err := LoadConfig(createTempConfigFile(t, content))
+	require.NoError(t, err)
+	policies := cfg.TokenPolicies()
+
+	shop := policies.Lookup("shop")
+	assert.Equal(t, "shop-1", shop.Keyring.ActiveKeyID())
+	assert.Equal(t, 15*time.Minute, shop.Expiration)
+	assert.Equal(t, []string{"GTM-SHOP"}, shop.AllowedGtmIDs)
+	assert.Equal(t, &security.Binding{Origin: true}, shop.Binding)
+
+	blog := policies.Lookup("blog")
+	assert.Same(t, cfg.TokenKeyring(), blog.Keyring)
+	assert.Zero(t, blog.Expiration, "Sites without expiration use security.token.expiration")
+	assert.Equal(t, &security.Binding{IP: true}, blog.Binding)
+	assert.True(t, blog.AllowsGtmID("GTM-BLOG"))
+	assert.False(t, blog.AllowsGtmID("GTM-SHOP"))
+
+	other := policies.Lookup("other")
+	assert.Same(t, cfg.TokenKeyring(), other.Keyring)
+	assert.True(t, other.AllowsGtmID("GTM-SHOP"))
+}
+
+func TestLoadConfig_ReplayProtectionWindow(t *testing.T) {
+	content := `
+server:
+  mode: "standalone"
+  domain: "example.com"
+security:
+  token:
+    secret: "test_token_secret_exactly_32chars"
+    expiration: "1h"
+  sites:
+    shop:
+      expiration: "48h"
+  replay_protection:
+    enabled: true
+`
+	cfg, err := LoadConfig(createTempConfigFile(t, content))
+	require.NoError(t, err)
+	assert.Equal(t, "48h", cfg.Security.ReplayProtection.Window, "Window defaults to the longest token expiration")
+	assert.Equal(t, 100000, cfg.Security.ReplayProtection.MaxEntries)
+}
+
+// writeTestCertificate writes a self-signed certificate and its key to dir and returns their paths.
+func writeTestCertificate(t *testing.T, dir string) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"example.com"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	certFile, keyFile := filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	return certFile, keyFile
+}
+
+func TestLoadConfig_TLSReloadIntervalZero(t *testing.T) {
+	certFile, keyFile := writeTestCertificate(t, t.TempDir())
+	cfg, err := LoadConfig(createTempConfigFile(t, `
+server:
+  mode: "standalone"
+  domain: "example.com"
+  tls:
+    enabled: true
+    cert_file: "`+certFile+`"
+    key_file: "`+keyFile+`"
+    reload_interval: "0s"
+security:
+  token:
+    secret: "test_token_secret_exactly_32chars"
+    expiration: "24h"
+`))
+	require.NoError(t, err, "0s disables reloading")
+	assert.Equal(t, "0s", cfg.Server.TLS.ReloadInterval)
+}
+
+func TestLoadConfig_Listeners(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte(`
+server:
+  mode: "standalone"
+  domain: "example.com"
+  trusted_proxies: ["10.0.0.0/8"]
+  proxy_protocol: true
+security:
+  token:
+    secret: "test_token_secret_exactly_32chars"
+    expiration: "24h"
+`), 0600))
+	cfg, err := LoadConfig(configPath)
+	require.NoError(t, err)
+	assert.Equal(t, []ListenerConfig{{Network: "tcp", Address: "0.0.0.0:8080", ProxyProtocol: true}}, cfg.ServerListeners())
+
+	require.NoError(t, os.WriteFile(configPath, []byte(`
+server:
+  mode: "standalone"
+  domain: "example.com"
+  listeners:
+    - address: "[::1]:8080"
+    - network: "unix"
+      address: "/run/weblogproxy.sock"
+      socket_mode: "0660"
+      admin: true
+security:
+  token:
+    secret: "test_token_secret_exactly_32chars"
+    expiration: "24h"
+`), 0600))
+	cfg, err = LoadConfig(configPath)
+	require.NoError(t, err)
+	listeners := cfg.ServerListeners()
+	require.Len(t, listeners, 2)
+	assert.Equal(t, "tcp", listeners[0].Network)
+	mode, err := listeners[1].FileMode()
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0660), mode)
+	assert.True(t, listeners[1].Admin)
+}
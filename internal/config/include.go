@@ -0,0 +1,178 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// configFragment is a rule file from the include directory. It may contain only rules,
+// destinations and a priority.
+type configFragment struct {
+	Priority        int              `yaml:"priority"` // Lower priority rules are evaluated first, the main file has priority 0
+	LogDestinations []LogDestination `yaml:"log_destinations"`
+	LogConfig       []LogRule        `yaml:"log_config"`
+}
+
+// IncludeDirPath returns the include directory of the configuration, resolved relative to the
+// directory of the main config file. Returns an empty string if no include directory is configured.
+func IncludeDirPath(cfg *Config, configPath string) string {
+	if cfg.IncludeDir == "" {
+		return ""
+	}
+	if filepath.IsAbs(cfg.IncludeDir) {
+		return cfg.IncludeDir
+	}
+	return filepath.Join(filepath.Dir(configPath), cfg.IncludeDir)
+}
+
+// includeFiles lists the *.yaml files of the include directory sorted by file name.
+func includeFiles(dir string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// loadIncludeDir merges rules and destinations from the include directory into the configuration.
+// Rule files are ordered by priority and then by file name, the main config file has priority 0
+// and comes first among files with the same priority.
+func loadIncludeDir(cfg *Config, configPath string) error {
+	dir := IncludeDirPath(cfg, configPath)
+	if dir == "" {
+		return nil
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("include_dir: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("include_dir: '%s' is not a directory", dir)
+	}
+
+	files, err := includeFiles(dir)
+	if err != nil {
+		return fmt.Errorf("include_dir: %w", err)
+	}
+
+	fragments := []configFragment{{LogDestinations: cfg.LogDestinations, LogConfig: cfg.LogConfig}}
+	for _, file := range files {
+		fragment, err := loadFragment(file)
+		if err != nil {
+			return err
+		}
+		fragments = append(fragments, fragment)
+	}
+	sort.SliceStable(fragments, func(i, j int) bool {
+		return fragments[i].Priority < fragments[j].Priority
+	})
+
+	cfg.LogDestinations = nil
+	cfg.LogConfig = nil
+	for _, fragment := range fragments {
+		cfg.LogDestinations = append(cfg.LogDestinations, fragment.LogDestinations...)
+		cfg.LogConfig = append(cfg.LogConfig, fragment.LogConfig...)
+	}
+	return nil
+}
+
+// loadFragment reads a rule file from the include directory. Unknown keys are rejected so
+// that server or security settings cannot be overridden by a rule file.
+func loadFragment(path string) (configFragment, error) {
+	var fragment configFragment
+
+	data, err := os.ReadFile(path) // #nosec G304 -- Files come from the include directory configured by the operator.
+	if err != nil {
+		return fragment, fmt.Errorf("failed to read include file %s: %w", path, err)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&fragment); err != nil && !errors.Is(err, io.EOF) {
+		return fragment, fmt.Errorf("error parsing include file '%s': %w", path, err)
+	}
+
+	name := filepath.Base(path)
+	for i := range fragment.LogConfig {
+		fragment.LogConfig[i].SourceFile = name
+		fragment.LogConfig[i].SourceIndex = i
+	}
+	return fragment, nil
+}
+
+// SourceModTime returns the latest modification time of the main config file, the include
+// directory and its rule files. Used to detect configuration changes for reload.
+func SourceModTime(cfg *Config, configPath string) time.Time {
+	var latest time.Time
+	track := func(path string) {
+		if info, err := os.Stat(path); err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+
+	track(configPath)
+	if dir := IncludeDirPath(cfg, configPath); dir != "" {
+		track(dir) // Changes when files are added or removed
+		files, _ := includeFiles(dir)
+		for _, file := range files {
+			track(file)
+		}
+	}
+	return latest
+}
+
+// RestartRequired returns the top-level sections (e.g. "server") that differ between the running
+// and a reloaded configuration. The config reload only applies the rules (log_config, include_dir)
+// and the list of GeoIP databases, changes of any other section require a restart.
+func RestartRequired(running, reloaded *Config) ([]string, error) {
+	before, err := restartSections(running)
+	if err != nil {
+		return nil, err
+	}
+	after, err := restartSections(reloaded)
+	if err != nil {
+		return nil, err
+	}
+	var changed []string
+	for name, value := range after {
+		if !reflect.DeepEqual(before[name], value) {
+			changed = append(changed, name)
+		}
+	}
+	for name := range before {
+		if _, ok := after[name]; !ok {
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+	return changed, nil
+}
+
+// restartSections returns the top-level sections of the configuration without the settings
+// applied by the config reload.
+func restartSections(cfg *Config) (map[string]interface{}, error) {
+	c := *cfg
+	c.LogConfig = nil
+	c.IncludeDir = ""
+	c.GeoIP.Databases = nil
+	data, err := yaml.Marshal(&c)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compare configurations: %w", err)
+	}
+	var sections map[string]interface{}
+	if err := yaml.Unmarshal(data, &sections); err != nil {
+		return nil, fmt.Errorf("failed to compare configurations: %w", err)
+	}
+	return sections, nil
+}
@@ -0,0 +1,201 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const includeMainConfig = `
+server:
+  mode: "standalone"
+  domain: "example.com"
+security:
+  token:
+    secret: "test_token_secret_exactly_32chars"
+    expiration: "24h"
+include_dir: "conf.d"
+log_destinations:
+  - name: "main_file"
+    type: "file"
+    enabled: true
+    path: "/tmp/main.log"
+    format: "json"
+log_config:
+  - id: "main"
+    condition:
+      site_id: "main"
+    enabled: true
+`
+
+// writeIncludeConfig creates the main config file and the given files in its conf.d directory.
+func writeIncludeConfig(t *testing.T, main string, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "conf.d"), 0755))
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "conf.d", name), []byte(content), 0644))
+	}
+	path := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(main), 0644))
+	return path
+}
+
+func TestLoadConfig_IncludeDir(t *testing.T) {
+	path := writeIncludeConfig(t, includeMainConfig, map[string]string{
+		"b-shop.yaml": `
+priority: 10
+log_config:
+  - id: "shop"
+    description: "Shop team rules"
+    condition:
+      site_id: "shop"
+    enabled: true
+    log_destinations: ["shop_file"]
+log_destinations:
+  - name: "shop_file"
+    type: "file"
+    enabled: true
+    path: "/tmp/shop.log"
+    format: "json"
+`,
+		"a-blog.yaml": `
+priority: 10
+log_config:
+  - condition:
+      site_id: "blog"
+    enabled: true
+`,
+		"z-defaults.yaml": `
+priority: -5
+log_config:
+  - condition: {}
+    enabled: true
+    continue: true
+`,
+		"empty.yaml": ``,
+		"notes.txt":  `not a rule file`,
+	})
+
+	cfg, err := LoadConfig(path)
+	require.NoError(t, err)
+
+	var paths []string
+	for i, rule := range cfg.LogConfig {
+		paths = append(paths, rule.Path(i))
+	}
+	assert.Equal(t, []string{
+		"log_config[z-defaults.yaml#0]", // priority -5
+		"log_config[main]",              // main config file, priority 0
+		"log_config[a-blog.yaml#0]",     // priority 10, sorted by file name
+		"log_config[shop]",
+	}, paths)
+	assert.Equal(t, "Shop team rules", cfg.LogConfig[3].Description)
+	assert.Equal(t, "b-shop.yaml", cfg.LogConfig[3].SourceFile)
+
+	require.Len(t, cfg.LogDestinations, 2)
+	assert.Equal(t, "main_file", cfg.LogDestinations[0].Name)
+	assert.Equal(t, "shop_file", cfg.LogDestinations[1].Name)
+}
+
+func TestLoadConfig_IncludeDirErrors(t *testing.T) {
+	t.Run("missing directory", func(t *testing.T) {
+		_, err := LoadConfig(createTempConfigFile(t, includeMainConfig))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "include_dir")
+	})
+
+	t.Run("unknown keys are rejected", func(t *testing.T) {
+		path := writeIncludeConfig(t, includeMainConfig, map[string]string{
+			"shop.yaml": "security:\n  token:\n    secret: \"override_override_override_override\"\n",
+		})
+		_, err := LoadConfig(path)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "error parsing include file")
+		assert.Contains(t, err.Error(), "shop.yaml")
+	})
+
+	t.Run("errors reference the include file", func(t *testing.T) {
+		path := writeIncludeConfig(t, includeMainConfig, map[string]string{
+			"shop.yaml": `
+log_config:
+  - condition:
+      site_id: "shop"
+    enabled: true
+    log_destinations: ["missing"]
+`,
+		})
+		_, err := LoadConfig(path)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "log_config[shop.yaml#0]: specified log_destination 'missing' not found")
+	})
+
+	t.Run("duplicate id across files", func(t *testing.T) {
+		path := writeIncludeConfig(t, includeMainConfig, map[string]string{
+			"shop.yaml": `
+log_config:
+  - id: "main"
+    enabled: true
+`,
+		})
+		_, err := LoadConfig(path)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "log_config[1]: duplicate id 'main' in include file 'shop.yaml', already used by log_config[0] in main config file")
+	})
+}
+
+func TestSourceModTime(t *testing.T) {
+	path := writeIncludeConfig(t, includeMainConfig, map[string]string{"shop.yaml": "log_config: []\n"})
+	cfg, err := LoadConfig(path)
+	require.NoError(t, err)
+
+	old := time.Now().Add(-time.Hour)
+	newer := time.Now().Add(-time.Minute)
+	dir := filepath.Dir(path)
+	for _, p := range []string{path, filepath.Join(dir, "conf.d"), filepath.Join(dir, "conf.d", "shop.yaml")} {
+		require.NoError(t, os.Chtimes(p, old, old))
+	}
+	assert.True(t, SourceModTime(cfg, path).Equal(old))
+
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "conf.d", "shop.yaml"), newer, newer))
+	assert.True(t, SourceModTime(cfg, path).Equal(newer))
+}
+
+func TestRestartRequired(t *testing.T) {
+	path := writeIncludeConfig(t, includeMainConfig, map[string]string{"shop.yaml": "log_config: []\n"})
+	running, err := LoadConfig(path)
+	require.NoError(t, err)
+
+	reload := func(main string, files map[string]string) []string {
+		t.Helper()
+		cfg, err := LoadConfig(writeIncludeConfig(t, main, files))
+		require.NoError(t, err)
+		changed, err := RestartRequired(running, cfg)
+		require.NoError(t, err)
+		return changed
+	}
+
+	// Same configuration loaded from another directory
+	assert.Empty(t, reload(includeMainConfig, map[string]string{"shop.yaml": "log_config: []\n"}))
+
+	// Rules are applied by the reload
+	rules := map[string]string{"shop.yaml": `
+log_config:
+  - id: "shop"
+    condition:
+      site_id: "shop"
+    enabled: true
+`}
+	assert.Empty(t, reload(strings.Replace(includeMainConfig, `site_id: "main"`, `site_id: "other"`, 1), rules))
+
+	// Destinations and server settings require a restart
+	assert.Equal(t, []string{"log_destinations", "server"}, reload(strings.NewReplacer(
+		`/tmp/main.log`, `/tmp/other.log`,
+		`domain: "example.com"`, `domain: "example.org"`,
+	).Replace(includeMainConfig), nil))
+}
@@ -0,0 +1,118 @@
+// internal/consent/consent.go
+
+// Package consent reads privacy signals (Global Privacy Control, Do Not Track and consent
+// categories from a cookie or header) from requests.
+package consent
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Actions taken when consent is denied.
+const (
+	ActionDrop      = "drop"      // Do not log the record, logger.js returns a no-op script
+	ActionStrip     = "strip"     // Log the record without identifying fields
+	ActionAnonymize = "anonymize" // Log the record with truncated IP addresses and without cookie values
+)
+
+// Actions lists the supported actions, from the weakest to the strongest.
+var Actions = []string{ActionAnonymize, ActionStrip, ActionDrop}
+
+// Stronger returns the stronger of two actions, an empty action is the weakest.
+func Stronger(a, b string) string {
+	if strength(b) > strength(a) {
+		return b
+	}
+	return a
+}
+
+// strength returns the position of the action in Actions, -1 for an empty or unknown action.
+func strength(action string) int {
+	for i, a := range Actions {
+		if a == action {
+			return i
+		}
+	}
+	return -1
+}
+
+// Signals are the privacy signals of a request.
+type Signals struct {
+	GPC        bool            // Sec-GPC: 1
+	DNT        bool            // DNT: 1
+	Categories map[string]bool // Consent per category, categories not mentioned are missing
+}
+
+// Read returns the privacy signals of the request. Categories are parsed from the cookie and
+// the header with the given names (either may be empty); the header takes precedence.
+func Read(r *http.Request, cookieName, headerName string) Signals {
+	var s Signals
+	if r == nil {
+		return s
+	}
+	s.GPC = strings.TrimSpace(r.Header.Get("Sec-GPC")) == "1"
+	s.DNT = strings.TrimSpace(r.Header.Get("DNT")) == "1"
+
+	if cookieName != "" {
+		if cookie, err := r.Cookie(cookieName); err == nil {
+			s.Categories = merge(s.Categories, ParseCategories(cookie.Value))
+		}
+	}
+	if headerName != "" {
+		if value := r.Header.Get(headerName); value != "" {
+			s.Categories = merge(s.Categories, ParseCategories(value))
+		}
+	}
+	return s
+}
+
+// Granted reports whether the category is granted and whether it is mentioned at all.
+func (s Signals) Granted(category string) (granted, ok bool) {
+	granted, ok = s.Categories[strings.ToLower(category)]
+	return granted, ok
+}
+
+// ParseCategories parses a consent value like "analytics=false,marketing=true" into a map of
+// lower-case category names. Pairs may be separated by ',', ';', '|' or '&' and use '=' or ':'
+// between name and value. Values true, 1, yes, granted, allow and accept grant consent,
+// false, 0, no, denied, deny and reject deny it; pairs with other values are ignored.
+// URL-encoded values (common in cookies) are decoded first.
+func ParseCategories(value string) map[string]bool {
+	if decoded, err := url.QueryUnescape(value); err == nil {
+		value = decoded
+	}
+	categories := make(map[string]bool)
+	for _, pair := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ';' || r == '|' || r == '&' }) {
+		sep := strings.IndexAny(pair, "=:")
+		if sep == -1 {
+			continue
+		}
+		name := strings.ToLower(strings.TrimSpace(pair[:sep]))
+		if name == "" {
+			continue
+		}
+		switch strings.ToLower(strings.TrimSpace(pair[sep+1:])) {
+		case "true", "1", "yes", "granted", "allow", "accept":
+			categories[name] = true
+		case "false", "0", "no", "denied", "deny", "reject":
+			categories[name] = false
+		}
+	}
+	return categories
+}
+
+// merge copies the categories of src into dst, allocating dst if needed.
+func merge(dst, src map[string]bool) map[string]bool {
+	if len(src) == 0 {
+		return dst
+	}
+	if dst == nil {
+		dst = make(map[string]bool, len(src))
+	}
+	for name, granted := range src {
+		dst[name] = granted
+	}
+	return dst
+}
@@ -0,0 +1,58 @@
+package consent
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCategories(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  map[string]bool
+	}{
+		{"comma separated", "analytics=false,marketing=true", map[string]bool{"analytics": false, "marketing": true}},
+		{"colon and semicolon", "Analytics:1; ads:0", map[string]bool{"analytics": true, "ads": false}},
+		{"url encoded", "analytics%3Dgranted%7Cads%3Ddenied", map[string]bool{"analytics": true, "ads": false}},
+		{"unknown values ignored", "analytics=maybe,necessary=yes,broken", map[string]bool{"necessary": true}},
+		{"empty", "", map[string]bool{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ParseCategories(tt.value))
+		})
+	}
+}
+
+func TestRead(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/logger.js", nil)
+	r.Header.Set("Sec-GPC", "1")
+	r.Header.Set("X-Consent", "analytics=true")
+	r.AddCookie(&http.Cookie{Name: "consent", Value: "analytics=false,marketing=false"})
+
+	s := Read(r, "consent", "X-Consent")
+	assert.True(t, s.GPC)
+	assert.False(t, s.DNT)
+	granted, ok := s.Granted("Analytics")
+	assert.True(t, ok)
+	assert.True(t, granted, "header takes precedence over cookie")
+	granted, ok = s.Granted("marketing")
+	assert.True(t, ok)
+	assert.False(t, granted)
+	_, ok = s.Granted("ads")
+	assert.False(t, ok)
+
+	s = Read(r, "", "")
+	assert.Nil(t, s.Categories)
+	assert.Equal(t, Signals{}, Read(nil, "consent", ""))
+}
+
+func TestStronger(t *testing.T) {
+	assert.Equal(t, ActionDrop, Stronger(ActionStrip, ActionDrop))
+	assert.Equal(t, ActionStrip, Stronger(ActionStrip, ActionAnonymize))
+	assert.Equal(t, ActionAnonymize, Stronger("", ActionAnonymize))
+	assert.Equal(t, "", Stronger("", ""))
+}
@@ -12,6 +12,10 @@ import (
 	"time"
 
 	"github.com/orgoj/weblogproxy/internal/config"
+	"github.com/orgoj/weblogproxy/internal/geoip"
+	"github.com/orgoj/weblogproxy/internal/logtemplate"
+	"github.com/orgoj/weblogproxy/internal/useragent"
+	"github.com/orgoj/weblogproxy/internal/version"
 )
 
 // Standard Bunyan fields
@@ -164,6 +168,63 @@ func processAddLogData(add config.AddLogDataSpec, record map[string]interface{},
 		if request != nil && request.Body != nil {
 			value, found = getValueFromMap(clientData, add.Value)
 		}
+	case "cookie":
+		if request != nil {
+			if cookie, err := request.Cookie(add.Value); err == nil {
+				value = cookie.Value
+				found = cookie.Value != ""
+			}
+		}
+	case "client_ip":
+		// Already resolved by iputil.GetClientIP (trusted proxies, client IP header) for the base record
+		if clientIP, ok := record["client_ip"].(string); ok {
+			value = clientIP
+			found = clientIP != ""
+		}
+	case "request":
+		if request != nil {
+			value = requestField(request, add.Value)
+			found = value != ""
+		}
+	case "env":
+		value = add.EnvValue
+		found = add.EnvValue != ""
+	case "server":
+		switch add.Value {
+		case "hostname":
+			cacheOnce.Do(initCachedValues)
+			value = cachedHostname
+		case "version":
+			value = version.Version
+		}
+		found = value != nil
+	case "template":
+		if add.Template == nil {
+			return fmt.Errorf("template for field '%s' is not compiled", add.Name)
+		}
+		rendered, err := add.Template.Execute(logtemplate.NewData(request, clientData, record))
+		if err != nil {
+			return err
+		}
+		value = rendered
+		found = rendered != ""
+	case "geoip":
+		if clientIP, ok := record["client_ip"].(string); ok {
+			value = geoip.LookupString(clientIP).Field(add.Value)
+			found = value != nil
+		}
+	case "user_agent":
+		if request != nil {
+			fields := useragent.Parse(request.UserAgent()).Fields()
+			if add.Value == "" {
+				// No field selected, add all known fields under the name as prefix
+				for field, v := range fields {
+					record[add.Name+"_"+field] = v
+				}
+				return nil
+			}
+			value, found = fields[add.Value]
+		}
 	default:
 		return fmt.Errorf("unknown source type: %s", add.Source)
 	}
@@ -192,6 +253,23 @@ func processAddLogData(add config.AddLogDataSpec, record map[string]interface{},
 	return nil
 }
 
+// requestField returns a field of the request for the request source
+func requestField(request *http.Request, field string) string {
+	switch field {
+	case "method":
+		return request.Method
+	case "path":
+		if request.URL != nil {
+			return request.URL.Path
+		}
+	case "host":
+		return request.Host
+	case "protocol":
+		return request.Proto
+	}
+	return ""
+}
+
 // getValueFromMap retrieves a value from a nested map using dot notation
 func getValueFromMap(data map[string]interface{}, key string) (interface{}, bool) {
 	if data == nil {
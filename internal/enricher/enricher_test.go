@@ -7,6 +7,7 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"path/filepath"
 	"reflect" // Added import
 	"testing"
 	"time"
@@ -14,6 +15,10 @@ import (
 	// Added import
 	"github.com/orgoj/weblogproxy/internal/config" // Added import
 	"github.com/orgoj/weblogproxy/internal/enricher"
+	"github.com/orgoj/weblogproxy/internal/geoip"
+	"github.com/orgoj/weblogproxy/internal/geoip/geoiptest"
+	"github.com/orgoj/weblogproxy/internal/logtemplate"
+	"github.com/orgoj/weblogproxy/internal/version"
 	// Added import
 )
 
@@ -621,3 +626,150 @@ func TestCreateBaseRecord(t *testing.T) {
 		})
 	}
 }
+
+func TestEnrichAndMerge_GeoIP(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "geo.mmdb")
+	err := geoiptest.WriteFile(path, "GeoIP2-City", []geoiptest.Entry{
+		{Network: "81.2.69.0/24", Data: map[string]interface{}{
+			"country": map[string]interface{}{"iso_code": "GB"},
+			"city":    map[string]interface{}{"names": map[string]interface{}{"en": "London"}},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	db, err := geoip.OpenDB([]string{path})
+	if err != nil {
+		t.Fatalf("OpenDB() error = %v", err)
+	}
+	geoip.SetDefault(db)
+	t.Cleanup(func() { geoip.SetDefault(nil) })
+
+	adds := []config.AddLogDataSpec{
+		{Name: "geo_country", Source: "geoip", Value: "country"},
+		{Name: "geo_city", Source: "geoip", Value: "city"},
+		{Name: "geo_asn", Source: "geoip", Value: "asn"}, // Not in the database, field is omitted
+	}
+
+	got, err := enricher.EnrichAndMerge(enricher.CreateBaseRecord("site", "", "81.2.69.142"), adds, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("EnrichAndMerge() error = %v", err)
+	}
+	if got["geo_country"] != "GB" || got["geo_city"] != "London" {
+		t.Errorf("unexpected GeoIP fields: country=%v city=%v", got["geo_country"], got["geo_city"])
+	}
+	if _, exists := got["geo_asn"]; exists {
+		t.Errorf("geo_asn should be absent, got %v", got["geo_asn"])
+	}
+
+	got, err = enricher.EnrichAndMerge(enricher.CreateBaseRecord("site", "", "8.8.8.8"), adds, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("EnrichAndMerge() error = %v", err)
+	}
+	if _, exists := got["geo_country"]; exists {
+		t.Errorf("geo_country should be absent for unknown IP, got %v", got["geo_country"])
+	}
+}
+
+func TestEnrichAndMerge_UserAgent(t *testing.T) {
+	req := newMockRequest(http.MethodGet, "/log", map[string]string{
+		"User-Agent": "Mozilla/5.0 (iPhone; CPU iPhone OS 17_2_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.2 Mobile/15E148 Safari/604.1",
+	}, nil, nil)
+	adds := []config.AddLogDataSpec{
+		{Name: "ua", Source: "user_agent"},                           // All fields with prefix
+		{Name: "device", Source: "user_agent", Value: "device_type"}, // Single field
+	}
+
+	got, err := enricher.EnrichAndMerge(enricher.CreateBaseRecord("site", "", "10.0.0.1"), adds, nil, nil, req)
+	if err != nil {
+		t.Fatalf("EnrichAndMerge() error = %v", err)
+	}
+	want := map[string]interface{}{
+		"ua_browser":         "Safari",
+		"ua_browser_version": "17.2",
+		"ua_os":              "iOS",
+		"ua_os_version":      "17.2.1",
+		"ua_device_type":     "mobile",
+		"device":             "mobile",
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %v, want %v", k, got[k], v)
+		}
+	}
+}
+
+func TestEnrichAndMerge_RequestSources(t *testing.T) {
+	hostname, _ := os.Hostname()
+	req := newMockRequest(http.MethodPost, "/log?x=1", nil, nil, nil)
+	req.Host = "logs.example.com"
+	req.AddCookie(&http.Cookie{Name: "session_id", Value: "abc123"})
+
+	adds := []config.AddLogDataSpec{
+		{Name: "session", Source: "cookie", Value: "session_id"},
+		{Name: "missing_cookie", Source: "cookie", Value: "nope"},
+		{Name: "visitor_ip", Source: "client_ip"},
+		{Name: "http_method", Source: "request", Value: "method"},
+		{Name: "http_path", Source: "request", Value: "path"},
+		{Name: "http_host", Source: "request", Value: "host"},
+		{Name: "http_protocol", Source: "request", Value: "protocol"},
+		{Name: "deployment", Source: "env", Value: "DEPLOYMENT", EnvValue: "blue"},
+		{Name: "unset_env", Source: "env", Value: "UNSET"},
+		{Name: "proxy_host", Source: "server", Value: "hostname"},
+		{Name: "proxy_version", Source: "server", Value: "version"},
+	}
+
+	got, err := enricher.EnrichAndMerge(enricher.CreateBaseRecord("site", "", "203.0.113.7"), adds, nil, nil, req)
+	if err != nil {
+		t.Fatalf("EnrichAndMerge() error = %v", err)
+	}
+	want := map[string]interface{}{
+		"session":       "abc123",
+		"visitor_ip":    "203.0.113.7",
+		"http_method":   "POST",
+		"http_path":     "/log",
+		"http_host":     "logs.example.com",
+		"http_protocol": "HTTP/1.1",
+		"deployment":    "blue",
+		"proxy_host":    hostname,
+		"proxy_version": version.Version,
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %v, want %v", k, got[k], v)
+		}
+	}
+	for _, k := range []string{"missing_cookie", "unset_env"} {
+		if _, exists := got[k]; exists {
+			t.Errorf("%s should be absent, got %v", k, got[k])
+		}
+	}
+}
+
+func TestEnrichAndMerge_Template(t *testing.T) {
+	tmpl, err := logtemplate.Compile(`{{.Header.X-Env}}-{{.Data.page.section | default "home"}}-{{.Record.team}}`)
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+	req := newMockRequest(http.MethodPost, "/log", map[string]string{"X-Env": "prod"}, nil, nil)
+	adds := []config.AddLogDataSpec{
+		{Name: "team", Source: "static", Value: "web"},
+		{Name: "label", Source: "template", Value: tmpl.String(), Template: tmpl},
+	}
+	clientData := map[string]interface{}{"page": map[string]interface{}{"section": "news"}}
+
+	got, err := enricher.EnrichAndMerge(enricher.CreateBaseRecord("site", "", "10.0.0.1"), adds, nil, clientData, req)
+	if err != nil {
+		t.Fatalf("EnrichAndMerge() error = %v", err)
+	}
+	if got["label"] != "prod-news-web" {
+		t.Errorf("label = %v, want prod-news-web", got["label"])
+	}
+
+	// A spec that was not compiled by config validation is an error
+	_, err = enricher.EnrichAndMerge(enricher.CreateBaseRecord("site", "", "10.0.0.1"),
+		[]config.AddLogDataSpec{{Name: "label", Source: "template", Value: "{{.ClientIP}}"}}, nil, nil, req)
+	if err == nil {
+		t.Error("expected error for uncompiled template")
+	}
+}
@@ -0,0 +1,232 @@
+// internal/geoip/geoip.go
+
+package geoip
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Fields supported by the geoip add_log_data source.
+var Fields = []string{"country", "region", "city", "asn", "org"}
+
+// Record holds the GeoIP data of an IP address. Empty values mean unknown.
+type Record struct {
+	Country string // ISO 3166-1 alpha-2 country code
+	Region  string // ISO 3166-2 subdivision code (without country prefix)
+	City    string // English city name
+	ASN     uint   // Autonomous system number
+	Org     string // Autonomous system organization
+}
+
+// Field returns the value of a field by name (see Fields), or nil if it is unknown.
+func (r Record) Field(name string) interface{} {
+	switch name {
+	case "country":
+		if r.Country != "" {
+			return r.Country
+		}
+	case "region":
+		if r.Region != "" {
+			return r.Region
+		}
+	case "city":
+		if r.City != "" {
+			return r.City
+		}
+	case "asn":
+		if r.ASN != 0 {
+			return r.ASN
+		}
+	case "org":
+		if r.Org != "" {
+			return r.Org
+		}
+	}
+	return nil
+}
+
+// merge fills the empty fields of r from a MaxMind record (City, Country or ASN database layout).
+func (r *Record) merge(data map[string]interface{}) {
+	if r.Country == "" {
+		r.Country = nestedString(data, "country", "iso_code")
+	}
+	if r.Country == "" {
+		r.Country = nestedString(data, "registered_country", "iso_code")
+	}
+	if r.Region == "" {
+		if subdivisions, ok := data["subdivisions"].([]interface{}); ok && len(subdivisions) > 0 {
+			if first, ok := subdivisions[0].(map[string]interface{}); ok {
+				r.Region = nestedString(first, "iso_code")
+			}
+		}
+	}
+	if r.City == "" {
+		r.City = nestedString(data, "city", "names", "en")
+	}
+	if r.ASN == 0 {
+		if asn, ok := data["autonomous_system_number"].(uint64); ok {
+			r.ASN = uint(asn)
+		}
+	}
+	if r.Org == "" {
+		r.Org = nestedString(data, "autonomous_system_organization")
+	}
+}
+
+// nestedString returns the string at the path of nested maps, or "".
+func nestedString(data map[string]interface{}, path ...string) string {
+	var current interface{} = data
+	for _, key := range path {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		current = m[key]
+	}
+	s, _ := current.(string)
+	return s
+}
+
+// database is a loaded database file with the modification time it was loaded at.
+type database struct {
+	path    string
+	modTime time.Time
+	reader  *Reader
+}
+
+// DB combines several database files (e.g. a City and an ASN database) and reloads them
+// when they change on disk. It is safe for concurrent use.
+type DB struct {
+	databases atomic.Pointer[[]database]
+	reloadMu  sync.Mutex
+}
+
+// OpenDB loads the database files. The files are queried in order, the first database
+// providing a field wins.
+func OpenDB(paths []string) (*DB, error) {
+	databases := make([]database, 0, len(paths))
+	for _, path := range paths {
+		db, err := loadDatabase(path)
+		if err != nil {
+			return nil, err
+		}
+		databases = append(databases, db)
+	}
+
+	d := &DB{}
+	d.databases.Store(&databases)
+	return d, nil
+}
+
+// loadDatabase reads a database file and remembers its modification time.
+func loadDatabase(path string) (database, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return database{}, fmt.Errorf("failed to read GeoIP database '%s': %w", path, err)
+	}
+	reader, err := Open(path)
+	if err != nil {
+		return database{}, err
+	}
+	return database{path: path, modTime: info.ModTime(), reader: reader}, nil
+}
+
+// Paths returns the database file paths.
+func (d *DB) Paths() []string {
+	if d == nil {
+		return nil
+	}
+	databases := *d.databases.Load()
+	paths := make([]string, len(databases))
+	for i, db := range databases {
+		paths[i] = db.path
+	}
+	return paths
+}
+
+// ReloadIfChanged reloads database files whose modification time changed. A file that fails
+// to load keeps the previously loaded version. Returns the paths of the reloaded files.
+func (d *DB) ReloadIfChanged() ([]string, error) {
+	if d == nil {
+		return nil, nil
+	}
+	d.reloadMu.Lock()
+	defer d.reloadMu.Unlock()
+
+	current := *d.databases.Load()
+	updated := make([]database, len(current))
+	copy(updated, current)
+
+	var reloaded []string
+	var firstErr error
+	for i, db := range current {
+		info, err := os.Stat(db.path)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("failed to stat GeoIP database '%s': %w", db.path, err)
+			}
+			continue
+		}
+		if info.ModTime().Equal(db.modTime) {
+			continue
+		}
+		fresh, err := loadDatabase(db.path)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		updated[i] = fresh
+		reloaded = append(reloaded, db.path)
+	}
+
+	if len(reloaded) > 0 {
+		d.databases.Store(&updated)
+	}
+	return reloaded, firstErr
+}
+
+// Lookup returns the GeoIP data of the IP address. Unknown addresses return an empty Record.
+func (d *DB) Lookup(ip net.IP) Record {
+	var record Record
+	if d == nil || ip == nil {
+		return record
+	}
+	for _, db := range *d.databases.Load() {
+		data, err := db.reader.Lookup(ip)
+		if err != nil || data == nil {
+			continue
+		}
+		record.merge(data)
+	}
+	return record
+}
+
+// defaultDB is the database used by the enricher and rule conditions.
+var defaultDB atomic.Pointer[DB]
+
+// SetDefault sets the database used by the geoip add_log_data source and the country/asn
+// rule conditions. Passing nil disables GeoIP lookups.
+func SetDefault(db *DB) {
+	defaultDB.Store(db)
+}
+
+// Default returns the database set by SetDefault, or nil if GeoIP is not configured.
+func Default() *DB {
+	return defaultDB.Load()
+}
+
+// LookupString looks up an IP address given as a string in the default database.
+func LookupString(ip string) Record {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return Record{}
+	}
+	return Default().Lookup(parsed)
+}
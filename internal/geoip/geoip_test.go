@@ -0,0 +1,191 @@
+package geoip
+
+import (
+	"encoding/binary"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/orgoj/weblogproxy/internal/geoip/geoiptest"
+)
+
+var cityEntries = []geoiptest.Entry{
+	{Network: "81.2.69.0/24", Data: map[string]interface{}{
+		"country":      map[string]interface{}{"iso_code": "GB"},
+		"subdivisions": []interface{}{map[string]interface{}{"iso_code": "ENG"}},
+		"city":         map[string]interface{}{"names": map[string]interface{}{"en": "London", "de": "London"}},
+	}},
+	{Network: "2001:db8::/32", Data: map[string]interface{}{
+		"country": map[string]interface{}{"iso_code": "CZ"},
+		"city":    map[string]interface{}{"names": map[string]interface{}{"en": strings.Repeat("Praha", 10)}},
+	}},
+	{Network: "10.0.0.0/8", Data: map[string]interface{}{
+		"registered_country": map[string]interface{}{"iso_code": "US"},
+	}},
+}
+
+var asnEntries = []geoiptest.Entry{
+	{Network: "81.2.0.0/16", Data: map[string]interface{}{
+		"autonomous_system_number":       uint32(20712),
+		"autonomous_system_organization": "Andrews & Arnold Ltd",
+	}},
+}
+
+func writeDB(t *testing.T, name, dbType string, entries []geoiptest.Entry) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, geoiptest.WriteFile(path, dbType, entries))
+	return path
+}
+
+func TestReader_Lookup(t *testing.T) {
+	r, err := Open(writeDB(t, "city.mmdb", "GeoIP2-City", cityEntries))
+	require.NoError(t, err)
+	assert.Equal(t, "GeoIP2-City", r.Metadata().DatabaseType)
+	assert.Equal(t, uint(6), r.Metadata().IPVersion)
+
+	data, err := r.Lookup(net.ParseIP("81.2.69.142"))
+	require.NoError(t, err)
+	require.NotNil(t, data)
+	assert.Equal(t, "GB", data["country"].(map[string]interface{})["iso_code"])
+
+	data, err = r.Lookup(net.ParseIP("2001:db8:1::1"))
+	require.NoError(t, err)
+	require.NotNil(t, data)
+
+	data, err = r.Lookup(net.ParseIP("8.8.8.8"))
+	require.NoError(t, err)
+	assert.Nil(t, data)
+
+	data, err = r.Lookup(net.ParseIP("2a00::1"))
+	require.NoError(t, err)
+	assert.Nil(t, data)
+}
+
+func TestReader_InvalidFiles(t *testing.T) {
+	_, err := Open(filepath.Join(t.TempDir(), "missing.mmdb"))
+	assert.Error(t, err)
+
+	_, err = FromBytes([]byte("not a database"))
+	assert.Error(t, err)
+
+	valid, err := geoiptest.Build("Test", cityEntries)
+	require.NoError(t, err)
+	_, err = FromBytes(valid[len(valid)/2:])
+	assert.Error(t, err)
+}
+
+func TestReader_MalformedSizes(t *testing.T) {
+	// metadata encodes a metadata map with the node count, record size 32 and IP version 4
+	metadata := func(nodeCount uint64) []byte {
+		b := append([]byte{}, metadataStartMarker...)
+		b = append(b, 0xE3) // Map with 3 entries
+		b = append(b, 0x4A)
+		b = append(b, "node_count"...)
+		b = append(b, 0x08, 0x02) // uint64, 8 bytes
+		b = binary.BigEndian.AppendUint64(b, nodeCount)
+		b = append(b, 0x4B)
+		b = append(b, "record_size"...)
+		b = append(b, 0xA1, 32) // uint16, 1 byte
+		b = append(b, 0x4A)
+		b = append(b, "ip_version"...)
+		return append(b, 0xA1, 4)
+	}
+	tree := make([]byte, 64)
+
+	_, err := FromBytes(append(tree, metadata(2)...))
+	require.NoError(t, err)
+
+	// node_count * record_size wraps around to 0
+	_, err = FromBytes(append(tree, metadata(1<<62)...))
+	assert.ErrorContains(t, err, "search tree exceeds file size")
+	_, err = FromBytes(append(tree, metadata(7)...))
+	assert.ErrorContains(t, err, "search tree exceeds file size")
+
+	// Map and array sizes larger than the remaining data are rejected before allocating
+	_, err = FromBytes(append(append(tree, metadataStartMarker...), 0xFF, 0xFF, 0xFF, 0xFF))
+	assert.ErrorContains(t, err, "map size 16843036 exceeds data section")
+	_, err = FromBytes(append(append(tree, metadataStartMarker...), 0x1F, 0x04, 0xFF, 0xFF, 0xFF))
+	assert.ErrorContains(t, err, "array size 16843036 exceeds data section")
+
+	// A map pointing back to itself
+	selfReferencing := append(append(tree, metadataStartMarker...), 0xE2, 0x41, 'a', 0x20, 0x00, 0x41, 'b', 0x20, 0x00)
+	_, err = FromBytes(selfReferencing)
+	assert.ErrorContains(t, err, "data section nesting too deep")
+
+	// 30 maps with both values pointing to the next map expand to 2^30 values
+	fanOut := append(append([]byte{}, tree...), metadataStartMarker...)
+	for level := 1; level <= 30; level++ {
+		next := level * 9 // Every map takes 9 bytes, pointers hold 11 bits
+		pointer := []byte{0x20 | byte(next>>8), byte(next)}
+		fanOut = append(fanOut, 0xE2, 0x41, 'a')
+		fanOut = append(fanOut, pointer...)
+		fanOut = append(fanOut, 0x41, 'b')
+		fanOut = append(fanOut, pointer...)
+	}
+	fanOut = append(fanOut, 0x41, 'x')
+	_, err = FromBytes(fanOut)
+	assert.ErrorContains(t, err, "data section record too large")
+}
+
+func TestDB_Lookup(t *testing.T) {
+	db, err := OpenDB([]string{
+		writeDB(t, "city.mmdb", "GeoIP2-City", cityEntries),
+		writeDB(t, "asn.mmdb", "GeoLite2-ASN", asnEntries),
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, Record{Country: "GB", Region: "ENG", City: "London", ASN: 20712, Org: "Andrews & Arnold Ltd"},
+		db.Lookup(net.ParseIP("81.2.69.142")))
+	assert.Equal(t, Record{ASN: 20712, Org: "Andrews & Arnold Ltd"}, db.Lookup(net.ParseIP("81.2.1.1")))
+	assert.Equal(t, Record{Country: "US"}, db.Lookup(net.ParseIP("10.1.2.3")))
+	assert.Equal(t, strings.Repeat("Praha", 10), db.Lookup(net.ParseIP("2001:db8::1")).City)
+	assert.Equal(t, Record{}, db.Lookup(net.ParseIP("8.8.8.8")))
+
+	var nilDB *DB
+	assert.Equal(t, Record{}, nilDB.Lookup(net.ParseIP("81.2.69.142")))
+}
+
+func TestDB_ReloadIfChanged(t *testing.T) {
+	path := writeDB(t, "city.mmdb", "GeoIP2-City", cityEntries)
+	db, err := OpenDB([]string{path})
+	require.NoError(t, err)
+
+	reloaded, err := db.ReloadIfChanged()
+	require.NoError(t, err)
+	assert.Empty(t, reloaded)
+
+	// Replace the database, the new version is used after reload
+	require.NoError(t, geoiptest.WriteFile(path, "GeoIP2-City", []geoiptest.Entry{
+		{Network: "81.2.69.0/24", Data: map[string]interface{}{"country": map[string]interface{}{"iso_code": "IE"}}},
+	}))
+	future := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(path, future, future))
+
+	reloaded, err = db.ReloadIfChanged()
+	require.NoError(t, err)
+	assert.Equal(t, []string{path}, reloaded)
+	assert.Equal(t, "IE", db.Lookup(net.ParseIP("81.2.69.142")).Country)
+
+	// A broken file keeps the loaded version
+	require.NoError(t, os.WriteFile(path, []byte("broken"), 0644))
+	later := future.Add(time.Minute)
+	require.NoError(t, os.Chtimes(path, later, later))
+	_, err = db.ReloadIfChanged()
+	assert.Error(t, err)
+	assert.Equal(t, "IE", db.Lookup(net.ParseIP("81.2.69.142")).Country)
+}
+
+func TestRecord_Field(t *testing.T) {
+	r := Record{Country: "CZ", ASN: 13335}
+	assert.Equal(t, "CZ", r.Field("country"))
+	assert.Equal(t, uint(13335), r.Field("asn"))
+	assert.Nil(t, r.Field("city"))
+	assert.Nil(t, r.Field("unknown"))
+}
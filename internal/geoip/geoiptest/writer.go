@@ -0,0 +1,205 @@
+// internal/geoip/geoiptest/writer.go
+
+// Package geoiptest builds small MaxMind DB files for tests.
+package geoiptest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+)
+
+// Entry maps a network to its data record. Values may be strings, unsigned integers,
+// maps with string keys and slices of these. Networks must not overlap.
+type Entry struct {
+	Network string // CIDR, e.g. "1.2.3.0/24" or "2001:db8::/32"
+	Data    map[string]interface{}
+}
+
+// node is a search tree node; records are node indexes, empty (-1) or data offsets (-2 - offset).
+type node [2]int
+
+const emptyRecord = -1
+
+// Build returns an IPv6 MaxMind DB with 32-bit records containing the entries.
+// IPv4 networks are stored in the ::/96 subtree like in the MaxMind databases.
+func Build(databaseType string, entries []Entry) ([]byte, error) {
+	nodes := []node{{emptyRecord, emptyRecord}}
+	var data bytes.Buffer
+
+	for _, entry := range entries {
+		_, network, err := net.ParseCIDR(entry.Network)
+		if err != nil {
+			return nil, err
+		}
+		ones, bits := network.Mask.Size()
+		ip := make(net.IP, net.IPv6len)
+		if bits == 32 {
+			copy(ip[12:], network.IP.To4())
+			ones += 96
+		} else {
+			copy(ip, network.IP)
+		}
+
+		offset := data.Len()
+		if err := encode(&data, entry.Data); err != nil {
+			return nil, err
+		}
+
+		current := 0
+		for i := 0; i < ones; i++ {
+			bit := int(ip[i/8]>>(7-uint(i%8))) & 1
+			if i == ones-1 {
+				nodes[current][bit] = -2 - offset
+				break
+			}
+			next := nodes[current][bit]
+			if next < 0 {
+				nodes = append(nodes, node{emptyRecord, emptyRecord})
+				next = len(nodes) - 1
+				nodes[current][bit] = next
+			}
+			current = next
+		}
+	}
+
+	nodeCount := len(nodes)
+	var out bytes.Buffer
+	for _, n := range nodes {
+		for _, record := range n {
+			var value uint32
+			switch {
+			case record == emptyRecord:
+				value = uint32(nodeCount)
+			case record < emptyRecord:
+				value = uint32(nodeCount + 16 + (-2 - record))
+			default:
+				value = uint32(record)
+			}
+			_ = binary.Write(&out, binary.BigEndian, value)
+		}
+	}
+	out.Write(make([]byte, 16))
+	out.Write(data.Bytes())
+	out.WriteString("\xAB\xCD\xEFMaxMind.com")
+	err := encode(&out, map[string]interface{}{
+		"node_count":                  uint32(nodeCount),
+		"record_size":                 uint16(32),
+		"ip_version":                  uint16(6),
+		"database_type":               databaseType,
+		"languages":                   []interface{}{"en"},
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+		"build_epoch":                 uint64(0),
+		"description":                 map[string]interface{}{"en": "test database"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// WriteFile builds a database and writes it to path.
+func WriteFile(path, databaseType string, entries []Entry) error {
+	data, err := Build(databaseType, entries)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// encode writes a value in the MaxMind DB data section format.
+func encode(buf *bytes.Buffer, value interface{}) error {
+	switch v := value.(type) {
+	case string:
+		writeControl(buf, 2, len(v))
+		buf.WriteString(v)
+	case uint16:
+		writeUint(buf, 5, uint64(v))
+	case uint32:
+		writeUint(buf, 6, uint64(v))
+	case uint64:
+		writeUint(buf, 9, v)
+	case uint:
+		writeUint(buf, 6, uint64(v))
+	case int:
+		writeUint(buf, 6, uint64(v))
+	case bool:
+		size := 0
+		if v {
+			size = 1
+		}
+		writeControl(buf, 14, size)
+	case map[string]interface{}:
+		writeControl(buf, 7, len(v))
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if err := encode(buf, k); err != nil {
+				return err
+			}
+			if err := encode(buf, v[k]); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		writeControl(buf, 11, len(v))
+		for _, item := range v {
+			if err := encode(buf, item); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported value type %T", value)
+	}
+	return nil
+}
+
+// writeUint writes an unsigned integer with the minimal number of bytes.
+func writeUint(buf *bytes.Buffer, typeNum int, v uint64) {
+	var b []byte
+	for v > 0 {
+		b = append([]byte{byte(v)}, b...)
+		v >>= 8
+	}
+	writeControl(buf, typeNum, len(b))
+	buf.Write(b)
+}
+
+// writeControl writes the control byte(s) for a type and payload size.
+func writeControl(buf *bytes.Buffer, typeNum, size int) {
+	var ctrl byte
+	extended := typeNum > 7
+	if !extended {
+		ctrl = byte(typeNum << 5)
+	}
+
+	var extra []byte
+	switch {
+	case size < 29:
+		ctrl |= byte(size)
+	case size < 285:
+		ctrl |= 29
+		extra = []byte{byte(size - 29)}
+	case size < 65821:
+		ctrl |= 30
+		s := size - 285
+		extra = []byte{byte(s >> 8), byte(s)}
+	default:
+		ctrl |= 31
+		s := size - 65821
+		extra = []byte{byte(s >> 16), byte(s >> 8), byte(s)}
+	}
+
+	buf.WriteByte(ctrl)
+	if extended {
+		buf.WriteByte(byte(typeNum - 7))
+	}
+	buf.Write(extra)
+}
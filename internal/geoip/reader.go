@@ -0,0 +1,406 @@
+// internal/geoip/reader.go
+
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net"
+	"os"
+)
+
+// metadataStartMarker separates the data section from the metadata of a MaxMind DB file.
+var metadataStartMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+// dataSectionSeparatorSize is the number of zero bytes between the search tree and the data section.
+const dataSectionSeparatorSize = 16
+
+// Metadata holds the fields of the MaxMind DB metadata used by the reader.
+type Metadata struct {
+	NodeCount    uint
+	RecordSize   uint
+	IPVersion    uint
+	DatabaseType string
+}
+
+// Reader looks up IP addresses in a MaxMind DB (.mmdb) file loaded into memory.
+// It is safe for concurrent use.
+type Reader struct {
+	buffer      []byte
+	dataSection []byte
+	metadata    Metadata
+	ipv4Start   uint // Node where the IPv4 subtree (::/96) starts in IPv6 databases
+}
+
+// Open reads and parses a MaxMind DB file.
+func Open(path string) (*Reader, error) {
+	data, err := os.ReadFile(path) // #nosec G304 -- Database path comes from the configuration.
+	if err != nil {
+		return nil, fmt.Errorf("failed to read GeoIP database '%s': %w", path, err)
+	}
+	r, err := FromBytes(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GeoIP database '%s': %w", path, err)
+	}
+	return r, nil
+}
+
+// FromBytes parses a MaxMind DB from memory.
+func FromBytes(buffer []byte) (*Reader, error) {
+	markerIndex := bytes.LastIndex(buffer, metadataStartMarker)
+	if markerIndex == -1 {
+		return nil, errors.New("metadata section not found")
+	}
+	metadataStart := markerIndex + len(metadataStartMarker)
+	raw, _, err := (&decoder{buffer: buffer[metadataStart:]}).decode(0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode metadata: %w", err)
+	}
+	metaMap, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("metadata is not a map")
+	}
+
+	meta := Metadata{
+		NodeCount:  toUint(metaMap["node_count"]),
+		RecordSize: toUint(metaMap["record_size"]),
+		IPVersion:  toUint(metaMap["ip_version"]),
+	}
+	meta.DatabaseType, _ = metaMap["database_type"].(string)
+
+	switch meta.RecordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("unsupported record size %d", meta.RecordSize)
+	}
+	if meta.IPVersion != 4 && meta.IPVersion != 6 {
+		return nil, fmt.Errorf("unsupported IP version %d", meta.IPVersion)
+	}
+
+	// Check the node count before multiplying, a corrupt value could overflow the tree size
+	if markerIndex < dataSectionSeparatorSize || meta.NodeCount > uint(markerIndex-dataSectionSeparatorSize)/meta.RecordSize*4 {
+		return nil, errors.New("search tree exceeds file size")
+	}
+	treeSize := meta.NodeCount * meta.RecordSize / 4
+	dataStart := treeSize + dataSectionSeparatorSize
+
+	r := &Reader{
+		buffer:      buffer,
+		dataSection: buffer[dataStart:markerIndex],
+		metadata:    meta,
+	}
+
+	if meta.IPVersion == 6 {
+		node := uint(0)
+		for i := 0; i < 96 && node < meta.NodeCount; i++ {
+			node = r.readNode(node, 0)
+		}
+		r.ipv4Start = node
+	}
+	return r, nil
+}
+
+// Metadata returns the metadata of the database.
+func (r *Reader) Metadata() Metadata {
+	return r.metadata
+}
+
+// Lookup returns the data record for the IP address, or nil if the address is not in the database.
+func (r *Reader) Lookup(ip net.IP) (map[string]interface{}, error) {
+	node, bitCount, err := r.startNode(ip)
+	if err != nil {
+		return nil, err
+	}
+
+	bits := ip.To4()
+	if bits == nil || r.metadata.IPVersion == 6 && bitCount == 128 {
+		bits = ip.To16()
+	}
+
+	nodeCount := r.metadata.NodeCount
+	for i := 0; i < bitCount && node < nodeCount; i++ {
+		bit := uint(bits[i>>3]>>(7-uint(i&7))) & 1
+		node = r.readNode(node, bit)
+	}
+
+	switch {
+	case node == nodeCount:
+		return nil, nil
+	case node > nodeCount:
+		offset := node - nodeCount - dataSectionSeparatorSize
+		if offset >= uint(len(r.dataSection)) {
+			return nil, errors.New("invalid data pointer in search tree")
+		}
+		value, _, err := (&decoder{buffer: r.dataSection}).decode(offset)
+		if err != nil {
+			return nil, err
+		}
+		record, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("unexpected record type %T", value)
+		}
+		return record, nil
+	default:
+		return nil, errors.New("invalid search tree")
+	}
+}
+
+// startNode returns the node where the lookup of the IP address starts and the number of bits to follow.
+func (r *Reader) startNode(ip net.IP) (uint, int, error) {
+	if ip4 := ip.To4(); ip4 != nil {
+		if r.metadata.IPVersion == 6 {
+			return r.ipv4Start, 32, nil
+		}
+		return 0, 32, nil
+	}
+	if ip.To16() == nil {
+		return 0, 0, fmt.Errorf("invalid IP address '%s'", ip)
+	}
+	if r.metadata.IPVersion == 4 {
+		return 0, 0, fmt.Errorf("IPv6 address '%s' cannot be looked up in an IPv4 database", ip)
+	}
+	return 0, 128, nil
+}
+
+// readNode returns the left (bit 0) or right (bit 1) record of the node.
+func (r *Reader) readNode(node, bit uint) uint {
+	switch r.metadata.RecordSize {
+	case 24:
+		offset := node*6 + bit*3
+		b := r.buffer[offset : offset+3]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		offset := node * 7
+		b := r.buffer[offset : offset+7]
+		if bit == 0 {
+			return (uint(b[3])&0xF0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return (uint(b[3])&0x0F)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default: // 32
+		offset := node*8 + bit*4
+		return uint(binary.BigEndian.Uint32(r.buffer[offset : offset+4]))
+	}
+}
+
+// Data section types
+const (
+	typeExtended = iota
+	typePointer
+	typeString
+	typeFloat64
+	typeBytes
+	typeUint16
+	typeUint32
+	typeMap
+	typeInt32
+	typeUint64
+	typeUint128
+	typeSlice
+	typeContainer
+	typeMarker
+	typeBool
+	typeFloat32
+)
+
+// maxDecodedValues limits the values decoded for one record. Pointers may refer to the same
+// value several times, so a malformed file could otherwise make a record expand exponentially.
+const maxDecodedValues = 1 << 16
+
+// decoder decodes values of the MaxMind DB data section.
+type decoder struct {
+	buffer  []byte
+	depth   int
+	decoded int // Values decoded so far, including pointers
+}
+
+// decode decodes the value at offset and returns it with the offset of the next value.
+func (d *decoder) decode(offset uint) (interface{}, uint, error) {
+	d.depth++
+	defer func() { d.depth-- }()
+	if d.depth > 64 {
+		return nil, 0, errors.New("data section nesting too deep")
+	}
+	d.decoded++
+	if d.decoded > maxDecodedValues {
+		return nil, 0, errors.New("data section record too large")
+	}
+
+	typeNum, size, offset, err := d.decodeControl(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if typeNum == typePointer {
+		pointer, next, err := d.decodePointer(size, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		value, _, err := d.decode(pointer)
+		return value, next, err
+	}
+
+	end := offset + size
+	if typeNum != typeMap && typeNum != typeSlice && typeNum != typeBool && end > uint(len(d.buffer)) {
+		return nil, 0, errors.New("unexpected end of data section")
+	}
+
+	switch typeNum {
+	case typeString:
+		return string(d.buffer[offset:end]), end, nil
+	case typeBytes:
+		return append([]byte(nil), d.buffer[offset:end]...), end, nil
+	case typeFloat64:
+		if size != 8 {
+			return nil, 0, fmt.Errorf("invalid double size %d", size)
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(d.buffer[offset:end])), end, nil
+	case typeFloat32:
+		if size != 4 {
+			return nil, 0, fmt.Errorf("invalid float size %d", size)
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(d.buffer[offset:end]))), end, nil
+	case typeUint16, typeUint32, typeUint64:
+		if size > 8 {
+			return nil, 0, fmt.Errorf("invalid unsigned integer size %d", size)
+		}
+		var v uint64
+		for _, b := range d.buffer[offset:end] {
+			v = v<<8 | uint64(b)
+		}
+		return v, end, nil
+	case typeInt32:
+		if size > 4 {
+			return nil, 0, fmt.Errorf("invalid int32 size %d", size)
+		}
+		var v uint32
+		for _, b := range d.buffer[offset:end] {
+			v = v<<8 | uint32(b)
+		}
+		return int64(int32(v)), end, nil
+	case typeUint128:
+		if size > 16 {
+			return nil, 0, fmt.Errorf("invalid uint128 size %d", size)
+		}
+		return new(big.Int).SetBytes(d.buffer[offset:end]), end, nil
+	case typeBool:
+		return size != 0, offset, nil
+	case typeMap:
+		// Every entry takes at least a key and a value control byte
+		if size > (uint(len(d.buffer))-offset)/2 {
+			return nil, 0, fmt.Errorf("map size %d exceeds data section", size)
+		}
+		m := make(map[string]interface{}, size)
+		for i := uint(0); i < size; i++ {
+			key, next, err := d.decode(offset)
+			if err != nil {
+				return nil, 0, err
+			}
+			keyStr, ok := key.(string)
+			if !ok {
+				return nil, 0, fmt.Errorf("map key must be a string, got %T", key)
+			}
+			value, next, err := d.decode(next)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[keyStr] = value
+			offset = next
+		}
+		return m, offset, nil
+	case typeSlice:
+		// Every element takes at least a control byte
+		if size > uint(len(d.buffer))-offset {
+			return nil, 0, fmt.Errorf("array size %d exceeds data section", size)
+		}
+		s := make([]interface{}, 0, size)
+		for i := uint(0); i < size; i++ {
+			value, next, err := d.decode(offset)
+			if err != nil {
+				return nil, 0, err
+			}
+			s = append(s, value)
+			offset = next
+		}
+		return s, offset, nil
+	default:
+		return nil, 0, fmt.Errorf("unsupported data type %d", typeNum)
+	}
+}
+
+// decodeControl decodes the control byte(s) and returns the type, payload size and payload offset.
+func (d *decoder) decodeControl(offset uint) (int, uint, uint, error) {
+	if offset >= uint(len(d.buffer)) {
+		return 0, 0, 0, errors.New("unexpected end of data section")
+	}
+	ctrl := d.buffer[offset]
+	offset++
+
+	typeNum := int(ctrl >> 5)
+	if typeNum == typeExtended {
+		if offset >= uint(len(d.buffer)) {
+			return 0, 0, 0, errors.New("unexpected end of data section")
+		}
+		typeNum = 7 + int(d.buffer[offset])
+		offset++
+	}
+
+	size := uint(ctrl & 0x1F)
+	if typeNum == typePointer {
+		return typeNum, size, offset, nil
+	}
+	if size >= 29 {
+		extra := size - 28
+		if offset+extra > uint(len(d.buffer)) {
+			return 0, 0, 0, errors.New("unexpected end of data section")
+		}
+		var v uint
+		for _, b := range d.buffer[offset : offset+extra] {
+			v = v<<8 | uint(b)
+		}
+		switch size {
+		case 29:
+			size = 29 + v
+		case 30:
+			size = 285 + v
+		default:
+			size = 65821 + v
+		}
+		offset += extra
+	}
+	return typeNum, size, offset, nil
+}
+
+// decodePointer decodes a pointer whose control byte size bits are ctrlSize.
+func (d *decoder) decodePointer(ctrlSize, offset uint) (uint, uint, error) {
+	pointerSize := (ctrlSize >> 3) & 0x3
+	n := pointerSize + 1
+	if offset+n > uint(len(d.buffer)) {
+		return 0, 0, errors.New("unexpected end of data section")
+	}
+	b := d.buffer[offset : offset+n]
+
+	var pointer uint
+	switch pointerSize {
+	case 0:
+		pointer = (ctrlSize&0x7)<<8 | uint(b[0])
+	case 1:
+		pointer = ((ctrlSize&0x7)<<16 | uint(b[0])<<8 | uint(b[1])) + 2048
+	case 2:
+		pointer = ((ctrlSize&0x7)<<24 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])) + 526336
+	default:
+		pointer = uint(binary.BigEndian.Uint32(b))
+	}
+	return pointer, offset + n, nil
+}
+
+// toUint converts a decoded unsigned integer to uint.
+func toUint(v interface{}) uint {
+	if n, ok := v.(uint64); ok {
+		return uint(n)
+	}
+	return 0
+}
@@ -0,0 +1,64 @@
+// internal/handler/admin.go
+
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/orgoj/weblogproxy/internal/logger"
+	"github.com/orgoj/weblogproxy/internal/redact"
+	"github.com/orgoj/weblogproxy/internal/rules"
+	"github.com/orgoj/weblogproxy/internal/security"
+)
+
+// AdminHandlerDeps holds dependencies for the admin handlers.
+type AdminHandlerDeps struct {
+	RuleProcessor *rules.RuleProcessor
+	AppLogger     *logger.AppLogger
+}
+
+// NewRuleExplainHandler creates a Gin handler that evaluates the rules for a synthetic
+// request (site_id, gtm_id, ip, user_agent, headers) and returns the per-rule trace as JSON.
+func NewRuleExplainHandler(deps AdminHandlerDeps) gin.HandlerFunc {
+	if deps.RuleProcessor == nil {
+		panic("RuleExplainHandler requires a non-nil RuleProcessor")
+	}
+	if deps.AppLogger == nil {
+		panic("RuleExplainHandler requires a non-nil AppLogger")
+	}
+
+	return func(ctx *gin.Context) {
+		var synthetic rules.SyntheticRequest
+		if err := ctx.ShouldBindJSON(&synthetic); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid JSON body"})
+			return
+		}
+
+		req, err := synthetic.HTTPRequest()
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		deps.AppLogger.Debug("Admin: explaining rules for site_id '%s', gtm_id '%s', ip '%s'", synthetic.SiteID, synthetic.GtmID, synthetic.IP)
+		ctx.JSON(http.StatusOK, deps.RuleProcessor.Explain(synthetic.SiteID, synthetic.GtmID, req))
+	}
+}
+
+// NewAdminMetricsHandler creates a Gin handler that returns the per-rule hit counters, the
+// redaction counters and the token binding failure counters as JSON.
+func NewAdminMetricsHandler(deps AdminHandlerDeps) gin.HandlerFunc {
+	if deps.RuleProcessor == nil {
+		panic("AdminMetricsHandler requires a non-nil RuleProcessor")
+	}
+
+	return func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, gin.H{
+			"rules":                  deps.RuleProcessor.Stats(),
+			"redactions":             redact.Stats(),
+			"token_binding_failures": security.BindingStats(),
+			"replayed_events":        security.ReplayStats(),
+		})
+	}
+}
@@ -76,8 +76,10 @@ func processAndLogToDestinations(
 		}
 
 		var destAdds []config.AddLogDataSpec
+		destClientData := clientData
 		if destConfig != nil {
 			destAdds = destConfig.AddLogData
+			destClientData = destConfig.Redaction.Apply(clientData)
 		} else {
 			deps.AppLogger.Warn("Log Handler: Destination config '%s' not found after getting logger instance", destName)
 		}
@@ -87,7 +89,7 @@ func processAndLogToDestinations(
 			destRecord,
 			ruleResult.AccumulatedAddLogData,
 			destAdds,
-			clientData, // Pass client data here
+			destClientData, // Client data with the destination redaction applied
 			ctx.Request,
 		)
 		if err != nil {
@@ -95,6 +97,23 @@ func processAndLogToDestinations(
 			continue
 		}
 
+		// Anonymize IP addresses after enrichment, rules and rate limiting have used the real address
+		ipSpecs := append(append([]config.AddLogDataSpec{}, ruleResult.AccumulatedAddLogData...), destAdds...)
+		for _, anonymization := range ruleResult.AccumulatedIPAnonymizations {
+			anonymization.Apply(finalRecord, ipSpecs, deps.Config.Server.ClientIPHeader)
+		}
+		if destConfig != nil {
+			destConfig.IPAnonymization.Apply(finalRecord, ipSpecs, deps.Config.Server.ClientIPHeader)
+		}
+		deps.Config.Consent.ApplyAction(ruleResult.ConsentAction, finalRecord, ipSpecs, deps.Config.Server.ClientIPHeader)
+
+		// Reshape the record: rule transformations first, then the destination ones
+		finalRecord = config.ApplyTransforms(finalRecord, ruleResult.AccumulatedTransforms)
+		if destConfig != nil {
+			finalRecord = config.ApplyTransforms(finalRecord, destConfig.Transform)
+			finalRecord = destConfig.Schema.Map(finalRecord)
+		}
+
 		limit := int64(deps.Config.Server.RequestLimits.MaxBodySize)
 		if limit > 0 {
 			truncated, err := truncate.TruncateMapIfNeeded(&finalRecord, limit)
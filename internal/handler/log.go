@@ -3,10 +3,14 @@
 package handler
 
 import (
+	"math"
 	"net/http"
+	"slices"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/orgoj/weblogproxy/internal/config"
+	"github.com/orgoj/weblogproxy/internal/consent"
 	"github.com/orgoj/weblogproxy/internal/enricher"
 	"github.com/orgoj/weblogproxy/internal/iputil"
 	"github.com/orgoj/weblogproxy/internal/logger"
@@ -17,22 +21,83 @@ import (
 
 // LogRequestBody defines the structure for the /log endpoint request body
 type LogRequestBody struct {
-	Token  string                 `json:"token" binding:"required"`
-	SiteID string                 `json:"site_id" binding:"required"`
-	GtmID  string                 `json:"gtm_id"` // Optional
-	Data   map[string]interface{} `json:"data" binding:"required"`
+	Token   string                 `json:"token" binding:"required"`
+	SiteID  string                 `json:"site_id" binding:"required"`
+	GtmID   string                 `json:"gtm_id"`   // Optional
+	EventID string                 `json:"event_id"` // Optional random ID of the event, used for replay protection
+	Data    map[string]interface{} `json:"data" binding:"required"`
 }
 
 // LogHandlerDependencies holds dependencies for the log handler
 type LogHandlerDependencies struct {
-	LoggerManager  *logger.Manager
-	TokenSecret    string
+	LoggerManager *logger.Manager
+	TokenPolicies *security.Policies
+	// TokenRateLimiter blocks clients sending invalid tokens, nil disables blocking
+	TokenRateLimiter *security.TokenValidationRateLimiter
+	// ReplayGuard rejects events sent more than once, nil disables replay protection
+	ReplayGuard    *security.ReplayGuard
 	RuleProcessor  *rules.RuleProcessor
 	TrustedProxies []string
 	Config         *config.Config
 	AppLogger      *logger.AppLogger
 }
 
+// schemaErrorsField is the client data field holding payload schema errors.
+const schemaErrorsField = "_schema_errors"
+
+// validatePayload validates the client data against the schema of the site and the schemas of the
+// matched rules. It returns the errors of all failing schemas, the strongest on_error action and,
+// for quarantine, the destination of the first failing schema with that action.
+func validatePayload(cfg *config.Config, siteID string, ruleSchemas []*config.PayloadSchema, data map[string]interface{}) ([]string, string, string) {
+	schemas := ruleSchemas
+	if siteSchema := cfg.PayloadSchemas[siteID]; siteSchema != nil {
+		schemas = append([]*config.PayloadSchema{siteSchema}, ruleSchemas...)
+	}
+
+	var errors []string
+	action, quarantine := "", ""
+	strength := func(a string) int { return slices.Index(config.PayloadSchemaActions, a) }
+	for _, schema := range schemas {
+		schemaErrors := schema.Validate(data)
+		if len(schemaErrors) == 0 {
+			continue
+		}
+		errors = append(errors, schemaErrors...)
+		if strength(schema.OnError) > strength(action) {
+			action = schema.OnError
+		}
+		if schema.OnError == config.PayloadSchemaQuarantine && quarantine == "" {
+			quarantine = schema.QuarantineDestination
+		}
+	}
+	return errors, action, quarantine
+}
+
+// Reasons of blocked /log requests, sent in the X-Log-Block-Reason header
+const (
+	blockReasonIP   = "invalid_tokens_from_ip"
+	blockReasonSite = "invalid_tokens_for_site"
+)
+
+// tokenRateLimitKey is a token rate limiter key with the reason reported when it is blocked.
+type tokenRateLimitKey struct {
+	key    string
+	reason string
+}
+
+// tokenRateLimitKeys returns the rate limiter keys of a request: the client IP over all sites
+// and the client IP for the site. Requests without client IP are not limited, a shared empty
+// key would block all of them together.
+func tokenRateLimitKeys(clientIP, siteID string) []tokenRateLimitKey {
+	if clientIP == "" {
+		return nil
+	}
+	return []tokenRateLimitKey{
+		{key: "ip:" + clientIP, reason: blockReasonIP},
+		{key: "site:" + clientIP + ":" + siteID, reason: blockReasonSite},
+	}
+}
+
 // NewLogHandler creates a Gin handler function for the /log endpoint
 func NewLogHandler(deps LogHandlerDependencies) gin.HandlerFunc {
 
@@ -91,6 +156,14 @@ func NewLogHandler(deps LogHandlerDependencies) gin.HandlerFunc {
 				return
 			}
 		}
+		if reqBody.EventID != "" {
+			if err := validation.IsValidID(reqBody.EventID, validation.DefaultMaxInputLength); err != nil {
+				clientIPForLog := iputil.GetClientIP(ctx.Request, parsedTrustedProxies, deps.Config.Server.ClientIPHeader)
+				deps.AppLogger.Warn("Log Handler: Invalid event_id from IP %s: %v", clientIPForLog, err)
+				// Do not process further, but return OK
+				return
+			}
+		}
 
 		// Sanitize the client-provided data map
 		sanitizedData, err := validation.SanitizeMapRecursively(
@@ -114,30 +187,95 @@ func NewLogHandler(deps LogHandlerDependencies) gin.HandlerFunc {
 		reqBody.Data = sanitizedData
 		// --- End Input Validation & Sanitization ---
 
-		// 1. Verify Token - Use security.ValidateToken directly
-		valid, err := security.ValidateToken(deps.TokenSecret, reqBody.SiteID, reqBody.GtmID, reqBody.Token)
+		// 1. Verify Token - Any non-retired key of the site's keyring is accepted, bound tokens
+		// must match the origin, client network and user agent of this request
+		clientIP := iputil.GetClientIP(ctx.Request, parsedTrustedProxies, deps.Config.Server.ClientIPHeader)
+		tokenPolicy := deps.TokenPolicies.Lookup(reqBody.SiteID)
+		if !tokenPolicy.AllowsGtmID(reqBody.GtmID) {
+			deps.AppLogger.Warn("Log Handler: gtm_id '%s' is not allowed for SiteID '%s', IP %s", reqBody.GtmID, reqBody.SiteID, clientIP)
+			ctx.Header("X-Log-Status", "failure")
+			return // Return OK
+		}
+		rateLimitKeys := tokenRateLimitKeys(clientIP, reqBody.SiteID)
+		if deps.TokenRateLimiter != nil {
+			for _, key := range rateLimitKeys {
+				if blocked, remaining := deps.TokenRateLimiter.Blocked(key.key); blocked {
+					deps.AppLogger.Info("Log Handler: IP %s is blocked for SiteID '%s' after too many invalid tokens (%s)", clientIP, reqBody.SiteID, key.reason)
+					ctx.Header("X-Log-Status", "blocked")
+					ctx.Header("X-Log-Block-Reason", key.reason)
+					ctx.Header("Retry-After", strconv.Itoa(int(math.Ceil(remaining.Seconds()))))
+					ctx.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "Too many invalid tokens"})
+					return
+				}
+			}
+		}
+		claims := security.RequestClaims(ctx.Request, clientIP)
+		valid, err := tokenPolicy.Keyring.ValidateBound(reqBody.SiteID, reqBody.GtmID, reqBody.Token, tokenPolicy.Binding, claims)
+		if deps.TokenRateLimiter != nil {
+			for _, key := range rateLimitKeys {
+				// Expired tokens and failed binding checks are correctly signed, they do not count
+				deps.TokenRateLimiter.CheckAndRecordAttempt(key.key, !security.IsSignatureError(err))
+			}
+		}
 		if err != nil {
-			clientIPForLog := iputil.GetClientIP(ctx.Request, parsedTrustedProxies, deps.Config.Server.ClientIPHeader)
-			deps.AppLogger.Warn("Log Handler: Token validation error for IP %s, SiteID '%s': %v", clientIPForLog, reqBody.SiteID, err)
+			deps.AppLogger.Warn("Log Handler: Token validation error for IP %s, SiteID '%s': %v", clientIP, reqBody.SiteID, err)
 			ctx.Header("X-Log-Status", "failure")
 			return // Return OK, but log the error
 		}
 		if !valid {
-			clientIPForLog := iputil.GetClientIP(ctx.Request, parsedTrustedProxies, deps.Config.Server.ClientIPHeader)
-			deps.AppLogger.Warn("Log Handler: Invalid token received from IP %s for SiteID '%s'", clientIPForLog, reqBody.SiteID)
+			deps.AppLogger.Warn("Log Handler: Invalid token received from IP %s for SiteID '%s'", clientIP, reqBody.SiteID)
 			ctx.Header("X-Log-Status", "failure")
 			return // Return OK
 		}
 
+		// Reject events already received with this token, duplicates are counted but not logged
+		if deps.ReplayGuard != nil {
+			if reqBody.EventID == "" {
+				if deps.Config.Security.ReplayProtection.RequireEventID {
+					deps.AppLogger.Warn("Log Handler: Missing event_id from IP %s for SiteID '%s'", clientIP, reqBody.SiteID)
+					ctx.Header("X-Log-Status", "failure")
+					return // Return OK
+				}
+			} else if deps.ReplayGuard.Seen(reqBody.Token, reqBody.EventID) {
+				deps.AppLogger.Debug("Log Handler: Duplicate event_id '%s' from IP %s for SiteID '%s'", reqBody.EventID, clientIP, reqBody.SiteID)
+				ctx.Header("X-Log-Status", "duplicate")
+				return // Return OK
+			}
+		}
+
 		// 2. Process Rules
 		ruleResult := deps.RuleProcessor.Process(reqBody.SiteID, reqBody.GtmID, ctx.Request)
 
-		// 3. If logging disabled by rules, stop here
+		// 3. If logging disabled by rules or denied consent, stop here
 		if !ruleResult.ShouldLogToServer {
 			return
 		}
+		if ruleResult.ConsentAction == consent.ActionDrop {
+			ctx.Header("X-Log-Status", "consent_denied")
+			return
+		}
+
+		// 4. Validate the client data against the site and rule schemas
+		if schemaErrors, action, quarantine := validatePayload(deps.Config, reqBody.SiteID, ruleResult.AccumulatedPayloadSchemas, reqBody.Data); len(schemaErrors) > 0 {
+			clientIPForLog := iputil.GetClientIP(ctx.Request, parsedTrustedProxies, deps.Config.Server.ClientIPHeader)
+			deps.AppLogger.Debug("Log Handler: Payload from IP %s for SiteID '%s' does not match its schema (%s): %v", clientIPForLog, reqBody.SiteID, action, schemaErrors)
+			switch action {
+			case config.PayloadSchemaDrop:
+				ctx.Header("X-Log-Status", "schema_invalid")
+				return
+			case config.PayloadSchemaQuarantine:
+				ruleResult.TargetDestinations = []string{quarantine}
+			}
+			reqBody.Data[schemaErrorsField] = schemaErrors
+		}
+
+		// 5. Redact personal data in the client data (global and matched rules, destinations are applied per destination)
+		reqBody.Data = deps.Config.Redaction.Apply(reqBody.Data)
+		for _, redaction := range ruleResult.AccumulatedRedactions {
+			reqBody.Data = redaction.Apply(reqBody.Data)
+		}
 
-		// 4. Determine Target Destinations and Log
+		// 6. Determine Target Destinations and Log
 		clientIPForLog := iputil.GetClientIP(ctx.Request, parsedTrustedProxies, deps.Config.Server.ClientIPHeader)
 		baseRecordTemplate := enricher.CreateBaseRecord(reqBody.SiteID, reqBody.GtmID, clientIPForLog)
 
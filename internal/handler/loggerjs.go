@@ -14,6 +14,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/orgoj/weblogproxy/internal/config"
+	"github.com/orgoj/weblogproxy/internal/consent"
 	"github.com/orgoj/weblogproxy/internal/enricher"
 	"github.com/orgoj/weblogproxy/internal/iputil"
 	"github.com/orgoj/weblogproxy/internal/logger"
@@ -36,7 +37,9 @@ type LoggerJsData struct {
 	SiteID            string
 	GtmID             string
 	Token             string
+	TokenExpiresAt    int64  // Token expiration (Unix time)
 	LogURL            string // Full URL for the /log endpoint
+	TokenURL          string // Full URL for the /token endpoint, empty when token refresh is disabled
 	ScriptsToInject   []ScriptInjectionTemplateData
 	GlobalObjectName  string // Name of the global JavaScript object
 	JavaScriptOptions struct {
@@ -143,9 +146,29 @@ func NewLoggerJSHandler(deps LoggerJSHandlerDeps) gin.HandlerFunc {
 			}
 		}
 
+		// Sites may restrict the accepted gtm_id values
+		tokenPolicy := deps.Config.TokenPolicies().Lookup(siteID)
+		if !tokenPolicy.AllowsGtmID(gtmID) {
+			deps.AppLogger.Warn("gtm_id '%s' is not allowed for site_id %s, remote_ip: %s", gtmID, siteID, ctx.ClientIP())
+			executeTemplateAndRespond(ctx, LoggerJsData{
+				GlobalObjectName: deps.Config.Server.JavaScript.GlobalObjectName,
+			}, deps.AppLogger)
+			return
+		}
+
 		// Now that we have valid parameters, process the rules
 		ruleResult := deps.RuleProcessor.Process(siteID, gtmID, ctx.Request)
 
+		// Denied consent gets a no-op script, nothing is logged and no scripts are injected.
+		// The response depends on request headers and cookies, so it must not be cached.
+		if ruleResult.ConsentAction == consent.ActionDrop {
+			ctx.Header("Cache-Control", "no-store")
+			executeTemplateAndRespond(ctx, LoggerJsData{
+				GlobalObjectName: deps.Config.Server.JavaScript.GlobalObjectName,
+			}, deps.AppLogger)
+			return
+		}
+
 		// Log script download if enabled
 		if ruleResult.ShouldLogScriptDownloads {
 			// Create base record with script download specific fields
@@ -200,20 +223,30 @@ func NewLoggerJSHandler(deps LoggerJSHandlerDeps) gin.HandlerFunc {
 		// Generate token and logURL only when logging is enabled
 		if ruleResult.ShouldLogToServer {
 			clientIP := iputil.GetClientIP(ctx.Request, parsedProxies, deps.Config.Server.ClientIPHeader)
-			token, err := security.GenerateToken(deps.Config.Security.Token.Secret, siteID, gtmID, deps.TokenExpirationDur)
+			claims := security.RequestClaims(ctx.Request, clientIP)
+			token, expiresAt, err := issueToken(tokenPolicy, deps.TokenExpirationDur, siteID, gtmID, claims)
 			if err != nil {
 				// Log internal error, but continue; token will be empty
 				deps.AppLogger.Error("Failed to generate token: %v, clientIP: %s, siteID: %s, gtm_id: %s", err, clientIP, siteID, gtmID)
 			} else {
 				data.Token = token
+				data.TokenExpiresAt = expiresAt.Unix()
 			}
 			data.LogURL = buildLogURL(ctx, deps.Config.Server.PathPrefix, deps.Config.Server.Mode, deps.Config.Server.Domain, deps.Config.Server.Protocol)
+			if deps.Config.Security.TokenRefresh.Enabled {
+				data.TokenURL = buildTokenURL(ctx, deps.Config)
+			}
 		}
 
 		// Set cache headers if configured
 		for key, value := range deps.Config.Server.Headers {
 			ctx.Header(key, value)
 		}
+		// Bound tokens are only valid for this client and responses depending on consent only for
+		// this client's consent, shared caches must not serve them to others
+		if tokenPolicy.Binding.Active() || ruleResult.ConsentDependent {
+			ctx.Header("Cache-Control", "private, no-store")
+		}
 
 		// Execute the template
 		executeTemplateAndRespond(ctx, data, deps.AppLogger)
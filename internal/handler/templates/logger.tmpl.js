@@ -10,7 +10,11 @@ Go template comments like this one are not rendered in the output.
         siteId: "{{.SiteID}}",
         gtmId: "{{.GtmID}}",
         token: "{{.Token}}",
+        expiresAt: {{.TokenExpiresAt}},
         logUrl: "{{.LogURL}}",
+        {{if .TokenURL}}
+        tokenUrl: "{{.TokenURL}}",
+        {{end}}
         {{if .ScriptsToInject}}
         scriptsToInject: [
             {{range .ScriptsToInject}}
@@ -34,11 +38,68 @@ Go template comments like this one are not rendered in the output.
     }
     {{end}}
 
+    // Random ID of each event, the server rejects events sent again with the same token and ID
+    function eventId() {
+        const c = window.crypto;
+        if (c && c.randomUUID) {
+            return c.randomUUID();
+        }
+        const bytes = new Uint8Array(16);
+        if (c && c.getRandomValues) {
+            c.getRandomValues(bytes);
+        } else {
+            // No less-than sign, html/template would escape it outside of a script element
+            bytes.forEach(function(_, i) {
+                bytes[i] = Math.floor(Math.random() * 256);
+            });
+        }
+        return Array.from(bytes, b => b.toString(16).padStart(2, '0')).join('');
+    }
+
+    {{if .TokenURL}}
+    // Tokens expire while the page stays open, refresh them before expiresAt
+    let refreshing = null;
+
+    function refreshToken() {
+        if (!refreshing && config.tokenUrl) {
+            refreshing = fetch(config.tokenUrl, {
+                method: 'POST',
+                headers: { 'Content-Type': 'text/plain' },
+                body: JSON.stringify({ token: config.token, site_id: config.siteId, gtm_id: config.gtmId })
+            }).then(function(response) {
+                if (response.status === 401 || response.status === 403) {
+                    // The token cannot be refreshed anymore, a page reload gets a new one
+                    config.tokenUrl = null;
+                }
+                return response.ok ? response.json() : null;
+            }).then(function(result) {
+                if (result && result.token) {
+                    config.token = result.token;
+                    config.expiresAt = result.expires_at;
+                    scheduleRefresh();
+                }
+            }).catch(function() {}).then(function() {
+                refreshing = null;
+            });
+        }
+        return refreshing || Promise.resolve();
+    }
+
+    function scheduleRefresh() {
+        // Refresh after 90% of the remaining lifetime, timers are limited to about 24 days
+        const remaining = config.expiresAt * 1000 - Date.now();
+        setTimeout(refreshToken, Math.min(Math.max(remaining * 0.9, 1000), 2147483647));
+    }
+
+    scheduleRefresh();
+    {{end}}
+
     function sendLog(data) {
         const payload = {
             token: config.token,
             site_id: config.siteId,
             gtm_id: config.gtmId,
+            event_id: eventId(),
             data: {}
         };
 
@@ -55,6 +116,16 @@ Go template comments like this one are not rendered in the output.
         payload.data.__traceback = getCallStack();
         {{end}}
 
+        {{if .TokenURL}}
+        // Timers of background tabs are throttled, so the token may have expired in the meantime
+        if (config.tokenUrl && Date.now() >= config.expiresAt * 1000) {
+            refreshToken().then(function() {
+                payload.token = config.token;
+                navigator.sendBeacon(config.logUrl, JSON.stringify(payload));
+            });
+            return;
+        }
+        {{end}}
         navigator.sendBeacon(config.logUrl, JSON.stringify(payload));
     }
 
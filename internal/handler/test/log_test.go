@@ -0,0 +1,698 @@
+package test
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/orgoj/weblogproxy/internal/config"
+	"github.com/orgoj/weblogproxy/internal/handler"
+	"github.com/orgoj/weblogproxy/internal/logger"
+	"github.com/orgoj/weblogproxy/internal/rules"
+	"github.com/orgoj/weblogproxy/internal/security"
+)
+
+const logTestSecret = "test_token_secret_exactly_32chars"
+
+// newLogTestHandler builds the /log handler from a YAML config loaded like at startup,
+// server and security settings are added.
+func newLogTestHandler(t *testing.T, yamlConfig string) gin.HandlerFunc {
+	t.Helper()
+	return handler.NewLogHandler(newLogTestDeps(t, yamlConfig))
+}
+
+// newLogTestDeps builds the /log handler dependencies like newLogTestHandler.
+func newLogTestDeps(t *testing.T, yamlConfig string) handler.LogHandlerDependencies {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := `
+server:
+  mode: "standalone"
+  domain: "example.com"
+security:
+  token:
+    secret: "` + logTestSecret + `"
+    expiration: "1h"
+` + yamlConfig
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	cfg, err := config.LoadConfig(path)
+	require.NoError(t, err)
+
+	manager := logger.NewManager()
+	require.NoError(t, manager.InitLoggers(cfg.LogDestinations))
+	t.Cleanup(manager.CloseAll)
+	ruleProcessor, err := rules.NewRuleProcessor(cfg)
+	require.NoError(t, err)
+
+	return handler.LogHandlerDependencies{
+		LoggerManager: manager,
+		TokenPolicies: cfg.TokenPolicies(),
+		RuleProcessor: ruleProcessor,
+		Config:        cfg,
+		AppLogger:     logger.GetAppLogger(),
+	}
+}
+
+// postLog sends a /log request with a valid token for the site.
+func postLog(t *testing.T, h gin.HandlerFunc, siteID string, data map[string]interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	token, err := security.GenerateToken(logTestSecret, siteID, "", time.Hour)
+	require.NoError(t, err)
+	return postLogWithToken(t, h, siteID, "", token, data)
+}
+
+// postLogWithToken sends a /log request with the given GTM ID and token.
+func postLogWithToken(t *testing.T, h gin.HandlerFunc, siteID, gtmID, token string, data map[string]interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	body, err := json.Marshal(map[string]interface{}{"token": token, "site_id": siteID, "gtm_id": gtmID, "data": data})
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/log", bytes.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Request.RemoteAddr = "203.0.113.7:1234"
+	h(c)
+	return w
+}
+
+// postLogEvent sends a /log request with the given token and event ID.
+func postLogEvent(t *testing.T, h gin.HandlerFunc, siteID, token, eventID string, data map[string]interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	body, err := json.Marshal(map[string]interface{}{"token": token, "site_id": siteID, "event_id": eventID, "data": data})
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/log", bytes.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	h(c)
+	return w
+}
+
+// readRecords returns the JSON records written to a file destination.
+func readRecords(t *testing.T, path string) []map[string]interface{} {
+	t.Helper()
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	var records []map[string]interface{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var record map[string]interface{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &record))
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestLogHandler_Redaction(t *testing.T) {
+	dir := t.TempDir()
+	h := newLogTestHandler(t, `
+redaction:
+  detectors: ["email"]
+log_destinations:
+  - name: "internal"
+    type: "file"
+    enabled: true
+    path: "`+filepath.Join(dir, "internal.log")+`"
+    format: "json"
+  - name: "vendor"
+    type: "file"
+    enabled: true
+    path: "`+filepath.Join(dir, "vendor.log")+`"
+    format: "json"
+    redaction:
+      fields:
+        - path: "user.id"
+          action: "drop"
+log_config:
+  - condition:
+      site_id: "shop"
+    enabled: true
+    redaction:
+      detectors: ["credit_card"]
+`)
+
+	w := postLog(t, h, "shop", map[string]interface{}{
+		"message": "checkout",
+		"contact": "alice@example.com",
+		"card":    "4111 1111 1111 1111",
+		"user":    map[string]interface{}{"id": "u-42", "plan": "pro"},
+	})
+	require.Equal(t, "success", w.Header().Get("X-Log-Status"))
+
+	internal := readRecords(t, filepath.Join(dir, "internal.log"))
+	require.Len(t, internal, 1)
+	assert.Equal(t, "***@example.com", internal[0]["contact"], "global redaction")
+	assert.Equal(t, "**** **** **** 1111", internal[0]["card"], "rule redaction")
+	assert.Equal(t, map[string]interface{}{"id": "u-42", "plan": "pro"}, internal[0]["user"])
+
+	vendor := readRecords(t, filepath.Join(dir, "vendor.log"))
+	require.Len(t, vendor, 1)
+	assert.Equal(t, "***@example.com", vendor[0]["contact"])
+	assert.Equal(t, map[string]interface{}{"plan": "pro"}, vendor[0]["user"], "destination redaction")
+}
+
+func TestLogHandler_IPAnonymization(t *testing.T) {
+	dir := t.TempDir()
+	h := newLogTestHandler(t, `
+log_destinations:
+  - name: "internal"
+    type: "file"
+    enabled: true
+    path: "`+filepath.Join(dir, "internal.log")+`"
+    format: "json"
+  - name: "vendor"
+    type: "file"
+    enabled: true
+    path: "`+filepath.Join(dir, "vendor.log")+`"
+    format: "json"
+    ip_anonymization:
+      mode: "truncate"
+log_config:
+  - condition:
+      site_id: "shop"
+      ips: ["203.0.113.7"]
+    enabled: true
+    add_log_data:
+      - name: "visitor_ip"
+        source: "client_ip"
+      - name: "visitor"
+        source: "template"
+        value: "ip={{.ClientIP}}"
+  - condition:
+      site_id: "anon"
+    enabled: true
+    ip_anonymization:
+      mode: "drop"
+`)
+
+	// The rule matches the real address, the vendor destination gets it truncated
+	w := postLog(t, h, "shop", map[string]interface{}{"message": "view"})
+	require.Equal(t, "success", w.Header().Get("X-Log-Status"))
+
+	internal := readRecords(t, filepath.Join(dir, "internal.log"))
+	require.Len(t, internal, 1)
+	assert.Equal(t, "203.0.113.7", internal[0]["client_ip"])
+	assert.Equal(t, "203.0.113.7", internal[0]["visitor_ip"])
+	assert.Equal(t, "ip=203.0.113.7", internal[0]["visitor"])
+
+	vendor := readRecords(t, filepath.Join(dir, "vendor.log"))
+	require.Len(t, vendor, 1)
+	assert.Equal(t, "203.0.113.0", vendor[0]["client_ip"])
+	assert.Equal(t, "203.0.113.0", vendor[0]["visitor_ip"])
+	assert.Equal(t, "ip=203.0.113.0", vendor[0]["visitor"])
+
+	// Rule anonymization applies to all destinations
+	w = postLog(t, h, "anon", map[string]interface{}{"message": "view"})
+	require.Equal(t, "success", w.Header().Get("X-Log-Status"))
+	internal = readRecords(t, filepath.Join(dir, "internal.log"))
+	require.Len(t, internal, 2)
+	assert.NotContains(t, internal[1], "client_ip")
+}
+
+func TestLogHandler_Consent(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "consent.log")
+	h := newLogTestHandler(t, `
+consent:
+  honor_gpc: true
+  cookie: "consent"
+  categories: ["analytics"]
+  action: "anonymize"
+log_destinations:
+  - name: "file"
+    type: "file"
+    enabled: true
+    path: "`+logPath+`"
+    format: "json"
+    add_log_data:
+      - name: "session"
+        source: "cookie"
+        value: "sid"
+      - name: "browser"
+        source: "user_agent"
+        value: "browser"
+log_config:
+  - condition:
+      dnt: true
+    enabled: true
+    continue: true
+    consent_action: "strip"
+  - condition:
+      consent:
+        marketing: false
+    enabled: true
+    continue: true
+    consent_action: "drop"
+  - condition:
+      site_id: "shop"
+    enabled: true
+`)
+
+	post := func(headers map[string]string) *httptest.ResponseRecorder {
+		token, err := security.GenerateToken(logTestSecret, "shop", "", time.Hour)
+		require.NoError(t, err)
+		body, err := json.Marshal(map[string]interface{}{"token": token, "site_id": "shop", "data": map[string]interface{}{"message": "view"}})
+		require.NoError(t, err)
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/log", bytes.NewReader(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Request.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64; rv:126.0) Gecko/20100101 Firefox/126.0")
+		for name, value := range headers {
+			c.Request.Header.Set(name, value)
+		}
+		c.Request.RemoteAddr = "203.0.113.7:1234"
+		h(c)
+		return w
+	}
+
+	// Consent granted: full record
+	require.Equal(t, "success", post(map[string]string{"Cookie": "sid=abc; consent=analytics=true"}).Header().Get("X-Log-Status"))
+	// GPC denies under the global policy: anonymized
+	require.Equal(t, "success", post(map[string]string{"Cookie": "sid=abc", "Sec-GPC": "1"}).Header().Get("X-Log-Status"))
+	// DNT rule requests strip, which is stronger than the policy action
+	require.Equal(t, "success", post(map[string]string{"Cookie": "sid=abc", "Sec-GPC": "1", "DNT": "1"}).Header().Get("X-Log-Status"))
+	// Rule drops the record
+	require.Equal(t, "consent_denied", post(map[string]string{"Cookie": "sid=abc; consent=analytics=true,marketing=false"}).Header().Get("X-Log-Status"))
+
+	records := readRecords(t, logPath)
+	require.Len(t, records, 3)
+
+	assert.Equal(t, "203.0.113.7", records[0]["client_ip"])
+	assert.Equal(t, "abc", records[0]["session"])
+	assert.Equal(t, "Firefox", records[0]["browser"])
+
+	assert.Equal(t, "203.0.113.0", records[1]["client_ip"])
+	assert.NotContains(t, records[1], "session")
+	assert.Equal(t, "Firefox", records[1]["browser"])
+
+	assert.NotContains(t, records[2], "client_ip")
+	assert.NotContains(t, records[2], "session")
+	assert.NotContains(t, records[2], "browser")
+	assert.Equal(t, "view", records[2]["msg"])
+}
+
+func TestLogHandler_Transform(t *testing.T) {
+	dir := t.TempDir()
+	h := newLogTestHandler(t, `
+log_destinations:
+  - name: "internal"
+    type: "file"
+    enabled: true
+    path: "`+filepath.Join(dir, "internal.log")+`"
+    format: "json"
+  - name: "vendor"
+    type: "file"
+    enabled: true
+    path: "`+filepath.Join(dir, "vendor.log")+`"
+    format: "json"
+    transform:
+      - op: "cast"
+        path: "order.total"
+        type: "float"
+      - op: "flatten"
+        path: "order"
+        separator: "_"
+      - op: "drop"
+        paths: ["debug*"]
+log_config:
+  - condition:
+      site_id: "shop"
+    enabled: true
+    transform:
+      - op: "rename"
+        from: "msg"
+        to: "message"
+`)
+
+	w := postLog(t, h, "shop", map[string]interface{}{
+		"message":    "checkout",
+		"order":      map[string]interface{}{"id": "o-1", "total": "99.90"},
+		"debug_info": "x",
+	})
+	require.Equal(t, "success", w.Header().Get("X-Log-Status"))
+
+	internal := readRecords(t, filepath.Join(dir, "internal.log"))
+	require.Len(t, internal, 1)
+	assert.Equal(t, "checkout", internal[0]["message"])
+	assert.NotContains(t, internal[0], "msg")
+	assert.Equal(t, map[string]interface{}{"id": "o-1", "total": "99.90"}, internal[0]["order"], "destination transforms must not leak")
+	assert.Equal(t, "x", internal[0]["debug_info"])
+
+	vendor := readRecords(t, filepath.Join(dir, "vendor.log"))
+	require.Len(t, vendor, 1)
+	assert.Equal(t, "checkout", vendor[0]["message"])
+	assert.Equal(t, "o-1", vendor[0]["order_id"])
+	assert.Equal(t, 99.9, vendor[0]["order_total"])
+	assert.NotContains(t, vendor[0], "debug_info")
+}
+
+func TestLogHandler_Schema(t *testing.T) {
+	dir := t.TempDir()
+	h := newLogTestHandler(t, `
+log_destinations:
+  - name: "elastic"
+    type: "file"
+    enabled: true
+    path: "`+filepath.Join(dir, "elastic.log")+`"
+    format: "json"
+    schema:
+      format: "ecs"
+      namespace: "shop"
+log_config:
+  - condition:
+      site_id: "shop"
+    enabled: true
+`)
+
+	w := postLog(t, h, "shop", map[string]interface{}{"message": "checkout", "order_id": "o-1"})
+	require.Equal(t, "success", w.Header().Get("X-Log-Status"))
+
+	records := readRecords(t, filepath.Join(dir, "elastic.log"))
+	require.Len(t, records, 1)
+	assert.Equal(t, "checkout", records[0]["message"])
+	assert.Contains(t, records[0], "@timestamp")
+	assert.Equal(t, map[string]interface{}{"level": "info"}, records[0]["log"])
+	assert.Equal(t, map[string]interface{}{"ip": "203.0.113.7"}, records[0]["client"])
+	assert.Equal(t, map[string]interface{}{"site_id": "shop", "order_id": "o-1"}, records[0]["shop"])
+	assert.NotContains(t, records[0], "msg")
+}
+
+func TestLogHandler_PayloadSchema(t *testing.T) {
+	dir := t.TempDir()
+	h := newLogTestHandler(t, `
+payload_schemas:
+  shop:
+    on_error: "quarantine"
+    quarantine_destination: "quarantine"
+    schema:
+      type: "object"
+      required: ["event"]
+      properties:
+        event:
+          enum: ["view", "checkout"]
+log_destinations:
+  - name: "main"
+    type: "file"
+    enabled: true
+    path: "`+filepath.Join(dir, "main.log")+`"
+    format: "json"
+  - name: "quarantine"
+    type: "file"
+    enabled: true
+    path: "`+filepath.Join(dir, "quarantine.log")+`"
+    format: "json"
+log_config:
+  - condition:
+      site_id: "blog"
+    enabled: true
+    log_destinations: ["main"]
+    payload_schema:
+      schema:
+        properties:
+          page:
+            type: "string"
+  - condition:
+      site_id: "shop"
+      headers:
+        X-Strict: true
+    enabled: true
+    log_destinations: ["main"]
+    payload_schema:
+      on_error: "drop"
+      schema:
+        required: ["order_id"]
+  - condition:
+      site_id: "shop"
+    enabled: true
+    log_destinations: ["main"]
+`)
+
+	// Valid payload goes to the rule destination
+	require.Equal(t, "success", postLog(t, h, "shop", map[string]interface{}{"event": "view"}).Header().Get("X-Log-Status"))
+	// Invalid site payload is quarantined
+	require.Equal(t, "success", postLog(t, h, "shop", map[string]interface{}{"event": "click"}).Header().Get("X-Log-Status"))
+	// Invalid rule payload is annotated (default on_error)
+	require.Equal(t, "success", postLog(t, h, "blog", map[string]interface{}{"page": 3}).Header().Get("X-Log-Status"))
+
+	main := readRecords(t, filepath.Join(dir, "main.log"))
+	require.Len(t, main, 2)
+	assert.Equal(t, "view", main[0]["event"])
+	assert.NotContains(t, main[0], "_schema_errors")
+	assert.Equal(t, []interface{}{"/page: expected string, got integer"}, main[1]["_schema_errors"])
+
+	quarantine := readRecords(t, filepath.Join(dir, "quarantine.log"))
+	require.Len(t, quarantine, 1)
+	assert.Equal(t, "click", quarantine[0]["event"])
+	assert.Equal(t, []interface{}{`/event: must be one of ["view","checkout"]`}, quarantine[0]["_schema_errors"])
+
+	// The strongest action of all failing schemas wins
+	token, err := security.GenerateToken(logTestSecret, "shop", "", time.Hour)
+	require.NoError(t, err)
+	body, err := json.Marshal(map[string]interface{}{"token": token, "site_id": "shop", "data": map[string]interface{}{"event": "click"}})
+	require.NoError(t, err)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/log", bytes.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Request.Header.Set("X-Strict", "1")
+	h(c)
+	assert.Equal(t, "schema_invalid", w.Header().Get("X-Log-Status"))
+	assert.Len(t, readRecords(t, filepath.Join(dir, "quarantine.log")), 1)
+}
+
+func TestLogHandler_SiteTokenPolicy(t *testing.T) {
+	dir := t.TempDir()
+	const tenantSecret = "tenant_token_secret_exactly_32ch"
+	// The indented sites key continues the security section added by newLogTestHandler
+	h := newLogTestHandler(t, `
+  sites:
+    tenant:
+      secret: "`+tenantSecret+`"
+      allowed_gtm_ids: ["GTM-OK"]
+log_destinations:
+  - name: "file"
+    type: "file"
+    enabled: true
+    path: "`+filepath.Join(dir, "file.log")+`"
+    format: "json"
+log_config:
+  - condition: {}
+    enabled: true
+`)
+	tenantToken := func(gtmID string) string {
+		keyring, err := security.NewKeyring([]security.Key{{ID: security.DefaultKeyID, Secret: tenantSecret}}, security.DefaultKeyID, true)
+		require.NoError(t, err)
+		token, err := keyring.Generate("tenant", gtmID, time.Hour)
+		require.NoError(t, err)
+		return token
+	}
+	globalToken, err := security.GenerateToken(logTestSecret, "tenant", "GTM-OK", time.Hour)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		gtmID  string
+		token  string
+		status string
+	}{
+		{"tenant secret and allowed gtm_id", "GTM-OK", tenantToken("GTM-OK"), "success"},
+		{"global secret", "GTM-OK", globalToken, "failure"},
+		{"gtm_id not allowed", "GTM-OTHER", tenantToken("GTM-OTHER"), "failure"},
+		{"missing gtm_id", "", tenantToken(""), "failure"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := postLogWithToken(t, h, "tenant", tt.gtmID, tt.token, map[string]interface{}{"message": tt.name})
+			assert.Equal(t, tt.status, w.Header().Get("X-Log-Status"))
+		})
+	}
+
+	// Other sites keep using the global secret
+	w := postLog(t, h, "other", map[string]interface{}{"message": "other"})
+	assert.Equal(t, "success", w.Header().Get("X-Log-Status"))
+	assert.Len(t, readRecords(t, filepath.Join(dir, "file.log")), 2)
+}
+
+func TestLogHandler_TokenBinding(t *testing.T) {
+	dir := t.TempDir()
+	// The indented binding key continues the security.token section added by newLogTestHandler
+	h := newLogTestHandler(t, `    binding:
+      ip: true
+      user_agent: true
+log_destinations:
+  - name: "file"
+    type: "file"
+    enabled: true
+    path: "`+filepath.Join(dir, "file.log")+`"
+    format: "json"
+log_config:
+  - condition: {}
+    enabled: true
+`)
+	keyring, err := security.NewKeyring([]security.Key{{ID: security.DefaultKeyID, Secret: logTestSecret}}, security.DefaultKeyID, true)
+	require.NoError(t, err)
+	binding := &security.Binding{IP: true, UserAgent: true}
+	bound := func(ipNetwork string) string {
+		token, err := keyring.GenerateBound("shop", "", time.Hour, binding, security.Claims{IPNetwork: ipNetwork})
+		require.NoError(t, err)
+		return token
+	}
+	legacy, err := security.GenerateToken(logTestSecret, "shop", "", time.Hour)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		token  string
+		status string
+	}{
+		{"same client network", bound("203.0.113.0/24"), "success"},
+		{"other client network", bound("198.51.100.0/24"), "failure"},
+		{"unbound token", legacy, "failure"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := postLogWithToken(t, h, "shop", "", tt.token, map[string]interface{}{"message": tt.name})
+			assert.Equal(t, tt.status, w.Header().Get("X-Log-Status"))
+		})
+	}
+	assert.Len(t, readRecords(t, filepath.Join(dir, "file.log")), 1)
+}
+
+func TestLogHandler_TokenRateLimit(t *testing.T) {
+	deps := newLogTestDeps(t, `
+log_config:
+  - condition: {}
+    enabled: true
+`)
+	deps.TokenRateLimiter = security.NewTokenValidationRateLimiter(2, time.Minute, time.Hour)
+	t.Cleanup(deps.TokenRateLimiter.Stop)
+	h := handler.NewLogHandler(deps)
+	data := map[string]interface{}{"message": "test"}
+
+	// Failures for one site block the client for that site first
+	assert.Equal(t, "failure", postLogWithToken(t, h, "shop", "", "invalid", data).Header().Get("X-Log-Status"))
+	assert.Equal(t, "failure", postLogWithToken(t, h, "shop", "", "invalid", data).Header().Get("X-Log-Status"))
+
+	w := postLog(t, h, "shop", data)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "blocked", w.Header().Get("X-Log-Status"))
+	assert.Equal(t, "invalid_tokens_from_ip", w.Header().Get("X-Log-Block-Reason"))
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+
+	// The per-IP key blocks other sites as well
+	w = postLog(t, h, "blog", data)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+}
+
+func TestLogHandler_TokenRateLimitCountsOnlyForgedTokens(t *testing.T) {
+	deps := newLogTestDeps(t, `
+log_config:
+  - condition: {}
+    enabled: true
+`)
+	deps.TokenRateLimiter = security.NewTokenValidationRateLimiter(2, time.Minute, time.Hour)
+	t.Cleanup(deps.TokenRateLimiter.Stop)
+	h := handler.NewLogHandler(deps)
+	data := map[string]interface{}{"message": "test"}
+
+	// Correctly signed but expired tokens, e.g. of long open pages, do not count
+	past := time.Now().Add(-time.Minute).Unix()
+	mac := hmac.New(sha256.New, []byte(logTestSecret))
+	mac.Write([]byte(fmt.Sprintf("shop::%d", past)))
+	expired := fmt.Sprintf("%d:%s", past, hex.EncodeToString(mac.Sum(nil)))
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, "failure", postLogWithToken(t, h, "shop", "", expired, data).Header().Get("X-Log-Status"))
+	}
+	assert.Equal(t, http.StatusOK, postLog(t, h, "shop", data).Code)
+
+	// Valid requests between forged tokens do not reset the failure count
+	postLogWithToken(t, h, "shop", "", "invalid", data)
+	assert.Equal(t, http.StatusOK, postLog(t, h, "shop", data).Code)
+	postLogWithToken(t, h, "shop", "", "invalid", data)
+	assert.Equal(t, http.StatusTooManyRequests, postLog(t, h, "shop", data).Code)
+}
+
+func TestLogHandler_ReplayProtection(t *testing.T) {
+	dir := t.TempDir()
+	deps := newLogTestDeps(t, `
+  replay_protection:
+    enabled: true
+log_destinations:
+  - name: "main"
+    type: "file"
+    enabled: true
+    path: "`+filepath.Join(dir, "main.log")+`"
+    format: "json"
+log_config:
+  - condition: {}
+    enabled: true
+`)
+	assert.Equal(t, "1h", deps.Config.Security.ReplayProtection.Window, "window defaults to the token expiration")
+	deps.ReplayGuard = security.NewReplayGuard(time.Hour, 100)
+	h := handler.NewLogHandler(deps)
+	token, err := security.GenerateToken(logTestSecret, "shop", "", time.Hour)
+	require.NoError(t, err)
+	before := security.ReplayStats()
+
+	assert.Equal(t, "success", postLogEvent(t, h, "shop", token, "e1", map[string]interface{}{"n": 1}).Header().Get("X-Log-Status"))
+	assert.Equal(t, "duplicate", postLogEvent(t, h, "shop", token, "e1", map[string]interface{}{"n": 2}).Header().Get("X-Log-Status"))
+	assert.Equal(t, "success", postLogEvent(t, h, "shop", token, "e2", map[string]interface{}{"n": 3}).Header().Get("X-Log-Status"))
+	// Events without event_id are accepted unless require_event_id is set
+	assert.Equal(t, "success", postLogEvent(t, h, "shop", token, "", map[string]interface{}{"n": 4}).Header().Get("X-Log-Status"))
+	// Invalid tokens are rejected before the event is remembered
+	assert.Equal(t, "failure", postLogEvent(t, h, "shop", "invalid", "e3", map[string]interface{}{"n": 5}).Header().Get("X-Log-Status"))
+	assert.Equal(t, "success", postLogEvent(t, h, "shop", token, "e3", map[string]interface{}{"n": 6}).Header().Get("X-Log-Status"))
+
+	records := readRecords(t, filepath.Join(dir, "main.log"))
+	require.Len(t, records, 4)
+	for i, n := range []float64{1, 3, 4, 6} {
+		assert.Equal(t, n, records[i]["n"])
+	}
+	assert.Equal(t, before+1, security.ReplayStats())
+}
+
+func TestLogHandler_ReplayProtectionRequireEventID(t *testing.T) {
+	deps := newLogTestDeps(t, `
+  replay_protection:
+    enabled: true
+    require_event_id: true
+log_destinations:
+  - name: "main"
+    type: "file"
+    enabled: true
+    path: "`+filepath.Join(t.TempDir(), "main.log")+`"
+    format: "json"
+log_config:
+  - condition: {}
+    enabled: true
+`)
+	deps.ReplayGuard = security.NewReplayGuard(time.Hour, 100)
+	h := handler.NewLogHandler(deps)
+	token, err := security.GenerateToken(logTestSecret, "shop", "", time.Hour)
+	require.NoError(t, err)
+	data := map[string]interface{}{"message": "test"}
+
+	assert.Equal(t, "failure", postLogEvent(t, h, "shop", token, "", data).Header().Get("X-Log-Status"))
+	assert.Equal(t, "success", postLogEvent(t, h, "shop", token, "e1", data).Header().Get("X-Log-Status"))
+}
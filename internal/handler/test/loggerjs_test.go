@@ -3,6 +3,9 @@ package test
 import (
 	"net/http"
 	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -11,7 +14,9 @@ import (
 	"github.com/orgoj/weblogproxy/internal/handler"
 	"github.com/orgoj/weblogproxy/internal/logger"
 	"github.com/orgoj/weblogproxy/internal/rules"
+	"github.com/orgoj/weblogproxy/internal/security"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestLoggerJSHandler_MissingSiteID(t *testing.T) {
@@ -178,6 +183,8 @@ func TestLoggerJSHandler_WithJavaScriptOptions(t *testing.T) {
 	assert.Equal(t, http.StatusOK, w.Code, "Should return 200 OK status")
 	assert.Contains(t, w.Header().Get("Content-Type"), "application/javascript", "Content-Type should be javascript")
 	assert.Contains(t, w.Body.String(), "payload.data.__url = window.location.href;", "Should set __url in payload if enabled")
+	assert.Contains(t, w.Body.String(), "event_id: eventId(),", "Should attach a random event ID to the payload")
+	assert.NotContains(t, w.Body.String(), "&lt;", "Script must not contain HTML-escaped characters")
 	assert.Contains(t, w.Body.String(), "payload.data.__traceback = getCallStack();", "Should set __traceback in payload if enabled")
 }
 
@@ -284,3 +291,220 @@ func TestLoggerJSHandler_WithDotInSiteID(t *testing.T) {
 	assert.NotContains(t, w.Body.String(), "logEnabled: true", "Should NOT enable logging for site_id with dots (security)")
 	assert.Contains(t, w.Body.String(), "window.wlp.log = function() {};", "Should return disabled logger stub")
 }
+
+func TestLoggerJSHandler_ConsentDenied(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	testConfig := &config.Config{}
+	testConfig.Server.JavaScript.GlobalObjectName = "wlp"
+	testConfig.Security.Token.Secret = "test-secret"
+	testConfig.Server.Headers = map[string]string{"Cache-Control": "public, max-age=3600"}
+	testConfig.Consent = &config.Consent{HonorGPC: true, Cookie: "consent", Categories: []string{"analytics"}, Action: "drop"}
+	testConfig.LogConfig = []config.LogRule{
+		{
+			Condition:       config.LogRuleCondition{SiteID: "test-site"},
+			Enabled:         true,
+			ScriptInjection: []config.ScriptInjectionSpec{{URL: "https://cdn.example.com/analytics.js"}},
+		},
+	}
+
+	ruleProcessor, _ := rules.NewRuleProcessor(testConfig)
+	handlerFunc := handler.NewLoggerJSHandler(handler.LoggerJSHandlerDeps{
+		RuleProcessor:      ruleProcessor,
+		Config:             testConfig,
+		TokenExpirationDur: 10 * time.Minute,
+		AppLogger:          logger.GetAppLogger(),
+		LoggerManager:      logger.NewManager(),
+	})
+
+	serve := func(setup func(r *http.Request)) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest("GET", "/logger.js?site_id=test-site", nil)
+		setup(c.Request)
+		handlerFunc(c)
+		return w
+	}
+
+	denied := []struct {
+		name  string
+		setup func(r *http.Request)
+	}{
+		{"GPC", func(r *http.Request) { r.Header.Set("Sec-GPC", "1") }},
+		{"consent cookie", func(r *http.Request) { r.AddCookie(&http.Cookie{Name: "consent", Value: "analytics=false"}) }},
+	}
+	for _, tc := range denied {
+		t.Run(tc.name, func(t *testing.T) {
+			w := serve(tc.setup)
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+			assert.Contains(t, w.Body.String(), "window.wlp.log = function() {}", "Should return no-op log function")
+			assert.NotContains(t, w.Body.String(), "analytics.js", "Should not inject scripts")
+		})
+	}
+
+	t.Run("granted", func(t *testing.T) {
+		w := serve(func(r *http.Request) { r.AddCookie(&http.Cookie{Name: "consent", Value: "analytics=true"}) })
+		assert.NotContains(t, w.Body.String(), "window.wlp.log = function() {}")
+		assert.Contains(t, w.Body.String(), "analytics.js")
+		// The granted script must not be served from a shared cache to clients denying consent
+		assert.Equal(t, "private, no-store", w.Header().Get("Cache-Control"))
+	})
+}
+
+func TestLoggerJSHandler_ConsentRuleNotCached(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	serve := func(condition config.LogRuleCondition) string {
+		testConfig := &config.Config{}
+		testConfig.Server.JavaScript.GlobalObjectName = "wlp"
+		testConfig.Server.Headers = map[string]string{"Cache-Control": "public, max-age=3600"}
+		testConfig.Security.Token.Secret = "test-secret"
+		testConfig.LogConfig = []config.LogRule{{Condition: condition, Enabled: true}}
+		ruleProcessor, err := rules.NewRuleProcessor(testConfig)
+		require.NoError(t, err)
+		handlerFunc := handler.NewLoggerJSHandler(handler.LoggerJSHandlerDeps{
+			RuleProcessor:      ruleProcessor,
+			Config:             testConfig,
+			TokenExpirationDur: 10 * time.Minute,
+			AppLogger:          logger.GetAppLogger(),
+			LoggerManager:      logger.NewManager(),
+		})
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest("GET", "/logger.js?site_id=test-site", nil)
+		handlerFunc(c)
+		return w.Header().Get("Cache-Control")
+	}
+
+	gpc := false
+	assert.Equal(t, "private, no-store", serve(config.LogRuleCondition{GPC: &gpc}), "rules with consent conditions")
+	assert.Equal(t, "public, max-age=3600", serve(config.LogRuleCondition{}), "without consent the configured headers apply")
+}
+
+func TestLoggerJSHandler_SiteTokenPolicy(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	testConfig := &config.Config{}
+	testConfig.Server.JavaScript.GlobalObjectName = "wlp"
+	testConfig.Security.Token.Secret = "test-secret"
+	testConfig.LogConfig = []config.LogRule{{Condition: config.LogRuleCondition{}, Enabled: true}}
+	tenantKeys, err := security.NewKeyring([]security.Key{{ID: "tenant-1", Secret: "tenant-secret"}}, "tenant-1", true)
+	require.NoError(t, err)
+	testConfig.Security.Policies = security.NewPolicies(security.Policy{Keyring: testConfig.TokenKeyring()}, map[string]security.Policy{
+		"tenant": {Keyring: tenantKeys, Expiration: 5 * time.Minute, AllowedGtmIDs: []string{"GTM-OK"}},
+	})
+
+	ruleProcessor, _ := rules.NewRuleProcessor(testConfig)
+	handlerFunc := handler.NewLoggerJSHandler(handler.LoggerJSHandlerDeps{
+		RuleProcessor:      ruleProcessor,
+		Config:             testConfig,
+		TokenExpirationDur: 10 * time.Minute,
+		AppLogger:          logger.GetAppLogger(),
+		LoggerManager:      logger.NewManager(),
+	})
+	serve := func(query string) string {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest("GET", "/logger.js?"+query, nil)
+		handlerFunc(c)
+		return w.Body.String()
+	}
+	tokenOf := func(body string) string {
+		match := regexp.MustCompile(`token: "([^"]*)"`).FindStringSubmatch(body)
+		require.Len(t, match, 2, body)
+		return match[1]
+	}
+
+	// The site's own key and expiration are used
+	token := tokenOf(serve("site_id=tenant&gtm_id=GTM-OK"))
+	parts := strings.Split(token, ":")
+	require.Len(t, parts, 3)
+	assert.Equal(t, "tenant-1", parts[0])
+	expiresAt, err := strconv.ParseInt(parts[1], 10, 64)
+	require.NoError(t, err)
+	assert.InDelta(t, time.Now().Add(5*time.Minute).Unix(), expiresAt, 5)
+	valid, _ := tenantKeys.Validate("tenant", "GTM-OK", token)
+	assert.True(t, valid)
+
+	// Other gtm_id values get the disabled stub
+	for _, query := range []string{"site_id=tenant&gtm_id=GTM-OTHER", "site_id=tenant"} {
+		assert.Contains(t, serve(query), "window.wlp.log = function() {};", query)
+	}
+
+	// Other sites keep the default key and expiration
+	token = tokenOf(serve("site_id=other&gtm_id=GTM-OTHER"))
+	assert.True(t, strings.HasPrefix(token, security.DefaultKeyID+":"))
+}
+
+func TestLoggerJSHandler_TokenRefresh(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	serve := func(refresh bool) string {
+		testConfig := &config.Config{}
+		testConfig.Server.JavaScript.GlobalObjectName = "wlp"
+		testConfig.Server.PathPrefix = "/wlp"
+		testConfig.Security.Token.Secret = "test-secret"
+		testConfig.Security.TokenRefresh.Enabled = refresh
+		testConfig.LogConfig = []config.LogRule{{Condition: config.LogRuleCondition{}, Enabled: true}}
+		ruleProcessor, _ := rules.NewRuleProcessor(testConfig)
+		handlerFunc := handler.NewLoggerJSHandler(handler.LoggerJSHandlerDeps{
+			RuleProcessor:      ruleProcessor,
+			Config:             testConfig,
+			TokenExpirationDur: 10 * time.Minute,
+			AppLogger:          logger.GetAppLogger(),
+			LoggerManager:      logger.NewManager(),
+		})
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest("GET", "/logger.js?site_id=shop", nil)
+		handlerFunc(c)
+		return w.Body.String()
+	}
+
+	body := serve(true)
+	match := regexp.MustCompile(`expiresAt: *(\d+)`).FindStringSubmatch(body)
+	require.Len(t, match, 2, body)
+	expiresAt, err := strconv.ParseInt(match[1], 10, 64)
+	require.NoError(t, err)
+	assert.InDelta(t, time.Now().Add(10*time.Minute).Unix(), expiresAt, 5)
+	assert.Regexp(t, `tokenUrl: "\\?/wlp\\?/token"`, body)
+	assert.Contains(t, body, "scheduleRefresh();")
+	assert.NotContains(t, body, "&lt;")
+	// The token is sent in the body, credentials would break CORS with a wildcard origin
+	assert.NotContains(t, body, "credentials")
+
+	body = serve(false)
+	assert.NotContains(t, body, "tokenUrl")
+	assert.NotContains(t, body, "refreshToken")
+}
+
+func TestLoggerJSHandler_BoundTokenNotCached(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	serve := func(binding *security.Binding) *httptest.ResponseRecorder {
+		testConfig := &config.Config{}
+		testConfig.Server.JavaScript.GlobalObjectName = "wlp"
+		testConfig.Server.Headers = map[string]string{"Cache-Control": "public, max-age=3600"}
+		testConfig.Security.Token.Secret = "test-secret"
+		testConfig.LogConfig = []config.LogRule{{Condition: config.LogRuleCondition{}, Enabled: true}}
+		testConfig.Security.Policies = security.NewPolicies(security.Policy{Keyring: testConfig.TokenKeyring(), Binding: binding}, nil)
+		ruleProcessor, _ := rules.NewRuleProcessor(testConfig)
+		handlerFunc := handler.NewLoggerJSHandler(handler.LoggerJSHandlerDeps{
+			RuleProcessor:      ruleProcessor,
+			Config:             testConfig,
+			TokenExpirationDur: 10 * time.Minute,
+			AppLogger:          logger.GetAppLogger(),
+			LoggerManager:      logger.NewManager(),
+		})
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest("GET", "/logger.js?site_id=shop", nil)
+		handlerFunc(c)
+		return w
+	}
+
+	// Configured cache headers apply to unbound tokens, bound tokens are private to the client
+	assert.Equal(t, "public, max-age=3600", serve(nil).Header().Get("Cache-Control"))
+	assert.Equal(t, "private, no-store", serve(&security.Binding{IP: true}).Header().Get("Cache-Control"))
+}
@@ -0,0 +1,159 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/orgoj/weblogproxy/internal/config"
+	"github.com/orgoj/weblogproxy/internal/handler"
+	"github.com/orgoj/weblogproxy/internal/security"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTokenRefreshTestHandler creates a /token handler for the config snippet appended to the
+// token_refresh section with token refresh enabled.
+func newTokenRefreshTestHandler(t *testing.T, yamlConfig string) (gin.HandlerFunc, handler.LogHandlerDependencies) {
+	t.Helper()
+	deps := newLogTestDeps(t, `
+  token_refresh:
+    enabled: true
+`+yamlConfig)
+	grace, err := config.ParseNonNegativeDuration(deps.Config.Security.TokenRefresh.GracePeriod)
+	require.NoError(t, err)
+	return handler.NewTokenRefreshHandler(handler.TokenRefreshHandlerDeps{
+		RuleProcessor:      deps.RuleProcessor,
+		Config:             deps.Config,
+		TokenExpirationDur: time.Hour,
+		GracePeriod:        grace,
+		AppLogger:          deps.AppLogger,
+	}), deps
+}
+
+// postToken sends a /token request and returns the response.
+func postToken(t *testing.T, h gin.HandlerFunc, body map[string]interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	data, err := json.Marshal(body)
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/token", bytes.NewReader(data))
+	// logger.js sends text/plain to avoid CORS preflight requests
+	c.Request.Header.Set("Content-Type", "text/plain")
+	c.Request.RemoteAddr = "203.0.113.7:1234"
+	h(c)
+	return w
+}
+
+func TestTokenRefreshHandler(t *testing.T) {
+	h, deps := newTokenRefreshTestHandler(t, `
+log_config:
+  - condition:
+      site_id: "shop"
+    enabled: true
+`)
+	keyring := deps.Config.TokenKeyring()
+	token, err := keyring.Generate("shop", "GTM-1", time.Minute)
+	require.NoError(t, err)
+
+	w := postToken(t, h, map[string]interface{}{"token": token, "site_id": "shop", "gtm_id": "GTM-1"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	var resp handler.TokenRefreshResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.InDelta(t, time.Now().Add(time.Hour).Unix(), resp.ExpiresAt, 5)
+	valid, err := keyring.Validate("shop", "GTM-1", resp.Token)
+	assert.True(t, valid)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		body   map[string]interface{}
+		status int
+	}{
+		{"Invalid token", map[string]interface{}{"token": "invalid", "site_id": "shop", "gtm_id": "GTM-1"}, http.StatusUnauthorized},
+		{"Token of another site", map[string]interface{}{"token": token, "site_id": "blog", "gtm_id": "GTM-1"}, http.StatusUnauthorized},
+		{"Missing token", map[string]interface{}{"site_id": "shop"}, http.StatusBadRequest},
+		{"Invalid site_id", map[string]interface{}{"token": token, "site_id": "shop!"}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.status, postToken(t, h, tt.body).Code)
+		})
+	}
+
+	// Sites without logging get no new token
+	blogToken, err := keyring.Generate("blog", "", time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, postToken(t, h, map[string]interface{}{"token": blogToken, "site_id": "blog"}).Code)
+}
+
+func TestTokenRefreshHandler_GracePeriod(t *testing.T) {
+	h, deps := newTokenRefreshTestHandler(t, `
+    grace_period: "1h"
+log_config:
+  - condition: {}
+    enabled: true
+`)
+	// 0s refreshes only unexpired tokens
+	strict, _ := newTokenRefreshTestHandler(t, `
+    grace_period: "0s"
+log_config:
+  - condition: {}
+    enabled: true
+`)
+	token, err := deps.Config.TokenKeyring().Generate("shop", "", time.Second)
+	require.NoError(t, err)
+	time.Sleep(2 * time.Second)
+
+	body := map[string]interface{}{"token": token, "site_id": "shop"}
+	assert.Equal(t, http.StatusUnauthorized, postToken(t, strict, body).Code, "expired token without grace period")
+	assert.Equal(t, http.StatusOK, postToken(t, h, body).Code, "expired token within the grace period")
+}
+
+func TestTokenRefreshHandler_SitePolicy(t *testing.T) {
+	deps := newLogTestDeps(t, `
+  token_refresh:
+    enabled: true
+  sites:
+    shop:
+      expiration: "5m"
+      allowed_gtm_ids: ["GTM-OK"]
+log_config:
+  - condition: {}
+    enabled: true
+`)
+	limiter := security.NewTokenValidationRateLimiter(2, time.Minute, time.Hour)
+	t.Cleanup(limiter.Stop)
+	h := handler.NewTokenRefreshHandler(handler.TokenRefreshHandlerDeps{
+		RuleProcessor:      deps.RuleProcessor,
+		Config:             deps.Config,
+		TokenRateLimiter:   limiter,
+		TokenExpirationDur: time.Hour,
+		AppLogger:          deps.AppLogger,
+	})
+	token, err := deps.Config.TokenKeyring().Generate("shop", "GTM-OK", time.Minute)
+	require.NoError(t, err)
+
+	// The site expiration applies to refreshed tokens
+	w := postToken(t, h, map[string]interface{}{"token": token, "site_id": "shop", "gtm_id": "GTM-OK"})
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp handler.TokenRefreshResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.InDelta(t, time.Now().Add(5*time.Minute).Unix(), resp.ExpiresAt, 5)
+
+	assert.Equal(t, http.StatusForbidden, postToken(t, h, map[string]interface{}{"token": token, "site_id": "shop", "gtm_id": "GTM-OTHER"}).Code)
+
+	// Invalid tokens count towards the token rate limit
+	postToken(t, h, map[string]interface{}{"token": "invalid", "site_id": "shop", "gtm_id": "GTM-OK"})
+	postToken(t, h, map[string]interface{}{"token": "invalid", "site_id": "shop", "gtm_id": "GTM-OK"})
+	w = postToken(t, h, map[string]interface{}{"token": token, "site_id": "shop", "gtm_id": "GTM-OK"})
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+}
@@ -0,0 +1,161 @@
+package handler
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/orgoj/weblogproxy/internal/config"
+	"github.com/orgoj/weblogproxy/internal/consent"
+	"github.com/orgoj/weblogproxy/internal/iputil"
+	"github.com/orgoj/weblogproxy/internal/logger"
+	"github.com/orgoj/weblogproxy/internal/rules"
+	"github.com/orgoj/weblogproxy/internal/security"
+	"github.com/orgoj/weblogproxy/internal/validation"
+)
+
+// TokenRefreshRequest defines the structure for the /token endpoint request body
+type TokenRefreshRequest struct {
+	Token  string `json:"token" binding:"required"`
+	SiteID string `json:"site_id" binding:"required"`
+	GtmID  string `json:"gtm_id"` // Optional
+}
+
+// TokenRefreshResponse is the /token response with the new token and its expiration (Unix time).
+type TokenRefreshResponse struct {
+	Token     string `json:"token"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+// TokenRefreshHandlerDeps holds dependencies for the token refresh handler.
+type TokenRefreshHandlerDeps struct {
+	RuleProcessor *rules.RuleProcessor
+	Config        *config.Config
+	// TokenRateLimiter blocks clients sending invalid tokens, nil disables blocking
+	TokenRateLimiter   *security.TokenValidationRateLimiter
+	TrustedProxies     []string
+	TokenExpirationDur time.Duration
+	GracePeriod        time.Duration // How long after expiration tokens can still be refreshed
+	AppLogger          *logger.AppLogger
+}
+
+// NewTokenRefreshHandler creates a Gin handler function for the /token endpoint. A valid token,
+// or one expired less than the grace period ago, is exchanged for a fresh token if the rules
+// evaluated for the request still enable logging, as for /logger.js.
+func NewTokenRefreshHandler(deps TokenRefreshHandlerDeps) gin.HandlerFunc {
+	if deps.RuleProcessor == nil {
+		panic("TokenRefreshHandler requires a non-nil RuleProcessor")
+	}
+	if deps.Config == nil {
+		panic("TokenRefreshHandler requires a non-nil Config")
+	}
+	if deps.AppLogger == nil {
+		panic("TokenRefreshHandler requires a non-nil AppLogger")
+	}
+
+	parsedTrustedProxies, err := iputil.ParseCIDRs(deps.TrustedProxies)
+	if err != nil {
+		deps.AppLogger.Error("Failed to parse trusted proxies for token refresh handler: %v", err)
+	}
+
+	return func(ctx *gin.Context) {
+		// The response depends on the token, it must never be cached
+		ctx.Header("Cache-Control", "no-store")
+
+		if deps.Config.Server.RequestLimits.MaxBodySize > 0 {
+			ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, int64(deps.Config.Server.RequestLimits.MaxBodySize))
+		}
+
+		clientIP := iputil.GetClientIP(ctx.Request, parsedTrustedProxies, deps.Config.Server.ClientIPHeader)
+		var reqBody TokenRefreshRequest
+		if err := ctx.ShouldBindJSON(&reqBody); err != nil {
+			deps.AppLogger.Warn("Token Refresh: JSON binding error for IP %s: %v", clientIP, err)
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+		if err := validation.IsValidID(reqBody.SiteID, validation.DefaultMaxInputLength); err != nil {
+			deps.AppLogger.Warn("Token Refresh: Invalid site_id '%s' from IP %s: %v", reqBody.SiteID, clientIP, err)
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+		if reqBody.GtmID != "" {
+			if err := validation.IsValidID(reqBody.GtmID, validation.DefaultMaxInputLength); err != nil {
+				deps.AppLogger.Warn("Token Refresh: Invalid gtm_id '%s' from IP %s: %v", reqBody.GtmID, clientIP, err)
+				ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+				return
+			}
+		}
+
+		// 1. Verify the token as /log does, accepting recently expired tokens
+		tokenPolicy := deps.Config.TokenPolicies().Lookup(reqBody.SiteID)
+		if !tokenPolicy.AllowsGtmID(reqBody.GtmID) {
+			deps.AppLogger.Warn("Token Refresh: gtm_id '%s' is not allowed for SiteID '%s', IP %s", reqBody.GtmID, reqBody.SiteID, clientIP)
+			ctx.JSON(http.StatusForbidden, gin.H{"error": "Token refresh not allowed"})
+			return
+		}
+		rateLimitKeys := tokenRateLimitKeys(clientIP, reqBody.SiteID)
+		if deps.TokenRateLimiter != nil {
+			for _, key := range rateLimitKeys {
+				if blocked, remaining := deps.TokenRateLimiter.Blocked(key.key); blocked {
+					deps.AppLogger.Info("Token Refresh: IP %s is blocked for SiteID '%s' after too many invalid tokens (%s)", clientIP, reqBody.SiteID, key.reason)
+					ctx.Header("X-Log-Block-Reason", key.reason)
+					ctx.Header("Retry-After", strconv.Itoa(int(math.Ceil(remaining.Seconds()))))
+					ctx.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "Too many invalid tokens"})
+					return
+				}
+			}
+		}
+		claims := security.RequestClaims(ctx.Request, clientIP)
+		valid, err := tokenPolicy.Keyring.ValidateBoundWithGrace(reqBody.SiteID, reqBody.GtmID, reqBody.Token, tokenPolicy.Binding, claims, deps.GracePeriod)
+		if deps.TokenRateLimiter != nil {
+			for _, key := range rateLimitKeys {
+				// Expired tokens and failed binding checks are correctly signed, they do not count
+				deps.TokenRateLimiter.CheckAndRecordAttempt(key.key, !security.IsSignatureError(err))
+			}
+		}
+		if err != nil || !valid {
+			deps.AppLogger.Warn("Token Refresh: Invalid token received from IP %s for SiteID '%s': %v", clientIP, reqBody.SiteID, err)
+			ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			return
+		}
+
+		// 2. Process rules, tokens are only issued while logging is enabled for the client
+		ruleResult := deps.RuleProcessor.Process(reqBody.SiteID, reqBody.GtmID, ctx.Request)
+		if !ruleResult.ShouldLogToServer || ruleResult.ConsentAction == consent.ActionDrop {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": "Logging disabled"})
+			return
+		}
+
+		// 3. Issue the new token
+		token, expiresAt, err := issueToken(tokenPolicy, deps.TokenExpirationDur, reqBody.SiteID, reqBody.GtmID, claims)
+		if err != nil {
+			deps.AppLogger.Error("Failed to generate token: %v, clientIP: %s, siteID: %s, gtm_id: %s", err, clientIP, reqBody.SiteID, reqBody.GtmID)
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
+			return
+		}
+		ctx.JSON(http.StatusOK, TokenRefreshResponse{Token: token, ExpiresAt: expiresAt.Unix()})
+	}
+}
+
+// issueToken generates a token for the site with the expiration of its policy (or the default
+// expiration) bound to the request claims, and returns it with its expiration time.
+func issueToken(policy security.Policy, defaultExpiration time.Duration, siteID, gtmID string, claims security.Claims) (string, time.Time, error) {
+	expiration := defaultExpiration
+	if policy.Expiration > 0 {
+		expiration = policy.Expiration
+	}
+	token, err := policy.Keyring.GenerateBound(siteID, gtmID, expiration, policy.Binding, claims)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	expiresAt, _ := security.TokenExpiresAt(token)
+	return token, expiresAt, nil
+}
+
+// buildTokenURL constructs the URL for the /token endpoint, relative or absolute as the /log URL
+func buildTokenURL(c *gin.Context, cfg *config.Config) string {
+	logURL := buildLogURL(c, cfg.Server.PathPrefix, cfg.Server.Mode, cfg.Server.Domain, cfg.Server.Protocol)
+	return logURL[:len(logURL)-len("/log")] + "/token"
+}
@@ -0,0 +1,133 @@
+// internal/ipanon/ipanon.go
+
+// Package ipanon anonymizes IP addresses in log records.
+package ipanon
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"regexp"
+	"time"
+)
+
+// Anonymization modes.
+const (
+	ModeTruncate = "truncate" // Zero the host part: IPv4 to /24, IPv6 to /48
+	ModeHash     = "hash"     // Keyed HMAC with a salt that rotates every rotation period
+	ModeDrop     = "drop"     // Remove the field
+)
+
+// Modes lists the supported modes.
+var Modes = []string{ModeTruncate, ModeHash, ModeDrop}
+
+// MinKeyLength is the minimum length of the hash key.
+const MinKeyLength = 16
+
+// ipCandidate finds IPv4 and IPv6 candidates in header values like "for=1.2.3.4, [2001:db8::1]:443".
+var ipCandidate = regexp.MustCompile(`[0-9A-Fa-f]{0,4}(?::[0-9A-Fa-f]{0,4}){2,7}(?:\.\d{1,3}){0,3}|\b(?:\d{1,3}\.){3}\d{1,3}\b`)
+
+// Anonymizer anonymizes IP addresses. It is safe for concurrent use.
+type Anonymizer struct {
+	mode     string
+	key      []byte
+	rotation time.Duration
+	now      func() time.Time
+}
+
+// New creates an Anonymizer. The key and rotation are required for ModeHash only.
+func New(mode, key string, rotation time.Duration) (*Anonymizer, error) {
+	switch mode {
+	case ModeTruncate, ModeDrop:
+	case ModeHash:
+		if len(key) < MinKeyLength {
+			return nil, fmt.Errorf("hash_key must be at least %d characters for mode 'hash'", MinKeyLength)
+		}
+		if rotation <= 0 {
+			return nil, fmt.Errorf("salt rotation must be positive, got %s", rotation)
+		}
+	default:
+		return nil, fmt.Errorf("invalid mode '%s', must be one of %v", mode, Modes)
+	}
+	return &Anonymizer{mode: mode, key: []byte(key), rotation: rotation, now: time.Now}, nil
+}
+
+// Mode returns the anonymization mode.
+func (a *Anonymizer) Mode() string {
+	return a.mode
+}
+
+// Apply anonymizes the IP addresses in the given string fields of the record in place.
+// In ModeDrop the fields are removed. Values without an IP address are kept.
+func (a *Anonymizer) Apply(record map[string]interface{}, fields []string) {
+	if a == nil {
+		return
+	}
+	for _, field := range fields {
+		value, ok := record[field].(string)
+		if !ok {
+			continue
+		}
+		if a.mode == ModeDrop {
+			delete(record, field)
+			continue
+		}
+		record[field] = a.AnonymizeString(value)
+	}
+}
+
+// AnonymizeString replaces every IP address in s, e.g. all addresses of an X-Forwarded-For list.
+func (a *Anonymizer) AnonymizeString(s string) string {
+	if ip := net.ParseIP(s); ip != nil {
+		return a.anonymize(ip)
+	}
+	return ipCandidate.ReplaceAllStringFunc(s, func(candidate string) string {
+		ip := net.ParseIP(candidate)
+		if ip == nil {
+			return candidate
+		}
+		return a.anonymize(ip)
+	})
+}
+
+// anonymize returns the anonymized form of a single address. ModeDrop returns an empty string.
+func (a *Anonymizer) anonymize(ip net.IP) string {
+	switch a.mode {
+	case ModeTruncate:
+		return Truncate(ip).String()
+	case ModeHash:
+		return a.hash(ip)
+	}
+	return ""
+}
+
+// Truncate zeroes the host part of the address: IPv4 addresses are truncated to /24 and
+// IPv6 addresses to /48.
+func Truncate(ip net.IP) net.IP {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.Mask(net.CIDRMask(24, 32))
+	}
+	return ip.Mask(net.CIDRMask(48, 128))
+}
+
+// hash returns a hex encoded HMAC of the address keyed with the salt of the current period.
+// The same address hashes to the same value within a period, so requests stay correlatable
+// for at most one period.
+func (a *Anonymizer) hash(ip net.IP) string {
+	mac := hmac.New(sha256.New, a.salt(a.now()))
+	mac.Write(ip.To16())
+	return hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+// salt derives the salt of the rotation period containing t from the key, so all instances
+// sharing the key use the same salt without coordination.
+func (a *Anonymizer) salt(t time.Time) []byte {
+	var period [8]byte
+	binary.BigEndian.PutUint64(period[:], uint64(t.UnixNano()/int64(a.rotation)))
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write(period[:])
+	return mac.Sum(nil)
+}
@@ -0,0 +1,84 @@
+package ipanon
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testKey = "ip-hash-key-0123456789"
+
+func TestTruncate(t *testing.T) {
+	assert.Equal(t, "192.168.10.0", Truncate(net.ParseIP("192.168.10.77")).String())
+	assert.Equal(t, "2001:db8:abcd::", Truncate(net.ParseIP("2001:db8:abcd:12::1")).String())
+	assert.Equal(t, "10.1.2.0", Truncate(net.ParseIP("::ffff:10.1.2.3")).String())
+}
+
+func TestAnonymizer_Apply(t *testing.T) {
+	a, err := New(ModeTruncate, "", 0)
+	require.NoError(t, err)
+
+	record := map[string]interface{}{
+		"client_ip":       "203.0.113.7",
+		"forwarded_for":   "203.0.113.7, 2001:db8:1:2::3",
+		"forwarded":       "for=198.51.100.17;proto=https",
+		"user_agent":      "Mozilla/5.0",
+		"request_counter": 5,
+	}
+	a.Apply(record, []string{"client_ip", "forwarded_for", "forwarded", "user_agent", "request_counter", "missing"})
+
+	assert.Equal(t, "203.0.113.0", record["client_ip"])
+	assert.Equal(t, "203.0.113.0, 2001:db8:1::", record["forwarded_for"])
+	assert.Equal(t, "for=198.51.100.0;proto=https", record["forwarded"])
+	assert.Equal(t, "Mozilla/5.0", record["user_agent"])
+	assert.Equal(t, 5, record["request_counter"])
+}
+
+func TestAnonymizer_Drop(t *testing.T) {
+	a, err := New(ModeDrop, "", 0)
+	require.NoError(t, err)
+	record := map[string]interface{}{"client_ip": "203.0.113.7", "site_id": "shop"}
+	a.Apply(record, []string{"client_ip"})
+	assert.Equal(t, map[string]interface{}{"site_id": "shop"}, record)
+}
+
+func TestAnonymizer_HashRotation(t *testing.T) {
+	a, err := New(ModeHash, testKey, 24*time.Hour)
+	require.NoError(t, err)
+	day1 := time.Date(2025, 6, 2, 10, 0, 0, 0, time.UTC)
+	a.now = func() time.Time { return day1 }
+
+	first := a.AnonymizeString("203.0.113.7")
+	assert.Regexp(t, `^[0-9a-f]{16}$`, first)
+	assert.Equal(t, first, a.AnonymizeString("203.0.113.7"), "stable within a period")
+	assert.NotEqual(t, first, a.AnonymizeString("203.0.113.8"))
+
+	// Another instance with the same key produces the same value
+	other, err := New(ModeHash, testKey, 24*time.Hour)
+	require.NoError(t, err)
+	other.now = a.now
+	assert.Equal(t, first, other.AnonymizeString("203.0.113.7"))
+
+	// The salt rotates with the period
+	a.now = func() time.Time { return day1.Add(24 * time.Hour) }
+	assert.NotEqual(t, first, a.AnonymizeString("203.0.113.7"))
+}
+
+func TestNew_Invalid(t *testing.T) {
+	_, err := New("mask", "", 0)
+	assert.ErrorContains(t, err, "invalid mode 'mask'")
+	_, err = New(ModeHash, "short", time.Hour)
+	assert.ErrorContains(t, err, "hash_key must be at least 16 characters")
+	_, err = New(ModeHash, testKey, 0)
+	assert.ErrorContains(t, err, "salt rotation must be positive")
+}
+
+func TestAnonymizer_Nil(t *testing.T) {
+	var a *Anonymizer
+	record := map[string]interface{}{"client_ip": "203.0.113.7"}
+	a.Apply(record, []string{"client_ip"})
+	assert.Equal(t, "203.0.113.7", record["client_ip"])
+}
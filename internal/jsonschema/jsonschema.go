@@ -0,0 +1,650 @@
+// internal/jsonschema/jsonschema.go
+
+// Package jsonschema validates JSON values against a subset of JSON Schema draft 2020-12.
+//
+// Supported keywords: type, enum, const, properties, required, additionalProperties,
+// patternProperties, propertyNames, minProperties, maxProperties, items, prefixItems,
+// minItems, maxItems, uniqueItems, contains, minLength, maxLength, pattern, minimum,
+// maximum, exclusiveMinimum, exclusiveMaximum, multipleOf, allOf, anyOf, oneOf, not,
+// $defs and local $ref ("#", "#/$defs/name"). Annotations ($schema, $id, $comment, title,
+// description, default, examples, format, deprecated, readOnly, writeOnly) are ignored,
+// other keywords are rejected so typos are caught at compile time.
+package jsonschema
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxErrors limits the number of errors returned by Validate.
+const MaxErrors = 20
+
+// annotations are keywords without validation effect.
+var annotations = map[string]bool{
+	"$schema": true, "$id": true, "$comment": true, "title": true, "description": true, "default": true,
+	"examples": true, "format": true, "deprecated": true, "readOnly": true, "writeOnly": true,
+}
+
+// types lists the JSON Schema type names.
+var types = []string{"null", "boolean", "object", "array", "number", "integer", "string"}
+
+// Schema is a compiled schema.
+type Schema struct {
+	always *bool // Boolean schema: true accepts and false rejects everything
+
+	types    []string
+	enum     []interface{}
+	constant *interface{}
+
+	properties           map[string]*Schema
+	required             []string
+	additionalProperties *Schema
+	patternProperties    []patternSchema
+	propertyNames        *Schema
+	minProperties        *int
+	maxProperties        *int
+
+	items       *Schema
+	prefixItems []*Schema
+	minItems    *int
+	maxItems    *int
+	uniqueItems bool
+	contains    *Schema
+
+	minLength *int
+	maxLength *int
+	pattern   *regexp.Regexp
+
+	minimum          *float64
+	maximum          *float64
+	exclusiveMinimum *float64
+	exclusiveMaximum *float64
+	multipleOf       *float64
+
+	allOf []*Schema
+	anyOf []*Schema
+	oneOf []*Schema
+	not   *Schema
+
+	ref     string  // Local reference, resolved after compilation
+	refNode *Schema // Resolved reference
+}
+
+type patternSchema struct {
+	re     *regexp.Regexp
+	schema *Schema
+}
+
+// compiler holds the state of a single compilation.
+type compiler struct {
+	root *Schema
+	defs map[string]*Schema
+	refs []*Schema
+}
+
+// Compile parses and compiles a JSON schema document.
+func Compile(data []byte) (*Schema, error) {
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	return CompileValue(doc)
+}
+
+// CompileValue compiles a schema given as decoded JSON (maps, slices, float64, ...). Integer
+// types produced by YAML decoders are accepted as well.
+func CompileValue(doc interface{}) (*Schema, error) {
+	c := &compiler{defs: make(map[string]*Schema)}
+	root, err := c.compile(normalize(doc), "#")
+	if err != nil {
+		return nil, err
+	}
+	c.root = root
+	for _, s := range c.refs {
+		switch {
+		case s.ref == "#":
+			s.refNode = root
+		case strings.HasPrefix(s.ref, "#/$defs/"):
+			target, ok := c.defs[strings.TrimPrefix(s.ref, "#/$defs/")]
+			if !ok {
+				return nil, fmt.Errorf("$ref '%s': definition not found", s.ref)
+			}
+			s.refNode = target
+		default:
+			return nil, fmt.Errorf("$ref '%s': only local references '#' and '#/$defs/<name>' are supported", s.ref)
+		}
+	}
+	return root, nil
+}
+
+func (c *compiler) compile(node interface{}, path string) (*Schema, error) {
+	if b, ok := node.(bool); ok {
+		return &Schema{always: &b}, nil
+	}
+	obj, ok := node.(map[string]interface{})
+	if !ok {
+		return nil, &compileError{path: path, err: fmt.Errorf("schema must be an object or a boolean")}
+	}
+
+	s := &Schema{}
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := obj[key]
+		at := path + "/" + key
+		var err error
+		switch key {
+		case "type":
+			s.types, err = compileTypes(value)
+		case "enum":
+			list, ok := value.([]interface{})
+			if !ok || len(list) == 0 {
+				err = fmt.Errorf("must be a non-empty array")
+			}
+			s.enum = list
+		case "const":
+			v := value
+			s.constant = &v
+		case "properties":
+			s.properties, err = c.compileMap(value, at)
+		case "required":
+			s.required, err = stringList(value)
+		case "additionalProperties":
+			s.additionalProperties, err = c.compile(value, at)
+		case "patternProperties":
+			var props map[string]*Schema
+			props, err = c.compileMap(value, at)
+			for pattern, schema := range props {
+				re, reErr := regexp.Compile(pattern)
+				if reErr != nil {
+					err = fmt.Errorf("invalid pattern '%s': %w", pattern, reErr)
+					break
+				}
+				s.patternProperties = append(s.patternProperties, patternSchema{re: re, schema: schema})
+			}
+		case "propertyNames":
+			s.propertyNames, err = c.compile(value, at)
+		case "minProperties":
+			s.minProperties, err = nonNegativeInt(value)
+		case "maxProperties":
+			s.maxProperties, err = nonNegativeInt(value)
+		case "items":
+			s.items, err = c.compile(value, at)
+		case "prefixItems":
+			s.prefixItems, err = c.compileList(value, at)
+		case "minItems":
+			s.minItems, err = nonNegativeInt(value)
+		case "maxItems":
+			s.maxItems, err = nonNegativeInt(value)
+		case "uniqueItems":
+			b, ok := value.(bool)
+			if !ok {
+				err = fmt.Errorf("must be a boolean")
+			}
+			s.uniqueItems = b
+		case "contains":
+			s.contains, err = c.compile(value, at)
+		case "minLength":
+			s.minLength, err = nonNegativeInt(value)
+		case "maxLength":
+			s.maxLength, err = nonNegativeInt(value)
+		case "pattern":
+			str, ok := value.(string)
+			if !ok {
+				err = fmt.Errorf("must be a string")
+				break
+			}
+			s.pattern, err = regexp.Compile(str)
+		case "minimum":
+			s.minimum, err = number(value)
+		case "maximum":
+			s.maximum, err = number(value)
+		case "exclusiveMinimum":
+			s.exclusiveMinimum, err = number(value)
+		case "exclusiveMaximum":
+			s.exclusiveMaximum, err = number(value)
+		case "multipleOf":
+			s.multipleOf, err = number(value)
+			if err == nil && *s.multipleOf <= 0 {
+				err = fmt.Errorf("must be greater than 0")
+			}
+		case "allOf":
+			s.allOf, err = c.compileList(value, at)
+		case "anyOf":
+			s.anyOf, err = c.compileList(value, at)
+		case "oneOf":
+			s.oneOf, err = c.compileList(value, at)
+		case "not":
+			s.not, err = c.compile(value, at)
+		case "$defs":
+			var defs map[string]*Schema
+			defs, err = c.compileMap(value, at)
+			if path == "#" {
+				for name, def := range defs {
+					c.defs[name] = def
+				}
+			}
+		case "$ref":
+			str, ok := value.(string)
+			if !ok {
+				err = fmt.Errorf("must be a string")
+				break
+			}
+			s.ref = str
+			c.refs = append(c.refs, s)
+		default:
+			if !annotations[key] {
+				err = fmt.Errorf("unsupported keyword")
+			}
+		}
+		if err != nil {
+			var nested *compileError
+			if errors.As(err, &nested) {
+				return nil, err // Already located in a subschema
+			}
+			return nil, &compileError{path: at, err: err}
+		}
+	}
+	return s, nil
+}
+
+// compileError locates a compile error by the JSON pointer of the offending keyword.
+type compileError struct {
+	path string
+	err  error
+}
+
+func (e *compileError) Error() string { return e.path + ": " + e.err.Error() }
+
+func (e *compileError) Unwrap() error { return e.err }
+
+func (c *compiler) compileMap(value interface{}, path string) (map[string]*Schema, error) {
+	obj, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("must be an object")
+	}
+	result := make(map[string]*Schema, len(obj))
+	for name, node := range obj {
+		s, err := c.compile(node, path+"/"+escapePointer(name))
+		if err != nil {
+			return nil, err
+		}
+		result[name] = s
+	}
+	return result, nil
+}
+
+func (c *compiler) compileList(value interface{}, path string) ([]*Schema, error) {
+	list, ok := value.([]interface{})
+	if !ok || len(list) == 0 {
+		return nil, fmt.Errorf("must be a non-empty array")
+	}
+	result := make([]*Schema, len(list))
+	for i, node := range list {
+		s, err := c.compile(node, fmt.Sprintf("%s/%d", path, i))
+		if err != nil {
+			return nil, err
+		}
+		result[i] = s
+	}
+	return result, nil
+}
+
+func compileTypes(value interface{}) ([]string, error) {
+	var names []string
+	if str, ok := value.(string); ok {
+		names = []string{str}
+	} else {
+		var err error
+		if names, err = stringList(value); err != nil {
+			return nil, err
+		}
+	}
+	for _, name := range names {
+		valid := false
+		for _, t := range types {
+			valid = valid || t == name
+		}
+		if !valid {
+			return nil, fmt.Errorf("unknown type '%s', must be one of %v", name, types)
+		}
+	}
+	return names, nil
+}
+
+func stringList(value interface{}) ([]string, error) {
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("must be an array of strings")
+	}
+	result := make([]string, len(list))
+	for i, v := range list {
+		str, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("must be an array of strings")
+		}
+		result[i] = str
+	}
+	return result, nil
+}
+
+func number(value interface{}) (*float64, error) {
+	f, ok := value.(float64)
+	if !ok {
+		return nil, fmt.Errorf("must be a number")
+	}
+	return &f, nil
+}
+
+func nonNegativeInt(value interface{}) (*int, error) {
+	f, ok := value.(float64)
+	if !ok || f < 0 || f != math.Trunc(f) {
+		return nil, fmt.Errorf("must be a non-negative integer")
+	}
+	n := int(f)
+	return &n, nil
+}
+
+// normalize converts integer types and map[interface{}]interface{} (from YAML decoders)
+// to their JSON equivalents.
+func normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for k, inner := range v {
+			result[k] = normalize(inner)
+		}
+		return result
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for k, inner := range v {
+			result[fmt.Sprint(k)] = normalize(inner)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, inner := range v {
+			result[i] = normalize(inner)
+		}
+		return result
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	}
+	return value
+}
+
+// Validate validates a decoded JSON value and returns at most MaxErrors messages of the form
+// "<instance location>: <problem>", e.g. "/order/total: expected number, got string".
+// A nil result means the value is valid.
+func (s *Schema) Validate(value interface{}) []string {
+	v := &validator{}
+	v.validate(s, normalize(value), "")
+	return v.errors
+}
+
+type validator struct {
+	errors []string
+}
+
+func (v *validator) fail(location, format string, args ...interface{}) {
+	if len(v.errors) >= MaxErrors {
+		return
+	}
+	if location == "" {
+		location = "/"
+	}
+	v.errors = append(v.errors, location+": "+fmt.Sprintf(format, args...))
+}
+
+// valid reports whether value is valid against s without recording errors.
+func valid(s *Schema, value interface{}) bool {
+	v := &validator{}
+	v.validate(s, value, "")
+	return len(v.errors) == 0
+}
+
+func (v *validator) validate(s *Schema, value interface{}, location string) {
+	if s.always != nil {
+		if !*s.always {
+			v.fail(location, "not allowed")
+		}
+		return
+	}
+	if s.refNode != nil {
+		v.validate(s.refNode, value, location)
+	}
+
+	if len(s.types) > 0 && !matchesType(s.types, value) {
+		v.fail(location, "expected %s, got %s", strings.Join(s.types, " or "), typeName(value))
+		return
+	}
+	if s.constant != nil && !equal(*s.constant, value) {
+		v.fail(location, "must be %s", display(*s.constant))
+	}
+	if len(s.enum) > 0 {
+		found := false
+		for _, allowed := range s.enum {
+			found = found || equal(allowed, value)
+		}
+		if !found {
+			v.fail(location, "must be one of %s", display(s.enum))
+		}
+	}
+
+	switch val := value.(type) {
+	case map[string]interface{}:
+		v.validateObject(s, val, location)
+	case []interface{}:
+		v.validateArray(s, val, location)
+	case string:
+		length := utf8.RuneCountInString(val)
+		if s.minLength != nil && length < *s.minLength {
+			v.fail(location, "length must be >= %d", *s.minLength)
+		}
+		if s.maxLength != nil && length > *s.maxLength {
+			v.fail(location, "length must be <= %d", *s.maxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(val) {
+			v.fail(location, "must match pattern '%s'", s.pattern)
+		}
+	case float64:
+		if s.minimum != nil && val < *s.minimum {
+			v.fail(location, "must be >= %v", *s.minimum)
+		}
+		if s.maximum != nil && val > *s.maximum {
+			v.fail(location, "must be <= %v", *s.maximum)
+		}
+		if s.exclusiveMinimum != nil && val <= *s.exclusiveMinimum {
+			v.fail(location, "must be > %v", *s.exclusiveMinimum)
+		}
+		if s.exclusiveMaximum != nil && val >= *s.exclusiveMaximum {
+			v.fail(location, "must be < %v", *s.exclusiveMaximum)
+		}
+		if s.multipleOf != nil {
+			q := val / *s.multipleOf
+			if math.Abs(q-math.Round(q)) > 1e-9 {
+				v.fail(location, "must be a multiple of %v", *s.multipleOf)
+			}
+		}
+	}
+
+	for _, sub := range s.allOf {
+		v.validate(sub, value, location)
+	}
+	if len(s.anyOf) > 0 {
+		matched := false
+		for _, sub := range s.anyOf {
+			if valid(sub, value) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			v.fail(location, "must match at least one schema of anyOf")
+		}
+	}
+	if len(s.oneOf) > 0 {
+		matches := 0
+		for _, sub := range s.oneOf {
+			if valid(sub, value) {
+				matches++
+			}
+		}
+		if matches != 1 {
+			v.fail(location, "must match exactly one schema of oneOf, matched %d", matches)
+		}
+	}
+	if s.not != nil && valid(s.not, value) {
+		v.fail(location, "must not match the schema of not")
+	}
+}
+
+func (v *validator) validateObject(s *Schema, obj map[string]interface{}, location string) {
+	for _, name := range s.required {
+		if _, ok := obj[name]; !ok {
+			v.fail(location, "missing required property '%s'", name)
+		}
+	}
+	if s.minProperties != nil && len(obj) < *s.minProperties {
+		v.fail(location, "must have >= %d properties", *s.minProperties)
+	}
+	if s.maxProperties != nil && len(obj) > *s.maxProperties {
+		v.fail(location, "must have <= %d properties", *s.maxProperties)
+	}
+
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names) // Stable error order
+
+	for _, name := range names {
+		value := obj[name]
+		at := location + "/" + escapePointer(name)
+		if s.propertyNames != nil && !valid(s.propertyNames, name) {
+			v.fail(at, "invalid property name")
+		}
+		evaluated := false
+		if sub, ok := s.properties[name]; ok {
+			v.validate(sub, value, at)
+			evaluated = true
+		}
+		for _, pp := range s.patternProperties {
+			if pp.re.MatchString(name) {
+				v.validate(pp.schema, value, at)
+				evaluated = true
+			}
+		}
+		if !evaluated && s.additionalProperties != nil {
+			if s.additionalProperties.always != nil && !*s.additionalProperties.always {
+				v.fail(at, "unknown property '%s'", name)
+				continue
+			}
+			v.validate(s.additionalProperties, value, at)
+		}
+	}
+}
+
+func (v *validator) validateArray(s *Schema, arr []interface{}, location string) {
+	if s.minItems != nil && len(arr) < *s.minItems {
+		v.fail(location, "must have >= %d items", *s.minItems)
+	}
+	if s.maxItems != nil && len(arr) > *s.maxItems {
+		v.fail(location, "must have <= %d items", *s.maxItems)
+	}
+	for i, item := range arr {
+		at := location + "/" + strconv.Itoa(i)
+		if i < len(s.prefixItems) {
+			v.validate(s.prefixItems[i], item, at)
+		} else if s.items != nil {
+			v.validate(s.items, item, at)
+		}
+	}
+	if s.uniqueItems {
+		for i := 0; i < len(arr); i++ {
+			for j := i + 1; j < len(arr); j++ {
+				if equal(arr[i], arr[j]) {
+					v.fail(location, "items %d and %d are equal", i, j)
+					return
+				}
+			}
+		}
+	}
+	if s.contains != nil {
+		found := false
+		for _, item := range arr {
+			if valid(s.contains, item) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			v.fail(location, "must contain an item matching the schema of contains")
+		}
+	}
+}
+
+func matchesType(names []string, value interface{}) bool {
+	actual := typeName(value)
+	for _, name := range names {
+		if name == actual || name == "number" && actual == "integer" {
+			return true
+		}
+	}
+	return false
+}
+
+// typeName returns the JSON Schema type of a decoded JSON value.
+func typeName(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case float64:
+		if v == math.Trunc(v) && !math.IsInf(v, 0) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func equal(a, b interface{}) bool {
+	return reflect.DeepEqual(a, b)
+}
+
+func display(value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
+
+// escapePointer escapes a property name for use in a JSON pointer.
+func escapePointer(name string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(name, "~", "~0"), "/", "~1")
+}
@@ -0,0 +1,133 @@
+package jsonschema
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const orderSchema = `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "type": "object",
+  "required": ["event", "order"],
+  "properties": {
+    "event": {"enum": ["view", "checkout"]},
+    "order": {"$ref": "#/$defs/order"},
+    "tags": {"type": "array", "items": {"type": "string", "maxLength": 5}, "uniqueItems": true},
+    "version": {"const": 2}
+  },
+  "patternProperties": {"^x_": {"type": "string"}},
+  "additionalProperties": false,
+  "$defs": {
+    "order": {
+      "type": "object",
+      "required": ["id"],
+      "properties": {
+        "id": {"type": "string", "pattern": "^o-[0-9]+$"},
+        "total": {"type": "number", "minimum": 0, "exclusiveMaximum": 10000, "multipleOf": 0.01},
+        "items": {"type": "integer", "minimum": 1}
+      }
+    }
+  }
+}`
+
+func decode(t *testing.T, s string) interface{} {
+	t.Helper()
+	var v interface{}
+	require.NoError(t, json.Unmarshal([]byte(s), &v))
+	return v
+}
+
+func TestValidate(t *testing.T) {
+	schema, err := Compile([]byte(orderSchema))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		data string
+		want []string
+	}{
+		{"valid", `{"event": "checkout", "order": {"id": "o-1", "total": 99.9, "items": 2}, "tags": ["a"], "version": 2, "x_ab": "1"}`, nil},
+		{"missing required", `{"event": "view"}`, []string{"/: missing required property 'order'"}},
+		{"enum and const", `{"event": "click", "order": {"id": "o-1"}, "version": 1}`,
+			[]string{"/event: must be one of [\"view\",\"checkout\"]", "/version: must be 2"}},
+		{"nested types", `{"event": "view", "order": {"id": "x", "total": "99", "items": 1.5}}`,
+			[]string{"/order/id: must match pattern '^o-[0-9]+$'", "/order/items: expected integer, got number", "/order/total: expected number, got string"}},
+		{"numbers", `{"event": "view", "order": {"id": "o-1", "total": 10000, "items": 0}}`,
+			[]string{"/order/items: must be >= 1", "/order/total: must be < 10000"}},
+		{"unknown property", `{"event": "view", "order": {"id": "o-1"}, "evnt": "typo", "x_n": 1}`,
+			[]string{"/evnt: unknown property 'evnt'", "/x_n: expected string, got integer"}},
+		{"arrays", `{"event": "view", "order": {"id": "o-1"}, "tags": ["a", "toolong", "a"]}`,
+			[]string{"/tags/1: length must be <= 5", "/tags: items 0 and 2 are equal"}},
+		{"root type", `[]`, []string{"/: expected object, got array"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, schema.Validate(decode(t, tt.data)))
+		})
+	}
+}
+
+func TestValidate_Combinators(t *testing.T) {
+	schema, err := Compile([]byte(`{
+	  "properties": {
+	    "id": {"anyOf": [{"type": "string"}, {"type": "integer"}]},
+	    "kind": {"oneOf": [{"type": "string"}, {"const": "both"}]},
+	    "name": {"allOf": [{"minLength": 2}, {"maxLength": 4}], "not": {"const": "root"}},
+	    "list": {"type": "array", "prefixItems": [{"type": "string"}], "items": {"type": "number"}, "contains": {"const": 1}, "minItems": 2}
+	  }
+	}`))
+	require.NoError(t, err)
+
+	assert.Nil(t, schema.Validate(decode(t, `{"id": 1, "kind": "a", "name": "abc", "list": ["a", 1, 2.5]}`)))
+	assert.Equal(t, []string{
+		"/id: must match at least one schema of anyOf",
+		"/kind: must match exactly one schema of oneOf, matched 2",
+		"/list/0: expected string, got integer",
+		"/list: must contain an item matching the schema of contains",
+		"/name: must not match the schema of not",
+	}, schema.Validate(decode(t, `{"id": 1.5, "kind": "both", "name": "root", "list": [2, 3]}`)))
+}
+
+func TestCompileValue_YAMLIntegers(t *testing.T) {
+	schema, err := CompileValue(map[string]interface{}{
+		"type":       "object",
+		"properties": map[string]interface{}{"count": map[string]interface{}{"type": "integer", "maximum": 10}},
+		"required":   []interface{}{"count"},
+	})
+	require.NoError(t, err)
+	assert.Nil(t, schema.Validate(map[string]interface{}{"count": 3.0}))
+	assert.Equal(t, []string{"/count: must be <= 10"}, schema.Validate(map[string]interface{}{"count": 11}))
+}
+
+func TestCompile_Invalid(t *testing.T) {
+	tests := []struct {
+		schema string
+		err    string
+	}{
+		{`{"type": "obj"}`, "#/type: unknown type 'obj'"},
+		{`{"properties": {"a": {"minLenght": 1}}}`, "#/properties/a/minLenght: unsupported keyword"},
+		{`{"pattern": "["}`, "#/pattern: error parsing regexp"},
+		{`{"$ref": "#/$defs/missing"}`, "$ref '#/$defs/missing': definition not found"},
+		{`{"$ref": "https://example.com/schema.json"}`, "only local references"},
+		{`{"minItems": -1}`, "#/minItems: must be a non-negative integer"},
+		{`"string"`, "#: schema must be an object or a boolean"},
+		{`{`, "invalid JSON"},
+	}
+	for _, tt := range tests {
+		_, err := Compile([]byte(tt.schema))
+		assert.ErrorContains(t, err, tt.err, tt.schema)
+	}
+}
+
+func TestValidate_MaxErrors(t *testing.T) {
+	schema, err := Compile([]byte(`{"additionalProperties": false}`))
+	require.NoError(t, err)
+	data := make(map[string]interface{})
+	for i := 0; i < 50; i++ {
+		data[string(rune('a'+i%26))+string(rune('a'+i/26))] = i
+	}
+	assert.Len(t, schema.Validate(data), MaxErrors)
+}
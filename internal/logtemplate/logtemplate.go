@@ -0,0 +1,261 @@
+// internal/logtemplate/logtemplate.go
+
+// Package logtemplate compiles and executes the text/template expressions of the
+// template add_log_data source.
+package logtemplate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"unicode/utf8"
+)
+
+// MaxOutputLength limits the length of a rendered value.
+const MaxOutputLength = 4096
+
+// noValue is what text/template prints for missing map keys, it is removed from the output.
+const noValue = "<no value>"
+
+// Data is the input of a template.
+type Data struct {
+	Header   map[string]string      // Request headers by canonical name, first value only
+	Query    map[string]string      // Query parameters, first value only
+	Data     map[string]interface{} // Client data sent to /log
+	ClientIP string                 // Client IP as resolved for the log record
+	Record   map[string]interface{} // Record fields set so far: base fields, for destination values also the rule values
+}
+
+// NewData builds template data from the request, client data and record. The request may be nil.
+func NewData(request *http.Request, clientData, record map[string]interface{}) Data {
+	data := Data{
+		Header: make(map[string]string),
+		Query:  make(map[string]string),
+		Data:   clientData,
+		Record: record,
+	}
+	if request != nil {
+		for name, values := range request.Header {
+			if len(values) > 0 {
+				data.Header[name] = values[0]
+			}
+		}
+		if request.URL != nil {
+			for name, values := range request.URL.Query() {
+				if len(values) > 0 {
+					data.Query[name] = values[0]
+				}
+			}
+		}
+	}
+	if clientIP, ok := record["client_ip"].(string); ok {
+		data.ClientIP = clientIP
+	}
+	return data
+}
+
+// Template is a compiled template expression.
+type Template struct {
+	expr string
+	tmpl *template.Template
+}
+
+// funcs are the only functions available besides the text/template builtins.
+var funcs = template.FuncMap{
+	"lower":    func(s interface{}) string { return strings.ToLower(toString(s)) },
+	"upper":    func(s interface{}) string { return strings.ToUpper(toString(s)) },
+	"trim":     func(s interface{}) string { return strings.TrimSpace(toString(s)) },
+	"default":  defaultValue,
+	"sha256":   sha256Hex,
+	"truncate": truncate,
+}
+
+// dashedField matches .Header.X-Env and .Query.utm-source references, which text/template cannot parse.
+var dashedField = regexp.MustCompile(`\.(Header|Query)\.([A-Za-z0-9_]+(?:-[A-Za-z0-9_]+)+)`)
+
+// headerField matches .Header.Name references, rewritten to the canonical header name.
+var headerField = regexp.MustCompile(`\.Header\.([A-Za-z0-9_]+)`)
+
+// Compile parses a template expression. Header and query names may contain dashes
+// (e.g. {{.Header.X-Env}}), header names are case-insensitive.
+func Compile(expr string) (*Template, error) {
+	rewritten := dashedField.ReplaceAllStringFunc(expr, func(ref string) string {
+		m := dashedField.FindStringSubmatch(ref)
+		name := m[2]
+		if m[1] == "Header" {
+			name = http.CanonicalHeaderKey(name)
+		}
+		return fmt.Sprintf("(index .%s %q)", m[1], name)
+	})
+	rewritten = headerField.ReplaceAllStringFunc(rewritten, func(ref string) string {
+		name := headerField.FindStringSubmatch(ref)[1]
+		return fmt.Sprintf("(index .Header %q)", http.CanonicalHeaderKey(name))
+	})
+
+	tmpl, err := template.New("value").Funcs(funcs).Parse(rewritten)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template '%s': %w", expr, err)
+	}
+	return &Template{expr: expr, tmpl: tmpl}, nil
+}
+
+// String returns the original expression.
+func (t *Template) String() string {
+	return t.expr
+}
+
+// Execute renders the template. Missing values render as empty strings and the output is
+// limited to MaxOutputLength bytes.
+func (t *Template) Execute(data Data) (string, error) {
+	var sb strings.Builder
+	if err := t.tmpl.Execute(&limitedWriter{sb: &sb, limit: MaxOutputLength}, data); err != nil {
+		return "", fmt.Errorf("executing template '%s': %w", t.expr, err)
+	}
+	return strings.ReplaceAll(sb.String(), noValue, ""), nil
+}
+
+// limitedWriter silently drops output beyond the limit.
+type limitedWriter struct {
+	sb    *strings.Builder
+	limit int
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	if remaining := w.limit - w.sb.Len(); remaining > 0 {
+		if len(p) > remaining {
+			w.sb.Write(p[:remaining])
+		} else {
+			w.sb.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+// defaultValue returns def when value is missing or empty, used as {{.Query.x | default "none"}}.
+func defaultValue(def interface{}, value ...interface{}) interface{} {
+	if len(value) == 0 || value[0] == nil || toString(value[0]) == "" {
+		return def
+	}
+	return value[0]
+}
+
+// sha256Hex returns the hex encoded SHA-256 hash, e.g. to pseudonymize identifiers.
+func sha256Hex(s interface{}) string {
+	sum := sha256.Sum256([]byte(toString(s)))
+	return hex.EncodeToString(sum[:])
+}
+
+// truncate shortens s to at most n characters, used as {{.Header.Referer | truncate 100}}.
+func truncate(n int, s interface{}) string {
+	str := toString(s)
+	if n < 0 || utf8.RuneCountInString(str) <= n {
+		return str
+	}
+	return string([]rune(str)[:n])
+}
+
+// toString converts a template value to a string, nil becomes "".
+func toString(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return fmt.Sprint(v)
+}
+
+// UsesClientIP reports whether the output may contain the client IP: the template reads
+// .ClientIP, .Record.client_ip, a header for which isIPHeader returns true (called with the
+// canonical name) or the whole Header or Record map (e.g. in range).
+func (t *Template) UsesClientIP(isIPHeader func(name string) bool) bool {
+	for _, tmpl := range t.tmpl.Templates() {
+		if tmpl.Tree != nil && usesClientIP(tmpl.Tree.Root, isIPHeader) {
+			return true
+		}
+	}
+	return false
+}
+
+// usesClientIP reports whether the node reads a value that may contain the client IP.
+func usesClientIP(node parse.Node, isIPHeader func(string) bool) bool {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return false
+		}
+		for _, child := range n.Nodes {
+			if usesClientIP(child, isIPHeader) {
+				return true
+			}
+		}
+	case *parse.ActionNode:
+		return usesClientIP(n.Pipe, isIPHeader)
+	case *parse.IfNode:
+		return usesClientIP(&n.BranchNode, isIPHeader)
+	case *parse.RangeNode:
+		return usesClientIP(&n.BranchNode, isIPHeader)
+	case *parse.WithNode:
+		return usesClientIP(&n.BranchNode, isIPHeader)
+	case *parse.BranchNode:
+		return usesClientIP(n.Pipe, isIPHeader) || usesClientIP(n.List, isIPHeader) || usesClientIP(n.ElseList, isIPHeader)
+	case *parse.TemplateNode:
+		return usesClientIP(n.Pipe, isIPHeader)
+	case *parse.PipeNode:
+		if n == nil {
+			return false
+		}
+		for _, cmd := range n.Cmds {
+			if usesClientIP(cmd, isIPHeader) {
+				return true
+			}
+		}
+	case *parse.CommandNode:
+		// index .Header "Name" and index .Record "field" read a single value
+		if len(n.Args) == 3 {
+			ident, _ := n.Args[0].(*parse.IdentifierNode)
+			field, _ := n.Args[1].(*parse.FieldNode)
+			key, _ := n.Args[2].(*parse.StringNode)
+			if ident != nil && ident.Ident == "index" && field != nil && len(field.Ident) == 1 && key != nil {
+				return usesField([]string{field.Ident[0], key.Text}, isIPHeader)
+			}
+		}
+		for _, arg := range n.Args {
+			if usesClientIP(arg, isIPHeader) {
+				return true
+			}
+		}
+	case *parse.ChainNode:
+		return usesClientIP(n.Node, isIPHeader)
+	case *parse.FieldNode:
+		return usesField(n.Ident, isIPHeader)
+	case *parse.VariableNode:
+		// $ is the whole data, $.ClientIP a field of it
+		if n.Ident[0] != "$" {
+			return false
+		}
+		return len(n.Ident) == 1 || usesField(n.Ident[1:], isIPHeader)
+	case *parse.DotNode:
+		// The whole data, or an element of range/with, is printed
+		return true
+	}
+	return false
+}
+
+// usesField reports whether the field path of Data may contain the client IP.
+func usesField(ident []string, isIPHeader func(string) bool) bool {
+	switch ident[0] {
+	case "ClientIP":
+		return true
+	case "Header":
+		return len(ident) == 1 || isIPHeader(http.CanonicalHeaderKey(ident[1]))
+	case "Record":
+		return len(ident) == 1 || ident[1] == "client_ip"
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+package logtemplate
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplate_Execute(t *testing.T) {
+	req := httptest.NewRequest("POST", "/log?utm-source=newsletter&lang=cs", nil)
+	req.Header.Set("X-Env", "prod")
+	req.Header.Set("Referer", "https://example.com/a/very/long/path")
+	clientData := map[string]interface{}{
+		"page": map[string]interface{}{"section": "news"},
+		"user": "Alice@Example.com",
+	}
+	record := map[string]interface{}{"client_ip": "203.0.113.7", "site_id": "shop"}
+	data := NewData(req, clientData, record)
+
+	tests := []struct {
+		name string
+		expr string
+		want string
+	}{
+		{"header and data path", "{{.Header.X-Env}}-{{.Data.page.section}}", "prod-news"},
+		{"header name is case-insensitive", "{{.Header.x-env}}", "prod"},
+		{"query with dash", "{{.Query.utm-source}}/{{.Query.lang}}", "newsletter/cs"},
+		{"client ip and record", "{{.ClientIP}}@{{.Record.site_id}}", "203.0.113.7@shop"},
+		{"missing values are empty", "[{{.Data.missing.deep}}{{.Header.X-Missing}}]", "[]"},
+		{"default", `{{.Query.campaign | default "none"}}`, "none"},
+		{"lower upper trim", `{{lower .Data.user}} {{upper "a"}} {{trim "  b  "}}`, "alice@example.com A b"},
+		{"sha256", `{{sha256 "abc"}}`, "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		{"truncate", "{{.Header.Referer | truncate 19}}", "https://example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := Compile(tt.expr)
+			require.NoError(t, err)
+			got, err := tmpl.Execute(data)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestTemplate_NilInputs(t *testing.T) {
+	tmpl, err := Compile("{{.Data.page.section}}{{.Header.X-Env}}{{.ClientIP}}")
+	require.NoError(t, err)
+	got, err := tmpl.Execute(NewData(nil, nil, map[string]interface{}{}))
+	require.NoError(t, err)
+	assert.Equal(t, "", got)
+}
+
+func TestTemplate_OutputLimit(t *testing.T) {
+	tmpl, err := Compile(`{{range .Data.items}}{{.}}{{end}}`)
+	require.NoError(t, err)
+	items := make([]interface{}, 2*MaxOutputLength)
+	for i := range items {
+		items[i] = "x"
+	}
+	got, err := tmpl.Execute(Data{Data: map[string]interface{}{"items": items}})
+	require.NoError(t, err)
+	assert.Equal(t, strings.Repeat("x", MaxOutputLength), got)
+}
+
+func TestCompile_Invalid(t *testing.T) {
+	for _, expr := range []string{"{{.Header.X-Env", "{{unknownFunc .Data}}", "{{end}}"} {
+		_, err := Compile(expr)
+		assert.Error(t, err, expr)
+	}
+}
+
+func TestTemplate_UsesClientIP(t *testing.T) {
+	isIPHeader := func(name string) bool { return name == "X-Forwarded-For" }
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{"{{.ClientIP}}", true},
+		{"{{.ClientIP | sha256}}", true},
+		{"{{$.ClientIP}}", true},
+		{"{{.Header.X-Forwarded-For}}", true},
+		{"{{.Header.x-forwarded-for | lower}}", true},
+		{`{{index .Header "X-Forwarded-For"}}`, true},
+		{"{{.Record.client_ip}}", true},
+		{"{{range $k, $v := .Header}}{{$v}}{{end}}", true},
+		{"{{if .Query.debug}}{{.ClientIP}}{{end}}", true},
+		{"{{with .Data.x}}{{.}}{{end}}", true},
+		{"{{.Header.User-Agent}}", false},
+		{"{{.Record.site_id}}-{{.Query.utm_source | default \"none\"}}", false},
+		{"{{.Data.page | truncate 50}}", false},
+	}
+	for _, tt := range tests {
+		tmpl, err := Compile(tt.expr)
+		require.NoError(t, err, tt.expr)
+		assert.Equal(t, tt.want, tmpl.UsesClientIP(isIPHeader), tt.expr)
+	}
+}
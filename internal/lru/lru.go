@@ -0,0 +1,86 @@
+// internal/lru/lru.go
+
+// Package lru provides a fixed-size least recently used cache.
+package lru
+
+import (
+	"container/list"
+	"sync"
+)
+
+// entry is a cached key/value pair stored in the recency list.
+type entry[K comparable, V any] struct {
+	key   K
+	value V
+}
+
+// Cache is a fixed-size LRU cache. When full, adding a new key evicts the least
+// recently used one. It is safe for concurrent use.
+type Cache[K comparable, V any] struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List // Front is the most recently used entry
+	items    map[K]*list.Element
+}
+
+// New creates a cache holding at most capacity entries. A capacity below 1 is treated as 1.
+func New[K comparable, V any](capacity int) *Cache[K, V] {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &Cache[K, V]{
+		capacity: capacity,
+		order:    list.New(),
+		items:    make(map[K]*list.Element, capacity),
+	}
+}
+
+// Get returns the value for key and marks it as recently used.
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		c.order.MoveToFront(elem)
+		return elem.Value.(*entry[K, V]).value, true
+	}
+	var zero V
+	return zero, false
+}
+
+// Add stores the value for key, evicting the least recently used entry if the cache is full.
+// Returns true if an entry was evicted.
+func (c *Cache[K, V]) Add(key K, value V) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		elem.Value.(*entry[K, V]).value = value
+		c.order.MoveToFront(elem)
+		return false
+	}
+
+	c.items[key] = c.order.PushFront(&entry[K, V]{key: key, value: value})
+	if c.order.Len() <= c.capacity {
+		return false
+	}
+	oldest := c.order.Back()
+	c.order.Remove(oldest)
+	delete(c.items, oldest.Value.(*entry[K, V]).key)
+	return true
+}
+
+// Contains reports whether key is cached without changing its recency.
+func (c *Cache[K, V]) Contains(key K) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.items[key]
+	return ok
+}
+
+// Len returns the number of cached entries.
+func (c *Cache[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
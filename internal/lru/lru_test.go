@@ -0,0 +1,60 @@
+package lru
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache_Eviction(t *testing.T) {
+	c := New[string, int](2)
+	assert.False(t, c.Add("a", 1))
+	assert.False(t, c.Add("b", 2))
+
+	// Touch "a" so "b" becomes the least recently used entry
+	v, ok := c.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 1, v)
+
+	assert.True(t, c.Add("c", 3))
+	assert.False(t, c.Contains("b"))
+	assert.True(t, c.Contains("a"))
+	assert.True(t, c.Contains("c"))
+	assert.Equal(t, 2, c.Len())
+
+	_, ok = c.Get("b")
+	assert.False(t, ok)
+}
+
+func TestCache_UpdateExisting(t *testing.T) {
+	c := New[string, int](2)
+	c.Add("a", 1)
+	c.Add("b", 2)
+	assert.False(t, c.Add("a", 10))
+	c.Add("c", 3) // Evicts "b", "a" was refreshed by the update
+
+	v, ok := c.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 10, v)
+	assert.False(t, c.Contains("b"))
+}
+
+func TestCache_Concurrent(t *testing.T) {
+	c := New[string, int](16)
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				key := fmt.Sprintf("%d-%d", g, i%32)
+				c.Add(key, i)
+				c.Get(key)
+			}
+		}(g)
+	}
+	wg.Wait()
+	assert.Equal(t, 16, c.Len())
+}
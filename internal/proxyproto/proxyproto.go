@@ -0,0 +1,189 @@
+// Package proxyproto reads PROXY protocol v1 and v2 headers sent by L4 load balancers
+// (HAProxy, AWS NLB, ...) in front of the server, so the connection reports the address of the
+// original client instead of the balancer.
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/orgoj/weblogproxy/internal/iputil"
+)
+
+// HeaderTimeout limits the time a trusted peer has to send the PROXY header.
+const HeaderTimeout = 10 * time.Second
+
+// v2Signature starts every PROXY protocol v2 header.
+var v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// v1MaxLength is the maximum length of a v1 header including CRLF.
+const v1MaxLength = 107
+
+// ErrInvalidHeader is returned for malformed PROXY headers, the connection is closed.
+var ErrInvalidHeader = errors.New("invalid PROXY protocol header")
+
+// Listener reads the PROXY header of connections from trusted peers. Connections from other
+// peers are passed through unchanged, a PROXY header they send is not interpreted.
+type Listener struct {
+	net.Listener
+	trusted []*net.IPNet
+}
+
+// NewListener wraps the listener. Only peers in trusted may send a PROXY header, trusted peers
+// may also connect without one (e.g. health checks of the balancer).
+func NewListener(inner net.Listener, trusted []*net.IPNet) *Listener {
+	return &Listener{Listener: inner, trusted: trusted}
+}
+
+// Accept returns the next connection. The PROXY header is read on the first Read or
+// RemoteAddr call, so a slow peer does not block accepting other connections.
+func (l *Listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	peer, _ := conn.RemoteAddr().(*net.TCPAddr)
+	if peer == nil || !iputil.IsIPInAnyCIDR(peer.IP, l.trusted) {
+		return conn, nil
+	}
+	return &Conn{Conn: conn, reader: bufio.NewReader(conn)}, nil
+}
+
+// Conn is a connection from a trusted peer that may start with a PROXY header.
+type Conn struct {
+	net.Conn
+	reader     *bufio.Reader
+	once       sync.Once
+	remoteAddr net.Addr // Client address from the header, nil = the peer address
+	err        error
+}
+
+// readHeader reads the PROXY header, if the connection starts with one.
+func (c *Conn) readHeader() {
+	c.once.Do(func() {
+		_ = c.Conn.SetReadDeadline(time.Now().Add(HeaderTimeout))
+		c.remoteAddr, c.err = readHeader(c.reader)
+		_ = c.Conn.SetReadDeadline(time.Time{})
+		if c.err != nil {
+			_ = c.Conn.Close()
+		}
+	})
+}
+
+// Read reads data after the PROXY header.
+func (c *Conn) Read(b []byte) (int, error) {
+	c.readHeader()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.reader.Read(b)
+}
+
+// RemoteAddr returns the client address of the PROXY header, or the peer address for
+// connections without one or with an UNKNOWN/LOCAL header.
+func (c *Conn) RemoteAddr() net.Addr {
+	c.readHeader()
+	if c.remoteAddr != nil {
+		return c.remoteAddr
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// readHeader parses a v1 or v2 header. Returns a nil address without header or for headers
+// that do not carry a TCP client address.
+func readHeader(r *bufio.Reader) (net.Addr, error) {
+	start, err := r.Peek(len(v2Signature))
+	if err != nil {
+		// Shorter than any header, pass the data through
+		if errors.Is(err, io.EOF) || errors.Is(err, bufio.ErrBufferFull) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	switch {
+	case bytes.Equal(start, v2Signature):
+		return readV2(r)
+	case bytes.HasPrefix(start, []byte("PROXY ")):
+		return readV1(r)
+	}
+	return nil, nil
+}
+
+// readV1 parses "PROXY TCP4|TCP6|UNKNOWN src dst sport dport\r\n".
+func readV1(r *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	for len(line) < v1MaxLength {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidHeader, err)
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, fmt.Errorf("%w: v1 header too long", ErrInvalidHeader)
+	}
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidHeader, line)
+	}
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if ip == nil || err != nil || (fields[1] == "TCP4") != (ip.To4() != nil) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidHeader, line)
+	}
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+// readV2 parses the binary v2 header.
+func readV2(r *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidHeader, err)
+	}
+	if header[12]>>4 != 2 {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidHeader, header[12]>>4)
+	}
+	command, family := header[12]&0x0f, header[13]
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidHeader, err)
+	}
+
+	switch command {
+	case 0x0: // LOCAL, e.g. health checks of the balancer itself
+		return nil, nil
+	case 0x1: // PROXY
+	default:
+		return nil, fmt.Errorf("%w: unsupported command %d", ErrInvalidHeader, command)
+	}
+	// Address family in the high nibble, TLVs after the addresses are ignored
+	switch family >> 4 {
+	case 0x1: // IPv4: src, dst, sport, dport
+		if len(payload) < 12 {
+			return nil, fmt.Errorf("%w: short IPv4 address block", ErrInvalidHeader)
+		}
+		return &net.TCPAddr{IP: net.IP(payload[0:4]), Port: int(binary.BigEndian.Uint16(payload[8:10]))}, nil
+	case 0x2: // IPv6
+		if len(payload) < 36 {
+			return nil, fmt.Errorf("%w: short IPv6 address block", ErrInvalidHeader)
+		}
+		return &net.TCPAddr{IP: net.IP(payload[0:16]), Port: int(binary.BigEndian.Uint16(payload[32:34]))}, nil
+	}
+	// Unspecified or unix addresses carry no client IP
+	return nil, nil
+}
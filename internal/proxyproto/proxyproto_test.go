@@ -0,0 +1,105 @@
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// v2Header builds a v2 PROXY header for the command, family and address block.
+func v2Header(command, family byte, addresses []byte) []byte {
+	header := append([]byte{}, v2Signature...)
+	header = append(header, 0x20|command, family)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(addresses)))
+	return append(header, addresses...)
+}
+
+func TestReadHeader(t *testing.T) {
+	ipv4 := []byte{203, 0, 113, 9, 10, 0, 0, 1, 0x9c, 0x40, 0x01, 0xbb}
+	ipv6 := append(append(net.ParseIP("2001:db8::9").To16(), net.ParseIP("2001:db8::1").To16()...), 0x9c, 0x40, 0x01, 0xbb)
+
+	tests := []struct {
+		name    string
+		input   []byte
+		addr    string // Empty = no client address
+		wantErr bool
+	}{
+		{"v1 TCP4", []byte("PROXY TCP4 203.0.113.9 10.0.0.1 40000 443\r\nGET /"), "203.0.113.9:40000", false},
+		{"v1 TCP6", []byte("PROXY TCP6 2001:db8::9 2001:db8::1 40000 443\r\nGET /"), "[2001:db8::9]:40000", false},
+		{"v1 UNKNOWN", []byte("PROXY UNKNOWN\r\nGET /"), "", false},
+		{"v1 family mismatch", []byte("PROXY TCP4 2001:db8::9 2001:db8::1 40000 443\r\nGET /"), "", true},
+		{"v1 invalid port", []byte("PROXY TCP4 203.0.113.9 10.0.0.1 port 443\r\nGET /"), "", true},
+		{"v1 too long", []byte("PROXY TCP4 " + strings.Repeat("1", 120) + "\r\n"), "", true},
+		{"v2 IPv4", v2Header(0x1, 0x11, ipv4), "203.0.113.9:40000", false},
+		{"v2 IPv6 with TLV", v2Header(0x1, 0x21, append(ipv6, 0x04, 0x00, 0x01, 0x00)), "[2001:db8::9]:40000", false},
+		{"v2 LOCAL", v2Header(0x0, 0x00, nil), "", false},
+		{"v2 short address block", v2Header(0x1, 0x11, ipv4[:8]), "", true},
+		{"No header", []byte("GET / HTTP/1.1\r\nHost: x\r\n\r\n"), "", false},
+		{"Short data", []byte("GET /"), "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, err := readHeader(bufio.NewReader(bytes.NewReader(tt.input)))
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidHeader)
+				return
+			}
+			require.NoError(t, err)
+			if tt.addr == "" {
+				assert.Nil(t, addr)
+			} else {
+				require.NotNil(t, addr)
+				assert.Equal(t, tt.addr, addr.String())
+			}
+		})
+	}
+}
+
+func TestListener(t *testing.T) {
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer inner.Close()
+
+	// accept sends data from a new client and returns the accepted connection
+	accept := func(l net.Listener, data string) net.Conn {
+		client, err := net.Dial("tcp", inner.Addr().String())
+		require.NoError(t, err)
+		t.Cleanup(func() { client.Close() })
+		_, err = client.Write([]byte(data))
+		require.NoError(t, err)
+		conn, err := l.Accept()
+		require.NoError(t, err)
+		t.Cleanup(func() { conn.Close() })
+		return conn
+	}
+	readAll := func(conn net.Conn, n int) string {
+		buf := make([]byte, n)
+		_, err := io.ReadFull(conn, buf)
+		require.NoError(t, err)
+		return string(buf)
+	}
+	header := "PROXY TCP4 203.0.113.9 10.0.0.1 40000 443\r\n"
+
+	// Trusted peers: the header is consumed and sets the remote address
+	trusted := NewListener(inner, []*net.IPNet{{IP: net.IPv4(127, 0, 0, 1), Mask: net.CIDRMask(32, 32)}})
+	conn := accept(trusted, header+"GET /")
+	assert.Equal(t, "203.0.113.9:40000", conn.RemoteAddr().String())
+	assert.Equal(t, "GET /", readAll(conn, 5))
+
+	conn = accept(trusted, "GET / HTTP/1.1\r\n")
+	assert.Equal(t, "GET / HTTP/1.1\r\n", readAll(conn, 16))
+	assert.Contains(t, conn.RemoteAddr().String(), "127.0.0.1:")
+
+	// Untrusted peers: the header is passed through and ignored
+	untrusted := NewListener(inner, nil)
+	conn = accept(untrusted, header)
+	assert.Contains(t, conn.RemoteAddr().String(), "127.0.0.1:")
+	assert.Equal(t, header, readAll(conn, len(header)))
+}
@@ -0,0 +1,396 @@
+// internal/redact/redact.go
+
+// Package redact detects and masks personal data (PII) in client log data.
+package redact
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Actions applied to detected values and fields.
+const (
+	ActionMask = "mask" // Replace the value, keeping a hint (e.g. last 4 digits of a card, email domain)
+	ActionHash = "hash" // Replace the value with a salted hash, equal values stay correlatable
+	ActionDrop = "drop" // Remove the whole field
+)
+
+// Actions lists the supported actions.
+var Actions = []string{ActionMask, ActionHash, ActionDrop}
+
+// maskedValue replaces values without a detector specific mask.
+const maskedValue = "[REDACTED]"
+
+// detector finds one kind of personal data in strings.
+type detector struct {
+	name  string
+	re    *regexp.Regexp
+	valid func(match string) bool // Optional check of a regex match (checksum, IP parsing)
+	mask  func(match string) string
+}
+
+// builtinDetectors are the detectors selectable by name, in the order they are applied.
+// Credit cards and IBANs run before phone numbers, which would match their digits.
+var builtinDetectors = []detector{
+	{name: "email", re: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`), mask: maskEmail},
+	{name: "jwt", re: regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)},
+	{name: "credit_card", re: regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`), valid: luhnValid, mask: maskKeepLast4},
+	{name: "iban", re: regexp.MustCompile(`\b[A-Z]{2}\d{2}(?: ?[A-Z0-9]){11,30}\b`), valid: ibanValid, mask: maskKeepLast4},
+	{name: "ipv6", re: regexp.MustCompile(`[0-9A-Fa-f]{0,4}(?::[0-9A-Fa-f]{0,4}){2,7}(?:\.\d{1,3}){0,3}`), valid: ipv6Valid},
+	{name: "ipv4", re: regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`), valid: ipv4Valid, mask: maskIPv4},
+	{name: "phone", re: regexp.MustCompile(`(?:\+\d[\d ().-]{6,}\d|\b\d{3}[ .-]\d{3}[ .-]\d{3,4}\b)`), valid: phoneValid, mask: maskKeepLast4},
+}
+
+// Detectors lists the names of the built-in detectors.
+var Detectors = func() []string {
+	names := make([]string, len(builtinDetectors))
+	for i, d := range builtinDetectors {
+		names[i] = d.name
+	}
+	return names
+}()
+
+// Pattern is a custom regular expression to redact.
+type Pattern struct {
+	Name   string
+	Regex  string
+	Action string // Empty means the default action
+}
+
+// Field is an action applied to a whole field of the data, addressed by a dot separated path.
+type Field struct {
+	Path   string
+	Action string
+}
+
+// Options configures a Redactor.
+type Options struct {
+	Detectors []string // Names of built-in detectors to apply to all string values
+	Action    string   // Default action for detectors and patterns (default: mask)
+	HashSalt  string   // Salt for the hash action
+	Patterns  []Pattern
+	Fields    []Field
+}
+
+// matcher is a compiled detector or custom pattern with its action.
+type matcher struct {
+	detector
+	kind   string // "detector" or "pattern", used for counters
+	action string
+}
+
+// Redactor applies the configured detectors, patterns and field actions to data maps.
+// It is safe for concurrent use.
+type Redactor struct {
+	matchers []matcher
+	fields   map[string]string // Path -> action
+	salt     []byte
+}
+
+// New validates the options and compiles a Redactor.
+func New(opts Options) (*Redactor, error) {
+	defaultAction := opts.Action
+	if defaultAction == "" {
+		defaultAction = ActionMask
+	}
+	if !validAction(defaultAction) {
+		return nil, fmt.Errorf("invalid action '%s', must be one of %v", defaultAction, Actions)
+	}
+
+	r := &Redactor{fields: make(map[string]string, len(opts.Fields)), salt: []byte(opts.HashSalt)}
+	usesHash := defaultAction == ActionHash && (len(opts.Detectors) > 0 || len(opts.Patterns) > 0)
+
+	for _, d := range builtinDetectors {
+		for _, name := range opts.Detectors {
+			if name == d.name {
+				r.matchers = append(r.matchers, matcher{detector: d, kind: "detector", action: defaultAction})
+			}
+		}
+	}
+	for i, name := range opts.Detectors {
+		if !contains(Detectors, name) {
+			return nil, fmt.Errorf("detectors[%d]: unknown detector '%s', must be one of %v", i, name, Detectors)
+		}
+	}
+
+	for i, p := range opts.Patterns {
+		if p.Name == "" {
+			return nil, fmt.Errorf("patterns[%d]: name is required", i)
+		}
+		re, err := regexp.Compile(p.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("patterns[%d]: invalid regex '%s': %w", i, p.Regex, err)
+		}
+		if p.Regex == "" || re.MatchString("") {
+			return nil, fmt.Errorf("patterns[%d]: regex '%s' must not match an empty string", i, p.Regex)
+		}
+		action := p.Action
+		if action == "" {
+			action = defaultAction
+		}
+		if !validAction(action) {
+			return nil, fmt.Errorf("patterns[%d]: invalid action '%s', must be one of %v", i, action, Actions)
+		}
+		usesHash = usesHash || action == ActionHash
+		r.matchers = append(r.matchers, matcher{detector: detector{name: p.Name, re: re}, kind: "pattern", action: action})
+	}
+
+	for i, f := range opts.Fields {
+		if f.Path == "" {
+			return nil, fmt.Errorf("fields[%d]: path is required", i)
+		}
+		if !validAction(f.Action) {
+			return nil, fmt.Errorf("fields[%d]: invalid action '%s', must be one of %v", i, f.Action, Actions)
+		}
+		usesHash = usesHash || f.Action == ActionHash
+		r.fields[f.Path] = f.Action
+	}
+
+	if usesHash && len(r.salt) < 16 {
+		return nil, fmt.Errorf("hash_salt must be at least 16 characters when the hash action is used")
+	}
+	return r, nil
+}
+
+// Apply returns a copy of data with the personal data redacted. The input is not modified.
+// A nil Redactor returns data unchanged.
+func (r *Redactor) Apply(data map[string]interface{}) map[string]interface{} {
+	if r == nil || data == nil {
+		return data
+	}
+	return r.applyMap(data, "")
+}
+
+// applyMap redacts a nested map whose fields are addressed relative to prefix.
+func (r *Redactor) applyMap(data map[string]interface{}, prefix string) map[string]interface{} {
+	out := make(map[string]interface{}, len(data))
+	for key, value := range data {
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+
+		if action, ok := r.fields[path]; ok {
+			count("field:" + path)
+			switch action {
+			case ActionDrop:
+				continue
+			case ActionHash:
+				out[key] = r.hash(fmt.Sprint(value))
+			default:
+				out[key] = maskedValue
+			}
+			continue
+		}
+
+		redacted, drop := r.applyValue(value, path)
+		if !drop {
+			out[key] = redacted
+		}
+	}
+	return out
+}
+
+// applyValue redacts a single value. Returns drop=true if the field has to be removed.
+func (r *Redactor) applyValue(value interface{}, path string) (interface{}, bool) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return r.applyMap(v, path), false
+	case []interface{}:
+		out := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			if redacted, drop := r.applyValue(item, path); !drop {
+				out = append(out, redacted)
+			}
+		}
+		return out, false
+	case string:
+		return r.applyString(v)
+	}
+	return value, false
+}
+
+// applyString runs all matchers over a string value.
+func (r *Redactor) applyString(s string) (string, bool) {
+	for _, m := range r.matchers {
+		matched := false
+		s = m.re.ReplaceAllStringFunc(s, func(match string) string {
+			if m.valid != nil && !m.valid(match) {
+				return match
+			}
+			matched = true
+			count(m.kind + ":" + m.name)
+			switch m.action {
+			case ActionHash:
+				return r.hash(match)
+			case ActionMask:
+				if m.mask != nil {
+					return m.mask(match)
+				}
+			}
+			return maskedValue
+		})
+		if matched && m.action == ActionDrop {
+			return "", true
+		}
+	}
+	return s, false
+}
+
+// hash returns a truncated HMAC-SHA256 of the value keyed with the salt.
+func (r *Redactor) hash(value string) string {
+	mac := hmac.New(sha256.New, r.salt)
+	mac.Write([]byte(value))
+	return "hash:" + hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+// counters holds the number of redactions by "detector:<name>", "pattern:<name>" and "field:<path>".
+var counters sync.Map // string -> *atomic.Uint64
+
+// count increments a redaction counter.
+func count(key string) {
+	c, ok := counters.Load(key)
+	if !ok {
+		c, _ = counters.LoadOrStore(key, new(atomic.Uint64))
+	}
+	c.(*atomic.Uint64).Add(1)
+}
+
+// Stats returns the number of redactions applied since start, keyed by "detector:<name>",
+// "pattern:<name>" and "field:<path>".
+func Stats() map[string]uint64 {
+	stats := make(map[string]uint64)
+	counters.Range(func(key, value interface{}) bool {
+		stats[key.(string)] = value.(*atomic.Uint64).Load()
+		return true
+	})
+	return stats
+}
+
+// maskEmail keeps the domain of an email address.
+func maskEmail(match string) string {
+	at := strings.LastIndex(match, "@")
+	return "***" + match[at:]
+}
+
+// maskKeepLast4 replaces all digits and letters except the last four.
+func maskKeepLast4(match string) string {
+	b := []byte(match)
+	keep := 4
+	for i := len(b) - 1; i >= 0; i-- {
+		if !isAlnum(b[i]) {
+			continue
+		}
+		if keep > 0 {
+			keep--
+			continue
+		}
+		b[i] = '*'
+	}
+	return string(b)
+}
+
+// maskIPv4 keeps the first three octets, like a /24 network.
+func maskIPv4(match string) string {
+	return match[:strings.LastIndex(match, ".")] + ".0"
+}
+
+// luhnValid checks the Luhn checksum of a card number candidate.
+func luhnValid(match string) bool {
+	digits := onlyDigits(match)
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// ibanValid checks the ISO 13616 mod-97 checksum of an IBAN candidate.
+func ibanValid(match string) bool {
+	iban := strings.ReplaceAll(match, " ", "")
+	if len(iban) < 15 || len(iban) > 34 {
+		return false
+	}
+	rearranged := iban[4:] + iban[:4]
+	remainder := 0
+	for i := 0; i < len(rearranged); i++ {
+		c := rearranged[i]
+		switch {
+		case c >= '0' && c <= '9':
+			remainder = (remainder*10 + int(c-'0')) % 97
+		case c >= 'A' && c <= 'Z':
+			remainder = (remainder*100 + int(c-'A'+10)) % 97
+		default:
+			return false
+		}
+	}
+	return remainder == 1
+}
+
+// ipv4Valid checks that all octets are in range.
+func ipv4Valid(match string) bool {
+	ip := net.ParseIP(match)
+	return ip != nil && ip.To4() != nil
+}
+
+// ipv6Valid checks that the candidate parses as an IPv6 address (not times like 12:30:45).
+func ipv6Valid(match string) bool {
+	ip := net.ParseIP(match)
+	return ip != nil && strings.Count(match, ":") >= 2
+}
+
+// phoneValid requires 8 to 15 digits (E.164).
+func phoneValid(match string) bool {
+	n := len(onlyDigits(match))
+	return n >= 8 && n <= 15
+}
+
+// onlyDigits returns the digits of s.
+func onlyDigits(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] >= '0' && s[i] <= '9' {
+			sb.WriteByte(s[i])
+		}
+	}
+	return sb.String()
+}
+
+// isAlnum reports whether c is an ASCII letter or digit.
+func isAlnum(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// validAction reports whether the action is supported.
+func validAction(action string) bool {
+	return contains(Actions, action)
+}
+
+// contains reports whether the slice contains the string.
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,159 @@
+// internal/rules/explain.go
+
+package rules
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/orgoj/weblogproxy/internal/config"
+)
+
+// ConditionCheck records the outcome of a single condition field of a rule.
+type ConditionCheck struct {
+	Field   string `json:"field"`
+	Matched bool   `json:"matched"`
+	Detail  string `json:"detail,omitempty"`
+}
+
+// RuleTrace records how a single rule was evaluated.
+type RuleTrace struct {
+	Index             int              `json:"index"`
+	ID                string           `json:"id,omitempty"`
+	Description       string           `json:"description,omitempty"`
+	Path              string           `json:"path"` // Rule path used in messages, e.g. log_config[shop-checkout]
+	Enabled           bool             `json:"enabled"`
+	Evaluated         bool             `json:"evaluated"` // False for disabled rules and rules after the final rule
+	Matched           bool             `json:"matched"`
+	Continue          bool             `json:"continue"`
+	Final             bool             `json:"final"` // Rule matched without continue and ended processing
+	Checks            []ConditionCheck `json:"checks,omitempty"`
+	AddLogData        []string         `json:"add_log_data,omitempty"`       // Field names accumulated by this rule
+	Scripts           []string         `json:"scripts,omitempty"`            // Script URLs newly accumulated by this rule
+	JavaScriptOptions []string         `json:"javascript_options,omitempty"` // JavaScript options set by this rule
+	Destinations      []string         `json:"destinations,omitempty"`       // Destinations selected by the final rule
+	Note              string           `json:"note,omitempty"`
+}
+
+// TraceOutcome is a JSON-friendly summary of the final LogProcessingResult.
+type TraceOutcome struct {
+	LogEnabled         bool     `json:"log_enabled"`
+	LogScriptDownloads bool     `json:"log_script_downloads"`
+	Destinations       []string `json:"destinations"` // Empty means all enabled destinations
+	Scripts            []string `json:"scripts"`
+	AddLogData         []string `json:"add_log_data"`
+	TrackURL           bool     `json:"track_url"`
+	TrackTraceback     bool     `json:"track_traceback"`
+	ConsentAction      string   `json:"consent_action,omitempty"` // drop, strip or anonymize when consent is denied
+}
+
+// Trace is the full explanation of a rule evaluation for one request.
+type Trace struct {
+	SiteID    string              `json:"site_id"`
+	GtmID     string              `json:"gtm_id,omitempty"`
+	ClientIP  string              `json:"client_ip"`
+	UserAgent string              `json:"user_agent"`
+	Time      time.Time           `json:"time"`
+	Rules     []RuleTrace         `json:"rules"`
+	Outcome   TraceOutcome        `json:"outcome"`
+	Result    LogProcessingResult `json:"-"`
+}
+
+// Explain evaluates the rules like Process does and additionally returns a per-rule trace.
+// Unlike Process, every field of a rule condition is checked so the trace shows all mismatches.
+func (rp *RuleProcessor) Explain(siteID, gtmID string, r *http.Request) *Trace {
+	trace := &Trace{}
+	trace.Result = rp.process(siteID, gtmID, r, trace)
+
+	res := trace.Result
+	trace.Outcome = TraceOutcome{
+		LogEnabled:         res.ShouldLogToServer,
+		LogScriptDownloads: res.ShouldLogScriptDownloads,
+		Destinations:       res.TargetDestinations,
+		TrackURL:           res.AccumulatedJavaScriptOptions.TrackURL,
+		TrackTraceback:     res.AccumulatedJavaScriptOptions.TrackTraceback,
+		ConsentAction:      res.ConsentAction,
+	}
+	for _, script := range res.AccumulatedScripts {
+		trace.Outcome.Scripts = append(trace.Outcome.Scripts, script.URL)
+	}
+	for _, spec := range res.AccumulatedAddLogData {
+		trace.Outcome.AddLogData = append(trace.Outcome.AddLogData, spec.Name)
+	}
+	sort.Strings(trace.Outcome.Scripts)
+	sort.Strings(trace.Outcome.AddLogData)
+
+	return trace
+}
+
+// skipRemaining records the rules that were not evaluated because a final rule matched.
+func (t *Trace) skipRemaining(rules []compiledRule, firstIndex int) {
+	for j, compiled := range rules {
+		rt := newRuleTrace(firstIndex+j, compiled.rule)
+		rt.Note = "not evaluated, an earlier final rule matched"
+		t.Rules = append(t.Rules, rt)
+	}
+}
+
+// newRuleTrace creates the trace entry of a rule before it is evaluated.
+func newRuleTrace(index int, rule config.LogRule) RuleTrace {
+	return RuleTrace{
+		Index:       index,
+		ID:          rule.ID,
+		Description: rule.Description,
+		Path:        rule.Path(index),
+		Enabled:     rule.Enabled,
+		Continue:    rule.Continue,
+	}
+}
+
+// describeHeaderCondition renders a header condition value for trace output.
+func describeHeaderCondition(v interface{}) string {
+	switch v {
+	case true:
+		return "present"
+	case false:
+		return "absent"
+	}
+	return fmt.Sprintf("'%v'", v)
+}
+
+// SyntheticRequest describes a request used to evaluate rules without real traffic,
+// e.g. by the explain endpoint, the CLI or rule tests.
+type SyntheticRequest struct {
+	SiteID    string            `json:"site_id" yaml:"site_id"`
+	GtmID     string            `json:"gtm_id,omitempty" yaml:"gtm_id,omitempty"`
+	IP        string            `json:"ip,omitempty" yaml:"ip,omitempty"`
+	UserAgent string            `json:"user_agent,omitempty" yaml:"user_agent,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+}
+
+// HTTPRequest builds an *http.Request carrying the synthetic client IP, user agent and headers.
+func (s SyntheticRequest) HTTPRequest() (*http.Request, error) {
+	if s.SiteID == "" {
+		return nil, fmt.Errorf("site_id is required")
+	}
+	r, err := http.NewRequest(http.MethodGet, "/logger.js", nil)
+	if err != nil {
+		return nil, err
+	}
+	r.RemoteAddr = ""
+	if s.IP != "" {
+		ip := net.ParseIP(strings.TrimSpace(s.IP))
+		if ip == nil {
+			return nil, fmt.Errorf("invalid ip '%s'", s.IP)
+		}
+		r.RemoteAddr = net.JoinHostPort(ip.String(), "0")
+	}
+	for name, value := range s.Headers {
+		r.Header.Set(name, value)
+	}
+	if s.UserAgent != "" {
+		r.Header.Set("User-Agent", s.UserAgent)
+	}
+	return r, nil
+}
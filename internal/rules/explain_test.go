@@ -0,0 +1,175 @@
+package rules
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/orgoj/weblogproxy/internal/config"
+)
+
+func TestRuleProcessor_Explain(t *testing.T) {
+	cfg := &config.Config{
+		LogConfig: []config.LogRule{
+			{
+				Condition:       config.LogRuleCondition{},
+				Enabled:         true,
+				Continue:        true,
+				AddLogData:      []config.AddLogDataSpec{{Name: "env", Source: "static", Value: "prod"}},
+				ScriptInjection: []config.ScriptInjectionSpec{{URL: "/base.js"}},
+			},
+			{
+				Condition: config.LogRuleCondition{SiteID: "disabled"},
+				Enabled:   false,
+			},
+			{
+				Condition: config.LogRuleCondition{
+					SiteID:  "shop",
+					GTMIDs:  []string{"GTM-1"},
+					Headers: map[string]interface{}{"X-Debug": true},
+				},
+				Enabled: true,
+			},
+			{
+				Condition:       config.LogRuleCondition{SiteID: "shop", IPs: []string{"10.0.0.0/8"}},
+				Enabled:         true,
+				LogDestinations: []string{"file"},
+				JavaScriptOptions: struct {
+					TrackURL       bool `yaml:"track_url,omitempty"`
+					TrackTraceback bool `yaml:"track_traceback,omitempty"`
+				}{TrackURL: true},
+			},
+			{
+				Condition: config.LogRuleCondition{},
+				Enabled:   true,
+			},
+		},
+	}
+	p, err := NewRuleProcessor(cfg)
+	require.NoError(t, err)
+
+	req, err := SyntheticRequest{SiteID: "shop", GtmID: "GTM-2", IP: "10.1.2.3", UserAgent: "TestAgent"}.HTTPRequest()
+	require.NoError(t, err)
+
+	trace := p.Explain("shop", "GTM-2", req)
+
+	assert.Equal(t, "10.1.2.3", trace.ClientIP)
+	assert.Equal(t, "TestAgent", trace.UserAgent)
+	require.Len(t, trace.Rules, 5)
+
+	// Rule 0: empty continue rule accumulates data and scripts
+	assert.True(t, trace.Rules[0].Matched)
+	assert.False(t, trace.Rules[0].Final)
+	assert.Equal(t, []string{"env"}, trace.Rules[0].AddLogData)
+	assert.Equal(t, []string{"/base.js"}, trace.Rules[0].Scripts)
+
+	// Rule 1: disabled
+	assert.False(t, trace.Rules[1].Evaluated)
+	assert.Equal(t, "rule is disabled", trace.Rules[1].Note)
+
+	// Rule 2: all fields are reported, not only the first failure
+	assert.True(t, trace.Rules[2].Evaluated)
+	assert.False(t, trace.Rules[2].Matched)
+	require.Len(t, trace.Rules[2].Checks, 3)
+	assert.Equal(t, ConditionCheck{Field: "site_id", Matched: true, Detail: "got 'shop', want 'shop'"}, trace.Rules[2].Checks[0])
+	assert.Equal(t, "gtm_ids", trace.Rules[2].Checks[1].Field)
+	assert.False(t, trace.Rules[2].Checks[1].Matched)
+	assert.Equal(t, "headers.X-Debug", trace.Rules[2].Checks[2].Field)
+	assert.False(t, trace.Rules[2].Checks[2].Matched)
+
+	// Rule 3: final rule
+	assert.True(t, trace.Rules[3].Final)
+	assert.Equal(t, []string{"file"}, trace.Rules[3].Destinations)
+	assert.Equal(t, []string{"track_url"}, trace.Rules[3].JavaScriptOptions)
+
+	// Rule 4: skipped after the final rule
+	assert.False(t, trace.Rules[4].Evaluated)
+	assert.NotEmpty(t, trace.Rules[4].Note)
+
+	// Outcome mirrors Process
+	assert.Equal(t, TraceOutcome{
+		LogEnabled:   true,
+		Destinations: []string{"file"},
+		Scripts:      []string{"/base.js"},
+		AddLogData:   []string{"env"},
+		TrackURL:     true,
+	}, trace.Outcome)
+	assert.Equal(t, p.Process("shop", "GTM-2", req).ShouldLogToServer, trace.Result.ShouldLogToServer)
+}
+
+func TestSyntheticRequest_HTTPRequest(t *testing.T) {
+	t.Run("sets client IP, user agent and headers", func(t *testing.T) {
+		req, err := SyntheticRequest{
+			SiteID:    "site",
+			IP:        "2001:db8::1",
+			UserAgent: "UA",
+			Headers:   map[string]string{"x-custom": "v"},
+		}.HTTPRequest()
+		require.NoError(t, err)
+		assert.Equal(t, "[2001:db8::1]:0", req.RemoteAddr)
+		assert.Equal(t, "UA", req.UserAgent())
+		assert.Equal(t, "v", req.Header.Get("X-Custom"))
+	})
+
+	t.Run("requires site_id", func(t *testing.T) {
+		_, err := SyntheticRequest{IP: "1.2.3.4"}.HTTPRequest()
+		assert.Error(t, err)
+	})
+
+	t.Run("rejects invalid IP", func(t *testing.T) {
+		_, err := SyntheticRequest{SiteID: "site", IP: "not-an-ip"}.HTTPRequest()
+		assert.Error(t, err)
+	})
+}
+
+func TestRuleProcessor_ExplainMatchesProcess(t *testing.T) {
+	dnt := true
+	cfg := &config.Config{
+		LogConfig: []config.LogRule{
+			{
+				Condition: config.LogRuleCondition{
+					SiteID:     "shop",
+					Headers:    map[string]interface{}{"X-Debug": true, "X-Env": "prod", "X-Skip": false},
+					UserAgents: []string{"*Chrome*"},
+					IPs:        []string{"10.0.0.0/8"},
+					DNT:        &dnt,
+				},
+				Enabled:         true,
+				LogDestinations: []string{"debug"},
+			},
+			{Condition: config.LogRuleCondition{SiteID: "shop"}, Enabled: true},
+		},
+	}
+	p, err := NewRuleProcessor(cfg)
+	require.NoError(t, err)
+
+	full := map[string]string{"X-Debug": "1", "X-Env": "prod", "DNT": "1"}
+	requests := []SyntheticRequest{
+		{SiteID: "shop", IP: "10.1.2.3", UserAgent: "Chrome", Headers: full},
+		{SiteID: "shop", IP: "192.0.2.1", UserAgent: "Chrome", Headers: full},
+		{SiteID: "shop", UserAgent: "Chrome", Headers: full},
+		{SiteID: "shop", IP: "10.1.2.3", UserAgent: "Firefox", Headers: full},
+		{SiteID: "shop", IP: "10.1.2.3", UserAgent: "Chrome", Headers: map[string]string{"X-Debug": "1", "X-Env": "prod", "X-Skip": "1", "DNT": "1"}},
+		{SiteID: "shop", IP: "10.1.2.3", UserAgent: "Chrome", Headers: map[string]string{"X-Debug": "1", "X-Env": "dev", "DNT": "1"}},
+		{SiteID: "shop", IP: "10.1.2.3", UserAgent: "Chrome", Headers: map[string]string{"X-Debug": "1", "X-Env": "prod"}},
+		{SiteID: "blog", IP: "10.1.2.3", UserAgent: "Chrome", Headers: full},
+	}
+	// Explain and Process share the matcher, so their results never differ
+	for _, sr := range requests {
+		req, err := sr.HTTPRequest()
+		require.NoError(t, err)
+		trace := p.Explain(sr.SiteID, "", req)
+		assert.Equal(t, p.Process(sr.SiteID, "", req).TargetDestinations, trace.Result.TargetDestinations, "%+v", sr)
+		assert.Equal(t, trace.Rules[0].Matched, trace.Result.TargetDestinations != nil, "%+v", sr)
+	}
+
+	// Traces list all fields in a stable order
+	req, err := requests[3].HTTPRequest()
+	require.NoError(t, err)
+	var fields []string
+	for _, check := range p.Explain("shop", "", req).Rules[0].Checks {
+		fields = append(fields, check.Field)
+	}
+	assert.Equal(t, []string{"site_id", "headers.X-Debug", "headers.X-Env", "headers.X-Skip", "user_agents", "ips", "dnt"}, fields)
+}
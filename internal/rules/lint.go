@@ -0,0 +1,262 @@
+// internal/rules/lint.go
+
+package rules
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/gobwas/glob"
+	"github.com/orgoj/weblogproxy/internal/config"
+)
+
+// LintWarning describes a logical problem in the rule configuration.
+// Warnings never prevent the configuration from being used.
+type LintWarning struct {
+	Rule    string // Path of the rule, see config.LogRule.Path
+	Message string // Human-readable description
+}
+
+// String formats the warning with the path of the rule.
+func (w LintWarning) String() string {
+	return fmt.Sprintf("%s: %s", w.Rule, w.Message)
+}
+
+// Lint checks the rules for logical problems that validation does not catch: rules that can never
+// match because an earlier final rule with a broader condition always wins, references to disabled
+// destinations, duplicate script URLs and add_log_data fields overwritten by later rules.
+// The configuration must already be valid, an error is returned if the rules cannot be compiled.
+func Lint(cfg *config.Config) ([]LintWarning, error) {
+	set, err := compileRules(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	disabledDestinations := make(map[string]bool)
+	for _, dest := range cfg.LogDestinations {
+		if !dest.Enabled {
+			disabledDestinations[dest.Name] = true
+		}
+	}
+
+	var warnings []LintWarning
+	path := func(i int) string {
+		return set.compiledRules[i].rule.Path(i)
+	}
+	warn := func(rule int, format string, args ...interface{}) {
+		warnings = append(warnings, LintWarning{Rule: path(rule), Message: fmt.Sprintf(format, args...)})
+	}
+
+	scriptOwner := make(map[string]int) // Script URL -> first continue rule injecting it
+	dataOwner := make(map[string]int)   // add_log_data name -> last continue rule setting it
+
+	for i, compiled := range set.compiledRules {
+		rule := compiled.rule
+		if !rule.Enabled {
+			continue
+		}
+
+		for j := 0; j < i; j++ {
+			earlier := set.compiledRules[j]
+			if earlier.rule.Enabled && !earlier.rule.Continue && conditionCovers(earlier, compiled) {
+				warn(i, "rule can never match, earlier final rule %s matches every request this rule matches", path(j))
+				break
+			}
+		}
+
+		for _, name := range rule.LogDestinations {
+			if disabledDestinations[name] {
+				warn(i, "log_destination '%s' is disabled, nothing will be logged to it", name)
+			}
+		}
+
+		seenScripts := make(map[string]bool)
+		for _, script := range rule.ScriptInjection {
+			if seenScripts[script.URL] {
+				warn(i, "script_injection url '%s' is listed more than once", script.URL)
+				continue
+			}
+			seenScripts[script.URL] = true
+			if owner, ok := scriptOwner[script.URL]; ok {
+				warn(i, "script_injection url '%s' is already injected by continue rule %s, this entry is ignored when both match", script.URL, path(owner))
+			}
+		}
+
+		seenData := make(map[string]bool)
+		for _, spec := range rule.AddLogData {
+			if seenData[spec.Name] {
+				warn(i, "add_log_data name '%s' is set more than once, the last entry wins", spec.Name)
+				continue
+			}
+			seenData[spec.Name] = true
+			if owner, ok := dataOwner[spec.Name]; ok && !isRemoval(spec) {
+				warn(i, "add_log_data name '%s' overwrites the value set by continue rule %s when both match", spec.Name, path(owner))
+			}
+		}
+
+		if rule.Continue {
+			for url := range seenScripts {
+				if _, ok := scriptOwner[url]; !ok {
+					scriptOwner[url] = i
+				}
+			}
+			for name := range seenData {
+				dataOwner[name] = i
+			}
+		}
+	}
+
+	return warnings, nil
+}
+
+// isRemoval reports whether the add_log_data spec removes the field, which is an intentional overwrite.
+func isRemoval(spec config.AddLogDataSpec) bool {
+	return spec.Source == "static" && spec.Value == "false"
+}
+
+// conditionCovers reports whether every request matching b is guaranteed to match a.
+// The check is conservative: false means a may not cover b.
+func conditionCovers(a, b compiledRule) bool {
+	ac, bc := a.condition, b.condition
+
+	if !ac.activeFrom.IsZero() && (bc.activeFrom.IsZero() || bc.activeFrom.Before(ac.activeFrom)) {
+		return false
+	}
+	if !ac.activeUntil.IsZero() && (bc.activeUntil.IsZero() || bc.activeUntil.After(ac.activeUntil)) {
+		return false
+	}
+	if len(ac.schedules) > 0 && !sameSchedules(a.rule.Condition, b.rule.Condition) {
+		return false
+	}
+	if ac.siteID != "" && ac.siteID != bc.siteID {
+		return false
+	}
+	if len(ac.gtmIDs) > 0 && (len(bc.gtmIDs) == 0 || !subsetStrings(bc.gtmIDs, ac.gtmIDs)) {
+		return false
+	}
+	if !headersCover(ac.headers, bc.headers) {
+		return false
+	}
+	if len(ac.userAgentGlobs) > 0 && !globsCover(ac.userAgentGlobs, a.rule.Condition.UserAgents, b.rule.Condition.UserAgents) {
+		return false
+	}
+	if len(ac.ipCIDRs) > 0 && (len(bc.ipCIDRs) == 0 || !cidrsCover(ac.ipCIDRs, bc.ipCIDRs)) {
+		return false
+	}
+	if len(ac.countries) > 0 && (len(bc.countries) == 0 || !subsetStrings(bc.countries, ac.countries)) {
+		return false
+	}
+	if len(ac.asns) > 0 && (len(bc.asns) == 0 || !subsetUints(bc.asns, ac.asns)) {
+		return false
+	}
+	if len(ac.deviceTypes) > 0 && (len(bc.deviceTypes) == 0 || !subsetStrings(bc.deviceTypes, ac.deviceTypes)) {
+		return false
+	}
+	if ac.isBot != nil && (bc.isBot == nil || *bc.isBot != *ac.isBot) {
+		return false
+	}
+	if ac.gpc != nil && (bc.gpc == nil || *bc.gpc != *ac.gpc) {
+		return false
+	}
+	if ac.dnt != nil && (bc.dnt == nil || *bc.dnt != *ac.dnt) {
+		return false
+	}
+	for category, want := range ac.consent {
+		if have, ok := bc.consent[category]; !ok || have != want {
+			return false
+		}
+	}
+	return true
+}
+
+// subsetUints reports whether every value of sub is contained in set.
+func subsetUints(sub, set []uint) bool {
+	for _, v := range sub {
+		if !containsUint(set, v) {
+			return false
+		}
+	}
+	return true
+}
+
+// sameSchedules reports whether both conditions use identical schedules in the same time zone.
+func sameSchedules(a, b config.LogRuleCondition) bool {
+	return a.Timezone == b.Timezone && sameStrings(a.Schedules, b.Schedules)
+}
+
+// subsetStrings reports whether every string of sub is contained in set.
+func subsetStrings(sub, set []string) bool {
+	for _, s := range sub {
+		if !containsString(set, s) {
+			return false
+		}
+	}
+	return true
+}
+
+// headersCover reports whether every header requirement of a is implied by the requirements of b.
+func headersCover(a, b map[string]interface{}) bool {
+	bCanonical := make(map[string]interface{}, len(b))
+	for name, value := range b {
+		bCanonical[http.CanonicalHeaderKey(name)] = value
+	}
+	for name, want := range a {
+		have, ok := bCanonical[http.CanonicalHeaderKey(name)]
+		if !ok {
+			return false
+		}
+		switch want {
+		case true:
+			if have == false {
+				return false
+			}
+		case false:
+			if have != false {
+				return false
+			}
+		default:
+			if have != want {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// globsCover reports whether every pattern of b matches only strings matched by a pattern of a.
+// Only identical patterns and literal patterns of b are recognized.
+func globsCover(aGlobs []glob.Glob, aPatterns, bPatterns []string) bool {
+	if len(bPatterns) == 0 {
+		return false
+	}
+	for _, bp := range bPatterns {
+		covered := containsString(aPatterns, bp)
+		if !covered && glob.QuoteMeta(bp) == bp {
+			covered = matchGlobs(aGlobs, bp)
+		}
+		if !covered {
+			return false
+		}
+	}
+	return true
+}
+
+// cidrsCover reports whether every network of b is contained in a network of a.
+func cidrsCover(a, b []*net.IPNet) bool {
+	for _, bn := range b {
+		bOnes, bBits := bn.Mask.Size()
+		covered := false
+		for _, an := range a {
+			aOnes, aBits := an.Mask.Size()
+			if aBits == bBits && aOnes <= bOnes && an.Contains(bn.IP) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			return false
+		}
+	}
+	return true
+}
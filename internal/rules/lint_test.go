@@ -0,0 +1,160 @@
+package rules
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/orgoj/weblogproxy/internal/config"
+)
+
+func TestLint(t *testing.T) {
+	tests := []struct {
+		name         string
+		rules        []config.LogRule
+		destinations []config.LogDestination
+		expected     []string
+	}{
+		{
+			name: "clean configuration",
+			rules: []config.LogRule{
+				{Condition: config.LogRuleCondition{}, Enabled: true, Continue: true,
+					AddLogData: []config.AddLogDataSpec{{Name: "env", Source: "static", Value: "prod"}}},
+				{Condition: config.LogRuleCondition{SiteID: "a"}, Enabled: true},
+				{Condition: config.LogRuleCondition{SiteID: "b"}, Enabled: true},
+			},
+		},
+		{
+			name: "empty final rule shadows later rules",
+			rules: []config.LogRule{
+				{Condition: config.LogRuleCondition{}, Enabled: true},
+				{Condition: config.LogRuleCondition{SiteID: "a"}, Enabled: true},
+				{Condition: config.LogRuleCondition{SiteID: "b"}, Enabled: false},
+			},
+			expected: []string{"log_config[1]: rule can never match, earlier final rule log_config[0] matches every request this rule matches"},
+		},
+		{
+			name: "continue and disabled rules do not shadow",
+			rules: []config.LogRule{
+				{Condition: config.LogRuleCondition{}, Enabled: true, Continue: true},
+				{Condition: config.LogRuleCondition{}, Enabled: false},
+				{Condition: config.LogRuleCondition{SiteID: "a"}, Enabled: true},
+			},
+		},
+		{
+			name: "broader site, gtm, ip, user agent and header conditions shadow",
+			rules: []config.LogRule{
+				{Condition: config.LogRuleCondition{
+					SiteID:     "a",
+					GTMIDs:     []string{"GTM-1", "GTM-2"},
+					IPs:        []string{"10.0.0.0/8"},
+					UserAgents: []string{"Mozilla/*"},
+					Headers:    map[string]interface{}{"X-Debug": true},
+				}, Enabled: true},
+				{Condition: config.LogRuleCondition{
+					SiteID:     "a",
+					GTMIDs:     []string{"GTM-2"},
+					IPs:        []string{"10.1.0.0/16", "10.2.3.4"},
+					UserAgents: []string{"Mozilla/5.0"},
+					Headers:    map[string]interface{}{"x-debug": "1", "X-Other": false},
+				}, Enabled: true},
+			},
+			expected: []string{"log_config[1]: rule can never match, earlier final rule log_config[0] matches every request this rule matches"},
+		},
+		{
+			name: "narrower earlier rule does not shadow",
+			rules: []config.LogRule{
+				{Condition: config.LogRuleCondition{SiteID: "a", IPs: []string{"10.1.0.0/16"}}, Enabled: true},
+				{Condition: config.LogRuleCondition{SiteID: "a", IPs: []string{"10.0.0.0/8"}}, Enabled: true},
+				{Condition: config.LogRuleCondition{SiteID: "a", UserAgents: []string{"Mozilla/*"}}, Enabled: true},
+				{Condition: config.LogRuleCondition{SiteID: "a", UserAgents: []string{"Chrome*"}}, Enabled: true},
+				{Condition: config.LogRuleCondition{SiteID: "b", Headers: map[string]interface{}{"X-Debug": false}}, Enabled: true},
+				{Condition: config.LogRuleCondition{SiteID: "b", Headers: map[string]interface{}{"X-Debug": "1"}}, Enabled: true},
+			},
+		},
+		{
+			name: "time window shadows only a narrower window",
+			rules: []config.LogRule{
+				{Condition: config.LogRuleCondition{SiteID: "a", ActiveFrom: "2030-01-01T00:00:00Z", ActiveUntil: "2030-02-01T00:00:00Z"}, Enabled: true},
+				{Condition: config.LogRuleCondition{SiteID: "a", ActiveFrom: "2030-01-10T00:00:00Z", ActiveUntil: "2030-01-20T00:00:00Z"}, Enabled: true},
+				{Condition: config.LogRuleCondition{SiteID: "a"}, Enabled: true},
+			},
+			expected: []string{"log_config[1]: rule can never match, earlier final rule log_config[0] matches every request this rule matches"},
+		},
+		{
+			name: "schedules shadow only identical schedules",
+			rules: []config.LogRule{
+				{Condition: config.LogRuleCondition{SiteID: "a", Schedules: []string{"* 9-17 * * *"}}, Enabled: true},
+				{Condition: config.LogRuleCondition{SiteID: "a", Schedules: []string{"* 10 * * *"}}, Enabled: true},
+				{Condition: config.LogRuleCondition{SiteID: "a", Schedules: []string{"* 9-17 * * *"}, GTMIDs: []string{"GTM-1"}}, Enabled: true},
+			},
+			expected: []string{"log_config[2]: rule can never match, earlier final rule log_config[0] matches every request this rule matches"},
+		},
+		{
+			name: "disabled destination",
+			rules: []config.LogRule{
+				{Condition: config.LogRuleCondition{SiteID: "a"}, Enabled: true, LogDestinations: []string{"on", "off"}},
+			},
+			destinations: []config.LogDestination{{Name: "on", Enabled: true}, {Name: "off", Enabled: false}},
+			expected:     []string{"log_config[0]: log_destination 'off' is disabled, nothing will be logged to it"},
+		},
+		{
+			name: "duplicate script URLs",
+			rules: []config.LogRule{
+				{Condition: config.LogRuleCondition{}, Enabled: true, Continue: true,
+					ScriptInjection: []config.ScriptInjectionSpec{{URL: "/a.js"}, {URL: "/a.js"}}},
+				{Condition: config.LogRuleCondition{SiteID: "a"}, Enabled: true,
+					ScriptInjection: []config.ScriptInjectionSpec{{URL: "/a.js", Async: true}}},
+				{Condition: config.LogRuleCondition{SiteID: "b"}, Enabled: true,
+					ScriptInjection: []config.ScriptInjectionSpec{{URL: "/b.js"}}},
+				{Condition: config.LogRuleCondition{SiteID: "c"}, Enabled: true,
+					ScriptInjection: []config.ScriptInjectionSpec{{URL: "/b.js"}}},
+			},
+			expected: []string{
+				"log_config[0]: script_injection url '/a.js' is listed more than once",
+				"log_config[1]: script_injection url '/a.js' is already injected by continue rule log_config[0], this entry is ignored when both match",
+			},
+		},
+		{
+			name: "overwritten add_log_data names",
+			rules: []config.LogRule{
+				{Condition: config.LogRuleCondition{}, Enabled: true, Continue: true,
+					AddLogData: []config.AddLogDataSpec{
+						{Name: "env", Source: "static", Value: "prod"},
+						{Name: "host", Source: "static", Value: "h1"},
+						{Name: "host", Source: "static", Value: "h2"},
+					}},
+				{Condition: config.LogRuleCondition{SiteID: "a"}, Enabled: true,
+					AddLogData: []config.AddLogDataSpec{
+						{Name: "env", Source: "static", Value: "dev"},
+						{Name: "host", Source: "static", Value: "false"}, // Intentional removal
+					}},
+			},
+			expected: []string{
+				"log_config[0]: add_log_data name 'host' is set more than once, the last entry wins",
+				"log_config[1]: add_log_data name 'env' overwrites the value set by continue rule log_config[0] when both match",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			warnings, err := Lint(&config.Config{LogConfig: tt.rules, LogDestinations: tt.destinations})
+			require.NoError(t, err)
+
+			var got []string
+			for _, w := range warnings {
+				got = append(got, w.String())
+			}
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
+
+func TestLint_InvalidRules(t *testing.T) {
+	_, err := Lint(&config.Config{LogConfig: []config.LogRule{
+		{Condition: config.LogRuleCondition{IPs: []string{"not-an-ip"}}, Enabled: true},
+	}})
+	assert.Error(t, err)
+}
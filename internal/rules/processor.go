@@ -6,10 +6,18 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/gobwas/glob"
 	"github.com/orgoj/weblogproxy/internal/config"
+	"github.com/orgoj/weblogproxy/internal/consent"
+	"github.com/orgoj/weblogproxy/internal/geoip"
 	"github.com/orgoj/weblogproxy/internal/iputil" // Helper for IP/CIDR matching
+	"github.com/orgoj/weblogproxy/internal/schedule"
+	"github.com/orgoj/weblogproxy/internal/useragent"
 )
 
 // ProcessingResult holds the outcome of processing rules for a request.
@@ -28,19 +36,44 @@ type compiledCondition struct {
 	userAgentGlobs []glob.Glob  // Pre-compiled glob patterns
 	ipCIDRs        []*net.IPNet // Pre-parsed IP/CIDR ranges
 	headers        map[string]interface{}
+	headerNames    []string             // Sorted names of headers, checked in this order
+	activeFrom     time.Time            // Zero means no lower bound
+	activeUntil    time.Time            // Zero means no upper bound
+	schedules      []*schedule.Schedule // Pre-parsed schedules, any must match
+	location       *time.Location       // Time zone for schedules
+	countries      []string             // Upper-case country codes of the client IP
+	asns           []uint               // Autonomous system numbers of the client IP
+	deviceTypes    []string             // Device types parsed from the User-Agent
+	isBot          *bool                // Required bot classification of the User-Agent
+	gpc            *bool                // Required presence of Sec-GPC: 1
+	dnt            *bool                // Required presence of DNT: 1
+	consent        map[string]bool      // Lower-case consent categories and their required state
+	consentNames   []string             // Sorted consent categories, checked in this order
 }
 
 // compiledRule holds a rule with its pre-compiled condition
 type compiledRule struct {
 	rule      config.LogRule
 	condition compiledCondition
+	key       string     // Identity of the rule across reloads (id or position)
+	hash      string     // Fingerprint of the rule definition, detects changed rules on reload
+	stats     *ruleStats // Hit counters, shared with the next rule set if the rule is unchanged
 }
 
-// RuleProcessor processes log rules against request parameters.
-type RuleProcessor struct {
+// ruleSet is an immutable set of compiled rules, swapped atomically on reload.
+type ruleSet struct {
 	cfg            *config.Config
 	trustedProxies []*net.IPNet   // Store parsed trusted proxies for reuse
 	compiledRules  []compiledRule // Pre-compiled rules for performance
+	needsGeoIP     bool           // Any rule has a countries or asns condition
+	usesConsent    bool           // A consent policy is set or any rule has gpc, dnt or consent conditions or a consent_action
+}
+
+// RuleProcessor processes log rules against request parameters.
+// It is safe for concurrent use, Reload replaces the rules without blocking Process.
+type RuleProcessor struct {
+	rules atomic.Pointer[ruleSet]
+	now   func() time.Time // Clock used for time window and schedule conditions
 }
 
 // LogProcessingResult holds the outcome of rule processing for a request.
@@ -51,6 +84,12 @@ type LogProcessingResult struct {
 	AccumulatedScripts           []config.ScriptInjectionSpec // List of unique scripts to inject from ALL matched rules
 	AccumulatedAddLogData        []config.AddLogDataSpec      // Combined specs from matched rules (last write wins for a name)
 	TargetDestinations           []string                     // Destinations from the *first* final rule (nil means all enabled)
+	AccumulatedRedactions        []*config.Redaction          // Redactions of all matched rules, in rule order
+	AccumulatedIPAnonymizations  []*config.IPAnonymization    // IP anonymizations of all matched rules, in rule order
+	AccumulatedTransforms        []config.TransformOp         // Transformations of all matched rules, in rule order
+	AccumulatedPayloadSchemas    []*config.PayloadSchema      // Payload schemas of all matched rules, in rule order
+	ConsentAction                string                       // Strongest consent action of the global policy and matched rules, empty if none applies
+	ConsentDependent             bool                         // The result may depend on consent signals of the request (Sec-GPC, DNT, consent cookie/header)
 	AccumulatedJavaScriptOptions struct {                     // JavaScript options from matched rules (last write wins)
 		TrackURL       bool
 		TrackTraceback bool
@@ -59,12 +98,59 @@ type LogProcessingResult struct {
 
 // NewRuleProcessor creates a new RuleProcessor with pre-compiled patterns.
 func NewRuleProcessor(cfg *config.Config) (*RuleProcessor, error) {
+	set, err := compileRules(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	rp := &RuleProcessor{now: time.Now}
+	rp.attachStats(set, nil)
+	rp.rules.Store(set)
+	return rp, nil
+}
+
+// Reload compiles the rules of the new configuration and atomically replaces the current rules.
+// Hit counters are preserved for rules that keep their id (or position when no id is set) and
+// whose definition did not change. On error the current rules stay in place.
+func (rp *RuleProcessor) Reload(cfg *config.Config) error {
+	set, err := compileRules(cfg)
+	if err != nil {
+		return err
+	}
+
+	rp.attachStats(set, rp.rules.Load())
+	rp.rules.Store(set)
+	return nil
+}
+
+// attachStats gives every rule of the set either the counters of the unchanged rule from the
+// previous set or fresh counters.
+func (rp *RuleProcessor) attachStats(set, previous *ruleSet) {
+	old := make(map[string]compiledRule)
+	if previous != nil {
+		for _, compiled := range previous.compiledRules {
+			old[compiled.key] = compiled
+		}
+	}
+
+	now := rp.now()
+	for i := range set.compiledRules {
+		compiled := &set.compiledRules[i]
+		if prev, ok := old[compiled.key]; ok && prev.hash != "" && prev.hash == compiled.hash {
+			compiled.stats = prev.stats
+		} else {
+			compiled.stats = &ruleStats{since: now}
+		}
+	}
+}
+
+// compileRules pre-compiles all rules and their patterns.
+func compileRules(cfg *config.Config) (*ruleSet, error) {
 	trustedProxies, err := iputil.ParseCIDRs(cfg.Server.TrustedProxies)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse trusted proxies: %w", err)
 	}
 
-	// Pre-compile all rules and their patterns
 	compiledRules := make([]compiledRule, 0, len(cfg.LogConfig))
 	for i, rule := range cfg.LogConfig {
 		compiled := compiledRule{
@@ -74,7 +160,32 @@ func NewRuleProcessor(cfg *config.Config) (*RuleProcessor, error) {
 				gtmIDs:  rule.Condition.GTMIDs,
 				headers: rule.Condition.Headers,
 			},
+			key:  ruleKey(i, rule),
+			hash: ruleHash(rule),
+		}
+
+		for _, country := range rule.Condition.Countries {
+			compiled.condition.countries = append(compiled.condition.countries, strings.ToUpper(country))
+		}
+		compiled.condition.asns = rule.Condition.ASNs
+		compiled.condition.deviceTypes = rule.Condition.DeviceTypes
+		compiled.condition.isBot = rule.Condition.IsBot
+		compiled.condition.gpc = rule.Condition.GPC
+		compiled.condition.dnt = rule.Condition.DNT
+		for category, granted := range rule.Condition.Consent {
+			if compiled.condition.consent == nil {
+				compiled.condition.consent = make(map[string]bool, len(rule.Condition.Consent))
+			}
+			compiled.condition.consent[strings.ToLower(category)] = granted
+		}
+		for category := range compiled.condition.consent {
+			compiled.condition.consentNames = append(compiled.condition.consentNames, category)
 		}
+		sort.Strings(compiled.condition.consentNames)
+		for name := range rule.Condition.Headers {
+			compiled.condition.headerNames = append(compiled.condition.headerNames, name)
+		}
+		sort.Strings(compiled.condition.headerNames)
 
 		// Pre-compile user agent glob patterns
 		if len(rule.Condition.UserAgents) > 0 {
@@ -82,7 +193,7 @@ func NewRuleProcessor(cfg *config.Config) (*RuleProcessor, error) {
 			for _, pattern := range rule.Condition.UserAgents {
 				g, err := glob.Compile(pattern)
 				if err != nil {
-					return nil, fmt.Errorf("rule %d: invalid user agent glob pattern '%s': %w", i, pattern, err)
+					return nil, fmt.Errorf("%s: invalid user agent glob pattern '%s': %w", rule.Path(i), pattern, err)
 				}
 				compiled.condition.userAgentGlobs = append(compiled.condition.userAgentGlobs, g)
 			}
@@ -92,23 +203,86 @@ func NewRuleProcessor(cfg *config.Config) (*RuleProcessor, error) {
 		if len(rule.Condition.IPs) > 0 {
 			cidrs, err := iputil.ParseCIDRs(rule.Condition.IPs)
 			if err != nil {
-				return nil, fmt.Errorf("rule %d: invalid IP/CIDR patterns: %w", i, err)
+				return nil, fmt.Errorf("%s: invalid IP/CIDR patterns: %w", rule.Path(i), err)
 			}
 			compiled.condition.ipCIDRs = cidrs
 		}
 
+		if err := compileTimeConditions(&compiled.condition, rule.Condition); err != nil {
+			return nil, fmt.Errorf("%s: %w", rule.Path(i), err)
+		}
+
 		compiledRules = append(compiledRules, compiled)
 	}
 
-	return &RuleProcessor{
+	set := &ruleSet{
 		cfg:            cfg,
 		trustedProxies: trustedProxies,
 		compiledRules:  compiledRules,
-	}, nil
+	}
+	set.usesConsent = cfg.Consent != nil
+	for _, compiled := range compiledRules {
+		if compiled.condition.needsGeoIP() {
+			set.needsGeoIP = true
+		}
+		cond := compiled.condition
+		if cond.gpc != nil || cond.dnt != nil || len(cond.consent) > 0 || compiled.rule.ConsentAction != "" {
+			set.usesConsent = true
+		}
+	}
+	return set, nil
+}
+
+// compileTimeConditions parses the time window, schedules and time zone of a condition.
+func compileTimeConditions(compiled *compiledCondition, cond config.LogRuleCondition) error {
+	var err error
+	if cond.ActiveFrom != "" {
+		if compiled.activeFrom, err = time.Parse(time.RFC3339, cond.ActiveFrom); err != nil {
+			return fmt.Errorf("invalid active_from '%s': %w", cond.ActiveFrom, err)
+		}
+	}
+	if cond.ActiveUntil != "" {
+		if compiled.activeUntil, err = time.Parse(time.RFC3339, cond.ActiveUntil); err != nil {
+			return fmt.Errorf("invalid active_until '%s': %w", cond.ActiveUntil, err)
+		}
+	}
+
+	compiled.location = time.UTC
+	if cond.Timezone != "" {
+		if compiled.location, err = time.LoadLocation(cond.Timezone); err != nil {
+			return fmt.Errorf("invalid timezone '%s': %w", cond.Timezone, err)
+		}
+	}
+
+	for _, expr := range cond.Schedules {
+		s, err := schedule.Parse(expr)
+		if err != nil {
+			return err
+		}
+		compiled.schedules = append(compiled.schedules, s)
+	}
+	return nil
+}
+
+// matchInput holds the request attributes rules are evaluated against.
+type matchInput struct {
+	siteID    string
+	gtmID     string
+	clientIP  net.IP
+	userAgent string
+	r         *http.Request
+	now       time.Time
+	geo       geoip.Record    // GeoIP data of the client IP, only looked up when a rule needs it
+	consent   consent.Signals // Privacy signals of the request
 }
 
 // Process evaluates the configured rules against the request parameters according to the defined logic.
 func (rp *RuleProcessor) Process(siteID, gtmID string, r *http.Request) LogProcessingResult {
+	return rp.process(siteID, gtmID, r, nil)
+}
+
+// process evaluates the rules and, when trace is non-nil, records how each rule was evaluated.
+func (rp *RuleProcessor) process(siteID, gtmID string, r *http.Request, trace *Trace) LogProcessingResult {
 	result := LogProcessingResult{
 		ShouldInjectScripts:      false,
 		ShouldLogToServer:        false, // Determined by the first final rule found, defaults to false
@@ -124,45 +298,110 @@ func (rp *RuleProcessor) Process(siteID, gtmID string, r *http.Request) LogProce
 	accumulatedScriptsMap := make(map[string]config.ScriptInjectionSpec)
 	accumulatedDataMap := make(map[string]config.AddLogDataSpec)
 
-	clientIPString := iputil.GetClientIP(r, rp.trustedProxies, "")
+	set := rp.rules.Load()
+	result.ConsentDependent = set.usesConsent
+	clientIPString := iputil.GetClientIP(r, set.trustedProxies, "")
 	var clientIP net.IP
 	if clientIPString != "" {
 		clientIP = net.ParseIP(clientIPString)
 	}
-	userAgent := r.UserAgent()
+	in := matchInput{
+		siteID:    siteID,
+		gtmID:     gtmID,
+		clientIP:  clientIP,
+		userAgent: r.UserAgent(),
+		r:         r,
+		now:       rp.now(),
+		consent:   set.cfg.Consent.Signals(r),
+	}
+	if set.needsGeoIP && clientIP != nil {
+		in.geo = geoip.Default().Lookup(clientIP)
+	}
+	if trace != nil {
+		trace.SiteID = siteID
+		trace.GtmID = gtmID
+		trace.ClientIP = clientIPString
+		trace.UserAgent = in.userAgent
+		trace.Time = in.now
+		trace.Rules = make([]RuleTrace, 0, len(set.compiledRules))
+	}
 
 	// Iterate through pre-compiled rules
-	for i, compiled := range rp.compiledRules {
+	for i, compiled := range set.compiledRules {
 		currentRule := compiled.rule
 		ruleID := i
 
+		var ruleTrace *RuleTrace
+		if trace != nil {
+			trace.Rules = append(trace.Rules, newRuleTrace(i, currentRule))
+			ruleTrace = &trace.Rules[len(trace.Rules)-1]
+		}
+
 		// Skip disabled rules entirely
 		if !currentRule.Enabled {
+			if ruleTrace != nil {
+				ruleTrace.Note = "rule is disabled"
+			}
 			continue
 		}
 
-		if rp.matchCompiledCondition(ruleID, compiled.condition, siteID, gtmID, clientIP, userAgent, r) {
+		var matched bool
+		if ruleTrace != nil {
+			ruleTrace.Evaluated = true
+			matched = rp.matchCompiledCondition(ruleID, compiled.condition, in, &ruleTrace.Checks)
+			ruleTrace.Matched = matched
+		} else {
+			matched = rp.matchCompiledCondition(ruleID, compiled.condition, in, nil)
+			compiled.stats.recordEvaluation(matched, matched && !currentRule.Continue, in.now)
+		}
+
+		if matched {
 			// Rule condition matched
 			result.ShouldInjectScripts = true // Mark that scripts might need injection
 
 			// Accumulate AddLogData (last write wins)
 			for _, spec := range currentRule.AddLogData {
 				accumulatedDataMap[spec.Name] = spec
+				if ruleTrace != nil {
+					ruleTrace.AddLogData = append(ruleTrace.AddLogData, spec.Name)
+				}
+			}
+
+			// Accumulate redactions, all of them are applied
+			if currentRule.Redaction != nil {
+				result.AccumulatedRedactions = append(result.AccumulatedRedactions, currentRule.Redaction)
+			}
+			if currentRule.IPAnonymization != nil {
+				result.AccumulatedIPAnonymizations = append(result.AccumulatedIPAnonymizations, currentRule.IPAnonymization)
+			}
+			result.ConsentAction = consent.Stronger(result.ConsentAction, currentRule.ConsentAction)
+			result.AccumulatedTransforms = append(result.AccumulatedTransforms, currentRule.Transform...)
+			if currentRule.PayloadSchema != nil {
+				result.AccumulatedPayloadSchemas = append(result.AccumulatedPayloadSchemas, currentRule.PayloadSchema)
 			}
 
 			// Accumulate Scripts (deduplicate by URL)
 			for _, script := range currentRule.ScriptInjection {
 				if _, exists := accumulatedScriptsMap[script.URL]; !exists {
 					accumulatedScriptsMap[script.URL] = script
+					if ruleTrace != nil {
+						ruleTrace.Scripts = append(ruleTrace.Scripts, script.URL)
+					}
 				}
 			}
 
 			// Accumulate JavaScript options (only overwrite if explicitly set in rule)
 			if currentRule.JavaScriptOptions.TrackURL != (struct{ TrackURL bool }{TrackURL: false}).TrackURL {
 				result.AccumulatedJavaScriptOptions.TrackURL = currentRule.JavaScriptOptions.TrackURL
+				if ruleTrace != nil {
+					ruleTrace.JavaScriptOptions = append(ruleTrace.JavaScriptOptions, "track_url")
+				}
 			}
 			if currentRule.JavaScriptOptions.TrackTraceback != (struct{ TrackTraceback bool }{TrackTraceback: false}).TrackTraceback {
 				result.AccumulatedJavaScriptOptions.TrackTraceback = currentRule.JavaScriptOptions.TrackTraceback
+				if ruleTrace != nil {
+					ruleTrace.JavaScriptOptions = append(ruleTrace.JavaScriptOptions, "track_traceback")
+				}
 			}
 
 			// Check if this is a final rule (not continuing)
@@ -175,12 +414,22 @@ func (rp *RuleProcessor) Process(siteID, gtmID string, r *http.Request) LogProce
 				} else {
 					result.TargetDestinations = nil // Explicitly nil means all enabled
 				}
+				if ruleTrace != nil {
+					ruleTrace.Final = true
+					ruleTrace.Destinations = currentRule.LogDestinations
+					trace.skipRemaining(set.compiledRules[i+1:], i+1)
+				}
 				break // Stop processing further rules
 			}
 			// For continue rules, just keep accumulating values
 		}
 	}
 
+	// Apply the global consent policy
+	if set.cfg.Consent.Denied(in.consent) {
+		result.ConsentAction = consent.Stronger(result.ConsentAction, set.cfg.Consent.Action)
+	}
+
 	// Convert accumulated maps to slices (always do this, scripts might be injected even if logging is off)
 	if len(accumulatedScriptsMap) > 0 {
 		result.AccumulatedScripts = make([]config.ScriptInjectionSpec, 0, len(accumulatedScriptsMap))
@@ -198,219 +447,226 @@ func (rp *RuleProcessor) Process(siteID, gtmID string, r *http.Request) LogProce
 	return result
 }
 
+// isEmpty reports whether the condition has no criteria and therefore matches every request.
+func (cond compiledCondition) isEmpty() bool {
+	return cond.siteID == "" && len(cond.gtmIDs) == 0 && len(cond.userAgentGlobs) == 0 && len(cond.ipCIDRs) == 0 && len(cond.headers) == 0 &&
+		cond.activeFrom.IsZero() && cond.activeUntil.IsZero() && len(cond.schedules) == 0 && !cond.needsGeoIP() &&
+		len(cond.deviceTypes) == 0 && cond.isBot == nil && cond.gpc == nil && cond.dnt == nil && len(cond.consent) == 0
+}
+
+// needsGeoIP reports whether the condition depends on GeoIP data of the client IP.
+func (cond compiledCondition) needsGeoIP() bool {
+	return len(cond.countries) > 0 || len(cond.asns) > 0
+}
+
 // matchCompiledCondition checks if the request parameters match the pre-compiled condition.
-// Uses pre-compiled glob patterns and CIDR ranges for better performance.
-func (rp *RuleProcessor) matchCompiledCondition(ruleID int, cond compiledCondition, siteID, gtmID string, clientIP net.IP, userAgent string, r *http.Request) bool {
+// Uses pre-compiled glob patterns and CIDR ranges for better performance. Without checks it
+// stops at the first mismatch; with checks (Explain) every field is evaluated and its outcome
+// is appended, so the trace shows all mismatches.
+func (rp *RuleProcessor) matchCompiledCondition(ruleID int, cond compiledCondition, in matchInput, checks *[]ConditionCheck) bool {
 	// Check if condition is empty (matches everything)
-	emptyCondition := cond.siteID == "" && len(cond.gtmIDs) == 0 && len(cond.userAgentGlobs) == 0 && len(cond.ipCIDRs) == 0 && len(cond.headers) == 0
-	if emptyCondition {
+	if cond.isEmpty() {
+		if checks != nil {
+			*checks = append(*checks, ConditionCheck{Field: "condition", Matched: true, Detail: "empty condition matches every request"})
+		}
 		return true
 	}
 
-	// SiteID check
-	if cond.siteID != "" {
-		if cond.siteID != siteID {
-			return false
+	// check records the outcome of a field and reports whether evaluation continues,
+	// details are only formatted for traces
+	matched := true
+	check := func(field string, ok bool, detail func() string) bool {
+		matched = matched && ok
+		if checks == nil {
+			return ok
 		}
+		*checks = append(*checks, ConditionCheck{Field: field, Matched: ok, Detail: detail()})
+		return true
 	}
 
-	// GTMIDs check
-	if len(cond.gtmIDs) > 0 {
-		match := false
-		for _, ruleGtmID := range cond.gtmIDs {
-			if ruleGtmID == gtmID {
-				match = true
-				break
-			}
-		}
-		if !match {
-			return false
-		}
+	// Time window check
+	if !cond.activeFrom.IsZero() && !check("active_from", !in.now.Before(cond.activeFrom), func() string {
+		return fmt.Sprintf("now %s, active from %s", in.now.Format(time.RFC3339), cond.activeFrom.Format(time.RFC3339))
+	}) {
+		return false
+	}
+	if !cond.activeUntil.IsZero() && !check("active_until", in.now.Before(cond.activeUntil), func() string {
+		return fmt.Sprintf("now %s, active until %s", in.now.Format(time.RFC3339), cond.activeUntil.Format(time.RFC3339))
+	}) {
+		return false
 	}
 
-	// Headers check
-	if len(cond.headers) > 0 {
-		if r == nil {
-			return false
+	// Schedules check - any schedule must match the current minute in the rule's time zone
+	if len(cond.schedules) > 0 && !check("schedules", matchSchedules(cond.schedules, cond.location, in.now), func() string {
+		exprs := make([]string, len(cond.schedules))
+		for i, s := range cond.schedules {
+			exprs[i] = s.String()
 		}
+		return fmt.Sprintf("local time %s, schedules %v", in.now.In(cond.location).Format("Mon 15:04 MST"), exprs)
+	}) {
+		return false
+	}
 
-		for headerName, headerCondition := range cond.headers {
-			// Processing false value means the header must be absent
-			if headerCondition == false {
-				if r.Header.Get(headerName) != "" {
-					return false
-				}
-				continue
-			}
+	// SiteID check
+	if cond.siteID != "" && !check("site_id", cond.siteID == in.siteID, func() string {
+		return fmt.Sprintf("got '%s', want '%s'", in.siteID, cond.siteID)
+	}) {
+		return false
+	}
 
-			// Value true means the header must exist (regardless of its value)
-			if headerCondition == true {
-				if r.Header.Get(headerName) == "" {
-					return false
-				}
-				continue
-			}
+	// GTMIDs check
+	if len(cond.gtmIDs) > 0 && !check("gtm_ids", containsString(cond.gtmIDs, in.gtmID), func() string {
+		return fmt.Sprintf("got '%s', want one of %v", in.gtmID, cond.gtmIDs)
+	}) {
+		return false
+	}
 
-			// Check for specific header value
-			expectedValue, ok := headerCondition.(string)
-			if ok {
-				actualValue := r.Header.Get(headerName)
-				if actualValue != expectedValue {
-					return false
-				}
-			} else {
-				// Unsupported value type in condition
-				return false
+	// Headers check
+	for _, name := range cond.headerNames {
+		want := cond.headers[name]
+		if !check("headers."+name, matchHeader(name, want, in.r), func() string {
+			actual := ""
+			if in.r != nil {
+				actual = in.r.Header.Get(name)
 			}
+			return fmt.Sprintf("got '%s', want %v", actual, describeHeaderCondition(want))
+		}) {
+			return false
 		}
 	}
 
 	// UserAgents check - use pre-compiled glob patterns
-	if len(cond.userAgentGlobs) > 0 {
-		match := false
-		for _, g := range cond.userAgentGlobs {
-			if g.Match(userAgent) {
-				match = true
-				break
-			}
+	if len(cond.userAgentGlobs) > 0 && !check("user_agents", matchGlobs(cond.userAgentGlobs, in.userAgent), func() string {
+		return fmt.Sprintf("got '%s'", in.userAgent)
+	}) {
+		return false
+	}
+
+	// IPs check - use pre-parsed CIDRs, requests without client IP never match
+	if len(cond.ipCIDRs) > 0 && !check("ips", in.clientIP != nil && iputil.IsIPInAnyCIDR(in.clientIP, cond.ipCIDRs), func() string {
+		nets := make([]string, len(cond.ipCIDRs))
+		for i, n := range cond.ipCIDRs {
+			nets[i] = n.String()
 		}
-		if !match {
-			return false
+		actual := ""
+		if in.clientIP != nil {
+			actual = in.clientIP.String()
 		}
+		return fmt.Sprintf("got '%s', want one of %v", actual, nets)
+	}) {
+		return false
 	}
 
-	// IPs check - use pre-parsed CIDRs
-	if len(cond.ipCIDRs) > 0 {
-		if clientIP == nil {
+	// Device type and bot checks - the parsed User-Agent is cached
+	if len(cond.deviceTypes) > 0 || cond.isBot != nil {
+		ua := useragent.Parse(in.userAgent)
+		if len(cond.deviceTypes) > 0 && !check("device_types", containsString(cond.deviceTypes, ua.DeviceType), func() string {
+			return fmt.Sprintf("got '%s', want one of %v", ua.DeviceType, cond.deviceTypes)
+		}) {
 			return false
 		}
-		if !iputil.IsIPInAnyCIDR(clientIP, cond.ipCIDRs) {
+		if cond.isBot != nil && !check("is_bot", *cond.isBot == ua.IsBot(), func() string {
+			return fmt.Sprintf("got %t, want %t", ua.IsBot(), *cond.isBot)
+		}) {
 			return false
 		}
 	}
 
-	// All conditions matched
-	return true
-}
-
-// matchCondition checks if the request parameters match the rule's condition.
-// DEPRECATED: Use matchCompiledCondition instead for better performance.
-// Added ruleID for logging purposes.
-func (rp *RuleProcessor) matchCondition(ruleID int, cond config.LogRuleCondition, siteID, gtmID string, clientIP net.IP, userAgent string, r *http.Request) bool {
-	// fmt.Printf("[DEBUG] matchCondition: Evaluating Rule %d, Condition: %+v, Inputs: siteID='%s', gtmID='%s', clientIP='%v', userAgent='%s'\n", ruleID, cond, siteID, gtmID, clientIP, userAgent)
-	emptyCondition := cond.SiteID == "" && len(cond.GTMIDs) == 0 && len(cond.UserAgents) == 0 && len(cond.IPs) == 0 && len(cond.Headers) == 0
-	if emptyCondition {
-		// fmt.Printf("[DEBUG] matchCondition SUCCESS Rule %d: Empty condition\n", ruleID)
-		return true
+	// Countries and ASNs check - unknown locations never match
+	if len(cond.countries) > 0 && !check("countries", containsString(cond.countries, in.geo.Country), func() string {
+		return fmt.Sprintf("got '%s', want one of %v", in.geo.Country, cond.countries)
+	}) {
+		return false
 	}
-
-	// --- Perform checks ONLY if the corresponding condition field is defined ---
-
-	// SiteID check
-	if cond.SiteID != "" {
-		if cond.SiteID != siteID {
-			// fmt.Printf("[DEBUG] matchCondition FAIL Rule %d: Reason=SiteID mismatch, Input='%s', Condition='%s'\n", ruleID, siteID, cond.SiteID)
-			return false
-		}
+	if len(cond.asns) > 0 && !check("asns", containsUint(cond.asns, in.geo.ASN), func() string {
+		return fmt.Sprintf("got %d, want one of %v", in.geo.ASN, cond.asns)
+	}) {
+		return false
 	}
 
-	// GTMIDs check
-	if len(cond.GTMIDs) > 0 {
-		match := false
-		for _, ruleGtmID := range cond.GTMIDs {
-			if ruleGtmID == gtmID {
-				match = true
-				break
+	// Privacy signal checks
+	if cond.gpc != nil && !check("gpc", *cond.gpc == in.consent.GPC, func() string {
+		return fmt.Sprintf("got %t, want %t", in.consent.GPC, *cond.gpc)
+	}) {
+		return false
+	}
+	if cond.dnt != nil && !check("dnt", *cond.dnt == in.consent.DNT, func() string {
+		return fmt.Sprintf("got %t, want %t", in.consent.DNT, *cond.dnt)
+	}) {
+		return false
+	}
+	// Consent categories must be explicitly set to the required state, missing categories never match
+	for _, category := range cond.consentNames {
+		want := cond.consent[category]
+		granted, ok := in.consent.Granted(category)
+		if !check("consent."+category, ok && granted == want, func() string {
+			actual := "missing"
+			if ok {
+				actual = fmt.Sprintf("%t", granted)
 			}
-		}
-		if !match {
-			// fmt.Printf("[DEBUG] matchCondition FAIL Rule %d: Reason=GTMID mismatch, Input='%s', Condition=%v\n", ruleID, gtmID, cond.GTMIDs)
+			return fmt.Sprintf("got %s, want %t", actual, want)
+		}) {
 			return false
 		}
 	}
 
-	// --- Headers check ---
-	if len(cond.Headers) > 0 {
-		if r == nil {
-			// fmt.Printf("[DEBUG] matchCondition FAIL Rule %d: Reason=Headers condition present but no request\n", ruleID)
-			return false
-		}
-
-		for headerName, headerCondition := range cond.Headers {
-			// Processing false value means the header must be absent
-			if headerCondition == false {
-				if r.Header.Get(headerName) != "" {
-					// fmt.Printf("[DEBUG] matchCondition FAIL Rule %d: Reason=Header '%s' should be absent but is present\n", ruleID, headerName)
-					return false
-				}
-				continue
-			}
-
-			// Value true means the header must exist (regardless of its value)
-			if headerCondition == true {
-				if r.Header.Get(headerName) == "" {
-					// fmt.Printf("[DEBUG] matchCondition FAIL Rule %d: Reason=Header '%s' should be present but is absent\n", ruleID, headerName)
-					return false
-				}
-				continue
-			}
+	return matched
+}
 
-			// Check for specific header value
-			expectedValue, ok := headerCondition.(string)
-			if ok {
-				actualValue := r.Header.Get(headerName)
-				if actualValue != expectedValue {
-					// fmt.Printf("[DEBUG] matchCondition FAIL Rule %d: Reason=Header '%s' value mismatch, Expected='%s', Got='%s'\n", ruleID, headerName, expectedValue, actualValue)
-					return false
-				}
-			} else {
-				// Unsupported value type in condition
-				// fmt.Printf("[WARN] matchCondition Rule %d: Unsupported header condition value type for '%s': %T\n", ruleID, headerName, headerCondition)
-				return false
-			}
+// matchSchedules reports whether any schedule matches now in the given location.
+func matchSchedules(schedules []*schedule.Schedule, location *time.Location, now time.Time) bool {
+	localNow := now.In(location)
+	for _, s := range schedules {
+		if s.Matches(localNow) {
+			return true
 		}
 	}
+	return false
+}
 
-	// --- UserAgents and IPs checks moved to the end ---
-
-	// UserAgents check
-	if len(cond.UserAgents) > 0 {
-		match := false
-		for _, pattern := range cond.UserAgents {
-			g, err := glob.Compile(pattern)
-			if err != nil {
-				// fmt.Printf("[WARN] matchCondition Rule %d: Invalid UserAgent glob pattern '%s': %v\n", ruleID, pattern, err)
-				continue // Skip invalid patterns
-			}
-			if g.Match(userAgent) {
-				match = true
-				break
-			}
-		}
-		if !match {
-			// fmt.Printf("[DEBUG] matchCondition FAIL Rule %d: Reason=UserAgent mismatch, Input='%s', Condition=%v\n", ruleID, userAgent, cond.UserAgents)
-			return false
+// containsString reports whether values contains v.
+func containsString(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
 		}
 	}
+	return false
+}
 
-	// IPs check
-	if len(cond.IPs) > 0 {
-		if clientIP == nil {
-			// fmt.Printf("[DEBUG] matchCondition FAIL Rule %d: Reason=IP mismatch (client IP is nil), Condition=%v\n", ruleID, cond.IPs)
-			return false
+// containsUint reports whether the slice contains the value.
+func containsUint(values []uint, v uint) bool {
+	for _, value := range values {
+		if value == v {
+			return true
 		}
-		cidrs, err := iputil.ParseCIDRs(cond.IPs)
-		if err != nil {
-			// fmt.Printf("[WARN] matchCondition Rule %d: Invalid IP CIDR patterns %v: %v\n", ruleID, cond.IPs, err)
-			return false // Don't match if patterns are invalid
-		}
-		if !iputil.IsIPInAnyCIDR(clientIP, cidrs) {
-			// fmt.Printf("[DEBUG] matchCondition FAIL Rule %d: Reason=IP mismatch (IP %v not in CIDRs), Condition=%v\n", ruleID, clientIP, cond.IPs)
-			return false
+	}
+	return false
+}
+
+// matchGlobs reports whether any of the glob patterns matches s.
+func matchGlobs(globs []glob.Glob, s string) bool {
+	for _, g := range globs {
+		if g.Match(s) {
+			return true
 		}
 	}
+	return false
+}
 
-	// If we haven't returned false yet, all defined and checked conditions matched
-	// fmt.Printf("[DEBUG] matchCondition SUCCESS Rule %d: All conditions met\n", ruleID)
-	return true
+// matchHeader checks a header condition against the request: false requires the header to be
+// absent, true requires it to be present and a string requires that exact value.
+func matchHeader(name string, want interface{}, r *http.Request) bool {
+	if r == nil {
+		return false
+	}
+	switch want {
+	case false:
+		return r.Header.Get(name) == ""
+	case true:
+		return r.Header.Get(name) != ""
+	}
+	// Unsupported value types in the condition never match
+	expected, ok := want.(string)
+	return ok && r.Header.Get(name) == expected
 }
@@ -2,11 +2,15 @@ package rules
 
 import (
 	"net/http"
+	"path/filepath"
 	"reflect"
 	"sort"
 	"testing"
+	"time"
 
 	"github.com/orgoj/weblogproxy/internal/config"
+	"github.com/orgoj/weblogproxy/internal/geoip"
+	"github.com/orgoj/weblogproxy/internal/geoip/geoiptest"
 )
 
 type testCase struct {
@@ -370,46 +374,13 @@ func TestRuleProcessor_Process(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			p, err := NewRuleProcessor(&config.Config{
-				LogConfig: tt.logConfig,
-				Server: struct {
-					Host             string   `yaml:"host"`
-					Port             int      `yaml:"port"`
-					Mode             string   `yaml:"mode"`
-					Protocol         string   `yaml:"protocol"`
-					Domain           string   `yaml:"domain"`
-					PathPrefix       string   `yaml:"path_prefix"`
-					TrustedProxies   []string `yaml:"trusted_proxies"`
-					HealthAllowedIPs []string `yaml:"health_allowed_ips"`
-					CORS             struct {
-						Enabled        bool     `yaml:"enabled"`
-						AllowedOrigins []string `yaml:"allowed_origins"`
-						MaxAge         int      `yaml:"max_age"`
-					} `yaml:"cors"`
-					Headers       map[string]string `yaml:"headers"`
-					RequestLimits struct {
-						MaxBodySize int `yaml:"max_body_size"`
-						RateLimit   int `yaml:"rate_limit"`
-					} `yaml:"request_limits"`
-					JavaScript struct {
-						GlobalObjectName string `yaml:"global_object_name"`
-					} `yaml:"javascript"`
-					UnknownRoute struct {
-						Code         int    `yaml:"code"`
-						CacheControl string `yaml:"cache_control"`
-					} `yaml:"unknown_route"`
-					ClientIPHeader string `yaml:"client_ip_header"`
-				}{
-					TrustedProxies: tt.trustedProxies,
-					Mode:           "embedded",
-					Protocol:       "http",
-					UnknownRoute: struct {
-						Code         int    `yaml:"code"`
-						CacheControl string `yaml:"cache_control"`
-					}{Code: 200, CacheControl: "public, max-age=3600"},
-					ClientIPHeader: "",
-				},
-			})
+			cfg := &config.Config{LogConfig: tt.logConfig}
+			cfg.Server.TrustedProxies = tt.trustedProxies
+			cfg.Server.Mode = "embedded"
+			cfg.Server.Protocol = "http"
+			cfg.Server.UnknownRoute.Code = 200
+			cfg.Server.UnknownRoute.CacheControl = "public, max-age=3600"
+			p, err := NewRuleProcessor(cfg)
 			if tt.expectError {
 				if err == nil {
 					t.Errorf("Expected error but got none")
@@ -492,3 +463,281 @@ func sortScriptInjectionSpecs(specs []config.ScriptInjectionSpec) {
 		return specs[i].URL < specs[j].URL
 	})
 }
+
+func TestRuleProcessor_TimeConditions(t *testing.T) {
+	// 2025-06-02 is a Monday
+	mondayNoonUTC := time.Date(2025, time.June, 2, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		condition config.LogRuleCondition
+		now       time.Time
+		want      bool
+	}{
+		{
+			name:      "InsideWindow",
+			condition: config.LogRuleCondition{ActiveFrom: "2025-06-01T00:00:00Z", ActiveUntil: "2025-06-03T00:00:00Z"},
+			now:       mondayNoonUTC,
+			want:      true,
+		},
+		{
+			name:      "BeforeWindow",
+			condition: config.LogRuleCondition{ActiveFrom: "2025-06-02T12:00:01Z"},
+			now:       mondayNoonUTC,
+			want:      false,
+		},
+		{
+			name:      "WindowEndIsExclusive",
+			condition: config.LogRuleCondition{ActiveUntil: "2025-06-02T12:00:00Z"},
+			now:       mondayNoonUTC,
+			want:      false,
+		},
+		{
+			name:      "ScheduleMatchesBusinessHours",
+			condition: config.LogRuleCondition{Schedules: []string{"* 9-17 * * mon-fri"}},
+			now:       mondayNoonUTC,
+			want:      true,
+		},
+		{
+			name:      "ScheduleOutsideBusinessHours",
+			condition: config.LogRuleCondition{Schedules: []string{"* 9-17 * * mon-fri"}},
+			now:       mondayNoonUTC.Add(8 * time.Hour),
+			want:      false,
+		},
+		{
+			name:      "AnyScheduleMatches",
+			condition: config.LogRuleCondition{Schedules: []string{"* * * * sat,sun", "0-30 12 * * *"}},
+			now:       mondayNoonUTC,
+			want:      true,
+		},
+		{
+			name:      "ScheduleUsesTimezone",
+			condition: config.LogRuleCondition{Schedules: []string{"* 14 * * *"}, Timezone: "Europe/Prague"},
+			now:       mondayNoonUTC, // 14:00 in Prague (CEST)
+			want:      true,
+		},
+		{
+			name:      "TimeAndSiteCombined",
+			condition: config.LogRuleCondition{SiteID: "other", Schedules: []string{"* * * * *"}},
+			now:       mondayNoonUTC,
+			want:      false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{
+				LogConfig: []config.LogRule{{Condition: tt.condition, Enabled: true}},
+			}
+			p, err := NewRuleProcessor(cfg)
+			if err != nil {
+				t.Fatalf("NewRuleProcessor() error = %v", err)
+			}
+			p.now = func() time.Time { return tt.now }
+
+			req := &http.Request{RemoteAddr: "1.1.1.1:1234", Header: make(http.Header)}
+			result := p.Process("test", "", req)
+			if result.ShouldLogToServer != tt.want {
+				t.Errorf("ShouldLogToServer = %v, want %v", result.ShouldLogToServer, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewRuleProcessor_InvalidSchedule(t *testing.T) {
+	cfg := &config.Config{
+		LogConfig: []config.LogRule{{Condition: config.LogRuleCondition{Schedules: []string{"* * *"}}, Enabled: true}},
+	}
+	if _, err := NewRuleProcessor(cfg); err == nil {
+		t.Fatal("expected error for malformed schedule")
+	}
+}
+
+func TestRuleProcessor_GeoIPConditions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "geo.mmdb")
+	err := geoiptest.WriteFile(path, "GeoIP2-City", []geoiptest.Entry{
+		{Network: "81.2.69.0/24", Data: map[string]interface{}{
+			"country":                  map[string]interface{}{"iso_code": "GB"},
+			"autonomous_system_number": uint32(20712),
+		}},
+		{Network: "2001:db8::/32", Data: map[string]interface{}{
+			"country": map[string]interface{}{"iso_code": "CZ"},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	db, err := geoip.OpenDB([]string{path})
+	if err != nil {
+		t.Fatalf("OpenDB() error = %v", err)
+	}
+	geoip.SetDefault(db)
+	t.Cleanup(func() { geoip.SetDefault(nil) })
+
+	tests := []struct {
+		name       string
+		condition  config.LogRuleCondition
+		remoteAddr string
+		want       bool
+	}{
+		{name: "CountryMatches", condition: config.LogRuleCondition{Countries: []string{"cz", "GB"}}, remoteAddr: "81.2.69.142:1234", want: true},
+		{name: "CountryMatchesIPv6", condition: config.LogRuleCondition{Countries: []string{"CZ"}}, remoteAddr: "[2001:db8::1]:1234", want: true},
+		{name: "CountryDiffers", condition: config.LogRuleCondition{Countries: []string{"CZ"}}, remoteAddr: "81.2.69.142:1234", want: false},
+		{name: "UnknownLocationNeverMatches", condition: config.LogRuleCondition{Countries: []string{"CZ"}}, remoteAddr: "8.8.8.8:1234", want: false},
+		{name: "ASNMatches", condition: config.LogRuleCondition{ASNs: []uint{15169, 20712}}, remoteAddr: "81.2.69.142:1234", want: true},
+		{name: "ASNDiffers", condition: config.LogRuleCondition{ASNs: []uint{15169}}, remoteAddr: "81.2.69.142:1234", want: false},
+		{name: "CountryAndASNCombined", condition: config.LogRuleCondition{Countries: []string{"CZ"}, ASNs: []uint{20712}}, remoteAddr: "81.2.69.142:1234", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{
+				LogConfig: []config.LogRule{{Condition: tt.condition, Enabled: true}},
+			}
+			p, err := NewRuleProcessor(cfg)
+			if err != nil {
+				t.Fatalf("NewRuleProcessor() error = %v", err)
+			}
+
+			req := &http.Request{RemoteAddr: tt.remoteAddr, Header: make(http.Header)}
+			result := p.Process("test", "", req)
+			if result.ShouldLogToServer != tt.want {
+				t.Errorf("ShouldLogToServer = %v, want %v", result.ShouldLogToServer, tt.want)
+			}
+			if trace := p.Explain("test", "", req); trace.Outcome.LogEnabled != tt.want {
+				t.Errorf("Explain() LogEnabled = %v, want %v", trace.Outcome.LogEnabled, tt.want)
+			}
+		})
+	}
+}
+
+func TestRuleProcessor_ConsentConditions(t *testing.T) {
+	yes, no := true, false
+
+	tests := []struct {
+		name      string
+		condition config.LogRuleCondition
+		headers   map[string]string
+		want      bool
+	}{
+		{name: "GPCMatches", condition: config.LogRuleCondition{GPC: &yes}, headers: map[string]string{"Sec-GPC": "1"}, want: true},
+		{name: "GPCAbsent", condition: config.LogRuleCondition{GPC: &yes}, want: false},
+		{name: "NoGPCMatches", condition: config.LogRuleCondition{GPC: &no}, want: true},
+		{name: "DNTMatches", condition: config.LogRuleCondition{DNT: &yes}, headers: map[string]string{"DNT": "1"}, want: true},
+		{name: "CategoryDenied", condition: config.LogRuleCondition{Consent: map[string]bool{"Analytics": false}},
+			headers: map[string]string{"Cookie": "consent=analytics%3Dfalse"}, want: true},
+		{name: "CategoryGranted", condition: config.LogRuleCondition{Consent: map[string]bool{"analytics": false}},
+			headers: map[string]string{"X-Consent": "analytics=true"}, want: false},
+		{name: "CategoryMissing", condition: config.LogRuleCondition{Consent: map[string]bool{"analytics": false}},
+			headers: map[string]string{"X-Consent": "marketing=false"}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{
+				Consent:   &config.Consent{Cookie: "consent", Header: "X-Consent", Action: "drop"},
+				LogConfig: []config.LogRule{{Condition: tt.condition, Enabled: true}},
+			}
+			p, err := NewRuleProcessor(cfg)
+			if err != nil {
+				t.Fatalf("NewRuleProcessor() error = %v", err)
+			}
+
+			req := &http.Request{RemoteAddr: "1.1.1.1:1234", Header: make(http.Header)}
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			if result := p.Process("test", "", req); result.ShouldLogToServer != tt.want {
+				t.Errorf("ShouldLogToServer = %v, want %v", result.ShouldLogToServer, tt.want)
+			}
+			if trace := p.Explain("test", "", req); trace.Outcome.LogEnabled != tt.want {
+				t.Errorf("Explain() LogEnabled = %v, want %v", trace.Outcome.LogEnabled, tt.want)
+			}
+		})
+	}
+}
+
+func TestRuleProcessor_ConsentAction(t *testing.T) {
+	dnt := true
+	cfg := &config.Config{
+		Consent: &config.Consent{HonorGPC: true, Header: "X-Consent", Categories: []string{"analytics"}, RequireExplicit: true, Action: "anonymize"},
+		LogConfig: []config.LogRule{
+			{Condition: config.LogRuleCondition{DNT: &dnt}, Enabled: true, Continue: true, ConsentAction: "strip"},
+			{Condition: config.LogRuleCondition{SiteID: "test"}, Enabled: true},
+		},
+	}
+	p, err := NewRuleProcessor(cfg)
+	if err != nil {
+		t.Fatalf("NewRuleProcessor() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    string
+	}{
+		{name: "Granted", headers: map[string]string{"X-Consent": "analytics=1"}, want: ""},
+		{name: "MissingCategoryWithRequireExplicit", want: "anonymize"},
+		{name: "GPCOverridesGrant", headers: map[string]string{"X-Consent": "analytics=1", "Sec-GPC": "1"}, want: "anonymize"},
+		{name: "RuleActionWithoutPolicy", headers: map[string]string{"X-Consent": "analytics=1", "DNT": "1"}, want: "strip"},
+		{name: "StrongerActionWins", headers: map[string]string{"X-Consent": "analytics=0", "DNT": "1"}, want: "strip"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &http.Request{RemoteAddr: "1.1.1.1:1234", Header: make(http.Header)}
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			if got := p.Process("test", "", req).ConsentAction; got != tt.want {
+				t.Errorf("ConsentAction = %q, want %q", got, tt.want)
+			}
+			if got := p.Explain("test", "", req).Outcome.ConsentAction; got != tt.want {
+				t.Errorf("Explain() ConsentAction = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRuleProcessor_UserAgentConditions(t *testing.T) {
+	const (
+		iPhone    = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_2_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.2 Mobile/15E148 Safari/604.1"
+		desktop   = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+		googlebot = "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)"
+	)
+	isBot, notBot := true, false
+
+	tests := []struct {
+		name      string
+		condition config.LogRuleCondition
+		userAgent string
+		want      bool
+	}{
+		{name: "DeviceTypeMatches", condition: config.LogRuleCondition{DeviceTypes: []string{"mobile", "tablet"}}, userAgent: iPhone, want: true},
+		{name: "DeviceTypeDiffers", condition: config.LogRuleCondition{DeviceTypes: []string{"mobile"}}, userAgent: desktop, want: false},
+		{name: "IsBotMatches", condition: config.LogRuleCondition{IsBot: &isBot}, userAgent: googlebot, want: true},
+		{name: "IsBotDiffers", condition: config.LogRuleCondition{IsBot: &isBot}, userAgent: desktop, want: false},
+		{name: "NotBotMatches", condition: config.LogRuleCondition{IsBot: &notBot}, userAgent: desktop, want: true},
+		{name: "EmptyUserAgentIsBot", condition: config.LogRuleCondition{IsBot: &notBot}, userAgent: "", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{
+				LogConfig: []config.LogRule{{Condition: tt.condition, Enabled: true}},
+			}
+			p, err := NewRuleProcessor(cfg)
+			if err != nil {
+				t.Fatalf("NewRuleProcessor() error = %v", err)
+			}
+
+			req := &http.Request{RemoteAddr: "1.1.1.1:1234", Header: make(http.Header)}
+			req.Header.Set("User-Agent", tt.userAgent)
+			if result := p.Process("test", "", req); result.ShouldLogToServer != tt.want {
+				t.Errorf("ShouldLogToServer = %v, want %v", result.ShouldLogToServer, tt.want)
+			}
+			if trace := p.Explain("test", "", req); trace.Outcome.LogEnabled != tt.want {
+				t.Errorf("Explain() LogEnabled = %v, want %v", trace.Outcome.LogEnabled, tt.want)
+			}
+		})
+	}
+}
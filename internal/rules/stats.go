@@ -0,0 +1,95 @@
+// internal/rules/stats.go
+
+package rules
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/orgoj/weblogproxy/internal/config"
+	"gopkg.in/yaml.v3"
+)
+
+// ruleStats holds lock-free hit counters of a single rule.
+type ruleStats struct {
+	evaluations  atomic.Uint64
+	matches      atomic.Uint64
+	finalMatches atomic.Uint64
+	lastMatch    atomic.Int64 // Unix nanoseconds, zero means never matched
+	since        time.Time    // When the counters started
+}
+
+// recordEvaluation counts one evaluation of the rule and its outcome.
+func (s *ruleStats) recordEvaluation(matched, final bool, now time.Time) {
+	s.evaluations.Add(1)
+	if !matched {
+		return
+	}
+	s.matches.Add(1)
+	if final {
+		s.finalMatches.Add(1)
+	}
+	s.lastMatch.Store(now.UnixNano())
+}
+
+// RuleStats is a snapshot of the hit counters of a rule.
+type RuleStats struct {
+	Index        int        `json:"index"`
+	ID           string     `json:"id,omitempty"`
+	Description  string     `json:"description,omitempty"`
+	Enabled      bool       `json:"enabled"`
+	Continue     bool       `json:"continue"`
+	Evaluations  uint64     `json:"evaluations"`   // Requests that reached this (enabled) rule
+	Matches      uint64     `json:"matches"`       // Evaluations where the condition matched
+	FinalMatches uint64     `json:"final_matches"` // Matches that ended rule processing
+	LastMatch    *time.Time `json:"last_match,omitempty"`
+	Since        time.Time  `json:"since"` // Counters start, reset when the rule changes
+}
+
+// Stats returns a snapshot of the hit counters of all current rules in configuration order.
+// Rule evaluations done by Explain are not counted.
+func (rp *RuleProcessor) Stats() []RuleStats {
+	set := rp.rules.Load()
+	stats := make([]RuleStats, 0, len(set.compiledRules))
+	for i, compiled := range set.compiledRules {
+		s := RuleStats{
+			Index:        i,
+			ID:           compiled.rule.ID,
+			Description:  compiled.rule.Description,
+			Enabled:      compiled.rule.Enabled,
+			Continue:     compiled.rule.Continue,
+			Evaluations:  compiled.stats.evaluations.Load(),
+			Matches:      compiled.stats.matches.Load(),
+			FinalMatches: compiled.stats.finalMatches.Load(),
+			Since:        compiled.stats.since,
+		}
+		if ns := compiled.stats.lastMatch.Load(); ns != 0 {
+			t := time.Unix(0, ns).UTC()
+			s.LastMatch = &t
+		}
+		stats = append(stats, s)
+	}
+	return stats
+}
+
+// ruleKey identifies a rule across reloads by its id, or by its position when it has none.
+func ruleKey(index int, rule config.LogRule) string {
+	if rule.ID != "" {
+		return "id:" + rule.ID
+	}
+	return fmt.Sprintf("index:%d", index)
+}
+
+// ruleHash fingerprints the rule definition so changed rules get fresh counters on reload.
+func ruleHash(rule config.LogRule) string {
+	data, err := yaml.Marshal(rule)
+	if err != nil {
+		// Unreachable for plain config data, treat the rule as changed
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,95 @@
+package rules
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/orgoj/weblogproxy/internal/config"
+)
+
+func TestRuleProcessor_Stats(t *testing.T) {
+	cfg := &config.Config{
+		LogConfig: []config.LogRule{
+			{ID: "all", Condition: config.LogRuleCondition{}, Enabled: true, Continue: true},
+			{ID: "shop", Condition: config.LogRuleCondition{SiteID: "shop"}, Enabled: true},
+			{Condition: config.LogRuleCondition{}, Enabled: false},
+			{Condition: config.LogRuleCondition{}, Enabled: true},
+		},
+	}
+	p, err := NewRuleProcessor(cfg)
+	require.NoError(t, err)
+	now := time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)
+	p.now = func() time.Time { return now }
+
+	req := httptest.NewRequest("GET", "/logger.js", nil)
+	p.Process("shop", "", req)
+	p.Process("other", "", req)
+	p.Process("other", "", req)
+	p.Explain("shop", "", req) // Explain is not counted
+
+	stats := p.Stats()
+	require.Len(t, stats, 4)
+
+	assert.Equal(t, "all", stats[0].ID)
+	assert.Equal(t, uint64(3), stats[0].Evaluations)
+	assert.Equal(t, uint64(3), stats[0].Matches)
+	assert.Equal(t, uint64(0), stats[0].FinalMatches)
+	require.NotNil(t, stats[0].LastMatch)
+	assert.True(t, now.Equal(*stats[0].LastMatch))
+
+	assert.Equal(t, uint64(3), stats[1].Evaluations)
+	assert.Equal(t, uint64(1), stats[1].Matches)
+	assert.Equal(t, uint64(1), stats[1].FinalMatches)
+
+	assert.False(t, stats[2].Enabled)
+	assert.Equal(t, uint64(0), stats[2].Evaluations)
+	assert.Nil(t, stats[2].LastMatch)
+
+	assert.Equal(t, uint64(2), stats[3].Evaluations)
+	assert.Equal(t, uint64(2), stats[3].FinalMatches)
+}
+
+func TestRuleProcessor_ReloadPreservesStats(t *testing.T) {
+	rules := []config.LogRule{
+		{ID: "all", Condition: config.LogRuleCondition{}, Enabled: true, Continue: true},
+		{ID: "shop", Condition: config.LogRuleCondition{SiteID: "shop"}, Enabled: true},
+		{Condition: config.LogRuleCondition{}, Enabled: true},
+	}
+	p, err := NewRuleProcessor(&config.Config{LogConfig: rules})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest("GET", "/logger.js", nil)
+	p.Process("shop", "", req)
+	p.Process("other", "", req)
+
+	// Rule "shop" moves and changes, rule "all" moves unchanged, the rule without id keeps its position
+	reloaded := []config.LogRule{
+		{ID: "shop", Condition: config.LogRuleCondition{SiteID: "shop", GTMIDs: []string{"GTM-1"}}, Enabled: true},
+		{ID: "all", Condition: config.LogRuleCondition{}, Enabled: true, Continue: true},
+		{Condition: config.LogRuleCondition{}, Enabled: true},
+	}
+	require.NoError(t, p.Reload(&config.Config{LogConfig: reloaded}))
+
+	stats := p.Stats()
+	require.Len(t, stats, 3)
+	assert.Equal(t, "shop", stats[0].ID)
+	assert.Equal(t, uint64(0), stats[0].Evaluations, "changed rule must get fresh counters")
+	assert.Equal(t, "all", stats[1].ID)
+	assert.Equal(t, uint64(2), stats[1].Matches, "unchanged rule must keep its counters")
+	assert.Equal(t, uint64(1), stats[2].FinalMatches, "unchanged rule without id at the same position keeps its counters")
+
+	// New rules take effect immediately
+	assert.True(t, p.Process("shop", "", req).ShouldLogToServer)
+	assert.Equal(t, uint64(1), p.Stats()[0].Evaluations)
+
+	// Invalid rules are rejected and the current rules stay in place
+	err = p.Reload(&config.Config{LogConfig: []config.LogRule{
+		{Condition: config.LogRuleCondition{IPs: []string{"bad"}}, Enabled: true},
+	}})
+	assert.Error(t, err)
+	assert.Len(t, p.Stats(), 3)
+}
@@ -0,0 +1,135 @@
+// internal/rules/suite.go
+
+package rules
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// TestExpectation describes the expected outcome of a rule evaluation.
+// Only fields that are set are checked, lists are compared ignoring order.
+type TestExpectation struct {
+	LogEnabled         *bool     `yaml:"log_enabled,omitempty"`
+	LogScriptDownloads *bool     `yaml:"log_script_downloads,omitempty"`
+	Destinations       *[]string `yaml:"destinations,omitempty"` // Empty list means all enabled destinations
+	Scripts            *[]string `yaml:"scripts,omitempty"`
+	AddLogData         *[]string `yaml:"add_log_data,omitempty"` // Field names
+	TrackURL           *bool     `yaml:"track_url,omitempty"`
+	TrackTraceback     *bool     `yaml:"track_traceback,omitempty"`
+}
+
+// TestCase is a single rule test: a synthetic request and its expected outcome.
+type TestCase struct {
+	Name    string           `yaml:"name"`
+	Request SyntheticRequest `yaml:"request"`
+	Expect  TestExpectation  `yaml:"expect"`
+}
+
+// TestSuite is a list of rule test cases loaded from YAML.
+type TestSuite struct {
+	Cases []TestCase `yaml:"cases"`
+}
+
+// TestResult is the outcome of running a single test case.
+type TestResult struct {
+	Name     string
+	Failures []string // Empty when the case passed
+	Trace    *Trace   // Nil when the request could not be built
+}
+
+// Passed reports whether the test case met all expectations.
+func (r TestResult) Passed() bool {
+	return len(r.Failures) == 0
+}
+
+// LoadTestSuite reads and validates a rule test suite from a YAML file.
+func LoadTestSuite(path string) (*TestSuite, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read test suite file '%s': %w", path, err)
+	}
+
+	var suite TestSuite
+	if err := yaml.Unmarshal(data, &suite); err != nil {
+		return nil, fmt.Errorf("failed to parse test suite file '%s': %w", path, err)
+	}
+	if len(suite.Cases) == 0 {
+		return nil, fmt.Errorf("test suite file '%s' contains no cases", path)
+	}
+	for i := range suite.Cases {
+		if suite.Cases[i].Name == "" {
+			suite.Cases[i].Name = fmt.Sprintf("case %d", i)
+		}
+	}
+	return &suite, nil
+}
+
+// Run evaluates every case of the suite against the rule processor.
+func (s *TestSuite) Run(rp *RuleProcessor) []TestResult {
+	results := make([]TestResult, 0, len(s.Cases))
+	for _, tc := range s.Cases {
+		results = append(results, tc.Run(rp))
+	}
+	return results
+}
+
+// Run evaluates the test case against the rule processor.
+func (tc TestCase) Run(rp *RuleProcessor) TestResult {
+	result := TestResult{Name: tc.Name}
+
+	req, err := tc.Request.HTTPRequest()
+	if err != nil {
+		result.Failures = append(result.Failures, fmt.Sprintf("invalid request: %v", err))
+		return result
+	}
+
+	result.Trace = rp.Explain(tc.Request.SiteID, tc.Request.GtmID, req)
+	result.Failures = tc.Expect.check(result.Trace.Outcome)
+	return result
+}
+
+// check compares the outcome with the expectation and returns a description of every mismatch.
+func (e TestExpectation) check(out TraceOutcome) []string {
+	var failures []string
+	checkBool := func(field string, want *bool, got bool) {
+		if want != nil && *want != got {
+			failures = append(failures, fmt.Sprintf("%s: got %t, want %t", field, got, *want))
+		}
+	}
+	checkList := func(field string, want *[]string, got []string) {
+		if want != nil && !sameStrings(*want, got) {
+			failures = append(failures, fmt.Sprintf("%s: got [%s], want [%s]", field, strings.Join(got, ", "), strings.Join(*want, ", ")))
+		}
+	}
+
+	checkBool("log_enabled", e.LogEnabled, out.LogEnabled)
+	checkBool("log_script_downloads", e.LogScriptDownloads, out.LogScriptDownloads)
+	checkList("destinations", e.Destinations, out.Destinations)
+	checkList("scripts", e.Scripts, out.Scripts)
+	checkList("add_log_data", e.AddLogData, out.AddLogData)
+	checkBool("track_url", e.TrackURL, out.TrackURL)
+	checkBool("track_traceback", e.TrackTraceback, out.TrackTraceback)
+	return failures
+}
+
+// sameStrings reports whether both lists contain the same strings, ignoring order.
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	as := append([]string(nil), a...)
+	bs := append([]string(nil), b...)
+	sort.Strings(as)
+	sort.Strings(bs)
+	for i := range as {
+		if as[i] != bs[i] {
+			return false
+		}
+	}
+	return true
+}
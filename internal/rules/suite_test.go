@@ -0,0 +1,119 @@
+package rules
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/orgoj/weblogproxy/internal/config"
+)
+
+func writeSuite(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "cases.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func TestLoadTestSuite(t *testing.T) {
+	t.Run("valid suite", func(t *testing.T) {
+		suite, err := LoadTestSuite(writeSuite(t, `
+cases:
+  - name: "shop"
+    request:
+      site_id: "shop"
+      headers:
+        X-Debug: "1"
+    expect:
+      log_enabled: true
+      destinations: []
+  - request:
+      site_id: "other"
+`))
+		require.NoError(t, err)
+		require.Len(t, suite.Cases, 2)
+		assert.Equal(t, "shop", suite.Cases[0].Name)
+		assert.Equal(t, "1", suite.Cases[0].Request.Headers["X-Debug"])
+		require.NotNil(t, suite.Cases[0].Expect.Destinations)
+		assert.Empty(t, *suite.Cases[0].Expect.Destinations)
+		assert.Nil(t, suite.Cases[0].Expect.Scripts)
+		assert.Equal(t, "case 1", suite.Cases[1].Name)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := LoadTestSuite(filepath.Join(t.TempDir(), "missing.yaml"))
+		assert.Error(t, err)
+
+		_, err = LoadTestSuite(writeSuite(t, "cases: [\n"))
+		assert.Error(t, err)
+
+		_, err = LoadTestSuite(writeSuite(t, "cases: []\n"))
+		assert.Error(t, err)
+	})
+}
+
+func TestTestSuite_Run(t *testing.T) {
+	cfg := &config.Config{
+		LogConfig: []config.LogRule{
+			{
+				Condition:       config.LogRuleCondition{},
+				Enabled:         true,
+				Continue:        true,
+				AddLogData:      []config.AddLogDataSpec{{Name: "host", Source: "static", Value: "h1"}},
+				ScriptInjection: []config.ScriptInjectionSpec{{URL: "/a.js"}, {URL: "/b.js"}},
+			},
+			{
+				Condition:       config.LogRuleCondition{SiteID: "shop"},
+				Enabled:         true,
+				LogDestinations: []string{"file", "gelf"},
+			},
+		},
+	}
+	p, err := NewRuleProcessor(cfg)
+	require.NoError(t, err)
+
+	yes, no := true, false
+	suite := &TestSuite{Cases: []TestCase{
+		{
+			Name:    "matching expectations",
+			Request: SyntheticRequest{SiteID: "shop"},
+			Expect: TestExpectation{
+				LogEnabled:   &yes,
+				Destinations: &[]string{"gelf", "file"},
+				Scripts:      &[]string{"/b.js", "/a.js"},
+				AddLogData:   &[]string{"host"},
+				TrackURL:     &no,
+			},
+		},
+		{
+			Name:    "mismatched expectations",
+			Request: SyntheticRequest{SiteID: "other"},
+			Expect: TestExpectation{
+				LogEnabled: &yes,
+				Scripts:    &[]string{"/a.js"},
+			},
+		},
+		{
+			Name:    "invalid request",
+			Request: SyntheticRequest{},
+		},
+	}}
+
+	results := suite.Run(p)
+	require.Len(t, results, 3)
+
+	assert.True(t, results[0].Passed(), "failures: %v", results[0].Failures)
+	assert.NotNil(t, results[0].Trace)
+
+	assert.False(t, results[1].Passed())
+	assert.Equal(t, []string{
+		"log_enabled: got false, want true",
+		"scripts: got [/a.js, /b.js], want [/a.js]",
+	}, results[1].Failures)
+
+	assert.False(t, results[2].Passed())
+	assert.Nil(t, results[2].Trace)
+}
@@ -0,0 +1,176 @@
+// internal/schedule/schedule.go
+
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// field describes one position of a cron-like expression.
+type field struct {
+	name  string
+	min   int
+	max   int
+	names map[string]int // Optional symbolic names (jan, mon, ...)
+}
+
+var fields = []field{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day-of-month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}},
+	// 7 is accepted as an alias for Sunday and folded to 0 after parsing
+	{name: "day-of-week", min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}},
+}
+
+// Schedule is a parsed cron-like expression with five fields:
+// minute, hour, day-of-month, month and day-of-week.
+type Schedule struct {
+	expr       string
+	minutes    uint64
+	hours      uint64
+	daysOfMon  uint64
+	months     uint64
+	daysOfWeek uint64
+	domStar    bool // Day-of-month was '*' (affects day matching semantics)
+	dowStar    bool // Day-of-week was '*'
+}
+
+// Parse parses a cron-like expression such as "*/15 9-17 * * mon-fri".
+// Each field supports '*', single values, ranges (a-b), lists (a,b) and steps (*/n, a-b/n).
+// Months and days of week also accept three-letter English names.
+func Parse(expr string) (*Schedule, error) {
+	parts := strings.Fields(expr)
+	if len(parts) != len(fields) {
+		return nil, fmt.Errorf("schedule '%s' must have %d fields (minute hour day-of-month month day-of-week), got %d", expr, len(fields), len(parts))
+	}
+
+	masks := make([]uint64, len(fields))
+	for i, part := range parts {
+		mask, err := parseField(part, fields[i])
+		if err != nil {
+			return nil, fmt.Errorf("schedule '%s': %w", expr, err)
+		}
+		masks[i] = mask
+	}
+
+	// Fold Sunday=7 into Sunday=0
+	if masks[4]&(1<<7) != 0 {
+		masks[4] = (masks[4] &^ (1 << 7)) | 1
+	}
+
+	return &Schedule{
+		expr:       expr,
+		minutes:    masks[0],
+		hours:      masks[1],
+		daysOfMon:  masks[2],
+		months:     masks[3],
+		daysOfWeek: masks[4],
+		domStar:    parts[2] == "*",
+		dowStar:    parts[4] == "*",
+	}, nil
+}
+
+// String returns the original expression.
+func (s *Schedule) String() string {
+	return s.expr
+}
+
+// Matches reports whether t (in its own location) falls into the scheduled minute.
+// As in cron, when both day-of-month and day-of-week are restricted, a day matches if either does.
+func (s *Schedule) Matches(t time.Time) bool {
+	if s.minutes&(1<<uint(t.Minute())) == 0 {
+		return false
+	}
+	if s.hours&(1<<uint(t.Hour())) == 0 {
+		return false
+	}
+	if s.months&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+
+	domMatch := s.daysOfMon&(1<<uint(t.Day())) != 0
+	dowMatch := s.daysOfWeek&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// parseField parses a single comma-separated field into a bit mask.
+func parseField(spec string, f field) (uint64, error) {
+	var mask uint64
+	for _, item := range strings.Split(spec, ",") {
+		if item == "" {
+			return 0, fmt.Errorf("%s: empty list item in '%s'", f.name, spec)
+		}
+
+		rangePart, step := item, 1
+		if idx := strings.Index(item, "/"); idx >= 0 {
+			rangePart = item[:idx]
+			n, err := strconv.Atoi(item[idx+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("%s: invalid step in '%s'", f.name, item)
+			}
+			step = n
+		}
+
+		var lo, hi int
+		switch {
+		case rangePart == "*":
+			lo, hi = f.min, f.max
+			if f.name == "day-of-week" {
+				hi = 6 // '*' must not double-count Sunday
+			}
+		case strings.Contains(rangePart, "-"):
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err error
+			if lo, err = parseValue(bounds[0], f); err != nil {
+				return 0, err
+			}
+			if hi, err = parseValue(bounds[1], f); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("%s: range start %d is after end %d in '%s'", f.name, lo, hi, item)
+			}
+		default:
+			v, err := parseValue(rangePart, f)
+			if err != nil {
+				return 0, err
+			}
+			lo, hi = v, v
+			if step > 1 {
+				hi = f.max // "5/10" means every 10th starting at 5
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			mask |= 1 << uint(v)
+		}
+	}
+	return mask, nil
+}
+
+// parseValue parses a numeric or symbolic value and checks its bounds.
+func parseValue(s string, f field) (int, error) {
+	if v, ok := f.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("%s: invalid value '%s'", f.name, s)
+	}
+	if v < f.min || v > f.max {
+		return 0, fmt.Errorf("%s: value %d out of range %d-%d", f.name, v, f.min, f.max)
+	}
+	return v, nil
+}
@@ -0,0 +1,83 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+	}{
+		{"too few fields", "* * * *"},
+		{"too many fields", "* * * * * *"},
+		{"minute out of range", "60 * * * *"},
+		{"hour out of range", "* 24 * * *"},
+		{"day of month zero", "* * 0 * *"},
+		{"unknown month name", "* * * foo *"},
+		{"reversed range", "* 17-9 * * *"},
+		{"zero step", "*/0 * * * *"},
+		{"empty list item", "1,,2 * * * *"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.expr)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestSchedule_Matches(t *testing.T) {
+	// 2025-06-02 is a Monday
+	monday := func(hour, minute int) time.Time {
+		return time.Date(2025, time.June, 2, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name string
+		expr string
+		at   time.Time
+		want bool
+	}{
+		{"every minute", "* * * * *", monday(3, 7), true},
+		{"business hours inside", "* 9-17 * * mon-fri", monday(10, 30), true},
+		{"business hours before", "* 9-17 * * mon-fri", monday(8, 59), false},
+		{"business hours after", "* 9-17 * * mon-fri", monday(18, 0), false},
+		{"weekend only on monday", "* * * * sat,sun", monday(12, 0), false},
+		{"sunday as 7", "* * * * 7", time.Date(2025, time.June, 1, 12, 0, 0, 0, time.UTC), true},
+		{"step minutes match", "*/15 * * * *", monday(12, 45), true},
+		{"step minutes miss", "*/15 * * * *", monday(12, 44), false},
+		{"offset step", "5/20 * * * *", monday(12, 25), true},
+		{"month name", "* * * jun *", monday(12, 0), true},
+		{"other month", "* * * jul *", monday(12, 0), false},
+		{"dom or dow when both restricted", "* * 15 * mon", monday(12, 0), true},
+		{"dom only", "* * 2 * *", monday(12, 0), true},
+		{"dom mismatch", "* * 3 * *", monday(12, 0), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := Parse(tt.expr)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, s.Matches(tt.at))
+		})
+	}
+}
+
+func TestSchedule_MatchesInLocation(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Prague")
+	require.NoError(t, err)
+
+	s, err := Parse("* 9-17 * * *")
+	require.NoError(t, err)
+
+	// 07:30 UTC is 09:30 in Prague during summer time
+	at := time.Date(2025, time.June, 2, 7, 30, 0, 0, time.UTC)
+	assert.False(t, s.Matches(at))
+	assert.True(t, s.Matches(at.In(loc)))
+}
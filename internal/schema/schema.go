@@ -0,0 +1,178 @@
+// internal/schema/schema.go
+
+// Package schema maps Bunyan-style log records to Elastic Common Schema (ECS) and
+// OpenTelemetry log data model records.
+package schema
+
+import "strings"
+
+// Formats
+const (
+	FormatBunyan = "bunyan" // Record as produced by the enricher
+	FormatECS    = "ecs"    // Elastic Common Schema
+	FormatOTel   = "otel"   // OpenTelemetry log data model with semantic convention attribute names
+)
+
+// Formats lists the supported formats.
+var Formats = []string{FormatBunyan, FormatECS, FormatOTel}
+
+// DefaultNamespace is the key custom fields are nested under.
+const DefaultNamespace = "weblogproxy"
+
+// ECSVersion is the ECS version the mapping follows.
+const ECSVersion = "8.11.0"
+
+// ecsFields maps record fields to ECS field paths. The Bunyan version "v" is dropped.
+var ecsFields = map[string]string{
+	"time":       "@timestamp",
+	"msg":        "message",
+	"hostname":   "host.name",
+	"pid":        "process.pid",
+	"name":       "service.name",
+	"client_ip":  "client.ip",
+	"user_agent": "user_agent.original",
+	"__url":      "url.full",
+}
+
+// otelResource maps record fields to OTel resource attributes.
+var otelResource = map[string]string{
+	"hostname": "host.name",
+	"pid":      "process.pid",
+	"name":     "service.name",
+}
+
+// otelAttributes maps record fields to OTel log attributes.
+var otelAttributes = map[string]string{
+	"client_ip":  "client.address",
+	"user_agent": "user_agent.original",
+	"__url":      "url.full",
+}
+
+// levels maps Bunyan levels to level names and OTel severity numbers.
+var levels = map[int]struct {
+	name     string
+	severity int
+}{
+	10: {"trace", 1},
+	20: {"debug", 5},
+	30: {"info", 9},
+	40: {"warn", 13},
+	50: {"error", 17},
+	60: {"fatal", 21},
+}
+
+// Map returns the record in the given format. Fields without a standard mapping are nested
+// under namespace (ECS) or prefixed with "namespace." (OTel attributes). FormatBunyan and
+// unknown formats return the record unchanged.
+func Map(record map[string]interface{}, format, namespace string) map[string]interface{} {
+	if namespace == "" {
+		namespace = DefaultNamespace
+	}
+	switch format {
+	case FormatECS:
+		return mapECS(record, namespace)
+	case FormatOTel:
+		return mapOTel(record, namespace)
+	}
+	return record
+}
+
+func mapECS(record map[string]interface{}, namespace string) map[string]interface{} {
+	out := map[string]interface{}{
+		"ecs": map[string]interface{}{"version": ECSVersion},
+	}
+	custom := make(map[string]interface{})
+	for key, value := range record {
+		if key == "v" {
+			continue
+		}
+		if key == "level" {
+			if name, _, ok := level(value); ok {
+				setPath(out, "log.level", name)
+				continue
+			}
+		}
+		if path, ok := ecsFields[key]; ok {
+			setPath(out, path, value)
+			continue
+		}
+		custom[key] = value
+	}
+	if len(custom) > 0 {
+		out[namespace] = custom
+	}
+	return out
+}
+
+func mapOTel(record map[string]interface{}, namespace string) map[string]interface{} {
+	out := make(map[string]interface{})
+	resource := make(map[string]interface{})
+	attributes := make(map[string]interface{})
+	for key, value := range record {
+		switch key {
+		case "v":
+			continue
+		case "time":
+			out["timestamp"] = value
+			continue
+		case "msg":
+			out["body"] = value
+			continue
+		case "level":
+			if name, severity, ok := level(value); ok {
+				out["severity_text"] = strings.ToUpper(name)
+				out["severity_number"] = severity
+				continue
+			}
+		}
+		if name, ok := otelResource[key]; ok {
+			resource[name] = value
+			continue
+		}
+		if name, ok := otelAttributes[key]; ok {
+			attributes[name] = value
+			continue
+		}
+		attributes[namespace+"."+key] = value
+	}
+	if len(resource) > 0 {
+		out["resource"] = resource
+	}
+	if len(attributes) > 0 {
+		out["attributes"] = attributes
+	}
+	return out
+}
+
+// level returns the name and OTel severity of a Bunyan level. JSON numbers arrive as float64.
+func level(value interface{}) (string, int, bool) {
+	var n int
+	switch v := value.(type) {
+	case int:
+		n = v
+	case int64:
+		n = int(v)
+	case float64:
+		n = int(v)
+	default:
+		return "", 0, false
+	}
+	l, ok := levels[n]
+	return l.name, l.severity, ok
+}
+
+// setPath sets a dotted path in nested objects, creating them as needed. An existing
+// non-object value on the way is replaced.
+func setPath(record map[string]interface{}, path string, value interface{}) {
+	segments := strings.Split(path, ".")
+	current := record
+	for _, segment := range segments[:len(segments)-1] {
+		next, ok := current[segment].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			current[segment] = next
+		}
+		current = next
+	}
+	current[segments[len(segments)-1]] = value
+}
@@ -0,0 +1,79 @@
+package schema
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func bunyanRecord() map[string]interface{} {
+	return map[string]interface{}{
+		"v":          0,
+		"name":       "weblogproxy",
+		"hostname":   "web-1",
+		"pid":        42,
+		"level":      30,
+		"msg":        "checkout",
+		"time":       "2025-06-01T08:00:00Z",
+		"site_id":    "shop",
+		"client_ip":  "203.0.113.7",
+		"user_agent": "Mozilla/5.0",
+		"order":      map[string]interface{}{"id": "o-1"},
+	}
+}
+
+func TestMap_ECS(t *testing.T) {
+	got := Map(bunyanRecord(), FormatECS, "")
+	assert.Equal(t, map[string]interface{}{
+		"@timestamp": "2025-06-01T08:00:00Z",
+		"message":    "checkout",
+		"ecs":        map[string]interface{}{"version": ECSVersion},
+		"log":        map[string]interface{}{"level": "info"},
+		"host":       map[string]interface{}{"name": "web-1"},
+		"process":    map[string]interface{}{"pid": 42},
+		"service":    map[string]interface{}{"name": "weblogproxy"},
+		"client":     map[string]interface{}{"ip": "203.0.113.7"},
+		"user_agent": map[string]interface{}{"original": "Mozilla/5.0"},
+		"weblogproxy": map[string]interface{}{
+			"site_id": "shop",
+			"order":   map[string]interface{}{"id": "o-1"},
+		},
+	}, got)
+}
+
+func TestMap_OTel(t *testing.T) {
+	record := bunyanRecord()
+	record["level"] = 50.0 // JSON numbers decode as float64
+	got := Map(record, FormatOTel, "shop")
+	assert.Equal(t, map[string]interface{}{
+		"timestamp":       "2025-06-01T08:00:00Z",
+		"body":            "checkout",
+		"severity_text":   "ERROR",
+		"severity_number": 17,
+		"resource": map[string]interface{}{
+			"host.name":    "web-1",
+			"process.pid":  42,
+			"service.name": "weblogproxy",
+		},
+		"attributes": map[string]interface{}{
+			"client.address":      "203.0.113.7",
+			"user_agent.original": "Mozilla/5.0",
+			"shop.site_id":        "shop",
+			"shop.order":          map[string]interface{}{"id": "o-1"},
+		},
+	}, got)
+}
+
+func TestMap_UnknownLevelIsCustom(t *testing.T) {
+	record := map[string]interface{}{"level": "verbose", "msg": "x"}
+	assert.Equal(t, map[string]interface{}{
+		"message":     "x",
+		"ecs":         map[string]interface{}{"version": ECSVersion},
+		"weblogproxy": map[string]interface{}{"level": "verbose"},
+	}, Map(record, FormatECS, ""))
+}
+
+func TestMap_Bunyan(t *testing.T) {
+	record := bunyanRecord()
+	assert.Equal(t, bunyanRecord(), Map(record, FormatBunyan, ""))
+}
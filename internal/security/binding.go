@@ -0,0 +1,151 @@
+package security
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Binding claims
+const (
+	ClaimOrigin    = "origin"     // Host of the Origin (or Referer) header
+	ClaimIP        = "ip"         // Client IP network, /24 for IPv4 and /64 for IPv6
+	ClaimUserAgent = "user_agent" // User-Agent header
+)
+
+// claimCodes are the short names of the claims in tokens.
+var claimCodes = map[string]string{ClaimOrigin: "o", ClaimIP: "i", ClaimUserAgent: "u"}
+
+// Binding selects the claims a token is bound to.
+type Binding struct {
+	Origin    bool
+	IP        bool
+	UserAgent bool
+}
+
+// Claims are the values of the binding claims of a request.
+type Claims struct {
+	Origin    string
+	IPNetwork string
+	UserAgent string
+}
+
+// RequestClaims returns the claims of the request. The origin is the host of the Origin header,
+// or of the Referer header when there is no Origin (as for script downloads).
+func RequestClaims(r *http.Request, clientIP string) Claims {
+	claims := Claims{UserAgent: r.UserAgent(), IPNetwork: ipNetwork(clientIP)}
+	for _, header := range []string{"Origin", "Referer"} {
+		if u, err := url.Parse(r.Header.Get(header)); err == nil && u.Hostname() != "" {
+			claims.Origin = strings.ToLower(u.Hostname())
+			break
+		}
+	}
+	return claims
+}
+
+// ipNetwork returns the /24 (IPv4) or /64 (IPv6) network of the IP, or "" for invalid IPs.
+func ipNetwork(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ""
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String() + "/24"
+	}
+	return parsed.Mask(net.CIDRMask(64, 128)).String() + "/64"
+}
+
+// BindingError reports a binding claim that is missing in the token or does not match the request.
+type BindingError struct {
+	Claim string
+}
+
+func (e *BindingError) Error() string {
+	return "token binding failed: " + e.Claim
+}
+
+// Active reports whether any claim is bound.
+func (b *Binding) Active() bool {
+	return b != nil && (b.Origin || b.IP || b.UserAgent)
+}
+
+// enabled returns the enabled claims in a fixed order with their request values.
+func (b *Binding) enabled(claims Claims) [][2]string {
+	if b == nil {
+		return nil
+	}
+	var result [][2]string
+	if b.Origin {
+		result = append(result, [2]string{ClaimOrigin, claims.Origin})
+	}
+	if b.IP {
+		result = append(result, [2]string{ClaimIP, claims.IPNetwork})
+	}
+	if b.UserAgent {
+		result = append(result, [2]string{ClaimUserAgent, claims.UserAgent})
+	}
+	return result
+}
+
+// encode returns the token claims part, e.g. "o=1a2b...,i=3c4d...". Values are keyed digests,
+// so the token reveals neither the client network nor the user agent.
+func (b *Binding) encode(key Key, claims Claims) string {
+	var encoded []string
+	for _, claim := range b.enabled(claims) {
+		encoded = append(encoded, claimCodes[claim[0]]+"="+claimDigest(key, claim[0], claim[1]))
+	}
+	return strings.Join(encoded, ",")
+}
+
+// check verifies the enabled claims against the token claims part. Claims in the token that are
+// not enabled are ignored, so a binding can be switched off without invalidating tokens.
+func (b *Binding) check(key Key, encoded string, claims Claims) *BindingError {
+	digests := make(map[string]string)
+	for _, pair := range strings.Split(encoded, ",") {
+		if code, digest, ok := strings.Cut(pair, "="); ok {
+			digests[code] = digest
+		}
+	}
+	for _, claim := range b.enabled(claims) {
+		digest, ok := digests[claimCodes[claim[0]]]
+		if !ok || !hmac.Equal([]byte(digest), []byte(claimDigest(key, claim[0], claim[1]))) {
+			return &BindingError{Claim: claim[0]}
+		}
+	}
+	return nil
+}
+
+// claimDigest returns a truncated HMAC-SHA256 of the claim value keyed with the signing key.
+func claimDigest(key Key, claim, value string) string {
+	h := hmac.New(sha256.New, []byte(key.Secret))
+	h.Write([]byte(claim + ":" + value))
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// bindingFailures holds the number of failed binding checks by claim.
+var bindingFailures sync.Map // string -> *atomic.Uint64
+
+func countBindingFailure(claim string) {
+	c, ok := bindingFailures.Load(claim)
+	if !ok {
+		c, _ = bindingFailures.LoadOrStore(claim, new(atomic.Uint64))
+	}
+	c.(*atomic.Uint64).Add(1)
+}
+
+// BindingStats returns the number of tokens rejected since start because a binding claim was
+// missing or did not match, keyed by claim.
+func BindingStats() map[string]uint64 {
+	stats := make(map[string]uint64)
+	bindingFailures.Range(func(key, value interface{}) bool {
+		stats[key.(string)] = value.(*atomic.Uint64).Load()
+		return true
+	})
+	return stats
+}
@@ -0,0 +1,83 @@
+package security
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestClaims(t *testing.T) {
+	r := httptest.NewRequest("GET", "/logger.js", nil)
+	r.Header.Set("Referer", "https://Shop.Example.com/cart?x=1")
+	r.Header.Set("User-Agent", "Mozilla/5.0")
+	claims := RequestClaims(r, "203.0.113.77")
+	assert.Equal(t, Claims{Origin: "shop.example.com", IPNetwork: "203.0.113.0/24", UserAgent: "Mozilla/5.0"}, claims)
+
+	// Origin takes precedence over Referer
+	r.Header.Set("Origin", "https://www.example.com:8443")
+	assert.Equal(t, "www.example.com", RequestClaims(r, "").Origin)
+
+	assert.Equal(t, "2001:db8:1:2::/64", RequestClaims(r, "2001:db8:1:2:3:4:5:6").IPNetwork)
+	assert.Equal(t, "", RequestClaims(r, "invalid").IPNetwork)
+}
+
+func TestKeyring_Binding(t *testing.T) {
+	ring, err := NewKeyring([]Key{{ID: "k", Secret: "secret"}}, "k", true)
+	require.NoError(t, err)
+	binding := &Binding{Origin: true, IP: true, UserAgent: true}
+	claims := Claims{Origin: "shop.example.com", IPNetwork: "203.0.113.0/24", UserAgent: "Mozilla/5.0"}
+
+	token, err := ring.GenerateBound("site", "", time.Hour, binding, claims)
+	require.NoError(t, err)
+	parts := strings.Split(token, ":")
+	require.Len(t, parts, 4)
+	assert.NotContains(t, token, "203.0.113", "Claim values must not be readable from the token")
+
+	valid, err := ring.ValidateBound("site", "", token, binding, claims)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+
+	// Another client on the same network
+	sameNetwork := claims
+	sameNetwork.IPNetwork = RequestClaims(httptest.NewRequest("GET", "/", nil), "203.0.113.200").IPNetwork
+	valid, _ = ring.ValidateBound("site", "", token, binding, sameNetwork)
+	assert.True(t, valid)
+
+	mismatches := map[string]Claims{
+		ClaimOrigin:    {Origin: "evil.example.com", IPNetwork: claims.IPNetwork, UserAgent: claims.UserAgent},
+		ClaimIP:        {Origin: claims.Origin, IPNetwork: "198.51.100.0/24", UserAgent: claims.UserAgent},
+		ClaimUserAgent: {Origin: claims.Origin, IPNetwork: claims.IPNetwork, UserAgent: "curl/8.0"},
+	}
+	for claim, other := range mismatches {
+		before := BindingStats()[claim]
+		valid, err := ring.ValidateBound("site", "", token, binding, other)
+		assert.False(t, valid)
+		assert.Equal(t, &BindingError{Claim: claim}, err)
+		assert.Equal(t, before+1, BindingStats()[claim])
+	}
+
+	// Disabled claims are not checked
+	valid, _ = ring.ValidateBound("site", "", token, &Binding{IP: true}, mismatches[ClaimOrigin])
+	assert.True(t, valid)
+
+	// Claims cannot be stripped or changed without breaking the signature
+	unbound := parts[0] + ":" + parts[1] + ":" + parts[3]
+	valid, err = ring.ValidateBound("site", "", unbound, nil, claims)
+	assert.False(t, valid)
+	assert.EqualError(t, err, "invalid token")
+
+	// Unbound and legacy tokens lack the required claims
+	plain, err := ring.Generate("site", "", time.Hour)
+	require.NoError(t, err)
+	legacy, err := GenerateToken("secret", "site", "", time.Hour)
+	require.NoError(t, err)
+	for _, tok := range []string{plain, legacy} {
+		valid, err = ring.ValidateBound("site", "", tok, &Binding{UserAgent: true}, claims)
+		assert.False(t, valid)
+		assert.Equal(t, &BindingError{Claim: ClaimUserAgent}, err)
+	}
+}
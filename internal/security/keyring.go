@@ -0,0 +1,205 @@
+package security
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultKeyID is the ID of the key built from the single security.token.secret.
+const DefaultKeyID = "default"
+
+// keyIDPattern restricts key IDs to characters that cannot be confused with the token separator.
+var keyIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// Key is a token signing secret identified by an ID. Retired keys are kept in the
+// configuration but tokens signed with them are rejected.
+type Key struct {
+	ID      string
+	Secret  string
+	Retired bool
+}
+
+// Keyring signs tokens with the active key and validates tokens signed with any non-retired key.
+//
+// Tokens have the format keyID:expiresAt:signature, where the signature is the HMAC-SHA256 of
+// keyID:siteID:gtmID:expiresAt, or keyID:expiresAt:claims:signature for tokens bound to the
+// request (see Binding). Legacy tokens (expiresAt:signature, see GenerateToken) are
+// accepted with any non-retired key when acceptLegacy is set, so tokens embedded in cached
+// logger.js responses stay valid while migrating.
+type Keyring struct {
+	keys         map[string]Key
+	ordered      []Key
+	active       Key
+	acceptLegacy bool
+}
+
+// NewKeyring creates a keyring signing with the key activeID.
+func NewKeyring(keys []Key, activeID string, acceptLegacy bool) (*Keyring, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("at least one key is required")
+	}
+	kr := &Keyring{keys: make(map[string]Key, len(keys)), acceptLegacy: acceptLegacy}
+	for _, key := range keys {
+		if !ValidKeyID(key.ID) {
+			return nil, fmt.Errorf("invalid key id '%s', use 1-64 letters, digits, '.', '_' or '-'", key.ID)
+		}
+		if key.Secret == "" {
+			return nil, fmt.Errorf("key '%s': secret cannot be empty", key.ID)
+		}
+		if _, exists := kr.keys[key.ID]; exists {
+			return nil, fmt.Errorf("duplicate key id '%s'", key.ID)
+		}
+		kr.keys[key.ID] = key
+		kr.ordered = append(kr.ordered, key)
+	}
+	active, ok := kr.keys[activeID]
+	if !ok {
+		return nil, fmt.Errorf("active key '%s' does not exist", activeID)
+	}
+	if active.Retired {
+		return nil, fmt.Errorf("active key '%s' is retired", activeID)
+	}
+	kr.active = active
+	return kr, nil
+}
+
+// ValidKeyID reports whether id can be used as a key ID.
+func ValidKeyID(id string) bool {
+	return keyIDPattern.MatchString(id)
+}
+
+// ActiveKeyID returns the ID of the key new tokens are signed with.
+func (kr *Keyring) ActiveKeyID() string {
+	return kr.active.ID
+}
+
+// Generate creates an unbound token for the site ID and GTM ID signed with the active key.
+func (kr *Keyring) Generate(siteID, gtmID string, expirationDuration time.Duration) (string, error) {
+	return kr.GenerateBound(siteID, gtmID, expirationDuration, nil, Claims{})
+}
+
+// GenerateBound creates a token signed with the active key and bound to the claims enabled in
+// binding (nil = unbound). Bound tokens have the format keyID:expiresAt:claims:signature.
+func (kr *Keyring) GenerateBound(siteID, gtmID string, expirationDuration time.Duration, binding *Binding, claims Claims) (string, error) {
+	if kr == nil {
+		return "", fmt.Errorf("no signing key configured")
+	}
+	if expirationDuration <= 0 {
+		return "", fmt.Errorf("expirationDuration must be positive")
+	}
+	expiresAt := time.Now().Add(expirationDuration).Unix()
+	prefix := fmt.Sprintf("%s:%d", kr.active.ID, expiresAt)
+	if encoded := binding.encode(kr.active, claims); encoded != "" {
+		prefix += ":" + encoded
+	}
+	return prefix + ":" + sign(kr.active, siteID, gtmID, prefix), nil
+}
+
+// Validate validates an unbound token in the keyed or (if accepted) the legacy format.
+func (kr *Keyring) Validate(siteID, gtmID, token string) (bool, error) {
+	return kr.ValidateBound(siteID, gtmID, token, nil, Claims{})
+}
+
+// ValidateBound validates a token and checks the claims enabled in binding against the claims
+// of the request. Tokens without a required claim (including legacy and unbound tokens) fail.
+// A failed binding check returns a *BindingError and is counted in BindingStats; other errors
+// are generic and do not reveal whether the key, the signature or the expiration failed, only
+// expired tokens can be told apart with errors.Is(err, ErrTokenExpired).
+func (kr *Keyring) ValidateBound(siteID, gtmID, token string, binding *Binding, claims Claims) (bool, error) {
+	return kr.ValidateBoundWithGrace(siteID, gtmID, token, binding, claims, 0)
+}
+
+// ValidateBoundWithGrace validates a token like ValidateBound, but also accepts tokens that
+// expired less than grace ago. Legacy tokens are only accepted before they expire.
+func (kr *Keyring) ValidateBoundWithGrace(siteID, gtmID, token string, binding *Binding, claims Claims, grace time.Duration) (bool, error) {
+	if kr == nil {
+		return false, fmt.Errorf("no signing key configured")
+	}
+	parts := strings.Split(token, ":")
+	var key Key
+	var encoded string
+	switch len(parts) {
+	case 2:
+		valid := false
+		if kr.acceptLegacy {
+			for _, k := range kr.ordered {
+				if k.Retired {
+					continue
+				}
+				var err error
+				if valid, err = ValidateToken(k.Secret, siteID, gtmID, token); valid {
+					key = k
+					break
+				}
+				if errors.Is(err, ErrTokenExpired) {
+					return false, err
+				}
+			}
+		}
+		if !valid {
+			return false, fmt.Errorf("invalid token")
+		}
+	case 3, 4:
+		var ok bool
+		key, ok = kr.keys[parts[0]]
+		expiresAt, err := strconv.ParseInt(parts[1], 10, 64)
+		if !ok || key.Retired || err != nil {
+			return false, fmt.Errorf("invalid token")
+		}
+		// Signature first, expiration after, as in ValidateToken
+		signed := strings.Join(parts[:len(parts)-1], ":")
+		if !hmac.Equal([]byte(parts[len(parts)-1]), []byte(sign(key, siteID, gtmID, signed))) {
+			return false, fmt.Errorf("invalid token")
+		}
+		if time.Now().After(time.Unix(expiresAt, 0).Add(grace)) {
+			return false, ErrTokenExpired
+		}
+		if len(parts) == 4 {
+			encoded = parts[2]
+		}
+	default:
+		return false, fmt.Errorf("invalid token")
+	}
+
+	if err := binding.check(key, encoded, claims); err != nil {
+		countBindingFailure(err.Claim)
+		return false, err
+	}
+	return true, nil
+}
+
+// TokenExpiresAt returns the expiration time of a token in the keyed or legacy format. The
+// token is not validated.
+func TokenExpiresAt(token string) (time.Time, bool) {
+	parts := strings.Split(token, ":")
+	field := 1
+	switch len(parts) {
+	case 2:
+		field = 0
+	case 3, 4:
+	default:
+		return time.Time{}, false
+	}
+	expiresAt, err := strconv.ParseInt(parts[field], 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(expiresAt, 0), true
+}
+
+// sign returns the hex HMAC-SHA256 of keyID:siteID:gtmID:expiresAt[:claims], with prefix being
+// the token without its signature. The key ID is part of the message so a signature cannot be
+// moved to a token naming another key.
+func sign(key Key, siteID, gtmID, prefix string) string {
+	keyID, rest, _ := strings.Cut(prefix, ":")
+	h := hmac.New(sha256.New, []byte(key.Secret))
+	h.Write([]byte(fmt.Sprintf("%s:%s:%s:%s", keyID, siteID, gtmID, rest)))
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,177 @@
+package security
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewKeyring_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		keys     []Key
+		active   string
+		errorMsg string
+	}{
+		{"No keys", nil, "a", "at least one key is required"},
+		{"Invalid ID", []Key{{ID: "a:b", Secret: "s"}}, "a:b", "invalid key id 'a:b'"},
+		{"Empty secret", []Key{{ID: "a"}}, "a", "key 'a': secret cannot be empty"},
+		{"Duplicate ID", []Key{{ID: "a", Secret: "s"}, {ID: "a", Secret: "t"}}, "a", "duplicate key id 'a'"},
+		{"Unknown active key", []Key{{ID: "a", Secret: "s"}}, "b", "active key 'b' does not exist"},
+		{"Retired active key", []Key{{ID: "a", Secret: "s", Retired: true}}, "a", "active key 'a' is retired"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewKeyring(tt.keys, tt.active, true)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.errorMsg)
+		})
+	}
+}
+
+func TestKeyring_Rotation(t *testing.T) {
+	oldRing, err := NewKeyring([]Key{{ID: "2024-01", Secret: "old-secret"}}, "2024-01", true)
+	require.NoError(t, err)
+	oldToken, err := oldRing.Generate("site", "GTM-1", time.Hour)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(oldToken, "2024-01:"))
+
+	// The new key signs, tokens of the old key stay valid until it is retired
+	ring, err := NewKeyring([]Key{{ID: "2024-06", Secret: "new-secret"}, {ID: "2024-01", Secret: "old-secret"}}, "2024-06", true)
+	require.NoError(t, err)
+	assert.Equal(t, "2024-06", ring.ActiveKeyID())
+	newToken, err := ring.Generate("site", "GTM-1", time.Hour)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(newToken, "2024-06:"))
+
+	for _, token := range []string{oldToken, newToken} {
+		valid, err := ring.Validate("site", "GTM-1", token)
+		assert.NoError(t, err)
+		assert.True(t, valid, token)
+	}
+
+	retired, err := NewKeyring([]Key{{ID: "2024-06", Secret: "new-secret"}, {ID: "2024-01", Secret: "old-secret", Retired: true}}, "2024-06", true)
+	require.NoError(t, err)
+	valid, err := retired.Validate("site", "GTM-1", oldToken)
+	assert.False(t, valid)
+	assert.EqualError(t, err, "invalid token")
+	valid, _ = retired.Validate("site", "GTM-1", newToken)
+	assert.True(t, valid)
+}
+
+func TestKeyring_Validate_Invalid(t *testing.T) {
+	ring, err := NewKeyring([]Key{{ID: "a", Secret: "secret-a"}, {ID: "b", Secret: "secret-b"}}, "a", true)
+	require.NoError(t, err)
+	token, err := ring.Generate("site", "", time.Hour)
+	require.NoError(t, err)
+	parts := strings.Split(token, ":")
+
+	past := time.Now().Add(-time.Minute).Unix()
+	expired := fmt.Sprintf("a:%d:%s", past, sign(Key{ID: "a", Secret: "secret-a"}, "site", "", fmt.Sprintf("a:%d", past)))
+
+	tests := []struct {
+		name   string
+		siteID string
+		token  string
+	}{
+		{"Other site", "other", token},
+		{"Unknown key", "site", "c:" + parts[1] + ":" + parts[2]},
+		{"Signature moved to another key", "site", "b:" + parts[1] + ":" + parts[2]},
+		{"Tampered expiration", "site", parts[0] + ":" + parts[1] + "0:" + parts[2]},
+		{"Non-numeric expiration", "site", parts[0] + ":x:" + parts[2]},
+		{"Expired", "site", expired},
+		{"Too many parts", "site", token + ":x"},
+		{"Garbage", "site", "garbage"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			valid, err := ring.Validate(tt.siteID, "", tt.token)
+			assert.False(t, valid)
+			assert.EqualError(t, err, "invalid token")
+		})
+	}
+}
+
+func TestKeyring_LegacyTokens(t *testing.T) {
+	legacy, err := GenerateToken("old-secret", "site", "", time.Hour)
+	require.NoError(t, err)
+
+	keys := []Key{{ID: "new", Secret: "new-secret"}, {ID: DefaultKeyID, Secret: "old-secret"}}
+	ring, err := NewKeyring(keys, "new", true)
+	require.NoError(t, err)
+	valid, err := ring.Validate("site", "", legacy)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+
+	valid, _ = ring.Validate("other", "", legacy)
+	assert.False(t, valid)
+
+	strict, err := NewKeyring(keys, "new", false)
+	require.NoError(t, err)
+	valid, err = strict.Validate("site", "", legacy)
+	assert.False(t, valid)
+	assert.EqualError(t, err, "invalid token")
+
+	keys[1].Retired = true
+	retired, err := NewKeyring(keys, "new", true)
+	require.NoError(t, err)
+	valid, _ = retired.Validate("site", "", legacy)
+	assert.False(t, valid)
+}
+
+func TestKeyring_ValidateBoundWithGrace(t *testing.T) {
+	ring, err := NewKeyring([]Key{{ID: "a", Secret: "secret-a"}}, "a", true)
+	require.NoError(t, err)
+	past := time.Now().Add(-time.Minute).Unix()
+	expired := fmt.Sprintf("a:%d:%s", past, sign(Key{ID: "a", Secret: "secret-a"}, "site", "", fmt.Sprintf("a:%d", past)))
+
+	valid, err := ring.ValidateBoundWithGrace("site", "", expired, nil, Claims{}, time.Hour)
+	assert.True(t, valid)
+	assert.NoError(t, err)
+	valid, _ = ring.ValidateBoundWithGrace("site", "", expired, nil, Claims{}, 30*time.Second)
+	assert.False(t, valid, "expired longer than the grace period")
+	valid, err = ring.ValidateBound("site", "", expired, nil, Claims{})
+	assert.False(t, valid)
+	assert.ErrorIs(t, err, ErrTokenExpired, "expired tokens can be told apart from forged ones")
+	assert.EqualError(t, err, "invalid token")
+
+	// Expired legacy tokens as well
+	legacy := fmt.Sprintf("%d:%s", past, hmacHex("secret-a", fmt.Sprintf("site::%d", past)))
+	_, err = ring.Validate("site", "", legacy)
+	assert.ErrorIs(t, err, ErrTokenExpired)
+	_, err = ring.Validate("site", "", "invalid")
+	assert.NotErrorIs(t, err, ErrTokenExpired)
+}
+
+// hmacHex returns the hex HMAC-SHA256 of message, as used by legacy tokens.
+func hmacHex(secret, message string) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(message))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func TestTokenExpiresAt(t *testing.T) {
+	ring, err := NewKeyring([]Key{{ID: "a", Secret: "secret-a"}}, "a", true)
+	require.NoError(t, err)
+	token, err := ring.GenerateBound("site", "", time.Hour, &Binding{IP: true}, Claims{IPNetwork: "203.0.113.0/24"})
+	require.NoError(t, err)
+	expiresAt, ok := TokenExpiresAt(token)
+	assert.True(t, ok)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), expiresAt, 2*time.Second)
+
+	legacy, err := GenerateToken("secret-a", "site", "", time.Hour)
+	require.NoError(t, err)
+	expiresAt, ok = TokenExpiresAt(legacy)
+	assert.True(t, ok)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), expiresAt, 2*time.Second)
+
+	_, ok = TokenExpiresAt("invalid")
+	assert.False(t, ok)
+}
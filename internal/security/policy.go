@@ -0,0 +1,53 @@
+package security
+
+import (
+	"slices"
+	"time"
+)
+
+// Policy holds the token settings of a site.
+type Policy struct {
+	Keyring       *Keyring      // Keyring signing and validating the tokens of the site
+	Expiration    time.Duration // Token lifetime, 0 = the default expiration
+	AllowedGtmIDs []string      // Accepted gtm_id values, empty = any (including none)
+	Binding       *Binding      // Claims tokens are bound to, nil = unbound
+}
+
+// AllowsGtmID reports whether the policy accepts the GTM ID. With AllowedGtmIDs set, requests
+// without a GTM ID are rejected as well.
+func (p Policy) AllowsGtmID(gtmID string) bool {
+	return len(p.AllowedGtmIDs) == 0 || slices.Contains(p.AllowedGtmIDs, gtmID)
+}
+
+// Policies looks up the token policy of a site.
+type Policies struct {
+	defaults Policy
+	sites    map[string]Policy
+}
+
+// NewPolicies creates policies with per-site overrides of the default policy. Sites without
+// a keyring, expiration or binding of their own inherit those of the default policy.
+func NewPolicies(defaults Policy, sites map[string]Policy) *Policies {
+	p := &Policies{defaults: defaults, sites: make(map[string]Policy, len(sites))}
+	for siteID, site := range sites {
+		if site.Keyring == nil {
+			site.Keyring = defaults.Keyring
+		}
+		if site.Expiration == 0 {
+			site.Expiration = defaults.Expiration
+		}
+		if site.Binding == nil {
+			site.Binding = defaults.Binding
+		}
+		p.sites[siteID] = site
+	}
+	return p
+}
+
+// Lookup returns the policy of the site, or the default policy for sites without overrides.
+func (p *Policies) Lookup(siteID string) Policy {
+	if site, ok := p.sites[siteID]; ok {
+		return site
+	}
+	return p.defaults
+}
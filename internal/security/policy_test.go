@@ -0,0 +1,38 @@
+package security
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicies_Lookup(t *testing.T) {
+	global, err := NewKeyring([]Key{{ID: DefaultKeyID, Secret: "global"}}, DefaultKeyID, true)
+	require.NoError(t, err)
+	tenant, err := NewKeyring([]Key{{ID: "tenant", Secret: "tenant"}}, "tenant", true)
+	require.NoError(t, err)
+
+	policies := NewPolicies(Policy{Keyring: global, Expiration: time.Hour}, map[string]Policy{
+		"own":     {Keyring: tenant, Expiration: time.Minute},
+		"inherit": {AllowedGtmIDs: []string{"GTM-A"}},
+	})
+
+	own := policies.Lookup("own")
+	assert.Same(t, tenant, own.Keyring)
+	assert.Equal(t, time.Minute, own.Expiration)
+
+	inherit := policies.Lookup("inherit")
+	assert.Same(t, global, inherit.Keyring)
+	assert.Equal(t, time.Hour, inherit.Expiration)
+
+	other := policies.Lookup("other")
+	assert.Same(t, global, other.Keyring)
+	assert.True(t, other.AllowsGtmID(""))
+	assert.True(t, other.AllowsGtmID("GTM-B"))
+
+	assert.True(t, inherit.AllowsGtmID("GTM-A"))
+	assert.False(t, inherit.AllowsGtmID("GTM-B"))
+	assert.False(t, inherit.AllowsGtmID(""))
+}
@@ -0,0 +1,57 @@
+package security
+
+import (
+	"crypto/sha256"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/orgoj/weblogproxy/internal/lru"
+)
+
+// ReplayGuard detects events sent more than once with the same token and event ID. Events are
+// remembered for the window in an LRU of bounded size, so under a flood of distinct events the
+// oldest ones may be forgotten before the window ends. The event ID is chosen by the client and
+// not signed, a replayed event with a new event ID is not detected.
+type ReplayGuard struct {
+	window time.Duration
+	seen   *lru.Cache[[16]byte, time.Time]
+	mu     sync.Mutex // Makes the lookup and the insert of an event atomic
+}
+
+// NewReplayGuard creates a guard remembering up to maxEntries events for the window.
+func NewReplayGuard(window time.Duration, maxEntries int) *ReplayGuard {
+	return &ReplayGuard{window: window, seen: lru.New[[16]byte, time.Time](maxEntries)}
+}
+
+// Seen records the event and reports whether it was already recorded within the window.
+// Duplicates are counted in ReplayStats.
+func (g *ReplayGuard) Seen(token, eventID string) bool {
+	key := replayKey(token, eventID)
+	now := time.Now()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if seenAt, ok := g.seen.Get(key); ok && now.Sub(seenAt) < g.window {
+		replayedEvents.Add(1)
+		return true
+	}
+	g.seen.Add(key, now)
+	return false
+}
+
+// replayKey returns a truncated SHA-256 of the token and event ID, keeping entries small.
+func replayKey(token, eventID string) [16]byte {
+	sum := sha256.Sum256([]byte(token + "\x00" + eventID))
+	var key [16]byte
+	copy(key[:], sum[:])
+	return key
+}
+
+// replayedEvents holds the number of duplicate events rejected since start.
+var replayedEvents atomic.Uint64
+
+// ReplayStats returns the number of duplicate events rejected since start.
+func ReplayStats() uint64 {
+	return replayedEvents.Load()
+}
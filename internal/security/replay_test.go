@@ -0,0 +1,36 @@
+package security
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplayGuard(t *testing.T) {
+	guard := NewReplayGuard(time.Hour, 100)
+	before := ReplayStats()
+
+	assert.False(t, guard.Seen("token-a", "event-1"))
+	assert.True(t, guard.Seen("token-a", "event-1"), "same token and event ID is a duplicate")
+	assert.False(t, guard.Seen("token-a", "event-2"), "other event ID")
+	assert.False(t, guard.Seen("token-b", "event-1"), "same event ID with another token")
+	assert.Equal(t, before+1, ReplayStats())
+}
+
+func TestReplayGuard_Window(t *testing.T) {
+	guard := NewReplayGuard(20*time.Millisecond, 100)
+	assert.False(t, guard.Seen("token", "event"))
+	time.Sleep(30 * time.Millisecond)
+	assert.False(t, guard.Seen("token", "event"), "events older than the window are accepted again")
+	assert.True(t, guard.Seen("token", "event"))
+}
+
+func TestReplayGuard_MaxEntries(t *testing.T) {
+	guard := NewReplayGuard(time.Hour, 2)
+	guard.Seen("token", "event-1")
+	guard.Seen("token", "event-2")
+	guard.Seen("token", "event-3")
+	assert.False(t, guard.Seen("token", "event-1"), "oldest event is evicted")
+	assert.True(t, guard.Seen("token", "event-3"))
+}
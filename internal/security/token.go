@@ -4,11 +4,23 @@ import (
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
 )
 
+// ErrTokenExpired is returned for correctly signed tokens that expired. It has the same generic
+// message as other validation errors, callers tell it apart with errors.Is.
+var ErrTokenExpired = errors.New("invalid token")
+
+// IsSignatureError reports whether a validation error is a malformed or wrongly signed token,
+// as opposed to an expired token or a failed binding check of a correctly signed token.
+func IsSignatureError(err error) bool {
+	var bindingErr *BindingError
+	return err != nil && !errors.Is(err, ErrTokenExpired) && !errors.As(err, &bindingErr)
+}
+
 // GenerateToken creates a security token for the given site ID and GTM ID
 // expirationDuration should be a positive duration.
 func GenerateToken(secret, siteID, gtmID string, expirationDuration time.Duration) (string, error) {
@@ -72,7 +84,7 @@ func ValidateToken(secret, siteID, gtmID, token string) (bool, error) {
 	expirationTime := time.Unix(expiresAt, 0)
 	if time.Now().After(expirationTime) {
 		// Return generic error to prevent information leakage
-		return false, fmt.Errorf("invalid token")
+		return false, ErrTokenExpired
 	}
 
 	return true, nil
@@ -81,17 +93,26 @@ func ValidateToken(secret, siteID, gtmID, token string) (bool, error) {
 // TokenValidationRateLimiter implements rate limiting for token validation attempts
 // to prevent brute force attacks on token validation.
 type TokenValidationRateLimiter struct {
-	attempts      sync.Map // map[string]*validationAttempts
-	maxAttempts   int      // Maximum failed attempts before blocking
-	blockDuration time.Duration
-	cleanupTicker *time.Ticker
-	stopCleanup   chan struct{}
+	attempts         sync.Map // map[string]*validationAttempts
+	maxAttempts      int      // Maximum failed attempts before blocking
+	blockDuration    time.Duration
+	maxBlockDuration time.Duration // Cap of the doubled block duration of repeat offenders
+	cleanupTicker    *time.Ticker
+	stopCleanup      chan struct{}
+	stopOnce         sync.Once
+	now              func() time.Time // Clock used for failures and blocks
 }
 
+// failureWindow is the period in which maxAttempts failures lead to a block.
+const failureWindow = 10 * time.Minute
+
 // validationAttempts tracks failed validation attempts for a specific key (typically IP or IP:siteID)
 type validationAttempts struct {
 	count        int
 	firstFail    time.Time
+	lastFail     time.Time
+	blocks       int // Number of recent blocks, decays by one per decay period without a block
+	lastBlock    time.Time
 	blockedUntil time.Time
 	mu           sync.Mutex
 }
@@ -101,11 +122,23 @@ type validationAttempts struct {
 // blockDuration: how long to block after exceeding max attempts (recommended: 1-15 minutes)
 // cleanupInterval: how often to clean up old entries (recommended: 5 minutes)
 func NewTokenValidationRateLimiter(maxAttempts int, blockDuration, cleanupInterval time.Duration) *TokenValidationRateLimiter {
+	return NewTokenValidationRateLimiterWithBackoff(maxAttempts, blockDuration, blockDuration, cleanupInterval)
+}
+
+// NewTokenValidationRateLimiterWithBackoff creates a rate limiter whose block duration doubles
+// with every further block of the same key, up to maxBlockDuration. The backoff is not reset by
+// successful validations, it decays by one step per period without a block, see decayPeriod.
+func NewTokenValidationRateLimiterWithBackoff(maxAttempts int, blockDuration, maxBlockDuration, cleanupInterval time.Duration) *TokenValidationRateLimiter {
+	if maxBlockDuration < blockDuration {
+		maxBlockDuration = blockDuration
+	}
 	rl := &TokenValidationRateLimiter{
-		maxAttempts:   maxAttempts,
-		blockDuration: blockDuration,
-		cleanupTicker: time.NewTicker(cleanupInterval),
-		stopCleanup:   make(chan struct{}),
+		maxAttempts:      maxAttempts,
+		blockDuration:    blockDuration,
+		maxBlockDuration: maxBlockDuration,
+		cleanupTicker:    time.NewTicker(cleanupInterval),
+		stopCleanup:      make(chan struct{}),
+		now:              time.Now,
 	}
 
 	// Start cleanup goroutine
@@ -114,10 +147,28 @@ func NewTokenValidationRateLimiter(maxAttempts int, blockDuration, cleanupInterv
 	return rl
 }
 
+// Blocked reports whether the key is currently blocked and for how long it stays blocked.
+func (rl *TokenValidationRateLimiter) Blocked(key string) (bool, time.Duration) {
+	val, ok := rl.attempts.Load(key)
+	if !ok {
+		return false, 0
+	}
+	attempt := val.(*validationAttempts)
+	attempt.mu.Lock()
+	defer attempt.mu.Unlock()
+	remaining := attempt.blockedUntil.Sub(rl.now())
+	return remaining > 0, max(remaining, 0)
+}
+
 // CheckAndRecordAttempt checks if an IP is blocked and records the attempt
-// Returns true if the request should be blocked, false otherwise
+// Returns true if the request should be blocked, false otherwise. Successful validations are
+// not recorded, so they neither reset the failure count nor the backoff of a key.
 func (rl *TokenValidationRateLimiter) CheckAndRecordAttempt(key string, success bool) bool {
-	now := time.Now()
+	if success {
+		blocked, _ := rl.Blocked(key)
+		return blocked
+	}
+	now := rl.now()
 
 	// Load or create attempts entry
 	val, _ := rl.attempts.LoadOrStore(key, &validationAttempts{})
@@ -131,29 +182,43 @@ func (rl *TokenValidationRateLimiter) CheckAndRecordAttempt(key string, success
 		return true // Blocked
 	}
 
-	// If successful validation, reset counter
-	if success {
+	// Record failed attempt, failures older than the failure window are forgotten
+	if attempt.count == 0 || now.Sub(attempt.firstFail) > failureWindow {
 		attempt.count = 0
-		attempt.firstFail = time.Time{}
-		attempt.blockedUntil = time.Time{}
-		return false
-	}
-
-	// Record failed attempt
-	if attempt.count == 0 {
 		attempt.firstFail = now
 	}
 	attempt.count++
+	attempt.lastFail = now
 
-	// Check if exceeded max attempts
+	// Check if exceeded max attempts, repeat offenders are blocked exponentially longer
 	if attempt.count >= rl.maxAttempts {
-		attempt.blockedUntil = now.Add(rl.blockDuration)
+		if attempt.blocks > 0 {
+			attempt.blocks = max(attempt.blocks-int(now.Sub(attempt.lastBlock)/rl.decayPeriod()), 0)
+		}
+		attempt.blockedUntil = now.Add(rl.backoff(attempt.blocks))
+		attempt.blocks++
+		attempt.lastBlock = now
+		attempt.count = 0
 		return true // Now blocked
 	}
 
 	return false // Not blocked yet
 }
 
+// decayPeriod is the time without a block after which the backoff of a key drops by one step.
+func (rl *TokenValidationRateLimiter) decayPeriod() time.Duration {
+	return max(failureWindow, rl.maxBlockDuration)
+}
+
+// backoff returns the block duration after the given number of previous blocks.
+func (rl *TokenValidationRateLimiter) backoff(blocks int) time.Duration {
+	d := rl.blockDuration
+	for i := 0; i < blocks && d < rl.maxBlockDuration; i++ {
+		d *= 2
+	}
+	return min(d, rl.maxBlockDuration)
+}
+
 // cleanupLoop periodically removes old entries
 func (rl *TokenValidationRateLimiter) cleanupLoop() {
 	for {
@@ -167,14 +232,16 @@ func (rl *TokenValidationRateLimiter) cleanupLoop() {
 	}
 }
 
-// cleanup removes entries that are no longer blocked and have no recent failures
+// cleanup removes entries that are no longer blocked and have no recent failures. The block
+// history of repeat offenders is kept until it has decayed.
 func (rl *TokenValidationRateLimiter) cleanup() {
-	now := time.Now()
+	now := rl.now()
 	rl.attempts.Range(func(key, value interface{}) bool {
 		attempt := value.(*validationAttempts)
 		attempt.mu.Lock()
-		// Remove if not blocked and no failures in last 10 minutes
-		if now.After(attempt.blockedUntil) && (attempt.count == 0 || now.Sub(attempt.firstFail) > 10*time.Minute) {
+		// Remove if not blocked and no failures in the retention period
+		retention := rl.decayPeriod() * time.Duration(max(attempt.blocks, 1))
+		if now.After(attempt.blockedUntil) && now.Sub(attempt.lastFail) > retention {
 			attempt.mu.Unlock()
 			rl.attempts.Delete(key)
 		} else {
@@ -184,7 +251,7 @@ func (rl *TokenValidationRateLimiter) cleanup() {
 	})
 }
 
-// Stop stops the cleanup goroutine
+// Stop stops the cleanup goroutine, it is safe to call Stop more than once
 func (rl *TokenValidationRateLimiter) Stop() {
-	close(rl.stopCleanup)
+	rl.stopOnce.Do(func() { close(rl.stopCleanup) })
 }
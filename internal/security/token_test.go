@@ -316,3 +316,104 @@ func TestGenerateToken_NonPositiveExpiration(t *testing.T) {
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "expirationDuration must be positive")
 }
+
+func TestTokenValidationRateLimiter_Blocks(t *testing.T) {
+	rl := NewTokenValidationRateLimiter(3, time.Minute, time.Hour)
+	defer rl.Stop()
+
+	assert.False(t, rl.CheckAndRecordAttempt("ip", false))
+	assert.False(t, rl.CheckAndRecordAttempt("ip", false))
+	blocked, _ := rl.Blocked("ip")
+	assert.False(t, blocked)
+
+	assert.True(t, rl.CheckAndRecordAttempt("ip", false), "Third failure should block")
+	blocked, remaining := rl.Blocked("ip")
+	assert.True(t, blocked)
+	assert.InDelta(t, time.Minute.Seconds(), remaining.Seconds(), 1)
+	assert.True(t, rl.CheckAndRecordAttempt("ip", true), "Valid tokens are blocked as well")
+
+	blocked, _ = rl.Blocked("other")
+	assert.False(t, blocked, "Other keys are not affected")
+}
+
+func TestTokenValidationRateLimiter_SuccessDoesNotReset(t *testing.T) {
+	rl := NewTokenValidationRateLimiter(2, time.Minute, time.Hour)
+	defer rl.Stop()
+
+	assert.False(t, rl.CheckAndRecordAttempt("ip", true), "Successes of unknown keys are not blocked")
+	assert.False(t, rl.CheckAndRecordAttempt("ip", false))
+	assert.False(t, rl.CheckAndRecordAttempt("ip", true))
+	assert.True(t, rl.CheckAndRecordAttempt("ip", false), "Successes between failures do not reset the failure count")
+}
+
+func TestTokenValidationRateLimiter_Backoff(t *testing.T) {
+	rl := NewTokenValidationRateLimiterWithBackoff(1, 20*time.Millisecond, 50*time.Millisecond, time.Hour)
+	defer rl.Stop()
+
+	assert.Equal(t, 20*time.Millisecond, rl.backoff(0))
+	assert.Equal(t, 40*time.Millisecond, rl.backoff(1))
+	assert.Equal(t, 50*time.Millisecond, rl.backoff(2), "Block duration is capped")
+	assert.Equal(t, 50*time.Millisecond, rl.backoff(100))
+
+	now := time.Now()
+	rl.now = func() time.Time { return now }
+
+	// Repeat offenders are blocked longer
+	assert.True(t, rl.CheckAndRecordAttempt("ip", false))
+	_, remaining := rl.Blocked("ip")
+	assert.Equal(t, 20*time.Millisecond, remaining)
+	now = now.Add(25 * time.Millisecond)
+	assert.True(t, rl.CheckAndRecordAttempt("ip", false))
+	_, remaining = rl.Blocked("ip")
+	assert.Equal(t, 40*time.Millisecond, remaining)
+
+	// A successful validation after the block does not reset the backoff
+	now = now.Add(45 * time.Millisecond)
+	assert.False(t, rl.CheckAndRecordAttempt("ip", true))
+	assert.True(t, rl.CheckAndRecordAttempt("ip", false))
+	_, remaining = rl.Blocked("ip")
+	assert.Equal(t, 50*time.Millisecond, remaining)
+}
+
+func TestTokenValidationRateLimiter_BackoffDecays(t *testing.T) {
+	rl := NewTokenValidationRateLimiterWithBackoff(1, time.Minute, time.Hour, time.Hour)
+	defer rl.Stop()
+
+	assert.True(t, rl.CheckAndRecordAttempt("ip", false))
+	val, _ := rl.attempts.Load("ip")
+	attempt := val.(*validationAttempts)
+	attempt.blocks = 3
+	// Two decay periods without a block drop the backoff by two steps
+	attempt.lastBlock = time.Now().Add(-2*rl.decayPeriod() - time.Minute)
+	attempt.blockedUntil = time.Time{}
+
+	assert.True(t, rl.CheckAndRecordAttempt("ip", false))
+	_, remaining := rl.Blocked("ip")
+	assert.InDelta(t, (2 * time.Minute).Seconds(), remaining.Seconds(), 1)
+}
+
+func TestIsSignatureError(t *testing.T) {
+	assert.False(t, IsSignatureError(nil))
+	assert.True(t, IsSignatureError(fmt.Errorf("invalid token")))
+	assert.False(t, IsSignatureError(ErrTokenExpired))
+	assert.False(t, IsSignatureError(&BindingError{Claim: ClaimIP}))
+}
+
+func TestTokenValidationRateLimiter_Cleanup(t *testing.T) {
+	rl := NewTokenValidationRateLimiter(5, time.Minute, time.Hour)
+	defer rl.Stop()
+
+	rl.CheckAndRecordAttempt("old", false)
+	rl.CheckAndRecordAttempt("recent", false)
+	val, _ := rl.attempts.Load("old")
+	val.(*validationAttempts).lastFail = time.Now().Add(-failureWindow - time.Minute)
+
+	rl.cleanup()
+	_, oldExists := rl.attempts.Load("old")
+	_, recentExists := rl.attempts.Load("recent")
+	assert.False(t, oldExists)
+	assert.True(t, recentExists)
+
+	rl.Stop()
+	rl.Stop() // Stop is idempotent
+}
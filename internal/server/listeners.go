@@ -0,0 +1,127 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	configparser "github.com/orgoj/weblogproxy/internal/config"
+	"github.com/orgoj/weblogproxy/internal/proxyproto"
+)
+
+// openListeners opens all listeners of the config. Listeners opened before a failure are closed.
+func (s *Server) openListeners() ([]net.Listener, error) {
+	var listeners []net.Listener
+	for _, lc := range s.config.ServerListeners() {
+		l, err := s.openListener(lc)
+		if err != nil {
+			for _, opened := range listeners {
+				_ = opened.Close()
+			}
+			return nil, fmt.Errorf("failed to listen on %s '%s': %w", lc.Network, lc.Address, err)
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
+
+// openListener opens a tcp or unix listener, wrapped to read PROXY headers with proxy_protocol.
+func (s *Server) openListener(lc configparser.ListenerConfig) (net.Listener, error) {
+	var l net.Listener
+	var err error
+	switch lc.Network {
+	case "unix":
+		mode, modeErr := lc.FileMode()
+		if modeErr != nil {
+			panic(fmt.Sprintf("server: failed to parse pre-validated server.listeners socket_mode: %v", modeErr))
+		}
+		l, err = listenUnix(lc.Address, mode)
+	default:
+		l, err = net.Listen("tcp", lc.Address)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if lc.ProxyProtocol {
+		l = proxyproto.NewListener(l, s.trustedProxiesParsed)
+	}
+	return l, nil
+}
+
+// listenUnix listens on the unix socket path and sets its permissions. A socket file left
+// behind by a previous process is removed, a socket still in use is not.
+func listenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	if err := removeStaleSocket(path); err != nil {
+		return nil, err
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if mode != 0 {
+		if err := os.Chmod(path, mode); err != nil {
+			_ = l.Close()
+			return nil, err
+		}
+	}
+	// Closing the listener removes the socket file
+	return &unixListener{Listener: l}, nil
+}
+
+// removeStaleSocket removes the socket file at path when no process accepts connections on it.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("'%s' exists and is not a socket", path)
+	}
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		_ = conn.Close()
+		return fmt.Errorf("socket '%s' is in use", path)
+	}
+	return os.Remove(path)
+}
+
+// localAddr is reported as the remote address of unix socket connections.
+var localAddr = &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)}
+
+// socketAdminAllowed reports whether the admin endpoints may be served to the request. Unix
+// socket clients look like local TCP clients, so they are refused unless the listener enables
+// admin; admin.allowed_ips applies in addition.
+func (s *Server) socketAdminAllowed(r *http.Request) bool {
+	addr, ok := r.Context().Value(http.LocalAddrContextKey).(*net.UnixAddr)
+	return !ok || s.socketAdmin[addr.Name]
+}
+
+// unixListener reports connections as coming from 127.0.0.1, so trusted_proxies and
+// health_allowed_ips apply to unix socket clients like to local TCP clients.
+type unixListener struct {
+	net.Listener
+}
+
+// Accept returns the next connection with 127.0.0.1 as its remote address.
+func (l *unixListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &localConn{Conn: conn}, nil
+}
+
+// localConn is a unix socket connection reporting 127.0.0.1 as its remote address.
+type localConn struct {
+	net.Conn
+}
+
+// RemoteAddr returns 127.0.0.1.
+func (c *localConn) RemoteAddr() net.Addr {
+	return localAddr
+}
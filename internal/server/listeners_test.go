@@ -0,0 +1,192 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/orgoj/weblogproxy/internal/config"
+	"github.com/orgoj/weblogproxy/internal/logger"
+	"github.com/orgoj/weblogproxy/internal/rules"
+)
+
+// freeTCPAddress returns a local address with a port that is free at the time of the call.
+func freeTCPAddress(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	require.NoError(t, l.Close())
+	return addr
+}
+
+// getHealth sends GET /health over conn, prefixed with header, and returns the status code.
+func getHealth(t *testing.T, conn net.Conn, header string) int {
+	t.Helper()
+	return sendRequest(t, conn, header, "GET /health")
+}
+
+// sendRequest sends a request without body over conn, prefixed with header, and returns the status code.
+func sendRequest(t *testing.T, conn net.Conn, header, requestLine string) int {
+	t.Helper()
+	defer conn.Close()
+	_, err := fmt.Fprintf(conn, "%s%s HTTP/1.1\r\nHost: localhost\r\nContent-Length: 0\r\nConnection: close\r\n\r\n", header, requestLine)
+	require.NoError(t, err)
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestServerListeners(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	dir := t.TempDir()
+	socket, adminSocket := filepath.Join(dir, "weblogproxy.sock"), filepath.Join(dir, "admin.sock")
+	tcpAddr := freeTCPAddress(t)
+
+	cfg := createTestConfig()
+	cfg.Server.TrustedProxies = []string{"127.0.0.1"}
+	cfg.Server.HealthAllowedIPs = []string{"203.0.113.9"}
+	cfg.Server.Admin.Enabled = true
+	cfg.Server.Listeners = []config.ListenerConfig{
+		{Network: "tcp", Address: tcpAddr},
+		{Network: "unix", Address: socket, SocketMode: "0660", ProxyProtocol: true},
+		{Network: "unix", Address: adminSocket, Admin: true},
+	}
+	ruleProc, err := rules.NewRuleProcessor(cfg)
+	require.NoError(t, err)
+	s := NewServer(Dependencies{
+		Config:        cfg,
+		LoggerManager: logger.NewManager(),
+		RuleProcessor: ruleProc,
+		AppLogger:     logger.GetAppLogger(),
+	})
+
+	// A stale socket file of a crashed process is replaced
+	stale, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	require.NoError(t, stale.Close())
+
+	started := make(chan error, 1)
+	go func() { started <- s.Start() }()
+	require.Eventually(t, func() bool {
+		conn, err := net.Dial("unix", socket)
+		if err == nil {
+			conn.Close()
+		}
+		return err == nil
+	}, 2*time.Second, 10*time.Millisecond)
+
+	info, err := os.Stat(socket)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0660), info.Mode().Perm())
+
+	// Both listeners serve the same router, the PROXY header sets the client IP on the unix socket
+	tcpConn, err := net.Dial("tcp", tcpAddr)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, getHealth(t, tcpConn, ""))
+	unixConn, err := net.Dial("unix", socket)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, getHealth(t, unixConn, ""))
+	unixConn, err = net.Dial("unix", socket)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, getHealth(t, unixConn, "PROXY TCP4 203.0.113.9 10.0.0.1 40000 443\r\n"))
+
+	// Unix socket clients get the admin endpoints only on listeners with admin
+	getMetrics := func(network, address string) int {
+		conn, err := net.Dial(network, address)
+		require.NoError(t, err)
+		return sendRequest(t, conn, "", "GET /admin/metrics")
+	}
+	assert.Equal(t, http.StatusOK, getMetrics("tcp", tcpAddr))
+	assert.Equal(t, http.StatusForbidden, getMetrics("unix", socket))
+	assert.Equal(t, http.StatusOK, getMetrics("unix", adminSocket))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, s.Shutdown(ctx))
+	assert.True(t, errors.Is(<-started, http.ErrServerClosed))
+	_, err = os.Stat(socket)
+	assert.True(t, errors.Is(err, os.ErrNotExist), "socket file is removed on shutdown")
+}
+
+func TestServerProxyProtocol(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	host, port, err := net.SplitHostPort(freeTCPAddress(t))
+	require.NoError(t, err)
+
+	cfg := createTestConfig()
+	cfg.Server.Host = host
+	cfg.Server.Port, err = strconv.Atoi(port)
+	require.NoError(t, err)
+	cfg.Server.ProxyProtocol = true
+	cfg.Server.TrustedProxies = []string{"127.0.0.1"}
+	cfg.Server.RequestLimits.RateLimit = 1
+	cfg.Server.Admin.Enabled = true
+	ruleProc, err := rules.NewRuleProcessor(cfg)
+	require.NoError(t, err)
+	s := NewServer(Dependencies{
+		Config:        cfg,
+		LoggerManager: logger.NewManager(),
+		RuleProcessor: ruleProc,
+		AppLogger:     logger.GetAppLogger(),
+	})
+
+	addr := net.JoinHostPort(host, port)
+	go func() { _ = s.Start() }()
+	defer s.Shutdown(context.Background())
+	require.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			conn.Close()
+		}
+		return err == nil
+	}, 2*time.Second, 10*time.Millisecond)
+
+	send := func(header, requestLine string) int {
+		conn, err := net.Dial("tcp", addr)
+		require.NoError(t, err)
+		return sendRequest(t, conn, header, requestLine)
+	}
+	v1 := func(ip string) string { return "PROXY TCP4 " + ip + " 10.0.0.1 40000 8080\r\n" }
+	v2 := string([]byte{'\r', '\n', '\r', '\n', 0, '\r', '\n', 'Q', 'U', 'I', 'T', '\n', 0x21, 0x11, 0, 12,
+		203, 0, 113, 2, 10, 0, 0, 1, 0x9c, 0x40, 0x1f, 0x90})
+
+	// Rate limiting is applied per client address of the PROXY header
+	assert.NotEqual(t, http.StatusTooManyRequests, send(v1("203.0.113.1"), "POST /log"))
+	assert.Equal(t, http.StatusTooManyRequests, send(v1("203.0.113.1"), "POST /log"))
+	assert.NotEqual(t, http.StatusTooManyRequests, send(v2, "POST /log"))
+	assert.Equal(t, http.StatusTooManyRequests, send(v2, "POST /log"))
+
+	// IP restrictions see the client address, connections without header the balancer address
+	assert.Equal(t, http.StatusForbidden, send(v1("203.0.113.1"), "GET /admin/metrics"))
+	assert.Equal(t, http.StatusOK, send("", "GET /admin/metrics"))
+}
+
+func TestListenUnix_SocketInUse(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "weblogproxy.sock")
+	l, err := listenUnix(socket, 0)
+	require.NoError(t, err)
+	defer l.Close()
+
+	_, err = listenUnix(socket, 0)
+	assert.ErrorContains(t, err, "is in use")
+
+	file := filepath.Join(t.TempDir(), "regular")
+	require.NoError(t, os.WriteFile(file, nil, 0600))
+	_, err = listenUnix(file, 0)
+	assert.ErrorContains(t, err, "is not a socket")
+}
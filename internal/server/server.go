@@ -2,6 +2,7 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"net"
 	"net/http"
@@ -19,6 +20,8 @@ import (
 	"github.com/orgoj/weblogproxy/internal/iputil"
 	"github.com/orgoj/weblogproxy/internal/logger"
 	"github.com/orgoj/weblogproxy/internal/rules"
+	"github.com/orgoj/weblogproxy/internal/security"
+	"github.com/orgoj/weblogproxy/internal/tlsutil"
 	"golang.org/x/time/rate"
 )
 
@@ -50,6 +53,11 @@ type Server struct {
 	burstLimit           int
 	trustedProxiesParsed []*net.IPNet
 	healthAllowed        []*net.IPNet
+	adminAllowed         []*net.IPNet
+	socketAdmin          map[string]bool                      // Unix socket paths serving the admin endpoints
+	tokenRateLimiter     *security.TokenValidationRateLimiter // nil when security.token_rate_limit is disabled
+	replayGuard          *security.ReplayGuard                // nil when security.replay_protection is disabled
+	tlsReloader          *tlsutil.Reloader                    // nil when server.tls is disabled
 	deps                 Dependencies
 	shutdownChan         chan struct{} // For graceful cleanup shutdown
 }
@@ -201,6 +209,30 @@ func NewServer(deps Dependencies) *Server {
 		panic(fmt.Sprintf("server: invalid server.health_allowed_ips: %v", err))
 	}
 	server.healthAllowed = parsedHealthAllowed
+	// Parse admin allowed_ips, admin endpoints are restricted to loopback by default
+	adminAllowedIPs := deps.Config.Server.Admin.AllowedIPs
+	if len(adminAllowedIPs) == 0 {
+		adminAllowedIPs = []string{"127.0.0.0/8", "::1"}
+	}
+	parsedAdminAllowed, err := iputil.ParseCIDRs(adminAllowedIPs)
+	if err != nil {
+		panic(fmt.Sprintf("server: invalid server.admin.allowed_ips: %v", err))
+	}
+	server.adminAllowed = parsedAdminAllowed
+	server.socketAdmin = make(map[string]bool)
+	for _, lc := range deps.Config.ServerListeners() {
+		if lc.Network == "unix" && lc.Admin {
+			server.socketAdmin[lc.Address] = true
+		}
+	}
+
+	// Load the TLS certificate, it is reloaded from disk while the server runs
+	if tlsConfig := deps.Config.Server.TLS; tlsConfig.Enabled {
+		server.tlsReloader, err = tlsutil.NewReloader(tlsConfig.CertFile, tlsConfig.KeyFile, tlsConfig.ClientCAFile)
+		if err != nil {
+			panic(fmt.Sprintf("server: failed to load pre-validated server.tls files: %v", err))
+		}
+	}
 
 	// Initialize rate limiter settings
 	if deps.Config.Server.RequestLimits.RateLimit > 0 {
@@ -218,6 +250,30 @@ func NewServer(deps Dependencies) *Server {
 		deps.AppLogger.Info("Rate limiting disabled for /log.")
 	}
 
+	// Block clients sending invalid tokens, with exponential backoff for repeat offenders
+	if limit := deps.Config.Security.TokenRateLimit; limit.MaxAttempts > 0 {
+		blockDuration, err := configparser.ParseDuration(limit.BlockDuration)
+		if err != nil {
+			panic(fmt.Sprintf("server: failed to parse pre-validated security.token_rate_limit.block_duration '%s': %v", limit.BlockDuration, err))
+		}
+		maxBlockDuration, err := configparser.ParseDuration(limit.MaxBlockDuration)
+		if err != nil {
+			panic(fmt.Sprintf("server: failed to parse pre-validated security.token_rate_limit.max_block_duration '%s': %v", limit.MaxBlockDuration, err))
+		}
+		server.tokenRateLimiter = security.NewTokenValidationRateLimiterWithBackoff(limit.MaxAttempts, blockDuration, maxBlockDuration, 5*time.Minute)
+		deps.AppLogger.Info("Token rate limiting enabled for /log: MaxAttempts=%d, Block=%s up to %s", limit.MaxAttempts, blockDuration, maxBlockDuration)
+	}
+
+	// Reject events replayed with the same token and event_id
+	if replay := deps.Config.Security.ReplayProtection; replay.Enabled {
+		window, err := configparser.ParseDuration(replay.Window)
+		if err != nil {
+			panic(fmt.Sprintf("server: failed to parse pre-validated security.replay_protection.window '%s': %v", replay.Window, err))
+		}
+		server.replayGuard = security.NewReplayGuard(window, replay.MaxEntries)
+		deps.AppLogger.Info("Replay protection enabled for /log: Window=%s, MaxEntries=%d", window, replay.MaxEntries)
+	}
+
 	// Zde naparsujeme dobu expirace tokenu jednou
 	tokenExpirationDur, err := configparser.ParseDuration(deps.Config.Security.Token.Expiration)
 	if err != nil {
@@ -280,17 +336,51 @@ func (s *Server) setupRoutes(tokenExpirationDur time.Duration) {
 		{
 			// Log Handler Dependencies
 			logDeps := handler.LogHandlerDependencies{
-				LoggerManager:  s.deps.LoggerManager,
-				TokenSecret:    s.deps.Config.Security.Token.Secret,
-				RuleProcessor:  s.deps.RuleProcessor,
-				TrustedProxies: s.deps.Config.Server.TrustedProxies,
-				Config:         s.deps.Config,
-				AppLogger:      s.deps.AppLogger,
+				LoggerManager:    s.deps.LoggerManager,
+				TokenPolicies:    s.deps.Config.TokenPolicies(),
+				TokenRateLimiter: s.tokenRateLimiter,
+				ReplayGuard:      s.replayGuard,
+				RuleProcessor:    s.deps.RuleProcessor,
+				TrustedProxies:   s.deps.Config.Server.TrustedProxies,
+				Config:           s.deps.Config,
+				AppLogger:        s.deps.AppLogger,
 			}
 
 			// Register Log Handler
 			logGroup.POST("", handler.NewLogHandler(logDeps)) // POST /log
 		}
+
+		// Token refresh endpoint - Same rate limiter as /log
+		if s.config.Security.TokenRefresh.Enabled {
+			gracePeriod, err := configparser.ParseNonNegativeDuration(s.config.Security.TokenRefresh.GracePeriod)
+			if err != nil {
+				panic(fmt.Sprintf("server: failed to parse pre-validated security.token_refresh.grace_period '%s': %v", s.config.Security.TokenRefresh.GracePeriod, err))
+			}
+			tokenGroup := group.Group("/token")
+			if s.rateLimit != rate.Inf {
+				tokenGroup.Use(s.rateLimitMiddleware())
+			}
+			tokenGroup.POST("", handler.NewTokenRefreshHandler(handler.TokenRefreshHandlerDeps{
+				RuleProcessor:      s.ruleProcessor,
+				Config:             s.config,
+				TokenRateLimiter:   s.tokenRateLimiter,
+				TrustedProxies:     s.config.Server.TrustedProxies,
+				TokenExpirationDur: tokenExpirationDur,
+				GracePeriod:        gracePeriod,
+				AppLogger:          s.deps.AppLogger,
+			})) // POST /token
+		}
+
+		// Admin endpoints (no rate limit, IP restricted)
+		if s.config.Server.Admin.Enabled {
+			adminDeps := handler.AdminHandlerDeps{
+				RuleProcessor: s.ruleProcessor,
+				AppLogger:     s.deps.AppLogger,
+			}
+			adminGroup := group.Group("admin", s.adminIPMiddleware())
+			adminGroup.POST("rules/explain", handler.NewRuleExplainHandler(adminDeps))
+			adminGroup.GET("metrics", handler.NewAdminMetricsHandler(adminDeps))
+		}
 	}
 
 	// Nastavím NoRoute handler
@@ -334,6 +424,9 @@ func (s *Server) rateLimitMiddleware() gin.HandlerFunc {
 // healthIPMiddleware checks client IP against allowed CIDRs for health endpoints
 func (s *Server) healthIPMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if !s.clientCertAllowed(c) {
+			return
+		}
 		ipStr := iputil.GetClientIP(c.Request, s.trustedProxiesParsed, s.config.Server.ClientIPHeader)
 		ip := net.ParseIP(ipStr)
 		if ip == nil {
@@ -349,14 +442,42 @@ func (s *Server) healthIPMiddleware() gin.HandlerFunc {
 	}
 }
 
-// Start starts the HTTP server
-func (s *Server) Start() error {
-	addr := fmt.Sprintf("%s:%d", s.config.Server.Host, s.config.Server.Port)
-	s.deps.AppLogger.Warn("Starting server on %s", addr)
+// adminIPMiddleware checks client IP against allowed CIDRs for admin endpoints
+func (s *Server) adminIPMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !s.clientCertAllowed(c) {
+			return
+		}
+		ipStr := iputil.GetClientIP(c.Request, s.trustedProxiesParsed, s.config.Server.ClientIPHeader)
+		ip := net.ParseIP(ipStr)
+		if ip == nil || !iputil.IsIPInAnyCIDR(ip, s.adminAllowed) || !s.socketAdminAllowed(c.Request) {
+			s.deps.AppLogger.Warn("Unauthorized admin access attempt from IP: %s, path: %s", ipStr, c.Request.URL.Path)
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// clientCertAllowed requires a verified client certificate when server.tls.client_ca_file is
+// set, requests without one are aborted with 403.
+func (s *Server) clientCertAllowed(c *gin.Context) bool {
+	if s.tlsReloader == nil || s.config.Server.TLS.ClientCAFile == "" {
+		return true
+	}
+	if err := tlsutil.RequireClientCert(c.Request.TLS); err != nil {
+		s.deps.AppLogger.Warn("Rejected request without client certificate from IP: %s, path: %s", c.ClientIP(), c.Request.URL.Path)
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+		return false
+	}
+	return true
+}
 
+// Start starts the HTTP server, or the HTTPS server with server.tls, on all listeners. It returns
+// when the first listener stops, http.ErrServerClosed after Shutdown.
+func (s *Server) Start() error {
 	// Create http.Server for graceful shutdown support
 	s.httpServer = &http.Server{
-		Addr:              addr,
 		Handler:           s.router,
 		ReadHeaderTimeout: 10 * time.Second, // Prevent Slowloris attacks (G112)
 		ReadTimeout:       30 * time.Second, // Maximum time to read entire request
@@ -364,15 +485,81 @@ func (s *Server) Start() error {
 		IdleTimeout:       60 * time.Second, // Maximum time to wait for next request (keep-alive)
 	}
 
-	return s.httpServer.ListenAndServe()
+	listeners, err := s.openListeners()
+	if err != nil {
+		return err
+	}
+	if s.tlsReloader != nil {
+		s.httpServer.TLSConfig = s.tlsConfig()
+		go s.reloadTLS()
+	}
+
+	configs := s.config.ServerListeners()
+	errs := make(chan error, len(listeners))
+	for i, l := range listeners {
+		lc := configs[i]
+		if s.tlsReloader != nil {
+			s.deps.AppLogger.Warn("Starting server on %s %s (TLS)", lc.Network, lc.Address)
+		} else {
+			s.deps.AppLogger.Warn("Starting server on %s %s", lc.Network, lc.Address)
+		}
+		go func(l net.Listener) {
+			if s.tlsReloader != nil {
+				errs <- s.httpServer.ServeTLS(l, "", "")
+				return
+			}
+			errs <- s.httpServer.Serve(l)
+		}(l)
+	}
+	return <-errs
+}
+
+// tlsConfig returns the TLS configuration of server.tls, the certificate is served by the reloader.
+func (s *Server) tlsConfig() *tls.Config {
+	minVersion, err := tlsutil.ParseVersion(s.config.Server.TLS.MinVersion)
+	if err != nil {
+		panic(fmt.Sprintf("server: failed to parse pre-validated server.tls.min_version: %v", err))
+	}
+	cipherSuites, err := tlsutil.ParseCipherSuites(s.config.Server.TLS.CipherSuites)
+	if err != nil {
+		panic(fmt.Sprintf("server: failed to parse pre-validated server.tls.cipher_suites: %v", err))
+	}
+	return s.tlsReloader.Config(minVersion, cipherSuites)
+}
+
+// reloadTLS checks the TLS files for changes until shutdown. New certificates are used for new
+// connections, established connections are not affected.
+func (s *Server) reloadTLS() {
+	interval, err := configparser.ParseNonNegativeDuration(s.config.Server.TLS.ReloadInterval)
+	if err != nil || interval == 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			reloaded, err := s.tlsReloader.ReloadIfChanged()
+			if err != nil {
+				s.deps.AppLogger.Error("TLS reload failed, keeping the loaded certificate: %v", err)
+			} else if reloaded {
+				s.deps.AppLogger.Info("TLS certificate reloaded from '%s'", s.config.Server.TLS.CertFile)
+			}
+		case <-s.shutdownChan:
+			return
+		}
+	}
 }
 
 // Shutdown gracefully shuts down the server
 func (s *Server) Shutdown(ctx context.Context) error {
 	// Signal cleanup goroutines to stop
 	close(s.shutdownChan)
+	if s.tokenRateLimiter != nil {
+		s.tokenRateLimiter.Stop()
+	}
 
-	// Shutdown HTTP server
+	// Shutdown HTTP server, closing the listeners removes unix socket files
 	if s.httpServer != nil {
 		return s.httpServer.Shutdown(ctx)
 	}
@@ -2,7 +2,10 @@ package server
 
 import (
 	"context"
+	"encoding/json"
+	"net/http"
 	"net/http/httptest"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -343,6 +346,26 @@ func TestShutdown(t *testing.T) {
 		}
 	})
 
+	t.Run("Shutdown stops token rate limiter", func(t *testing.T) {
+		cfg := createTestConfig()
+		cfg.Security.TokenRateLimit.MaxAttempts = 5
+		cfg.Security.TokenRateLimit.BlockDuration = "1m"
+		cfg.Security.TokenRateLimit.MaxBlockDuration = "1h"
+
+		ruleProc, _ := rules.NewRuleProcessor(cfg)
+
+		server := NewServer(Dependencies{
+			Config:        cfg,
+			LoggerManager: logger.NewManager(),
+			RuleProcessor: ruleProc,
+			AppLogger:     logger.GetAppLogger(),
+		})
+		require.NotNil(t, server.tokenRateLimiter)
+
+		assert.NoError(t, server.Shutdown(context.Background()))
+		assert.NotPanics(t, server.tokenRateLimiter.Stop, "Limiter should already be stopped")
+	})
+
 	t.Run("Shutdown handles nil httpServer", func(t *testing.T) {
 		cfg := createTestConfig()
 		loggerMgr := logger.NewManager()
@@ -506,6 +529,87 @@ func TestRateLimitMiddleware_WithEntry(t *testing.T) {
 	})
 }
 
+func TestAdminRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	newServer := func(t *testing.T, enabled bool) *Server {
+		cfg := createTestConfig()
+		cfg.Server.Admin.Enabled = enabled
+		cfg.LogConfig = []config.LogRule{{Condition: config.LogRuleCondition{SiteID: "shop"}, Enabled: true}}
+		ruleProc, err := rules.NewRuleProcessor(cfg)
+		require.NoError(t, err)
+		return NewServer(Dependencies{
+			Config:        cfg,
+			LoggerManager: logger.NewManager(),
+			RuleProcessor: ruleProc,
+			AppLogger:     logger.GetAppLogger(),
+		})
+	}
+	explain := func(s *Server, remoteAddr, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/admin/rules/explain", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Disabled by default", func(t *testing.T) {
+		w := explain(newServer(t, false), "127.0.0.1:12345", `{"site_id":"shop"}`)
+		assert.Equal(t, 404, w.Code)
+	})
+
+	t.Run("Explain from loopback", func(t *testing.T) {
+		w := explain(newServer(t, true), "127.0.0.1:12345", `{"site_id":"shop","ip":"1.2.3.4"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var trace rules.Trace
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &trace))
+		assert.Equal(t, "1.2.3.4", trace.ClientIP)
+		assert.True(t, trace.Outcome.LogEnabled)
+		require.Len(t, trace.Rules, 1)
+		assert.True(t, trace.Rules[0].Final)
+	})
+
+	t.Run("Forbidden from other IPs", func(t *testing.T) {
+		w := explain(newServer(t, true), "8.8.8.8:12345", `{"site_id":"shop"}`)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("Rule metrics", func(t *testing.T) {
+		s := newServer(t, true)
+		req := httptest.NewRequest(http.MethodGet, "/admin/metrics", nil)
+		req.RemoteAddr = "127.0.0.1:12345"
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var body struct {
+			Rules                []rules.RuleStats `json:"rules"`
+			Redactions           map[string]uint64 `json:"redactions"`
+			TokenBindingFailures map[string]uint64 `json:"token_binding_failures"`
+			ReplayedEvents       *uint64           `json:"replayed_events"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		require.Len(t, body.Rules, 1)
+		assert.NotNil(t, body.Redactions)
+		assert.NotNil(t, body.TokenBindingFailures)
+		assert.NotNil(t, body.ReplayedEvents)
+		assert.True(t, body.Rules[0].Enabled)
+
+		req.RemoteAddr = "8.8.8.8:12345"
+		w = httptest.NewRecorder()
+		s.router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("Invalid request", func(t *testing.T) {
+		s := newServer(t, true)
+		assert.Equal(t, http.StatusBadRequest, explain(s, "127.0.0.1:12345", `{`).Code)
+		assert.Equal(t, http.StatusBadRequest, explain(s, "127.0.0.1:12345", `{"ip":"1.2.3.4"}`).Code)
+	})
+}
+
 // Test server lifecycle
 func TestServerLifecycle(t *testing.T) {
 	gin.SetMode(gin.TestMode)
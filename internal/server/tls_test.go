@@ -0,0 +1,113 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/orgoj/weblogproxy/internal/logger"
+	"github.com/orgoj/weblogproxy/internal/rules"
+)
+
+// writeTestCert creates a certificate for 127.0.0.1 signed by the CA (self-signed when ca is nil),
+// writes it with its key to dir and returns the certificate, key and file paths.
+func writeTestCert(t *testing.T, dir, name string, ca *x509.Certificate, caKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		IsCA:                  ca == nil,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	parent, parentKey := template, key
+	if ca != nil {
+		parent, parentKey = ca, caKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile, keyFile := filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	return cert, key, certFile, keyFile
+}
+
+func TestServerTLS(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	dir := t.TempDir()
+	ca, caKey, caFile, _ := writeTestCert(t, dir, "ca", nil, nil)
+	_, _, certFile, keyFile := writeTestCert(t, dir, "server", ca, caKey)
+	_, _, clientCertFile, clientKeyFile := writeTestCert(t, dir, "client", ca, caKey)
+
+	cfg := createTestConfig()
+	cfg.Server.Admin.Enabled = true
+	cfg.Server.TLS.Enabled = true
+	cfg.Server.TLS.CertFile = certFile
+	cfg.Server.TLS.KeyFile = keyFile
+	cfg.Server.TLS.ClientCAFile = caFile
+	cfg.Server.TLS.MinVersion = "1.2"
+	ruleProc, err := rules.NewRuleProcessor(cfg)
+	require.NoError(t, err)
+	s := NewServer(Dependencies{
+		Config:        cfg,
+		LoggerManager: logger.NewManager(),
+		RuleProcessor: ruleProc,
+		AppLogger:     logger.GetAppLogger(),
+	})
+	require.NotNil(t, s.tlsReloader)
+
+	srv := httptest.NewUnstartedServer(s.router)
+	srv.TLS = s.tlsConfig()
+	srv.StartTLS()
+	defer srv.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	get := func(path string, certs ...tls.Certificate) *http.Response {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certs}}}
+		resp, err := client.Get(srv.URL + path)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp
+	}
+	clientCert, err := tls.LoadX509KeyPair(clientCertFile, clientKeyFile)
+	require.NoError(t, err)
+
+	// Public endpoints work without client certificate and send HSTS
+	resp := get("/logger.js?site_id=shop")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "max-age=31536000; includeSubDomains", resp.Header.Get("Strict-Transport-Security"))
+
+	// Health and admin endpoints require a client certificate of the client CA
+	assert.Equal(t, http.StatusForbidden, get("/health").StatusCode)
+	assert.Equal(t, http.StatusOK, get("/health", clientCert).StatusCode)
+	assert.Equal(t, http.StatusForbidden, get("/admin/metrics").StatusCode)
+	assert.Equal(t, http.StatusOK, get("/admin/metrics", clientCert).StatusCode)
+}
@@ -0,0 +1,214 @@
+// Package tlsutil builds the TLS configuration of the server and reloads its certificate and
+// client CA files when they change on disk.
+package tlsutil
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ParseVersion returns the TLS version for "1.2" or "1.3". Older versions are not supported.
+func ParseVersion(version string) (uint16, error) {
+	switch version {
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("unsupported TLS version '%s', must be '1.2' or '1.3'", version)
+}
+
+// ParseCipherSuites returns the IDs of the cipher suites named as in tls.CipherSuites, e.g.
+// TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256. Insecure cipher suites are rejected.
+func ParseCipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	known := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		known[suite.Name] = suite.ID
+	}
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := known[strings.TrimSpace(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown or insecure cipher suite '%s'", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// CheckHTTP2CipherSuites checks that a TLS 1.2 cipher suite list contains a suite required by
+// HTTP/2, without one the server fails to start. Lists are ignored with minimum version TLS 1.3.
+func CheckHTTP2CipherSuites(ids []uint16, minVersion uint16) error {
+	if len(ids) == 0 || minVersion >= tls.VersionTLS13 {
+		return nil
+	}
+	for _, id := range ids {
+		if id == tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 || id == tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256 {
+			return nil
+		}
+	}
+	return errors.New("HTTP/2 requires TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 or TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256")
+}
+
+// file is a loaded file with its modification time.
+type file struct {
+	path    string
+	modTime time.Time
+}
+
+// changed reports whether the modification time of the file differs from the loaded version.
+func (f file) changed() (bool, error) {
+	if f.path == "" {
+		return false, nil
+	}
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return false, err
+	}
+	return !info.ModTime().Equal(f.modTime), nil
+}
+
+// stat returns the file with its current modification time.
+func stat(path string) (file, error) {
+	if path == "" {
+		return file{}, nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return file{}, err
+	}
+	return file{path: path, modTime: info.ModTime()}, nil
+}
+
+// material is a loaded certificate with its client CAs.
+type material struct {
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool // nil without client CA file
+	files     [3]file        // Certificate, key and client CA file
+}
+
+// Reloader serves the certificate and client CAs of the TLS configuration and reloads them
+// when their files change. It is safe for concurrent use.
+type Reloader struct {
+	certFile, keyFile, clientCAFile string
+	current                         atomic.Pointer[material]
+	reloadMu                        sync.Mutex
+}
+
+// NewReloader loads the certificate and key files and, if set, the PEM client CA file.
+func NewReloader(certFile, keyFile, clientCAFile string) (*Reloader, error) {
+	r := &Reloader{certFile: certFile, keyFile: keyFile, clientCAFile: clientCAFile}
+	m, err := r.load()
+	if err != nil {
+		return nil, err
+	}
+	r.current.Store(m)
+	return r, nil
+}
+
+// load reads all files. Modification times are taken before reading, so a file changing while
+// it is read is loaded again on the next reload.
+func (r *Reloader) load() (*material, error) {
+	var m material
+	var err error
+	for i, path := range []string{r.certFile, r.keyFile, r.clientCAFile} {
+		if m.files[i], err = stat(path); err != nil {
+			return nil, fmt.Errorf("failed to read TLS file: %w", err)
+		}
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS certificate '%s': %w", r.certFile, err)
+	}
+	m.cert = &cert
+	if r.clientCAFile != "" {
+		data, err := os.ReadFile(r.clientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read TLS client CA file: %w", err)
+		}
+		m.clientCAs = x509.NewCertPool()
+		if !m.clientCAs.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("TLS client CA file '%s' contains no PEM certificates", r.clientCAFile)
+		}
+	}
+	return &m, nil
+}
+
+// ReloadIfChanged reloads the files if any of them changed. Files that fail to load keep the
+// previously loaded certificate and client CAs. Reports whether a new version was loaded.
+func (r *Reloader) ReloadIfChanged() (bool, error) {
+	r.reloadMu.Lock()
+	defer r.reloadMu.Unlock()
+
+	changed := false
+	for _, f := range r.current.Load().files {
+		c, err := f.changed()
+		if err != nil {
+			return false, fmt.Errorf("failed to stat TLS file: %w", err)
+		}
+		changed = changed || c
+	}
+	if !changed {
+		return false, nil
+	}
+	m, err := r.load()
+	if err != nil {
+		return false, err
+	}
+	r.current.Store(m)
+	return true, nil
+}
+
+// Certificate returns the loaded certificate.
+func (r *Reloader) Certificate() *tls.Certificate {
+	return r.current.Load().cert
+}
+
+// Config returns a TLS configuration serving the current certificate. With a client CA file,
+// client certificates are requested and verified when sent, see RequireClientCert.
+func (r *Reloader) Config(minVersion uint16, cipherSuites []uint16) *tls.Config {
+	base := &tls.Config{
+		MinVersion:   minVersion,
+		CipherSuites: cipherSuites,
+		// Set here as well as by http.Server.ServeTLS, which only adds h2 to its own copy and
+		// not to the configs returned by GetConfigForClient
+		NextProtos: []string{"h2", "http/1.1"},
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return r.Certificate(), nil
+		},
+	}
+	if r.clientCAFile == "" {
+		return base
+	}
+	base.ClientAuth = tls.VerifyClientCertIfGiven
+	// The client CAs are taken from the current files for every handshake
+	base.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		config := base.Clone()
+		config.GetConfigForClient = nil
+		config.ClientCAs = r.current.Load().clientCAs
+		return config, nil
+	}
+	return base
+}
+
+// ErrNoClientCert is returned by RequireClientCert for connections without a verified client certificate.
+var ErrNoClientCert = errors.New("verified client certificate required")
+
+// RequireClientCert checks that the connection presented a client certificate verified
+// against the client CAs.
+func RequireClientCert(state *tls.ConnectionState) error {
+	if state == nil || len(state.VerifiedChains) == 0 {
+		return ErrNoClientCert
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package tlsutil
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testCert is a generated certificate with its key.
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+// newTestCert creates a certificate for 127.0.0.1 signed by parent (self-signed when nil).
+func newTestCert(t *testing.T, name string, isCA bool, parent *testCert) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCert{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// write writes the certificate and key PEM files and returns their paths.
+func (c *testCert) write(t *testing.T, dir, name string) (string, string) {
+	t.Helper()
+	keyDER, err := x509.MarshalECPrivateKey(c.key)
+	require.NoError(t, err)
+	certFile, keyFile := filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	require.NoError(t, os.WriteFile(certFile, c.pem, 0600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	return certFile, keyFile
+}
+
+func TestParseVersion(t *testing.T) {
+	v, err := ParseVersion("1.2")
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS12), v)
+	v, err = ParseVersion("1.3")
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS13), v)
+	_, err = ParseVersion("1.0")
+	assert.Error(t, err)
+}
+
+func TestParseCipherSuites(t *testing.T) {
+	ids, err := ParseCipherSuites([]string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"})
+	assert.NoError(t, err)
+	assert.Equal(t, []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256}, ids)
+
+	_, err = ParseCipherSuites([]string{"TLS_RSA_WITH_RC4_128_SHA"})
+	assert.ErrorContains(t, err, "unknown or insecure cipher suite")
+}
+
+func TestCheckHTTP2CipherSuites(t *testing.T) {
+	assert.NoError(t, CheckHTTP2CipherSuites(nil, tls.VersionTLS12))
+	assert.NoError(t, CheckHTTP2CipherSuites([]uint16{tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384, tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256}, tls.VersionTLS12))
+	assert.Error(t, CheckHTTP2CipherSuites([]uint16{tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384}, tls.VersionTLS12))
+	assert.NoError(t, CheckHTTP2CipherSuites([]uint16{tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384}, tls.VersionTLS13), "ignored with TLS 1.3")
+}
+
+func TestReloader_ReloadIfChanged(t *testing.T) {
+	dir := t.TempDir()
+	first := newTestCert(t, "first", false, nil)
+	certFile, keyFile := first.write(t, dir, "server")
+
+	r, err := NewReloader(certFile, keyFile, "")
+	require.NoError(t, err)
+	assert.Equal(t, first.cert.Raw, r.Certificate().Certificate[0])
+
+	reloaded, err := r.ReloadIfChanged()
+	assert.NoError(t, err)
+	assert.False(t, reloaded)
+
+	// A broken file keeps the loaded certificate
+	require.NoError(t, os.WriteFile(certFile, []byte("broken"), 0600))
+	require.NoError(t, os.Chtimes(certFile, time.Now().Add(time.Minute), time.Now().Add(time.Minute)))
+	_, err = r.ReloadIfChanged()
+	assert.Error(t, err)
+	assert.Equal(t, first.cert.Raw, r.Certificate().Certificate[0])
+
+	second := newTestCert(t, "second", false, nil)
+	second.write(t, dir, "server")
+	require.NoError(t, os.Chtimes(certFile, time.Now().Add(2*time.Minute), time.Now().Add(2*time.Minute)))
+	reloaded, err = r.ReloadIfChanged()
+	assert.NoError(t, err)
+	assert.True(t, reloaded)
+	assert.Equal(t, second.cert.Raw, r.Certificate().Certificate[0])
+}
+
+func TestReloader_ClientCert(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "ca", true, nil)
+	caFile := filepath.Join(dir, "ca.crt")
+	require.NoError(t, os.WriteFile(caFile, ca.pem, 0600))
+	certFile, keyFile := newTestCert(t, "server", false, ca).write(t, dir, "server")
+	client := newTestCert(t, "client", false, ca)
+	clientCertFile, clientKeyFile := client.write(t, dir, "client")
+
+	r, err := NewReloader(certFile, keyFile, caFile)
+	require.NoError(t, err)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if err := RequireClientCert(req.TLS); err != nil {
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	srv.TLS = r.Config(tls.VersionTLS12, nil)
+	srv.StartTLS()
+	defer srv.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	get := func(certs ...tls.Certificate) int {
+		httpClient := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certs}}}
+		resp, err := httpClient.Get(srv.URL)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// Connections without client certificate are accepted, RequireClientCert rejects them
+	assert.Equal(t, http.StatusForbidden, get())
+	clientCert, err := tls.LoadX509KeyPair(clientCertFile, clientKeyFile)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, get(clientCert))
+}
+
+func TestReloader_ClientCertHTTP2(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "ca", true, nil)
+	caFile := filepath.Join(dir, "ca.crt")
+	require.NoError(t, os.WriteFile(caFile, ca.pem, 0600))
+	certFile, keyFile := newTestCert(t, "server", false, ca).write(t, dir, "server")
+
+	r, err := NewReloader(certFile, keyFile, caFile)
+	require.NoError(t, err)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := &http.Server{Handler: http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}), TLSConfig: r.Config(tls.VersionTLS12, nil)}
+	go func() { _ = srv.ServeTLS(l, "", "") }()
+	defer srv.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	httpClient := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}, ForceAttemptHTTP2: true}}
+	resp, err := httpClient.Get("https://" + l.Addr().String())
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, 2, resp.ProtoMajor, "HTTP/2 must be negotiated with a client CA file")
+}
+
+func TestNewReloader_Errors(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := newTestCert(t, "server", false, nil).write(t, dir, "server")
+	emptyCA := filepath.Join(dir, "empty.pem")
+	require.NoError(t, os.WriteFile(emptyCA, []byte("no certificates"), 0600))
+
+	_, err := NewReloader(filepath.Join(dir, "missing.crt"), keyFile, "")
+	assert.Error(t, err)
+	_, err = NewReloader(certFile, keyFile, emptyCA)
+	assert.ErrorContains(t, err, "contains no PEM certificates")
+}
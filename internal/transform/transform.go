@@ -0,0 +1,374 @@
+// internal/transform/transform.go
+
+// Package transform reshapes log records with rename, drop, move, cast, flatten and keep_only
+// operations. Paths use dot notation for nested objects, e.g. "user.address.city".
+package transform
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gobwas/glob"
+)
+
+// Operations
+const (
+	OpRename   = "rename"    // Rename the last segment of path 'from' to name 'to'
+	OpDrop     = "drop"      // Remove all fields matching the glob 'paths'
+	OpMove     = "move"      // Move path 'from' to path 'to', creating nested objects as needed
+	OpCast     = "cast"      // Convert the value at 'path' to 'type'
+	OpFlatten  = "flatten"   // Replace nested objects at 'path' (or the whole record) by dotted keys
+	OpKeepOnly = "keep_only" // Remove all fields not matching the glob 'paths'
+)
+
+// Ops lists the supported operations.
+var Ops = []string{OpRename, OpDrop, OpMove, OpCast, OpFlatten, OpKeepOnly}
+
+// Cast types
+const (
+	TypeString    = "string"
+	TypeInt       = "int"
+	TypeFloat     = "float"
+	TypeBool      = "bool"
+	TypeTimestamp = "timestamp" // RFC 3339 string in UTC, from RFC 3339 strings or Unix seconds/milliseconds
+)
+
+// Types lists the supported cast types.
+var Types = []string{TypeString, TypeInt, TypeFloat, TypeBool, TypeTimestamp}
+
+// Spec describes an operation as configured.
+type Spec struct {
+	Op        string
+	From      string
+	To        string
+	Path      string
+	Paths     []string
+	Type      string
+	Separator string // Separator of flattened keys (default ".")
+}
+
+// Op is a compiled operation.
+type Op struct {
+	spec  Spec
+	globs []glob.Glob
+}
+
+// Compile validates the spec and compiles its glob patterns. In glob patterns '*' matches
+// within one path segment and '**' across segments.
+func Compile(spec Spec) (*Op, error) {
+	op := &Op{spec: spec}
+	switch spec.Op {
+	case OpRename:
+		if spec.From == "" || spec.To == "" {
+			return nil, fmt.Errorf("rename requires 'from' and 'to'")
+		}
+		if strings.Contains(spec.To, ".") {
+			return nil, fmt.Errorf("rename 'to' must be a field name, use move for paths")
+		}
+	case OpMove:
+		if spec.From == "" || spec.To == "" {
+			return nil, fmt.Errorf("move requires 'from' and 'to'")
+		}
+		if spec.From == spec.To || strings.HasPrefix(spec.To, spec.From+".") {
+			return nil, fmt.Errorf("move 'to' cannot be '%s' or inside it", spec.From)
+		}
+	case OpCast:
+		if spec.Path == "" {
+			return nil, fmt.Errorf("cast requires 'path'")
+		}
+		if !contains(Types, spec.Type) {
+			return nil, fmt.Errorf("invalid cast type '%s', must be one of %v", spec.Type, Types)
+		}
+	case OpFlatten:
+		if op.spec.Separator == "" {
+			op.spec.Separator = "."
+		}
+	case OpDrop, OpKeepOnly:
+		if len(spec.Paths) == 0 {
+			return nil, fmt.Errorf("%s requires 'paths'", spec.Op)
+		}
+		for i, pattern := range spec.Paths {
+			g, err := glob.Compile(pattern, '.')
+			if err != nil || pattern == "" {
+				return nil, fmt.Errorf("paths[%d]: invalid glob pattern '%s'", i, pattern)
+			}
+			op.globs = append(op.globs, g)
+		}
+	default:
+		return nil, fmt.Errorf("unknown op '%s', must be one of %v", spec.Op, Ops)
+	}
+	return op, nil
+}
+
+// Apply returns a transformed deep copy of the record, the input is not modified.
+// Operations referring to missing paths do nothing and values that cannot be cast are kept.
+func Apply(record map[string]interface{}, ops []*Op) map[string]interface{} {
+	if len(ops) == 0 {
+		return record
+	}
+	result := deepCopy(record).(map[string]interface{})
+	for _, op := range ops {
+		op.apply(result)
+	}
+	return result
+}
+
+// apply runs the operation on a record owned by the caller.
+func (o *Op) apply(record map[string]interface{}) {
+	switch o.spec.Op {
+	case OpRename:
+		parent, key, ok := lookupParent(record, o.spec.From, false)
+		if !ok {
+			return
+		}
+		if value, exists := parent[key]; exists {
+			delete(parent, key)
+			parent[o.spec.To] = value
+		}
+	case OpMove:
+		parent, key, ok := lookupParent(record, o.spec.From, false)
+		if !ok {
+			return
+		}
+		value, exists := parent[key]
+		if !exists {
+			return
+		}
+		target, targetKey, ok := lookupParent(record, o.spec.To, true)
+		if !ok {
+			return // An intermediate segment of 'to' is not an object
+		}
+		delete(parent, key)
+		target[targetKey] = value
+	case OpCast:
+		parent, key, ok := lookupParent(record, o.spec.Path, false)
+		if !ok {
+			return
+		}
+		if value, exists := parent[key]; exists {
+			if converted, ok := cast(value, o.spec.Type); ok {
+				parent[key] = converted
+			}
+		}
+	case OpFlatten:
+		if o.spec.Path == "" {
+			flat := make(map[string]interface{}, len(record))
+			flatten(flat, "", record, o.spec.Separator)
+			for k := range record {
+				delete(record, k)
+			}
+			for k, v := range flat {
+				record[k] = v
+			}
+			return
+		}
+		parent, key, ok := lookupParent(record, o.spec.Path, false)
+		if !ok {
+			return
+		}
+		if nested, isMap := parent[key].(map[string]interface{}); isMap {
+			delete(parent, key)
+			flatten(parent, key, nested, o.spec.Separator)
+		}
+	case OpDrop:
+		filter(record, "", func(path string) bool { return matchAny(o.globs, path) }, false)
+	case OpKeepOnly:
+		filter(record, "", func(path string) bool { return !matchAny(o.globs, path) }, true)
+	}
+}
+
+// lookupParent returns the object containing the last segment of path and that segment.
+// With create, missing intermediate objects are created.
+func lookupParent(record map[string]interface{}, path string, create bool) (map[string]interface{}, string, bool) {
+	segments := strings.Split(path, ".")
+	current := record
+	for _, segment := range segments[:len(segments)-1] {
+		next, exists := current[segment]
+		if !exists {
+			if !create {
+				return nil, "", false
+			}
+			created := make(map[string]interface{})
+			current[segment] = created
+			current = created
+			continue
+		}
+		nextMap, ok := next.(map[string]interface{})
+		if !ok {
+			return nil, "", false
+		}
+		current = nextMap
+	}
+	return current, segments[len(segments)-1], true
+}
+
+// filter removes the fields whose path satisfies remove. Objects whose path is kept are kept as a
+// whole. With pruneEmpty, objects left empty by the removal of their fields are removed as well.
+func filter(record map[string]interface{}, prefix string, remove func(path string) bool, pruneEmpty bool) {
+	for key, value := range record {
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+		nested, isMap := value.(map[string]interface{})
+		if !remove(path) {
+			if !pruneEmpty && isMap {
+				filter(nested, path, remove, pruneEmpty)
+			}
+			continue
+		}
+		if !pruneEmpty || !isMap {
+			delete(record, key)
+			continue
+		}
+		filter(nested, path, remove, pruneEmpty)
+		if len(nested) == 0 {
+			delete(record, key)
+		}
+	}
+}
+
+// flatten adds the leaves of nested to dst with keys joined by sep.
+func flatten(dst map[string]interface{}, prefix string, nested map[string]interface{}, sep string) {
+	for key, value := range nested {
+		name := key
+		if prefix != "" {
+			name = prefix + sep + key
+		}
+		if inner, ok := value.(map[string]interface{}); ok && len(inner) > 0 {
+			flatten(dst, name, inner, sep)
+			continue
+		}
+		dst[name] = value
+	}
+}
+
+// cast converts value to the type, reporting whether the conversion succeeded.
+func cast(value interface{}, typ string) (interface{}, bool) {
+	switch typ {
+	case TypeString:
+		switch v := value.(type) {
+		case string:
+			return v, true
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64), true
+		case map[string]interface{}, []interface{}, nil:
+			return nil, false
+		default:
+			return fmt.Sprint(v), true
+		}
+	case TypeInt:
+		f, ok := toFloat(value)
+		if !ok || math.IsNaN(f) || math.IsInf(f, 0) || math.Abs(f) > 1<<53 {
+			return nil, false
+		}
+		return int64(math.Trunc(f)), true
+	case TypeFloat:
+		return toFloat(value)
+	case TypeBool:
+		switch v := value.(type) {
+		case bool:
+			return v, true
+		case string:
+			b, err := strconv.ParseBool(strings.TrimSpace(v))
+			return b, err == nil
+		case float64:
+			return v != 0, true
+		case int, int64:
+			return fmt.Sprint(v) != "0", true
+		}
+	case TypeTimestamp:
+		return toTimestamp(value)
+	}
+	return nil, false
+}
+
+// toFloat converts numbers, booleans and numeric strings to float64.
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// timestampLayouts are the accepted string formats besides Unix timestamps.
+var timestampLayouts = []string{time.RFC3339Nano, "2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02"}
+
+// toTimestamp converts RFC 3339 and similar strings and Unix timestamps in seconds or
+// milliseconds (values above 1e11) to an RFC 3339 string in UTC.
+func toTimestamp(value interface{}) (interface{}, bool) {
+	if s, ok := value.(string); ok {
+		s = strings.TrimSpace(s)
+		for _, layout := range timestampLayouts {
+			if t, err := time.Parse(layout, s); err == nil {
+				return t.UTC().Format(time.RFC3339Nano), true
+			}
+		}
+	}
+	f, ok := toFloat(value)
+	if !ok || f <= 0 || math.IsInf(f, 0) {
+		return nil, false
+	}
+	if _, isBool := value.(bool); isBool {
+		return nil, false
+	}
+	if f > 1e11 {
+		f /= 1000
+	}
+	sec, frac := math.Modf(f)
+	return time.Unix(int64(sec), int64(frac*1e9)).UTC().Format(time.RFC3339Nano), true
+}
+
+// deepCopy copies maps and slices recursively, other values are shared.
+func deepCopy(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(v))
+		for k, inner := range v {
+			copied[k] = deepCopy(inner)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, inner := range v {
+			copied[i] = deepCopy(inner)
+		}
+		return copied
+	}
+	return value
+}
+
+// matchAny reports whether any glob matches s.
+func matchAny(globs []glob.Glob, s string) bool {
+	for _, g := range globs {
+		if g.Match(s) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
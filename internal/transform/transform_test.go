@@ -0,0 +1,166 @@
+package transform
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func compileAll(t *testing.T, specs ...Spec) []*Op {
+	t.Helper()
+	ops := make([]*Op, len(specs))
+	for i, spec := range specs {
+		op, err := Compile(spec)
+		require.NoError(t, err)
+		ops[i] = op
+	}
+	return ops
+}
+
+func TestApply(t *testing.T) {
+	record := func() map[string]interface{} {
+		return map[string]interface{}{
+			"msg":      "checkout",
+			"duration": "12.5",
+			"count":    "3",
+			"debug":    map[string]interface{}{"trace": "x", "level": 2},
+			"tmp_a":    1,
+			"user":     map[string]interface{}{"id": "u-1", "address": map[string]interface{}{"city": "Brno"}},
+			"browser":  "Firefox",
+		}
+	}
+
+	tests := []struct {
+		name  string
+		specs []Spec
+		want  map[string]interface{}
+	}{
+		{
+			name:  "rename",
+			specs: []Spec{{Op: OpRename, From: "msg", To: "message"}, {Op: OpRename, From: "user.id", To: "uid"}},
+			want: map[string]interface{}{
+				"message": "checkout", "duration": "12.5", "count": "3", "debug": map[string]interface{}{"trace": "x", "level": 2}, "tmp_a": 1,
+				"user": map[string]interface{}{"uid": "u-1", "address": map[string]interface{}{"city": "Brno"}}, "browser": "Firefox",
+			},
+		},
+		{
+			name:  "drop",
+			specs: []Spec{{Op: OpDrop, Paths: []string{"debug", "tmp_*", "user.address.*"}}},
+			want: map[string]interface{}{
+				"msg": "checkout", "duration": "12.5", "count": "3",
+				"user": map[string]interface{}{"id": "u-1", "address": map[string]interface{}{}}, "browser": "Firefox",
+			},
+		},
+		{
+			name: "move",
+			specs: []Spec{
+				{Op: OpMove, From: "browser", To: "client.browser"},
+				{Op: OpMove, From: "user.address.city", To: "city"},
+				{Op: OpMove, From: "missing", To: "other"},
+				{Op: OpMove, From: "tmp_a", To: "msg.nested"},
+			},
+			want: map[string]interface{}{
+				"msg": "checkout", "duration": "12.5", "count": "3", "debug": map[string]interface{}{"trace": "x", "level": 2}, "tmp_a": 1,
+				"user": map[string]interface{}{"id": "u-1", "address": map[string]interface{}{}}, "client": map[string]interface{}{"browser": "Firefox"},
+				"city": "Brno",
+			},
+		},
+		{
+			name: "cast",
+			specs: []Spec{
+				{Op: OpCast, Path: "duration", Type: TypeFloat},
+				{Op: OpCast, Path: "count", Type: TypeInt},
+				{Op: OpCast, Path: "debug.level", Type: TypeString},
+				{Op: OpCast, Path: "browser", Type: TypeInt},
+			},
+			want: map[string]interface{}{
+				"msg": "checkout", "duration": 12.5, "count": int64(3), "debug": map[string]interface{}{"trace": "x", "level": "2"}, "tmp_a": 1,
+				"user": map[string]interface{}{"id": "u-1", "address": map[string]interface{}{"city": "Brno"}}, "browser": "Firefox",
+			},
+		},
+		{
+			name:  "flatten path",
+			specs: []Spec{{Op: OpFlatten, Path: "user", Separator: "_"}},
+			want: map[string]interface{}{
+				"msg": "checkout", "duration": "12.5", "count": "3", "debug": map[string]interface{}{"trace": "x", "level": 2}, "tmp_a": 1,
+				"user_id": "u-1", "user_address_city": "Brno", "browser": "Firefox",
+			},
+		},
+		{
+			name:  "flatten record",
+			specs: []Spec{{Op: OpFlatten}},
+			want: map[string]interface{}{
+				"msg": "checkout", "duration": "12.5", "count": "3", "debug.trace": "x", "debug.level": 2, "tmp_a": 1,
+				"user.id": "u-1", "user.address.city": "Brno", "browser": "Firefox",
+			},
+		},
+		{
+			name:  "keep_only",
+			specs: []Spec{{Op: OpKeepOnly, Paths: []string{"msg", "user.address", "debug.t*"}}},
+			want: map[string]interface{}{
+				"msg": "checkout", "debug": map[string]interface{}{"trace": "x"}, "user": map[string]interface{}{"address": map[string]interface{}{"city": "Brno"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := record()
+			got := Apply(input, compileAll(t, tt.specs...))
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, record(), input, "input must not be modified")
+		})
+	}
+}
+
+func TestCast(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		typ   string
+		want  interface{}
+		ok    bool
+	}{
+		{"42", TypeInt, int64(42), true},
+		{12.9, TypeInt, int64(12), true},
+		{"abc", TypeInt, nil, false},
+		{true, TypeFloat, 1.0, true},
+		{"yes", TypeBool, nil, false},
+		{"true", TypeBool, true, true},
+		{0.0, TypeBool, false, true},
+		{1.5, TypeString, "1.5", true},
+		{map[string]interface{}{}, TypeString, nil, false},
+		{"2025-06-01T10:00:00+02:00", TypeTimestamp, "2025-06-01T08:00:00Z", true},
+		{"2025-06-01", TypeTimestamp, "2025-06-01T00:00:00Z", true},
+		{1748764800.0, TypeTimestamp, "2025-06-01T08:00:00Z", true},
+		{1748764800500.0, TypeTimestamp, "2025-06-01T08:00:00.5Z", true},
+		{"soon", TypeTimestamp, nil, false},
+		{true, TypeTimestamp, nil, false},
+	}
+	for _, tt := range tests {
+		got, ok := cast(tt.value, tt.typ)
+		assert.Equal(t, tt.ok, ok, "cast(%v, %s)", tt.value, tt.typ)
+		if tt.ok {
+			assert.Equal(t, tt.want, got, "cast(%v, %s)", tt.value, tt.typ)
+		}
+	}
+}
+
+func TestCompile_Invalid(t *testing.T) {
+	tests := []struct {
+		spec Spec
+		err  string
+	}{
+		{Spec{Op: "copy"}, "unknown op 'copy'"},
+		{Spec{Op: OpRename, From: "a"}, "rename requires 'from' and 'to'"},
+		{Spec{Op: OpRename, From: "a", To: "b.c"}, "rename 'to' must be a field name"},
+		{Spec{Op: OpMove, From: "a", To: "a.b"}, "move 'to' cannot be 'a' or inside it"},
+		{Spec{Op: OpCast, Path: "a", Type: "date"}, "invalid cast type 'date'"},
+		{Spec{Op: OpDrop}, "drop requires 'paths'"},
+		{Spec{Op: OpKeepOnly, Paths: []string{"[a"}}, "paths[0]: invalid glob pattern '[a'"},
+	}
+	for _, tt := range tests {
+		_, err := Compile(tt.spec)
+		assert.ErrorContains(t, err, tt.err)
+	}
+}
@@ -0,0 +1,252 @@
+// internal/useragent/useragent.go
+
+// Package useragent parses User-Agent strings into browser, operating system and device type.
+package useragent
+
+import (
+	"strings"
+
+	"github.com/orgoj/weblogproxy/internal/lru"
+)
+
+// Device types
+const (
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceBot     = "bot"
+)
+
+// DeviceTypes lists the device types returned by Parse.
+var DeviceTypes = []string{DeviceDesktop, DeviceMobile, DeviceTablet, DeviceBot}
+
+// Fields lists the fields added by the user_agent add_log_data source, see Info.Fields.
+var Fields = []string{"browser", "browser_version", "os", "os_version", "device_type"}
+
+// CacheSize is the number of parsed User-Agent strings kept in the cache.
+const CacheSize = 4096
+
+// maxLength limits the part of a User-Agent string that is parsed and cached.
+const maxLength = 512
+
+// Info holds the parsed User-Agent. Empty values mean unknown.
+type Info struct {
+	Browser        string
+	BrowserVersion string
+	OS             string
+	OSVersion      string
+	DeviceType     string // One of DeviceTypes
+}
+
+// IsBot reports whether the User-Agent belongs to a crawler or an HTTP library.
+func (i Info) IsBot() bool {
+	return i.DeviceType == DeviceBot
+}
+
+// Fields returns the non-empty values keyed by the names in Fields.
+func (i Info) Fields() map[string]string {
+	values := map[string]string{
+		"browser":         i.Browser,
+		"browser_version": i.BrowserVersion,
+		"os":              i.OS,
+		"os_version":      i.OSVersion,
+		"device_type":     i.DeviceType,
+	}
+	for k, v := range values {
+		if v == "" {
+			delete(values, k)
+		}
+	}
+	return values
+}
+
+var cache = lru.New[string, Info](CacheSize)
+
+// Parse parses a User-Agent string. Results are cached, so repeated strings are cheap.
+// An empty User-Agent is treated as a bot, browsers always send one.
+func Parse(ua string) Info {
+	if len(ua) > maxLength {
+		ua = ua[:maxLength]
+	}
+	if info, ok := cache.Get(ua); ok {
+		return info
+	}
+	info := parse(ua)
+	cache.Add(ua, info)
+	return info
+}
+
+// botTokens are lower-case substrings identifying crawlers, monitors and HTTP libraries.
+var botTokens = []string{
+	"bot", "crawl", "spider", "slurp", "facebookexternalhit", "headlesschrome", "lighthouse",
+	"curl/", "wget/", "python-requests", "python-urllib", "go-http-client", "okhttp", "java/",
+	"libwww-perl", "httpclient", "axios/", "node-fetch", "postman", "monitor", "preview",
+}
+
+// browser maps a User-Agent product token to a browser name. Order matters: Chromium based
+// browsers also send "Chrome/" and most browsers also send "Safari/".
+type browser struct {
+	token string
+	name  string
+}
+
+var browsers = []browser{
+	{"Edg/", "Edge"},
+	{"EdgA/", "Edge"},
+	{"EdgiOS/", "Edge"},
+	{"Edge/", "Edge"},
+	{"OPR/", "Opera"},
+	{"OPiOS/", "Opera"},
+	{"Opera/", "Opera"},
+	{"SamsungBrowser/", "Samsung Internet"},
+	{"YaBrowser/", "Yandex Browser"},
+	{"Vivaldi/", "Vivaldi"},
+	{"FxiOS/", "Firefox"},
+	{"Firefox/", "Firefox"},
+	{"CriOS/", "Chrome"},
+	{"Chrome/", "Chrome"},
+	{"MSIE ", "Internet Explorer"},
+}
+
+// parse does the uncached parsing.
+func parse(ua string) Info {
+	var info Info
+	lower := strings.ToLower(ua)
+
+	info.OS, info.OSVersion = parseOS(ua)
+
+	switch {
+	case ua == "" || containsAny(lower, botTokens):
+		info.DeviceType = DeviceBot
+	case strings.Contains(ua, "iPad") || strings.Contains(lower, "tablet") ||
+		info.OS == "Android" && !strings.Contains(ua, "Mobile"):
+		info.DeviceType = DeviceTablet
+	case strings.Contains(ua, "Mobile") || strings.Contains(ua, "iPhone") || strings.Contains(ua, "iPod") ||
+		info.OS == "Android":
+		info.DeviceType = DeviceMobile
+	default:
+		info.DeviceType = DeviceDesktop
+	}
+
+	if info.DeviceType == DeviceBot {
+		info.Browser, info.BrowserVersion = parseBot(ua)
+		return info
+	}
+
+	for _, b := range browsers {
+		if version, ok := productVersion(ua, b.token); ok {
+			info.Browser, info.BrowserVersion = b.name, version
+			return info
+		}
+	}
+	if strings.Contains(ua, "Trident/") {
+		info.Browser = "Internet Explorer"
+		info.BrowserVersion, _ = productVersion(ua, "rv:")
+		return info
+	}
+	if strings.Contains(ua, "Safari/") {
+		info.Browser = "Safari"
+		info.BrowserVersion, _ = productVersion(ua, "Version/")
+	}
+	return info
+}
+
+// parseOS returns the operating system name and version.
+func parseOS(ua string) (string, string) {
+	switch {
+	case strings.Contains(ua, "Windows Phone"):
+		version, _ := productVersion(ua, "Windows Phone ")
+		return "Windows Phone", version
+	case strings.Contains(ua, "Windows"):
+		version, _ := productVersion(ua, "Windows NT ")
+		return "Windows", windowsVersions[version]
+	case strings.Contains(ua, "iPhone") || strings.Contains(ua, "iPad") || strings.Contains(ua, "iPod"):
+		version, ok := productVersion(ua, "iPhone OS ")
+		if !ok {
+			version, _ = productVersion(ua, "CPU OS ")
+		}
+		return "iOS", version
+	case strings.Contains(ua, "Android"):
+		version, _ := productVersion(ua, "Android ")
+		return "Android", version
+	case strings.Contains(ua, "CrOS"):
+		return "Chrome OS", ""
+	case strings.Contains(ua, "Mac OS X"):
+		version, _ := productVersion(ua, "Mac OS X ")
+		return "macOS", version
+	case strings.Contains(ua, "Linux"):
+		return "Linux", ""
+	}
+	return "", ""
+}
+
+// windowsVersions maps Windows NT kernel versions to marketing versions.
+var windowsVersions = map[string]string{
+	"10.0": "10",
+	"6.3":  "8.1",
+	"6.2":  "8",
+	"6.1":  "7",
+	"6.0":  "Vista",
+	"5.1":  "XP",
+}
+
+// parseBot returns the product token containing a bot token, e.g. Googlebot/2.1, or the first product token.
+func parseBot(ua string) (string, string) {
+	first := ""
+	for _, part := range strings.FieldsFunc(ua, func(r rune) bool { return r == ' ' || r == ';' || r == '(' || r == ')' || r == '+' }) {
+		name, version, _ := strings.Cut(part, "/")
+		if name == "" || strings.Contains(name, ":") || strings.Contains(name, ".") && version == "" {
+			continue
+		}
+		if first == "" && version != "" {
+			first = part
+		}
+		if containsAny(strings.ToLower(name), botTokens) {
+			return name, trimVersion(version)
+		}
+	}
+	if first != "" {
+		name, version, _ := strings.Cut(first, "/")
+		return name, trimVersion(version)
+	}
+	return "", ""
+}
+
+// productVersion returns the version following token, e.g. "Chrome/" in "Chrome/120.0.1 Safari".
+// Underscores (iOS, macOS) are normalized to dots.
+func productVersion(ua, token string) (string, bool) {
+	idx := strings.Index(ua, token)
+	if idx == -1 {
+		return "", false
+	}
+	rest := ua[idx+len(token):]
+	end := 0
+	for end < len(rest) {
+		c := rest[end]
+		if !(c >= '0' && c <= '9' || c == '.' || c == '_') {
+			break
+		}
+		end++
+	}
+	return trimVersion(strings.ReplaceAll(rest[:end], "_", ".")), true
+}
+
+// trimVersion removes trailing dots and limits the version to major.minor.patch.
+func trimVersion(version string) string {
+	version = strings.Trim(version, ".")
+	parts := strings.SplitN(version, ".", 4)
+	if len(parts) > 3 {
+		parts = parts[:3]
+	}
+	return strings.Join(parts, ".")
+}
+
+// containsAny reports whether s contains any of the substrings.
+func containsAny(s string, substrings []string) bool {
+	for _, sub := range substrings {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
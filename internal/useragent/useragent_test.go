@@ -0,0 +1,107 @@
+package useragent
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		ua   string
+		want Info
+	}{
+		{
+			name: "Chrome on Windows",
+			ua:   "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.6099.130 Safari/537.36",
+			want: Info{Browser: "Chrome", BrowserVersion: "120.0.6099", OS: "Windows", OSVersion: "10", DeviceType: DeviceDesktop},
+		},
+		{
+			name: "Edge on Windows",
+			ua:   "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36 Edg/120.0.2210.91",
+			want: Info{Browser: "Edge", BrowserVersion: "120.0.2210", OS: "Windows", OSVersion: "10", DeviceType: DeviceDesktop},
+		},
+		{
+			name: "Firefox on Linux",
+			ua:   "Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0",
+			want: Info{Browser: "Firefox", BrowserVersion: "121.0", OS: "Linux", DeviceType: DeviceDesktop},
+		},
+		{
+			name: "Safari on macOS",
+			ua:   "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.2 Safari/605.1.15",
+			want: Info{Browser: "Safari", BrowserVersion: "17.2", OS: "macOS", OSVersion: "10.15.7", DeviceType: DeviceDesktop},
+		},
+		{
+			name: "Safari on iPhone",
+			ua:   "Mozilla/5.0 (iPhone; CPU iPhone OS 17_2_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.2 Mobile/15E148 Safari/604.1",
+			want: Info{Browser: "Safari", BrowserVersion: "17.2", OS: "iOS", OSVersion: "17.2.1", DeviceType: DeviceMobile},
+		},
+		{
+			name: "Chrome on iPad",
+			ua:   "Mozilla/5.0 (iPad; CPU OS 16_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) CriOS/120.0.6099.119 Mobile/15E148 Safari/604.1",
+			want: Info{Browser: "Chrome", BrowserVersion: "120.0.6099", OS: "iOS", OSVersion: "16.6", DeviceType: DeviceTablet},
+		},
+		{
+			name: "Samsung Internet on Android phone",
+			ua:   "Mozilla/5.0 (Linux; Android 13; SM-S911B) AppleWebKit/537.36 (KHTML, like Gecko) SamsungBrowser/23.0 Chrome/115.0.0.0 Mobile Safari/537.36",
+			want: Info{Browser: "Samsung Internet", BrowserVersion: "23.0", OS: "Android", OSVersion: "13", DeviceType: DeviceMobile},
+		},
+		{
+			name: "Chrome on Android tablet",
+			ua:   "Mozilla/5.0 (Linux; Android 14; SM-X710) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+			want: Info{Browser: "Chrome", BrowserVersion: "120.0.0", OS: "Android", OSVersion: "14", DeviceType: DeviceTablet},
+		},
+		{
+			name: "Internet Explorer 11",
+			ua:   "Mozilla/5.0 (Windows NT 6.1; Trident/7.0; rv:11.0) like Gecko",
+			want: Info{Browser: "Internet Explorer", BrowserVersion: "11.0", OS: "Windows", OSVersion: "7", DeviceType: DeviceDesktop},
+		},
+		{
+			name: "Googlebot",
+			ua:   "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			want: Info{Browser: "Googlebot", BrowserVersion: "2.1", DeviceType: DeviceBot},
+		},
+		{
+			name: "Headless Chrome",
+			ua:   "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) HeadlessChrome/120.0.6099.71 Safari/537.36",
+			want: Info{Browser: "HeadlessChrome", BrowserVersion: "120.0.6099", OS: "Linux", DeviceType: DeviceBot},
+		},
+		{
+			name: "curl",
+			ua:   "curl/8.4.0",
+			want: Info{Browser: "curl", BrowserVersion: "8.4.0", DeviceType: DeviceBot},
+		},
+		{
+			name: "Empty",
+			ua:   "",
+			want: Info{DeviceType: DeviceBot},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Parse(tt.ua))
+		})
+	}
+}
+
+func TestParse_Cached(t *testing.T) {
+	ua := "Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0 cache-test"
+	first := Parse(ua)
+	assert.True(t, cache.Contains(ua))
+	assert.Equal(t, first, Parse(ua))
+
+	// Overlong strings are cut before parsing so they cannot blow up the cache
+	long := ua + strings.Repeat("x", 2*maxLength)
+	Parse(long)
+	assert.False(t, cache.Contains(long))
+	assert.True(t, cache.Contains(long[:maxLength]))
+}
+
+func TestInfo_Fields(t *testing.T) {
+	info := Info{Browser: "curl", BrowserVersion: "8.4.0", DeviceType: DeviceBot}
+	assert.True(t, info.IsBot())
+	assert.Equal(t, map[string]string{"browser": "curl", "browser_version": "8.4.0", "device_type": "bot"}, info.Fields())
+}